@@ -0,0 +1,605 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/comid"
+)
+
+const (
+	appraisalMatch    = "match"
+	appraisalMismatch = "mismatch"
+	appraisalMissing  = "missing"
+)
+
+var (
+	appraiseEvidenceFile string
+	appraiseFiles        []string
+	appraiseDirs         []string
+	appraiseFormat       string
+)
+
+var appraiseCmd = NewAppraiseCmd()
+
+func NewAppraiseCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "appraise",
+		Short: "match PSA or CCA evidence against the reference values and keys in CoRIMs and CoMIDs",
+		Long: `match PSA or CCA evidence against the reference values and keys in CoRIMs and CoMIDs
+
+	Check, offline, whether the evidence in token.cbor would be accepted given
+	the endorsements in corim.cbor.  The evidence is either a raw PSA token, a
+	raw CCA token, or the claims of one of these in JSON (as output by the
+	Veraison evcli tool).  The endorsements are CoRIMs or stand-alone CoMIDs.
+
+	  cocli appraise --evidence=token.cbor --file=corim.cbor
+
+	The reference values are those whose environment carries the
+	implementation ID of the evidence (or, for CCA realms, whose instance is
+	the realm initial measurement).  Each software component, platform
+	configuration and realm measurement is compared with the reference digests.
+	The attestation key is looked up in the attestation verification keys
+	triples using the implementation and instance IDs; for raw tokens, the
+	signature of the (platform) token is verified with it.  For raw CCA tokens,
+	the realm token signature is verified with the realm public key, which must
+	hash to the platform token challenge; the claims of JSON evidence are not
+	authenticated.
+
+	Same as above, using the CoMIDs in the endorsements/ directory and with a
+	JSON report.
+
+	  cocli appraise --evidence=claims.json --dir=endorsements --format=json
+
+	The command fails if any claim does not match the endorsements.
+	`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkAppraiseArgs(); err != nil {
+				return err
+			}
+
+			filesList := filesList(appraiseFiles, appraiseDirs, ".cbor")
+			if len(filesList) == 0 {
+				return errors.New("no endorsement files found")
+			}
+
+			ev, err := loadEvidence(appraiseEvidenceFile)
+			if err != nil {
+				return err
+			}
+
+			refs, err := loadAppraisalEndorsements(filesList)
+			if err != nil {
+				return err
+			}
+
+			results := appraise(ev, refs)
+
+			if err := printAppraisalResults(results, appraiseFormat); err != nil {
+				return err
+			}
+
+			var failed int
+			for _, r := range results {
+				if r.Status != appraisalMatch {
+					failed++
+				}
+			}
+
+			if failed != 0 {
+				return fmt.Errorf("%d/%d claim(s) not matched by the endorsements", failed, len(results))
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(
+		&appraiseEvidenceFile, "evidence", "e", "", "a PSA or CCA token, or its claims in JSON",
+	)
+
+	cmd.Flags().StringArrayVarP(
+		&appraiseFiles, "file", "f", []string{}, "a CoRIM or CoMID file (in CBOR format)",
+	)
+
+	cmd.Flags().StringArrayVarP(
+		&appraiseDirs, "dir", "d", []string{}, "a directory containing CoRIM or CoMID files (in CBOR format)",
+	)
+
+	cmd.Flags().StringVarP(
+		&appraiseFormat, "format", "o", "text", "output format: text or json",
+	)
+
+	return cmd
+}
+
+func checkAppraiseArgs() error {
+	if appraiseEvidenceFile == "" {
+		return errors.New("no evidence supplied")
+	}
+
+	if len(appraiseFiles) == 0 && len(appraiseDirs) == 0 {
+		return errors.New("no endorsement files supplied")
+	}
+
+	switch appraiseFormat {
+	case "text", "json":
+	default:
+		return fmt.Errorf("unknown output format %q (want text or json)", appraiseFormat)
+	}
+
+	return nil
+}
+
+func loadEvidence(file string) (*evidence, error) {
+	data, err := afero.ReadFile(fs, file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading evidence from %s: %w", file, err)
+	}
+
+	e, err := decodeEvidence(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding evidence from %s: %w", file, err)
+	}
+
+	return e, nil
+}
+
+type locatedValueTriple struct {
+	where string
+	comid.ValueTriple
+}
+
+type locatedKeyTriple struct {
+	where string
+	comid.KeyTriple
+}
+
+// appraisalEndorsements are the reference values and attestation keys found
+// in the endorsement files, along with their location
+type appraisalEndorsements struct {
+	refVals    []locatedValueTriple
+	attestKeys []locatedKeyTriple
+}
+
+func loadAppraisalEndorsements(files []string) (*appraisalEndorsements, error) {
+	var ret appraisalEndorsements
+
+	for _, file := range files {
+		endorsements, tagErrs, err := loadEndorsements(file)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(tagErrs) != 0 {
+			return nil, tagErrs[0]
+		}
+
+		for _, e := range endorsements {
+			if e.Comid == nil {
+				continue
+			}
+
+			where := e.Where()
+			if e.Loc != "" {
+				where += "."
+			} else {
+				where += ":"
+			}
+
+			if rvs := e.Comid.Triples.ReferenceValues; rvs != nil {
+				for i, vt := range rvs.Values {
+					ret.refVals = append(ret.refVals, locatedValueTriple{
+						fmt.Sprintf("%striples.reference-values[%d]", where, i), vt,
+					})
+				}
+			}
+
+			if aks := e.Comid.Triples.AttestVerifKeys; aks != nil {
+				for i, kt := range *aks {
+					ret.attestKeys = append(ret.attestKeys, locatedKeyTriple{
+						fmt.Sprintf("%striples.attester-verification-keys[%d]", where, i), kt,
+					})
+				}
+			}
+		}
+	}
+
+	return &ret, nil
+}
+
+// appraisalResult is the outcome of matching an evidence claim against the
+// endorsements
+type appraisalResult struct {
+	Claim  string `json:"claim"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// platformClaimNames are the names of the platform claims in the JSON
+// serialization of the evidence, used to label the results
+type platformClaimNames struct {
+	implID, instID, swComponents, config string
+}
+
+var evidenceClaimNames = map[string]platformClaimNames{
+	evidencePSA: {"psa-implementation-id", "psa-instance-id", "psa-software-components", ""},
+	evidenceCCA: {
+		"cca-platform-implementation-id", "cca-platform-instance-id",
+		"cca-platform-sw-components", "cca-platform-config",
+	},
+}
+
+func b64(v []byte) string {
+	return base64.StdEncoding.EncodeToString(v)
+}
+
+func envImplID(env comid.Environment) []byte {
+	if env.Class == nil || env.Class.ClassID == nil || env.Class.ClassID.Type() != "psa.impl-id" {
+		return nil
+	}
+	return env.Class.ClassID.Bytes()
+}
+
+func envInstance(env comid.Environment) []byte {
+	if env.Instance == nil {
+		return nil
+	}
+	return env.Instance.Bytes()
+}
+
+// digestsContain checks whether the value is one of the digests, optionally
+// restricted to the named hash algorithm
+func digestsContain(digests comid.Digests, value []byte, alg string) bool {
+	for _, d := range digests {
+		if alg != "" && hashAlgName(d.HashAlgID) != alg {
+			continue
+		}
+		if bytes.Equal(d.HashValue, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// appraise matches the evidence against the endorsements and returns the
+// outcome for each of the appraised claims
+func appraise(e *evidence, refs *appraisalEndorsements) []appraisalResult {
+	var (
+		ret   []appraisalResult
+		names = evidenceClaimNames[e.Format]
+		envs  []locatedValueTriple
+		where []string
+	)
+
+	for _, rv := range refs.refVals {
+		if bytes.Equal(envImplID(rv.Environment), e.ImplID) {
+			envs = append(envs, rv)
+			where = append(where, rv.where)
+		}
+	}
+
+	if len(envs) == 0 {
+		ret = append(ret, appraisalResult{
+			names.implID, appraisalMissing,
+			fmt.Sprintf("no reference values for implementation ID %s", b64(e.ImplID)),
+		})
+	} else {
+		ret = append(ret, appraisalResult{
+			names.implID, appraisalMatch,
+			"reference values found at " + strings.Join(where, ", "),
+		})
+	}
+
+	for i, sc := range e.SwComponents {
+		r := appraiseSwComponent(sc, envs)
+		r.Claim = fmt.Sprintf("%s[%d]", names.swComponents, i)
+		ret = append(ret, r)
+	}
+
+	if e.PlatformConfig != nil {
+		r := appraisePlatformConfig(e.PlatformConfig, envs)
+		r.Claim = names.config
+		ret = append(ret, r)
+	}
+
+	r := appraiseAttestationKey(e, refs.attestKeys)
+	r.Claim = names.instID
+	ret = append(ret, r)
+
+	if e.Realm != nil {
+		ret = append(ret, appraiseRealmToken(e))
+		ret = append(ret, appraiseRealm(e.Realm, refs.refVals)...)
+	}
+
+	return ret
+}
+
+func appraiseSwComponent(sc swComponentClaims, envs []locatedValueTriple) appraisalResult {
+	var candidates []string
+
+	for _, rv := range envs {
+		for j, m := range rv.Measurements.Values {
+			if m.Key == nil || !m.Key.IsSet() || m.Key.Type() != comid.PSARefValIDType {
+				continue
+			}
+
+			id, err := m.Key.GetPSARefValID()
+			if err != nil || !bytes.Equal(id.SignerID, sc.SignerID) ||
+				(id.Label != nil && *id.Label != sc.MeasurementType) ||
+				(id.Version != nil && *id.Version != sc.Version) {
+				continue
+			}
+
+			where := fmt.Sprintf("%s.measurements[%d]", rv.where, j)
+
+			if m.Val.Digests != nil && digestsContain(*m.Val.Digests, sc.MeasurementValue, "") {
+				return appraisalResult{
+					Status: appraisalMatch,
+					Detail: fmt.Sprintf("%s matches reference value at %s", sc, where),
+				}
+			}
+
+			candidates = append(candidates, where)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return appraisalResult{
+			Status: appraisalMissing,
+			Detail: fmt.Sprintf("no reference value for %s signed by %s", sc, b64(sc.SignerID)),
+		}
+	}
+
+	return appraisalResult{
+		Status: appraisalMismatch,
+		Detail: fmt.Sprintf(
+			"%s measurement %s does not match the reference value at %s",
+			sc, b64(sc.MeasurementValue), strings.Join(candidates, ", "),
+		),
+	}
+}
+
+func appraisePlatformConfig(config []byte, envs []locatedValueTriple) appraisalResult {
+	var candidates []string
+
+	for _, rv := range envs {
+		for j, m := range rv.Measurements.Values {
+			if m.Key == nil || !m.Key.IsSet() || m.Key.Type() != comid.CCAPlatformConfigIDType ||
+				m.Val.RawValue == nil {
+				continue
+			}
+
+			where := fmt.Sprintf("%s.measurements[%d]", rv.where, j)
+
+			if v, err := m.Val.RawValue.GetBytes(); err == nil && bytes.Equal(v, config) {
+				return appraisalResult{
+					Status: appraisalMatch,
+					Detail: "matches reference value at " + where,
+				}
+			}
+
+			candidates = append(candidates, where)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return appraisalResult{Status: appraisalMissing, Detail: "no reference value for the platform configuration"}
+	}
+
+	return appraisalResult{
+		Status: appraisalMismatch,
+		Detail: "does not match the reference value at " + strings.Join(candidates, ", "),
+	}
+}
+
+func appraiseAttestationKey(e *evidence, attestKeys []locatedKeyTriple) appraisalResult {
+	if len(e.InstID) == 0 {
+		return appraisalResult{Status: appraisalMissing, Detail: "evidence has no instance ID"}
+	}
+
+	var (
+		keys  []*comid.CryptoKey
+		where []string
+	)
+
+	for _, kt := range attestKeys {
+		if bytes.Equal(envImplID(kt.Environment), e.ImplID) &&
+			bytes.Equal(envInstance(kt.Environment), e.InstID) {
+			keys = append(keys, kt.VerifKeys...)
+			where = append(where, kt.where)
+		}
+	}
+
+	if len(keys) == 0 {
+		return appraisalResult{
+			Status: appraisalMissing,
+			Detail: fmt.Sprintf("no attestation key for instance ID %s", b64(e.InstID)),
+		}
+	}
+
+	at := strings.Join(where, ", ")
+
+	if e.platformToken == nil {
+		return appraisalResult{
+			Status: appraisalMatch,
+			Detail: fmt.Sprintf(
+				"%d attestation key(s) found at %s (signature not checked for JSON claims)", len(keys), at,
+			),
+		}
+	}
+
+	for _, k := range keys {
+		pub, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+
+		if e.verifySignature(pub) == nil {
+			return appraisalResult{
+				Status: appraisalMatch,
+				Detail: "token signature verified with the attestation key at " + at,
+			}
+		}
+	}
+
+	return appraisalResult{
+		Status: appraisalMismatch,
+		Detail: fmt.Sprintf("token signature does not verify with the %d attestation key(s) at %s", len(keys), at),
+	}
+}
+
+// appraiseRealmToken checks that the realm claims are authenticated: signed
+// with the realm attestation key that the platform token vouches for
+func appraiseRealmToken(e *evidence) appraisalResult {
+	const claim = "cca-realm-public-key"
+
+	if e.realmToken == nil {
+		return appraisalResult{claim, appraisalMatch, "realm token signature not checked for JSON claims"}
+	}
+
+	if err := e.verifyRealmToken(); err != nil {
+		return appraisalResult{claim, appraisalMismatch, err.Error()}
+	}
+
+	return appraisalResult{
+		claim, appraisalMatch,
+		"realm token signature verified with the realm public key, whose hash is the platform token challenge",
+	}
+}
+
+// appraiseRealm matches the realm claims of CCA evidence against the reference
+// values whose instance is the realm initial measurement (RIM), where the RIM
+// and the realm extensible measurements (REMs) are recorded as integrity
+// registers "rim" and "rem0" to "rem3"
+func appraiseRealm(r *realmTokenClaims, refVals []locatedValueTriple) []appraisalResult {
+	var (
+		envs  []locatedValueTriple
+		where []string
+	)
+
+	for _, rv := range refVals {
+		if bytes.Equal(envInstance(rv.Environment), r.InitialMeasurement) {
+			envs = append(envs, rv)
+			where = append(where, rv.where)
+		}
+	}
+
+	if len(envs) == 0 {
+		return []appraisalResult{{
+			"cca-realm-initial-measurement", appraisalMissing,
+			fmt.Sprintf("no reference values for realm initial measurement %s", b64(r.InitialMeasurement)),
+		}}
+	}
+
+	ret := []appraisalResult{
+		appraiseRealmRegister("cca-realm-initial-measurement", "rim", r.InitialMeasurement, r.HashAlgID, envs),
+	}
+
+	for i, rem := range r.ExtensibleMeasurements {
+		ret = append(ret, appraiseRealmRegister(
+			fmt.Sprintf("cca-realm-extensible-measurements[%d]", i), fmt.Sprintf("rem%d", i), rem, r.HashAlgID, envs,
+		))
+	}
+
+	if r.PersonalizationValue != nil {
+		ret = append(ret, appraiseRealmPersonalizationValue(r.PersonalizationValue, envs))
+	}
+
+	return ret
+}
+
+func appraiseRealmRegister(claim, register string, value []byte, alg string, envs []locatedValueTriple) appraisalResult {
+	var candidates []string
+
+	for _, rv := range envs {
+		for j, m := range rv.Measurements.Values {
+			if m.Val.IntegrityRegisters == nil {
+				continue
+			}
+
+			digests, ok := m.Val.IntegrityRegisters.IndexMap[register]
+			if !ok {
+				continue
+			}
+
+			where := fmt.Sprintf("%s.measurements[%d].integrity-registers.%s", rv.where, j, register)
+
+			if digestsContain(digests, value, alg) {
+				return appraisalResult{claim, appraisalMatch, "matches reference value at " + where}
+			}
+
+			candidates = append(candidates, where)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return appraisalResult{claim, appraisalMissing, "no reference value for register " + register}
+	}
+
+	return appraisalResult{
+		claim, appraisalMismatch,
+		fmt.Sprintf("%s does not match the reference value at %s", b64(value), strings.Join(candidates, ", ")),
+	}
+}
+
+func appraiseRealmPersonalizationValue(rpv []byte, envs []locatedValueTriple) appraisalResult {
+	const claim = "cca-realm-personalization-value"
+
+	var candidates []string
+
+	for _, rv := range envs {
+		for j, m := range rv.Measurements.Values {
+			if m.Val.RawValue == nil {
+				continue
+			}
+
+			where := fmt.Sprintf("%s.measurements[%d].raw-value", rv.where, j)
+
+			if v, err := m.Val.RawValue.GetBytes(); err == nil && bytes.Equal(v, rpv) {
+				return appraisalResult{claim, appraisalMatch, "matches reference value at " + where}
+			}
+
+			candidates = append(candidates, where)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return appraisalResult{claim, appraisalMissing, "no reference value for the personalization value"}
+	}
+
+	return appraisalResult{
+		claim, appraisalMismatch, "does not match the reference value at " + strings.Join(candidates, ", "),
+	}
+}
+
+func printAppraisalResults(results []appraisalResult, format string) error {
+	if format == "json" {
+		j, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("JSON encoding failed: %w", err)
+		}
+		fmt.Println(string(j))
+		return nil
+	}
+
+	for _, r := range results {
+		fmt.Printf("[%s] %s: %s\n", r.Status, r.Claim, r.Detail)
+	}
+
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(appraiseCmd)
+}
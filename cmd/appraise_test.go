@@ -0,0 +1,195 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/comid"
+)
+
+// testIakComid returns the CBOR encoding of the PSA attestation keys CoMID
+// from the data/ directory, with the key of the first instance replaced by
+// the public part of key
+func testIakComid(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	data, err := os.ReadFile("../data/comid/templates/comid-psa-iakpub.json")
+	require.NoError(t, err)
+
+	var c comid.Comid
+	require.NoError(t, c.FromJSON(data))
+
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	(*c.Triples.AttestVerifKeys)[0].VerifKeys = comid.CryptoKeys{comid.MustNewPKIXBase64Key(string(pemKey))}
+
+	cbor, err := c.ToCBOR()
+	require.NoError(t, err)
+
+	return cbor
+}
+
+func testAppraisalEndorsements(t *testing.T, files map[string][]byte) *appraisalEndorsements {
+	fs = afero.NewMemMapFs()
+
+	var names []string
+	for name, data := range files {
+		require.NoError(t, afero.WriteFile(fs, name, data, 0400))
+		names = append(names, name)
+	}
+
+	refs, err := loadAppraisalEndorsements(names)
+	require.NoError(t, err)
+
+	return refs
+}
+
+func Test_AppraiseCmd_no_evidence(t *testing.T) {
+	cmd := NewAppraiseCmd()
+
+	cmd.SetArgs([]string{"--file=corim.cbor"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no evidence supplied")
+}
+
+func Test_AppraiseCmd_no_endorsements(t *testing.T) {
+	cmd := NewAppraiseCmd()
+
+	cmd.SetArgs([]string{"--evidence=token.cbor", "--file=", "--dir="})
+	appraiseFiles, appraiseDirs = nil, nil
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no endorsement files found")
+}
+
+func Test_AppraiseCmd_mismatch(t *testing.T) {
+	refval, err := os.ReadFile("../data/comid/comid-psa-refval.cbor")
+	require.NoError(t, err)
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "refval.cbor", refval, 0400))
+	require.NoError(t, afero.WriteFile(fs, "claims.json", []byte(`{
+		"psa-implementation-id": "YWNtZS1pbXBsZW1lbnRhdGlvbi1pZC0wMDAwMDAwMDE=",
+		"psa-software-components": [{
+			"measurement-type": "BL",
+			"version": "2.1.0",
+			"signer-id": "rLsRx+TaIXIFUjzkzhokWuGiOa48a/2eeHH35di66Gs=",
+			"measurement-value": "AAAAxSKAPTEGXnvOPPA/5HUJZjHl4Hu9eg/eYMTPJcc="
+		}]
+	}`), 0400))
+
+	cmd := NewAppraiseCmd()
+	cmd.SetArgs([]string{"--evidence=claims.json", "--file=refval.cbor"})
+
+	err = cmd.Execute()
+	assert.EqualError(t, err, "2/3 claim(s) not matched by the endorsements")
+}
+
+func Test_appraise_psa_token(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	refval, err := os.ReadFile("../data/comid/comid-psa-refval.cbor")
+	require.NoError(t, err)
+
+	refs := testAppraisalEndorsements(t, map[string][]byte{
+		"refval.cbor": refval,
+		"iak.cbor":    testIakComid(t, key),
+	})
+
+	e, err := decodeEvidence(signTestToken(t, key, testPlatformClaims()))
+	require.NoError(t, err)
+
+	assert.Equal(t, []appraisalResult{
+		{
+			"psa-implementation-id", appraisalMatch,
+			"reference values found at refval.cbor:triples.reference-values[0]",
+		},
+		{
+			"psa-software-components[0]", appraisalMatch,
+			"BL 2.1.0 matches reference value at refval.cbor:triples.reference-values[0].measurements[0]",
+		},
+		{
+			"psa-instance-id", appraisalMatch,
+			"token signature verified with the attestation key at iak.cbor:triples.attester-verification-keys[0]",
+		},
+	}, appraise(e, refs))
+}
+
+func Test_appraise_psa_token_wrong_key(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	refs := testAppraisalEndorsements(t, map[string][]byte{"iak.cbor": testIakComid(t, other)})
+
+	e, err := decodeEvidence(signTestToken(t, key, testPlatformClaims()))
+	require.NoError(t, err)
+
+	results := appraise(e, refs)
+	require.Len(t, results, 3)
+
+	assert.Equal(t, appraisalResult{
+		"psa-implementation-id", appraisalMissing,
+		"no reference values for implementation ID YWNtZS1pbXBsZW1lbnRhdGlvbi1pZC0wMDAwMDAwMDE=",
+	}, results[0])
+	assert.Equal(t, appraisalMissing, results[1].Status)
+	assert.Equal(t, appraisalResult{
+		"psa-instance-id", appraisalMismatch,
+		"token signature does not verify with the 1 attestation key(s) at iak.cbor:triples.attester-verification-keys[0]",
+	}, results[2])
+}
+
+func Test_appraise_cca_realm(t *testing.T) {
+	data, err := os.ReadFile("../data/comid/templates/comid-cca-realm-refval.json")
+	require.NoError(t, err)
+
+	var c comid.Comid
+	require.NoError(t, c.FromJSON(data))
+
+	realm, err := c.ToCBOR()
+	require.NoError(t, err)
+
+	refs := testAppraisalEndorsements(t, map[string][]byte{"realm.cbor": realm})
+
+	e := &evidence{
+		Format: evidenceCCA,
+		ImplID: testImplID,
+		Realm: &realmTokenClaims{
+			HashAlgID:          "sha-384",
+			InitialMeasurement: mustB64Decode("QoS1aUymwNLPR4mguVrIAlyBjeUjBDZL580pgbLS7caFsyInfsJYGZYkE9jJssH1"),
+			ExtensibleMeasurements: [][]byte{
+				mustB64Decode("IQe752H8pS2VE2oTVNt6TdV7Gya+DT2nHZ6yOYazS6YVq/ZRTPNeWp6lWgMtBop4"),
+				make([]byte, 48),
+			},
+		},
+	}
+
+	results := appraise(e, refs)
+	require.Len(t, results, 6)
+
+	assert.Equal(t, appraisalResult{
+		"cca-realm-public-key", appraisalMatch, "realm token signature not checked for JSON claims",
+	}, results[2])
+	assert.Equal(t, appraisalResult{
+		"cca-realm-initial-measurement", appraisalMatch,
+		"matches reference value at realm.cbor:triples.reference-values[0].measurements[0].integrity-registers.rim",
+	}, results[3])
+	assert.Equal(t, appraisalMatch, results[4].Status)
+	assert.Equal(t, "cca-realm-extensible-measurements[1]", results[5].Claim)
+	assert.Equal(t, appraisalMismatch, results[5].Status)
+}
@@ -0,0 +1,861 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// The CoRIM, CoMID, CoTS and CoSWID CDDL, used by the --cddl conformance mode
+// of the validate commands.  The rules from all the files share the same name
+// space.
+//
+//go:embed cddl/*.cddl
+var cddlFS embed.FS
+
+// This is a parser for the subset of CDDL (RFC 8610) used by the embedded
+// files: rules (=, /= and //=), type and group choices, occurrence indicators,
+// member keys (=> and bareword:), maps, arrays, enumerations (&), CBOR tags
+// (#6.n), ranges (.. and ...), control operators and sockets ($ and $$).
+// Generic rules, unwrapping (~) and cuts (^) are not supported.
+
+type cddlTypeKind int
+
+const (
+	cddlChoice cddlTypeKind = iota
+	cddlRef
+	cddlValue
+	cddlMap
+	cddlArray
+	cddlTag
+	cddlEnum
+	cddlRange
+	cddlControl
+)
+
+// cddlType is a CDDL type expression
+type cddlType struct {
+	kind cddlTypeKind
+	// name is the rule name for cddlRef and the control operator (without
+	// the leading dot) for cddlControl
+	name string
+	// value is the literal for cddlValue: an int64, a float64, a string or
+	// a []byte
+	value interface{}
+	// alts are the alternatives for cddlChoice, the tagged type for
+	// cddlTag, the base and the argument for cddlControl, and the bounds for
+	// cddlRange
+	alts []*cddlType
+	// group is the content of cddlMap, cddlArray and cddlEnum
+	group     *cddlGroup
+	tag       uint64
+	exclusive bool
+}
+
+// cddlGroup is a choice of sequences of group entries
+type cddlGroup struct {
+	choices [][]*cddlEntry
+}
+
+// cddlEntry is a group entry.  Exactly one of typ and group is set.
+type cddlEntry struct {
+	min, max int // max is -1 for unbounded
+	key      *cddlType
+	// bare is the name of the "bareword:" member key, if any
+	bare  string
+	typ   *cddlType
+	group *cddlGroup
+}
+
+// cddlRule is a named type (typ) or group (group)
+type cddlRule struct {
+	name  string
+	typ   *cddlType
+	group *cddlGroup
+}
+
+type cddlSpec struct {
+	rules map[string]*cddlRule
+}
+
+var (
+	cddlSpecOnce  sync.Once
+	cddlSpecCache *cddlSpec
+	cddlSpecErr   error
+)
+
+// loadCDDLSpec parses the embedded CDDL files (only once)
+func loadCDDLSpec() (*cddlSpec, error) {
+	cddlSpecOnce.Do(func() {
+		cddlSpecCache, cddlSpecErr = parseCDDLFiles(cddlFS, "cddl")
+	})
+	return cddlSpecCache, cddlSpecErr
+}
+
+func parseCDDLFiles(efs embed.FS, dir string) (*cddlSpec, error) {
+	entries, err := efs.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error loading CDDL: %w", err)
+	}
+
+	srcs := make(map[string]string)
+	for _, e := range entries {
+		data, err := efs.ReadFile(dir + "/" + e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error loading CDDL %s: %w", e.Name(), err)
+		}
+		srcs[e.Name()] = string(data)
+	}
+
+	return parseCDDL(srcs)
+}
+
+// parseCDDL parses the supplied sources (indexed by file name) into a single
+// specification
+func parseCDDL(srcs map[string]string) (*cddlSpec, error) {
+	var names []string
+	for n := range srcs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	spec := &cddlSpec{rules: make(map[string]*cddlRule)}
+
+	for _, n := range names {
+		if err := spec.parse(n, srcs[n]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := spec.checkRefs(); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+// cddlPrelude lists the RFC 8610 prelude types that are understood
+var cddlPrelude = map[string]bool{
+	"any": true, "uint": true, "nint": true, "int": true, "bstr": true,
+	"bytes": true, "tstr": true, "text": true, "bool": true, "true": true,
+	"false": true, "nil": true, "null": true, "undefined": true,
+	"float": true, "float16": true, "float32": true, "float64": true,
+	"float16-32": true, "float32-64": true, "number": true, "unsigned": true,
+	"tdate": true, "time": true, "uri": true, "biguint": true,
+	"bignint": true, "bigint": true, "integer": true,
+}
+
+// checkRefs makes sure that all the referenced names are defined, apart from
+// sockets, which may be left empty
+func (o *cddlSpec) checkRefs() error {
+	var (
+		err        error
+		checkType  func(t *cddlType, rule string)
+		checkGroup func(g *cddlGroup, rule string)
+	)
+
+	checkGroup = func(g *cddlGroup, rule string) {
+		for _, c := range g.choices {
+			for _, e := range c {
+				if e.key != nil {
+					checkType(e.key, rule)
+				}
+				if e.typ != nil {
+					checkType(e.typ, rule)
+				}
+				if e.group != nil {
+					checkGroup(e.group, rule)
+				}
+			}
+		}
+	}
+
+	checkType = func(t *cddlType, rule string) {
+		if err != nil {
+			return
+		}
+
+		switch t.kind {
+		case cddlRef:
+			if _, ok := o.rules[t.name]; ok || cddlPrelude[t.name] || strings.HasPrefix(t.name, "$") {
+				return
+			}
+			err = fmt.Errorf("CDDL rule %s: undefined name %q", rule, t.name)
+		case cddlMap, cddlArray, cddlEnum:
+			checkGroup(t.group, rule)
+		}
+
+		for _, a := range t.alts {
+			checkType(a, rule)
+		}
+	}
+
+	var names []string
+	for n := range o.rules {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		r := o.rules[n]
+		if r.typ != nil {
+			checkType(r.typ, n)
+		}
+		if r.group != nil {
+			checkGroup(r.group, n)
+		}
+	}
+
+	return err
+}
+
+// lookup returns the rule with the supplied name, or nil
+func (o *cddlSpec) lookup(name string) *cddlRule {
+	return o.rules[name]
+}
+
+func (o *cddlSpec) parse(file, src string) error {
+	toks, err := lexCDDL(file, src)
+	if err != nil {
+		return err
+	}
+
+	p := &cddlParser{file: file, toks: toks}
+
+	for !p.at(cddlTokEOF, "") {
+		if err := p.parseRule(o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type cddlTokKind int
+
+const (
+	cddlTokEOF cddlTokKind = iota
+	cddlTokIdent
+	cddlTokNumber
+	cddlTokText
+	cddlTokBytes
+	cddlTokPunct
+	cddlTokControl
+	cddlTokTag
+)
+
+type cddlToken struct {
+	kind cddlTokKind
+	text string
+	line int
+}
+
+func isCDDLIdentStart(r byte) bool {
+	return r == '@' || r == '_' || r == '$' || unicode.IsLetter(rune(r))
+}
+
+func isCDDLIdentChar(r byte) bool {
+	return isCDDLIdentStart(r) || unicode.IsDigit(rune(r)) || r == '-' || r == '.'
+}
+
+func lexCDDL(file, src string) ([]cddlToken, error) {
+	var (
+		toks []cddlToken
+		line = 1
+		i    = 0
+	)
+
+	errorf := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%s:%d: %s", file, line, fmt.Sprintf(format, args...))
+	}
+
+	emit := func(kind cddlTokKind, text string) {
+		toks = append(toks, cddlToken{kind: kind, text: text, line: line})
+	}
+
+	for i < len(src) {
+		c := src[i]
+
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == ';':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, errorf("unterminated text string")
+			}
+			s, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return nil, errorf("invalid text string: %v", err)
+			}
+			emit(cddlTokText, s)
+			i = j + 1
+		case c == '\'' || (c == 'h' && i+1 < len(src) && src[i+1] == '\''):
+			isHex := c == 'h'
+			if isHex {
+				i++
+			}
+			j := strings.IndexByte(src[i+1:], '\'')
+			if j == -1 {
+				return nil, errorf("unterminated byte string")
+			}
+			s := src[i+1 : i+1+j]
+			if isHex {
+				b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+				if err != nil {
+					return nil, errorf("invalid byte string: %v", err)
+				}
+				s = string(b)
+			}
+			emit(cddlTokBytes, s)
+			i += j + 2
+		case isCDDLIdentStart(c):
+			j := i + 1
+			for j < len(src) && isCDDLIdentChar(src[j]) {
+				j++
+			}
+			// identifiers cannot end with "-" or "."
+			for src[j-1] == '-' || src[j-1] == '.' {
+				j--
+			}
+			emit(cddlTokIdent, src[i:j])
+			i = j
+		case unicode.IsDigit(rune(c)) || (c == '-' && i+1 < len(src) && unicode.IsDigit(rune(src[i+1]))):
+			j := i + 1
+			if strings.HasPrefix(src[i:], "0x") {
+				j = i + 2
+				for j < len(src) && strings.IndexByte("0123456789abcdefABCDEF", src[j]) != -1 {
+					j++
+				}
+			} else {
+				for j < len(src) && unicode.IsDigit(rune(src[j])) {
+					j++
+				}
+				// a fraction, but not a range
+				if j+1 < len(src) && src[j] == '.' && unicode.IsDigit(rune(src[j+1])) {
+					j++
+					for j < len(src) && unicode.IsDigit(rune(src[j])) {
+						j++
+					}
+				}
+			}
+			emit(cddlTokNumber, src[i:j])
+			i = j
+		case c == '.' && i+1 < len(src) && isCDDLIdentStart(src[i+1]):
+			j := i + 1
+			for j < len(src) && isCDDLIdentChar(src[j]) && src[j] != '.' {
+				j++
+			}
+			emit(cddlTokControl, src[i+1:j])
+			i = j
+		case c == '#':
+			if i+1 < len(src) && src[i+1] == '6' && i+2 < len(src) && src[i+2] == '.' {
+				j := i + 3
+				for j < len(src) && unicode.IsDigit(rune(src[j])) {
+					j++
+				}
+				if j == i+3 {
+					return nil, errorf("missing tag number")
+				}
+				emit(cddlTokTag, src[i+3:j])
+				i = j
+			} else if i+1 < len(src) && unicode.IsDigit(rune(src[i+1])) {
+				return nil, errorf("only major type 6 (#6.n) is supported")
+			} else {
+				emit(cddlTokPunct, "#")
+				i++
+			}
+		default:
+			punct := ""
+			for _, p := range []string{
+				"//=", "...", "/=", "//", "=>", "..", "=", "/", "(", ")", "{",
+				"}", "[", "]", "<", ">", ",", ":", "?", "*", "+", "~", "&", "^",
+			} {
+				if strings.HasPrefix(src[i:], p) {
+					punct = p
+					break
+				}
+			}
+			if punct == "" {
+				return nil, errorf("unexpected character %q", c)
+			}
+			emit(cddlTokPunct, punct)
+			i += len(punct)
+		}
+	}
+
+	emit(cddlTokEOF, "")
+
+	return toks, nil
+}
+
+type cddlParser struct {
+	file string
+	toks []cddlToken
+	pos  int
+}
+
+func (o *cddlParser) peek(n int) cddlToken {
+	if o.pos+n >= len(o.toks) {
+		return o.toks[len(o.toks)-1]
+	}
+	return o.toks[o.pos+n]
+}
+
+func (o *cddlParser) next() cddlToken {
+	t := o.peek(0)
+	if o.pos < len(o.toks)-1 {
+		o.pos++
+	}
+	return t
+}
+
+// at returns true if the current token has the supplied kind and (unless
+// empty) text
+func (o *cddlParser) at(kind cddlTokKind, text string) bool {
+	t := o.peek(0)
+	return t.kind == kind && (text == "" || t.text == text)
+}
+
+func (o *cddlParser) accept(text string) bool {
+	if o.at(cddlTokPunct, text) {
+		o.next()
+		return true
+	}
+	return false
+}
+
+func (o *cddlParser) expect(text string) error {
+	if !o.accept(text) {
+		return o.errorf("expecting %q, found %q", text, o.peek(0).text)
+	}
+	return nil
+}
+
+func (o *cddlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", o.file, o.peek(0).line, fmt.Sprintf(format, args...))
+}
+
+// atRuleStart returns true if the current token starts a new rule
+func (o *cddlParser) atRuleStart() bool {
+	if !o.at(cddlTokIdent, "") {
+		return false
+	}
+	n := o.peek(1)
+	return n.kind == cddlTokPunct && (n.text == "=" || n.text == "/=" || n.text == "//=")
+}
+
+func (o *cddlParser) parseRule(spec *cddlSpec) error {
+	if !o.at(cddlTokIdent, "") {
+		return o.errorf("expecting a rule name, found %q", o.peek(0).text)
+	}
+	name := o.next().text
+
+	if o.at(cddlTokPunct, "<") {
+		return o.errorf("rule %s: generic rules are not supported", name)
+	}
+
+	op := o.next()
+	if op.kind != cddlTokPunct {
+		return o.errorf("rule %s: expecting an assignment, found %q", name, op.text)
+	}
+
+	r := spec.rules[name]
+
+	switch op.text {
+	case "=":
+		if r != nil {
+			return o.errorf("rule %s: redefined", name)
+		}
+
+		g, err := o.parseGroup("")
+		if err != nil {
+			return err
+		}
+
+		r = &cddlRule{name: name}
+
+		if len(g.choices) == 1 && len(g.choices[0]) == 1 {
+			e := g.choices[0][0]
+			switch {
+			case e.key == nil && e.typ != nil && e.min == 1 && e.max == 1:
+				r.typ = e.typ
+			case e.key == nil && e.group != nil && e.min == 1 && e.max == 1:
+				r.group = e.group
+			default:
+				r.group = g
+			}
+		} else {
+			r.group = g
+		}
+		spec.rules[name] = r
+	case "/=":
+		t, err := o.parseType()
+		if err != nil {
+			return err
+		}
+
+		if r == nil {
+			r = &cddlRule{name: name, typ: &cddlType{kind: cddlChoice}}
+			spec.rules[name] = r
+		}
+
+		if r.typ == nil {
+			return o.errorf("rule %s: type choice added to a group", name)
+		}
+
+		if r.typ.kind != cddlChoice {
+			r.typ = &cddlType{kind: cddlChoice, alts: []*cddlType{r.typ}}
+		}
+		r.typ.alts = append(r.typ.alts, t)
+	case "//=":
+		g, err := o.parseGroup("")
+		if err != nil {
+			return err
+		}
+
+		// unwrap a parenthesised group
+		if len(g.choices) == 1 && len(g.choices[0]) == 1 {
+			if e := g.choices[0][0]; e.group != nil && e.key == nil && e.min == 1 && e.max == 1 {
+				g = e.group
+			}
+		}
+
+		if r == nil {
+			r = &cddlRule{name: name, group: &cddlGroup{}}
+			spec.rules[name] = r
+		}
+
+		if r.group == nil {
+			return o.errorf("rule %s: group choice added to a type", name)
+		}
+		r.group.choices = append(r.group.choices, g.choices...)
+	default:
+		return o.errorf("rule %s: expecting an assignment, found %q", name, op.text)
+	}
+
+	return nil
+}
+
+// parseGroup parses group choices up to the closing delimiter (which is not
+// consumed) or, at top level (closer is empty), up to the next rule
+func (o *cddlParser) parseGroup(closer string) (*cddlGroup, error) {
+	g := &cddlGroup{}
+	seq := []*cddlEntry{}
+
+	for {
+		if (closer != "" && o.at(cddlTokPunct, closer)) ||
+			(closer == "" && (o.at(cddlTokEOF, "") || o.atRuleStart())) {
+			break
+		}
+
+		if o.at(cddlTokEOF, "") {
+			return nil, o.errorf("expecting %q, found end of file", closer)
+		}
+
+		if o.accept("//") {
+			g.choices = append(g.choices, seq)
+			seq = []*cddlEntry{}
+			continue
+		}
+
+		e, err := o.parseEntry()
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, e)
+
+		o.accept(",")
+	}
+
+	g.choices = append(g.choices, seq)
+
+	return g, nil
+}
+
+func (o *cddlParser) parseOccurrence() (int, int, error) {
+	switch {
+	case o.accept("?"):
+		return 0, 1, nil
+	case o.accept("+"):
+		return 1, -1, nil
+	case o.accept("*"):
+		if o.at(cddlTokNumber, "") {
+			m, err := strconv.Atoi(o.next().text)
+			return 0, m, err
+		}
+		return 0, -1, nil
+	case o.at(cddlTokNumber, "") && o.peek(1).kind == cddlTokPunct && o.peek(1).text == "*":
+		n, err := strconv.Atoi(o.next().text)
+		if err != nil {
+			return 0, 0, o.errorf("invalid occurrence: %v", err)
+		}
+		o.next()
+		if o.at(cddlTokNumber, "") {
+			m, err := strconv.Atoi(o.next().text)
+			return n, m, err
+		}
+		return n, -1, nil
+	}
+
+	return 1, 1, nil
+}
+
+func (o *cddlParser) parseEntry() (*cddlEntry, error) {
+	min, max, err := o.parseOccurrence()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &cddlEntry{min: min, max: max}
+
+	// bareword or value member key
+	if n := o.peek(1); n.kind == cddlTokPunct && n.text == ":" {
+		t := o.next()
+		o.next()
+
+		switch t.kind {
+		case cddlTokIdent, cddlTokText:
+			e.bare = t.text
+			e.key = &cddlType{kind: cddlValue, value: t.text}
+		case cddlTokNumber:
+			v, err := o.literal(t)
+			if err != nil {
+				return nil, err
+			}
+			e.bare = t.text
+			e.key = &cddlType{kind: cddlValue, value: v}
+		default:
+			return nil, o.errorf("invalid member key %q", t.text)
+		}
+
+		if e.typ, err = o.parseType(); err != nil {
+			return nil, err
+		}
+
+		return e, nil
+	}
+
+	if o.accept("(") {
+		if e.group, err = o.parseGroup(")"); err != nil {
+			return nil, err
+		}
+		if err := o.expect(")"); err != nil {
+			return nil, err
+		}
+
+		// a parenthesised type used as member key, e.g., (int / tstr) => any
+		if o.accept("=>") {
+			c := e.group.choices
+			if len(c) != 1 || len(c[0]) != 1 || c[0][0].typ == nil || c[0][0].key != nil {
+				return nil, o.errorf("invalid member key")
+			}
+			e.key, e.group = c[0][0].typ, nil
+			if e.typ, err = o.parseType(); err != nil {
+				return nil, err
+			}
+		}
+
+		return e, nil
+	}
+
+	t, err := o.parseType1()
+	if err != nil {
+		return nil, err
+	}
+
+	if o.accept("=>") {
+		e.key = t
+		if e.typ, err = o.parseType(); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+
+	if e.typ, err = o.parseChoiceFrom(t); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (o *cddlParser) parseType() (*cddlType, error) {
+	t, err := o.parseType1()
+	if err != nil {
+		return nil, err
+	}
+	return o.parseChoiceFrom(t)
+}
+
+// parseChoiceFrom parses the remaining alternatives of a type choice whose
+// first alternative is t
+func (o *cddlParser) parseChoiceFrom(t *cddlType) (*cddlType, error) {
+	if !o.at(cddlTokPunct, "/") {
+		return t, nil
+	}
+
+	c := &cddlType{kind: cddlChoice, alts: []*cddlType{t}}
+	for o.accept("/") {
+		a, err := o.parseType1()
+		if err != nil {
+			return nil, err
+		}
+		c.alts = append(c.alts, a)
+	}
+
+	return c, nil
+}
+
+func (o *cddlParser) parseType1() (*cddlType, error) {
+	t, err := o.parseType2()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case o.at(cddlTokPunct, "..") || o.at(cddlTokPunct, "..."):
+		exclusive := o.next().text == "..."
+		hi, err := o.parseType2()
+		if err != nil {
+			return nil, err
+		}
+		if t.kind != cddlValue || hi.kind != cddlValue {
+			return nil, o.errorf("range bounds must be literal values")
+		}
+		return &cddlType{kind: cddlRange, alts: []*cddlType{t, hi}, exclusive: exclusive}, nil
+	case o.at(cddlTokControl, ""):
+		ctrl := o.next().text
+		arg, err := o.parseType2()
+		if err != nil {
+			return nil, err
+		}
+		return &cddlType{kind: cddlControl, name: ctrl, alts: []*cddlType{t, arg}}, nil
+	}
+
+	return t, nil
+}
+
+func (o *cddlParser) parseType2() (*cddlType, error) {
+	t := o.peek(0)
+
+	switch t.kind {
+	case cddlTokNumber, cddlTokText, cddlTokBytes:
+		o.next()
+		v, err := o.literal(t)
+		if err != nil {
+			return nil, err
+		}
+		return &cddlType{kind: cddlValue, value: v}, nil
+	case cddlTokIdent:
+		o.next()
+		if o.at(cddlTokPunct, "<") {
+			return nil, o.errorf("%s: generic rules are not supported", t.text)
+		}
+		return &cddlType{kind: cddlRef, name: t.text}, nil
+	case cddlTokTag:
+		o.next()
+		n, err := strconv.ParseUint(t.text, 10, 64)
+		if err != nil {
+			return nil, o.errorf("invalid tag number: %v", err)
+		}
+		if err := o.expect("("); err != nil {
+			return nil, err
+		}
+		inner, err := o.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if err := o.expect(")"); err != nil {
+			return nil, err
+		}
+		return &cddlType{kind: cddlTag, tag: n, alts: []*cddlType{inner}}, nil
+	case cddlTokPunct:
+		switch t.text {
+		case "{", "[":
+			o.next()
+			closer, kind := "}", cddlMap
+			if t.text == "[" {
+				closer, kind = "]", cddlArray
+			}
+			g, err := o.parseGroup(closer)
+			if err != nil {
+				return nil, err
+			}
+			return &cddlType{kind: kind, group: g}, o.expect(closer)
+		case "(":
+			o.next()
+			inner, err := o.parseType()
+			if err != nil {
+				return nil, err
+			}
+			return inner, o.expect(")")
+		case "&":
+			o.next()
+			if o.accept("(") {
+				g, err := o.parseGroup(")")
+				if err != nil {
+					return nil, err
+				}
+				return &cddlType{kind: cddlEnum, group: g}, o.expect(")")
+			}
+			if !o.at(cddlTokIdent, "") {
+				return nil, o.errorf("expecting a group after &")
+			}
+			ref := &cddlEntry{min: 1, max: 1, typ: &cddlType{kind: cddlRef, name: o.next().text}}
+			return &cddlType{kind: cddlEnum, group: &cddlGroup{choices: [][]*cddlEntry{{ref}}}}, nil
+		case "#":
+			o.next()
+			return &cddlType{kind: cddlRef, name: "any"}, nil
+		case "~", "^":
+			return nil, o.errorf("%q is not supported", t.text)
+		}
+	}
+
+	return nil, o.errorf("unexpected %q", t.text)
+}
+
+func (o *cddlParser) literal(t cddlToken) (interface{}, error) {
+	switch t.kind {
+	case cddlTokText:
+		return t.text, nil
+	case cddlTokBytes:
+		return []byte(t.text), nil
+	case cddlTokNumber:
+		if strings.Contains(t.text, ".") {
+			f, err := strconv.ParseFloat(t.text, 64)
+			if err != nil {
+				return nil, o.errorf("invalid number %q", t.text)
+			}
+			return f, nil
+		}
+		i, err := strconv.ParseInt(t.text, 0, 64)
+		if err != nil {
+			return nil, o.errorf("invalid number %q", t.text)
+		}
+		return i, nil
+	}
+
+	return nil, errors.New("not a literal")
+}
@@ -0,0 +1,1059 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// cddlViolation is a mismatch between a CBOR data item and the CDDL
+type cddlViolation struct {
+	// Path is the location of the offending item (e.g.,
+	// "tags[0].triples.reference-triples[1]"), empty for the top level item
+	Path    string
+	Message string
+	// mismatch is set when the item is of the wrong type altogether, in
+	// which case the message can be rephrased by the enclosing rule
+	mismatch bool
+}
+
+func (o cddlViolation) Error() string {
+	if o.Path == "" {
+		return o.Message
+	}
+	return fmt.Sprintf("%s: %s", o.Path, o.Message)
+}
+
+// cddlViolations collects all the violations found in a CBOR data item
+type cddlViolations []cddlViolation
+
+func (o cddlViolations) Error() string {
+	if len(o) == 1 {
+		return o[0].Error()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d CDDL violations found", len(o))
+	for _, v := range o {
+		b.WriteString("\n\t")
+		b.WriteString(v.Error())
+	}
+	return b.String()
+}
+
+// checkCDDL decodes the supplied CBOR data and checks it against the named
+// rule of the embedded CDDL.  An error is returned if the data is not
+// well-formed CBOR, or if it doesn't match the rule.  In the latter case, the
+// error is of type cddlViolations.
+func checkCDDL(data []byte, rule string) error {
+	spec, err := loadCDDLSpec()
+	if err != nil {
+		return err
+	}
+
+	return spec.check(data, rule)
+}
+
+func (o *cddlSpec) check(data []byte, rule string) error {
+	if o.lookup(rule) == nil {
+		return fmt.Errorf("unknown CDDL rule %q", rule)
+	}
+
+	item, err := decodeCBORItem(data)
+	if err != nil {
+		return err
+	}
+
+	c := &cddlChecker{spec: o}
+
+	if vs := c.check(&cddlType{kind: cddlRef, name: rule}, item, ""); len(vs) != 0 {
+		return cddlViolations(vs)
+	}
+
+	return nil
+}
+
+type cborKind int
+
+const (
+	cborUint cborKind = iota
+	cborNint
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborBool
+	cborNull
+	cborUndefined
+	cborSimple
+	cborFloat
+)
+
+// cborItem is a generic CBOR data item.  Unlike interface{} values decoded by
+// fxamacker/cbor, it retains all tags and the order of map entries.
+type cborItem struct {
+	kind cborKind
+	// u is the value of cborUint, the argument of cborNint (whose value is
+	// -1-u), the tag number of cborTag and the value of cborSimple
+	u       uint64
+	b       []byte // cborBytes and cborText
+	f       float64
+	bl      bool
+	items   []*cborItem // cborArray, or the tag content of cborTag
+	keys    []*cborItem // cborMap
+	vals    []*cborItem // cborMap
+	dupKeys []string    // cborMap
+}
+
+const cborMaxDepth = 256
+
+// decodeCBORItem decodes a single, complete CBOR data item
+func decodeCBORItem(data []byte) (*cborItem, error) {
+	d := cborItemDecoder{data: data}
+
+	item, err := d.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("malformed CBOR: %w", err)
+	}
+
+	if d.off != len(data) {
+		return nil, fmt.Errorf("malformed CBOR: %d trailing byte(s)", len(data)-d.off)
+	}
+
+	return item, nil
+}
+
+type cborItemDecoder struct {
+	data []byte
+	off  int
+}
+
+var errCBORBreak = errors.New("unexpected break")
+
+func (o *cborItemDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(o.data)-o.off) {
+		return nil, fmt.Errorf("unexpected end of data at offset %d", o.off)
+	}
+	b := o.data[o.off : o.off+int(n)]
+	o.off += int(n)
+	return b, nil
+}
+
+// head decodes the initial byte and the argument of a data item.  indef is
+// set for indefinite lengths.
+func (o *cborItemDecoder) head() (major byte, info byte, arg uint64, indef bool, err error) {
+	b, err := o.read(1)
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+
+	major, info = b[0]>>5, b[0]&0x1f
+
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		var a []byte
+		if a, err = o.read(1 << (info - 24)); err != nil {
+			return
+		}
+		for _, x := range a {
+			arg = arg<<8 | uint64(x)
+		}
+	case info == 31:
+		indef = true
+	default:
+		err = fmt.Errorf("reserved additional information %d at offset %d", info, o.off-1)
+	}
+
+	return
+}
+
+func (o *cborItemDecoder) decode(depth int) (*cborItem, error) {
+	if depth > cborMaxDepth {
+		return nil, errors.New("nesting too deep")
+	}
+
+	start := o.off
+
+	major, info, arg, indef, err := o.head()
+	if err != nil {
+		return nil, err
+	}
+
+	if indef {
+		switch major {
+		case 2, 3, 4, 5:
+		case 7:
+			return nil, errCBORBreak
+		default:
+			return nil, fmt.Errorf("invalid indefinite length at offset %d", start)
+		}
+	}
+
+	switch major {
+	case 0:
+		return &cborItem{kind: cborUint, u: arg}, nil
+	case 1:
+		return &cborItem{kind: cborNint, u: arg}, nil
+	case 2, 3:
+		kind := cborBytes
+		if major == 3 {
+			kind = cborText
+		}
+
+		if !indef {
+			b, err := o.read(arg)
+			if err != nil {
+				return nil, err
+			}
+			return &cborItem{kind: kind, b: b}, nil
+		}
+
+		// concatenate the definite length chunks
+		var buf []byte
+		for {
+			chunk, err := o.decode(depth + 1)
+			if err == errCBORBreak {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if chunk.kind != kind {
+				return nil, fmt.Errorf("invalid chunk in indefinite length string at offset %d", start)
+			}
+			buf = append(buf, chunk.b...)
+		}
+		return &cborItem{kind: kind, b: buf}, nil
+	case 4:
+		item := &cborItem{kind: cborArray}
+		for i := uint64(0); indef || i < arg; i++ {
+			elem, err := o.decode(depth + 1)
+			if indef && err == errCBORBreak {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			item.items = append(item.items, elem)
+		}
+		return item, nil
+	case 5:
+		item := &cborItem{kind: cborMap}
+		seen := make(map[string]bool)
+		for i := uint64(0); indef || i < arg; i++ {
+			keyStart := o.off
+			key, err := o.decode(depth + 1)
+			if indef && err == errCBORBreak {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			encodedKey := string(o.data[keyStart:o.off])
+			if seen[encodedKey] {
+				item.dupKeys = append(item.dupKeys, key.String())
+			}
+			seen[encodedKey] = true
+
+			val, err := o.decode(depth + 1)
+			if err != nil {
+				if err == errCBORBreak {
+					err = fmt.Errorf("missing map value at offset %d", o.off-1)
+				}
+				return nil, err
+			}
+
+			item.keys = append(item.keys, key)
+			item.vals = append(item.vals, val)
+		}
+		return item, nil
+	case 6:
+		content, err := o.decode(depth + 1)
+		if err != nil {
+			if err == errCBORBreak {
+				err = fmt.Errorf("missing tag content at offset %d", o.off-1)
+			}
+			return nil, err
+		}
+		return &cborItem{kind: cborTag, u: arg, items: []*cborItem{content}}, nil
+	}
+
+	// major type 7
+	switch info {
+	case 20, 21:
+		return &cborItem{kind: cborBool, bl: info == 21}, nil
+	case 22:
+		return &cborItem{kind: cborNull}, nil
+	case 23:
+		return &cborItem{kind: cborUndefined}, nil
+	case 25:
+		return &cborItem{kind: cborFloat, f: float64(halfToFloat32(uint16(arg)))}, nil
+	case 26:
+		return &cborItem{kind: cborFloat, f: float64(math.Float32frombits(uint32(arg)))}, nil
+	case 27:
+		return &cborItem{kind: cborFloat, f: math.Float64frombits(arg)}, nil
+	}
+
+	return &cborItem{kind: cborSimple, u: arg}, nil
+}
+
+func halfToFloat32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	frac := uint32(h) & 0x3ff
+
+	switch exp {
+	case 0:
+		// subnormal
+		f := float32(frac) / (1 << 24)
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	case 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | frac<<13)
+	}
+
+	return math.Float32frombits(sign | (exp+112)<<23 | frac<<13)
+}
+
+// int64 returns the value of an integer item, if it fits an int64
+func (o cborItem) int64() (int64, bool) {
+	switch o.kind {
+	case cborUint:
+		if o.u <= math.MaxInt64 {
+			return int64(o.u), true
+		}
+	case cborNint:
+		if o.u <= math.MaxInt64 {
+			return -1 - int64(o.u), true
+		}
+	}
+	return 0, false
+}
+
+// number returns the value of an integer or floating point item
+func (o cborItem) number() (float64, bool) {
+	switch o.kind {
+	case cborUint:
+		return float64(o.u), true
+	case cborNint:
+		return -1 - float64(o.u), true
+	case cborFloat:
+		return o.f, true
+	}
+	return 0, false
+}
+
+// String returns a short representation of the item, used in paths and
+// messages
+func (o cborItem) String() string {
+	switch o.kind {
+	case cborUint:
+		return strconv.FormatUint(o.u, 10)
+	case cborNint:
+		if v, ok := o.int64(); ok {
+			return strconv.FormatInt(v, 10)
+		}
+		return "-1-" + strconv.FormatUint(o.u, 10)
+	case cborText:
+		return strconv.Quote(string(o.b))
+	case cborFloat:
+		return strconv.FormatFloat(o.f, 'g', -1, 64)
+	case cborBool:
+		return strconv.FormatBool(o.bl)
+	}
+	return o.describe()
+}
+
+// describe returns the type of the item
+func (o cborItem) describe() string {
+	switch o.kind {
+	case cborUint:
+		return "unsigned integer"
+	case cborNint:
+		return "negative integer"
+	case cborBytes:
+		return "byte string"
+	case cborText:
+		return "text string"
+	case cborArray:
+		return "array"
+	case cborMap:
+		return "map"
+	case cborTag:
+		return fmt.Sprintf("tag %d", o.u)
+	case cborBool:
+		return "bool"
+	case cborNull:
+		return "null"
+	case cborUndefined:
+		return "undefined"
+	case cborFloat:
+		return "float"
+	}
+	return fmt.Sprintf("simple value %d", o.u)
+}
+
+const cddlMaxDepth = 512
+
+type cddlChecker struct {
+	spec  *cddlSpec
+	depth int
+}
+
+func joinCDDLPath(path, elem string) string {
+	if path == "" {
+		return elem
+	}
+	return path + "." + elem
+}
+
+func cddlMismatch(path string, v *cborItem, want string) []cddlViolation {
+	return []cddlViolation{{
+		Path:     path,
+		Message:  fmt.Sprintf("got %s, want %s", v.describe(), want),
+		mismatch: true,
+	}}
+}
+
+// nested marks the violations found in the content of a tag or of a byte
+// string, which have the same path as the enclosing item, as specific to it
+func nested(vs []cddlViolation) []cddlViolation {
+	for i := range vs {
+		vs[i].mismatch = false
+	}
+	return vs
+}
+
+// check matches v against t and returns the violations found
+func (o *cddlChecker) check(t *cddlType, v *cborItem, path string) []cddlViolation {
+	o.depth++
+	defer func() { o.depth-- }()
+
+	if o.depth > cddlMaxDepth {
+		return []cddlViolation{{Path: path, Message: "CDDL nesting too deep"}}
+	}
+
+	switch t.kind {
+	case cddlRef:
+		return o.checkRef(t.name, v, path)
+	case cddlValue:
+		if !cddlValueEqual(t.value, v) {
+			return cddlMismatch(path, v, cddlTypeName(t))
+		}
+		return nil
+	case cddlChoice:
+		return o.checkChoice(t.alts, v, path, cddlTypeName(t))
+	case cddlMap:
+		if v.kind != cborMap {
+			return cddlMismatch(path, v, "map")
+		}
+		return o.checkMap(t.group, v, path)
+	case cddlArray:
+		if v.kind != cborArray {
+			return cddlMismatch(path, v, "array")
+		}
+		return o.checkArray(t.group, v, path)
+	case cddlTag:
+		if v.kind != cborTag || v.u != t.tag {
+			return cddlMismatch(path, v, fmt.Sprintf("tag %d", t.tag))
+		}
+		return nested(o.check(t.alts[0], v.items[0], path))
+	case cddlEnum:
+		var alts []*cddlType
+		for _, seq := range o.flatten(t.group) {
+			for _, e := range seq {
+				alts = append(alts, e.typ)
+			}
+		}
+		if o.checkChoice(alts, v, path, "") == nil {
+			return nil
+		}
+		return []cddlViolation{{Path: path, Message: fmt.Sprintf("%s is not an allowed value", v)}}
+	case cddlRange:
+		return o.checkRange(t, v, path)
+	case cddlControl:
+		return o.checkControl(t, v, path)
+	}
+
+	return []cddlViolation{{Path: path, Message: "unsupported CDDL construct"}}
+}
+
+func (o *cddlChecker) checkRef(name string, v *cborItem, path string) []cddlViolation {
+	r := o.spec.lookup(name)
+
+	if r == nil {
+		if cddlPrelude[name] {
+			if !cddlPreludeMatch(name, v) {
+				return cddlMismatch(path, v, name)
+			}
+			return nil
+		}
+		// an empty socket matches nothing
+		return cddlMismatch(path, v, name)
+	}
+
+	if r.typ == nil {
+		return []cddlViolation{{Path: path, Message: fmt.Sprintf("CDDL group %s used as a type", name)}}
+	}
+
+	vs := o.check(r.typ, v, path)
+
+	// name the expected type after the rule rather than its definition
+	if len(vs) == 1 && vs[0].mismatch && vs[0].Path == path {
+		return cddlMismatch(path, v, name)
+	}
+
+	return vs
+}
+
+// checkChoice returns nil if v matches any of the alternatives.  Otherwise,
+// the violations of the closest alternative among those of the right type are
+// returned, so that they point at the actual problem.
+func (o *cddlChecker) checkChoice(alts []*cddlType, v *cborItem, path, want string) []cddlViolation {
+	var best []cddlViolation
+
+	for _, a := range alts {
+		if !o.shallowMatch(a, v) {
+			continue
+		}
+
+		vs := o.check(a, v, path)
+		if len(vs) == 0 {
+			return nil
+		}
+
+		if best == nil || len(vs) < len(best) {
+			best = vs
+		}
+	}
+
+	if best == nil {
+		return cddlMismatch(path, v, want)
+	}
+
+	return best
+}
+
+// shallowMatch tells whether v is of the type expected by t, without looking
+// into its content
+func (o *cddlChecker) shallowMatch(t *cddlType, v *cborItem) bool {
+	o.depth++
+	defer func() { o.depth-- }()
+
+	if o.depth > cddlMaxDepth {
+		return false
+	}
+
+	switch t.kind {
+	case cddlRef:
+		r := o.spec.lookup(t.name)
+		if r == nil {
+			return cddlPrelude[t.name] && cddlPreludeMatch(t.name, v)
+		}
+		return r.typ != nil && o.shallowMatch(r.typ, v)
+	case cddlValue:
+		return cddlValueEqual(t.value, v)
+	case cddlChoice:
+		for _, a := range t.alts {
+			if o.shallowMatch(a, v) {
+				return true
+			}
+		}
+		return false
+	case cddlMap:
+		return v.kind == cborMap
+	case cddlArray:
+		return v.kind == cborArray
+	case cddlTag:
+		return v.kind == cborTag && v.u == t.tag
+	case cddlEnum:
+		return len(o.check(t, v, "")) == 0
+	case cddlRange:
+		_, ok := v.number()
+		return ok
+	case cddlControl:
+		if t.name == "cbor" {
+			if v.kind != cborBytes {
+				return false
+			}
+			inner, err := decodeCBORItem(v.b)
+			return err == nil && o.shallowMatch(t.alts[1], inner)
+		}
+		return o.shallowMatch(t.alts[0], v)
+	}
+
+	return false
+}
+
+// cddlPreludeMatch matches v against the supported prelude types
+func cddlPreludeMatch(name string, v *cborItem) bool {
+	tagged := func(n uint64, kinds ...cborKind) bool {
+		if v.kind != cborTag || v.u != n {
+			return false
+		}
+		for _, k := range kinds {
+			if v.items[0].kind == k {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch name {
+	case "any":
+		return true
+	case "uint", "unsigned":
+		return v.kind == cborUint
+	case "nint":
+		return v.kind == cborNint
+	case "int", "integer":
+		return v.kind == cborUint || v.kind == cborNint
+	case "bstr", "bytes":
+		return v.kind == cborBytes
+	case "tstr", "text":
+		return v.kind == cborText
+	case "bool":
+		return v.kind == cborBool
+	case "true", "false":
+		return v.kind == cborBool && v.bl == (name == "true")
+	case "nil", "null":
+		return v.kind == cborNull
+	case "undefined":
+		return v.kind == cborUndefined
+	case "float", "float16", "float32", "float64", "float16-32", "float32-64":
+		return v.kind == cborFloat
+	case "number":
+		_, ok := v.number()
+		return ok
+	case "tdate":
+		return tagged(0, cborText)
+	case "time":
+		return tagged(1, cborUint, cborNint, cborFloat)
+	case "uri":
+		return tagged(32, cborText)
+	case "biguint":
+		return tagged(2, cborBytes)
+	case "bignint":
+		return tagged(3, cborBytes)
+	case "bigint":
+		return tagged(2, cborBytes) || tagged(3, cborBytes)
+	}
+
+	return false
+}
+
+func cddlValueEqual(lit interface{}, v *cborItem) bool {
+	switch l := lit.(type) {
+	case int64:
+		i, ok := v.int64()
+		return ok && i == l
+	case float64:
+		return v.kind == cborFloat && v.f == l
+	case string:
+		return v.kind == cborText && string(v.b) == l
+	case []byte:
+		return v.kind == cborBytes && bytes.Equal(v.b, l)
+	}
+	return false
+}
+
+// cddlTypeName returns a short description of t, used in messages
+func cddlTypeName(t *cddlType) string {
+	switch t.kind {
+	case cddlRef:
+		return t.name
+	case cddlValue:
+		switch l := t.value.(type) {
+		case string:
+			return strconv.Quote(l)
+		case []byte:
+			return fmt.Sprintf("h'%x'", l)
+		}
+		return fmt.Sprint(t.value)
+	case cddlChoice:
+		var names []string
+		for _, a := range t.alts {
+			names = append(names, cddlTypeName(a))
+		}
+		return strings.Join(names, " / ")
+	case cddlMap:
+		return "map"
+	case cddlArray:
+		return "array"
+	case cddlTag:
+		return fmt.Sprintf("tag %d", t.tag)
+	case cddlEnum:
+		return "enumeration"
+	case cddlRange:
+		op := ".."
+		if t.exclusive {
+			op = "..."
+		}
+		return cddlTypeName(t.alts[0]) + op + cddlTypeName(t.alts[1])
+	case cddlControl:
+		return cddlTypeName(t.alts[0]) + " ." + t.name + " " + cddlTypeName(t.alts[1])
+	}
+	return "?"
+}
+
+func (o *cddlChecker) checkRange(t *cddlType, v *cborItem, path string) []cddlViolation {
+	n, ok := v.number()
+	if !ok {
+		return cddlMismatch(path, v, cddlTypeName(t))
+	}
+
+	lo, _ := toFloat(t.alts[0].value)
+	hi, _ := toFloat(t.alts[1].value)
+
+	if n < lo || n > hi || (t.exclusive && n == hi) {
+		return []cddlViolation{{Path: path, Message: fmt.Sprintf("%s is out of range %s", v, cddlTypeName(t))}}
+	}
+
+	return nil
+}
+
+func toFloat(lit interface{}) (float64, bool) {
+	switch l := lit.(type) {
+	case int64:
+		return float64(l), true
+	case float64:
+		return l, true
+	}
+	return 0, false
+}
+
+func (o *cddlChecker) checkControl(t *cddlType, v *cborItem, path string) []cddlViolation {
+	base, arg := t.alts[0], t.alts[1]
+
+	if vs := o.check(base, v, path); len(vs) != 0 {
+		return vs
+	}
+
+	switch t.name {
+	case "size":
+		var size uint64
+		switch v.kind {
+		case cborBytes, cborText:
+			size = uint64(len(v.b))
+		case cborUint:
+			// the number of bytes needed to encode the value
+			for x := v.u; x != 0; x >>= 8 {
+				size++
+			}
+		default:
+			return nil
+		}
+
+		sizeItem := &cborItem{kind: cborUint, u: size}
+		if len(o.check(arg, sizeItem, "")) != 0 {
+			return []cddlViolation{{
+				Path:    path,
+				Message: fmt.Sprintf("size %d does not match %s", size, cddlTypeName(arg)),
+			}}
+		}
+	case "cbor":
+		inner, err := decodeCBORItem(v.b)
+		if err != nil {
+			return []cddlViolation{{Path: path, Message: fmt.Sprintf("embedded %v", err)}}
+		}
+		return nested(o.check(arg, inner, path))
+	case "regexp":
+		re, ok := arg.value.(string)
+		if arg.kind != cddlValue || !ok {
+			return []cddlViolation{{Path: path, Message: ".regexp needs a text string"}}
+		}
+		m, err := regexp.MatchString("^(?:"+re+")$", string(v.b))
+		if err != nil || !m {
+			return []cddlViolation{{Path: path, Message: fmt.Sprintf("%s does not match %q", v, re)}}
+		}
+	case "and", "within":
+		return o.check(arg, v, path)
+	case "lt", "le", "gt", "ge", "eq", "ne":
+		n, ok1 := v.number()
+		l, ok2 := toFloat(arg.value)
+		if !ok1 || !ok2 {
+			return nil
+		}
+		ok := map[string]bool{
+			"lt": n < l, "le": n <= l, "gt": n > l, "ge": n >= l, "eq": n == l, "ne": n != l,
+		}[t.name]
+		if !ok {
+			return []cddlViolation{{
+				Path:    path,
+				Message: fmt.Sprintf("%s does not satisfy .%s %s", v, t.name, cddlTypeName(arg)),
+			}}
+		}
+	}
+
+	// other control operators (e.g., .default) only constrain the base type
+
+	return nil
+}
+
+// cddlFlatEntry is a group entry whose type is not a group
+type cddlFlatEntry struct {
+	min, max int
+	key      *cddlType
+	typ      *cddlType
+}
+
+// flatten expands nested and referenced groups, returning the alternative
+// sequences of entries.  The occurrence of a nested group applies to each of
+// its entries.
+func (o *cddlChecker) flatten(g *cddlGroup) [][]cddlFlatEntry {
+	var ret [][]cddlFlatEntry
+
+	for _, seq := range g.choices {
+		alts := [][]cddlFlatEntry{{}}
+
+		for _, e := range seq {
+			inner := e.group
+			if inner == nil && e.key == nil && e.typ.kind == cddlRef {
+				if r := o.spec.lookup(e.typ.name); r != nil && r.group != nil {
+					inner = r.group
+				} else if r == nil && strings.HasPrefix(e.typ.name, "$$") {
+					// empty group socket
+					continue
+				}
+			}
+
+			if inner == nil {
+				fe := cddlFlatEntry{min: e.min, max: e.max, key: e.key, typ: e.typ}
+				for i := range alts {
+					alts[i] = append(alts[i], fe)
+				}
+				continue
+			}
+
+			var next [][]cddlFlatEntry
+			for _, innerSeq := range o.flatten(inner) {
+				for _, a := range alts {
+					n := append(append([]cddlFlatEntry{}, a...), scaleOccurrence(innerSeq, e.min, e.max)...)
+					next = append(next, n)
+				}
+			}
+			alts = next
+		}
+
+		ret = append(ret, alts...)
+	}
+
+	return ret
+}
+
+func scaleOccurrence(seq []cddlFlatEntry, min, max int) []cddlFlatEntry {
+	ret := make([]cddlFlatEntry, len(seq))
+	for i, e := range seq {
+		e.min *= min
+		if max == -1 || e.max == -1 {
+			e.max = -1
+		} else {
+			e.max *= max
+		}
+		ret[i] = e
+	}
+	return ret
+}
+
+// literalKey returns the value of a member key that matches a single value,
+// and the name used for it in paths
+func (o *cddlChecker) literalKey(t *cddlType) (interface{}, string, bool) {
+	switch t.kind {
+	case cddlValue:
+		if s, ok := t.value.(string); ok {
+			return s, s, true
+		}
+		return t.value, fmt.Sprint(t.value), true
+	case cddlRef:
+		if r := o.spec.lookup(t.name); r != nil && r.typ != nil && r.typ.kind == cddlValue {
+			return r.typ.value, t.name, true
+		}
+	case cddlEnum:
+		if len(t.group.choices) == 1 && len(t.group.choices[0]) == 1 {
+			e := t.group.choices[0][0]
+			if e.bare != "" && e.typ != nil && e.typ.kind == cddlValue {
+				return e.typ.value, e.bare, true
+			}
+		}
+	}
+	return nil, "", false
+}
+
+func (o *cddlChecker) checkMap(g *cddlGroup, v *cborItem, path string) []cddlViolation {
+	var best []cddlViolation
+
+	for i, seq := range o.flatten(g) {
+		vs := o.checkMapEntries(seq, v, path)
+		if len(vs) == 0 {
+			best = nil
+			break
+		}
+		if i == 0 || len(vs) < len(best) {
+			best = vs
+		}
+	}
+
+	for _, k := range v.dupKeys {
+		best = append(best, cddlViolation{Path: path, Message: fmt.Sprintf("duplicate key %s", k)})
+	}
+
+	return best
+}
+
+func (o *cddlChecker) checkMapEntries(seq []cddlFlatEntry, v *cborItem, path string) []cddlViolation {
+	var (
+		vs   []cddlViolation
+		used = make([]bool, len(v.keys))
+	)
+
+	keyPath := func(k *cborItem) string {
+		if k.kind == cborText {
+			return joinCDDLPath(path, string(k.b))
+		}
+		return joinCDDLPath(path, k.String())
+	}
+
+	// entries with a literal key first...
+	for _, e := range seq {
+		if e.key == nil {
+			continue
+		}
+
+		lit, name, ok := o.literalKey(e.key)
+		if !ok {
+			continue
+		}
+
+		found := false
+		for i, k := range v.keys {
+			if !used[i] && cddlValueEqual(lit, k) {
+				used[i], found = true, true
+				vs = append(vs, o.check(e.typ, v.vals[i], joinCDDLPath(path, name))...)
+				break
+			}
+		}
+
+		if !found && e.min > 0 {
+			vs = append(vs, cddlViolation{Path: path, Message: fmt.Sprintf("missing mandatory key %s (%v)", name, lit)})
+		}
+	}
+
+	// ...then those matching a type of keys
+	for _, e := range seq {
+		if e.key == nil {
+			continue
+		}
+
+		if _, _, ok := o.literalKey(e.key); ok {
+			continue
+		}
+
+		n := 0
+		for i, k := range v.keys {
+			if e.max != -1 && n >= e.max {
+				break
+			}
+			if used[i] || len(o.check(e.key, k, "")) != 0 {
+				continue
+			}
+			used[i] = true
+			n++
+			vs = append(vs, o.check(e.typ, v.vals[i], keyPath(k))...)
+		}
+
+		if n < e.min {
+			vs = append(vs, cddlViolation{
+				Path:    path,
+				Message: fmt.Sprintf("missing entry with key of type %s", cddlTypeName(e.key)),
+			})
+		}
+	}
+
+	for i, k := range v.keys {
+		if !used[i] {
+			vs = append(vs, cddlViolation{Path: path, Message: fmt.Sprintf("unexpected key %s", k)})
+		}
+	}
+
+	return vs
+}
+
+func (o *cddlChecker) checkArray(g *cddlGroup, v *cborItem, path string) []cddlViolation {
+	var best []cddlViolation
+
+	for i, seq := range o.flatten(g) {
+		vs := o.checkArrayEntries(seq, v, path)
+		if len(vs) == 0 {
+			return nil
+		}
+		if i == 0 || len(vs) < len(best) {
+			best = vs
+		}
+	}
+
+	return best
+}
+
+func (o *cddlChecker) checkArrayEntries(seq []cddlFlatEntry, v *cborItem, path string) []cddlViolation {
+	var (
+		vs []cddlViolation
+		i  int
+	)
+
+	// tells whether any of the entries following the k-th accepts item
+	laterAccepts := func(k int, item *cborItem) bool {
+		for _, e := range seq[k+1:] {
+			if o.shallowMatch(e.typ, item) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for k, e := range seq {
+		n := 0
+		for i < len(v.items) && (e.max == -1 || n < e.max) {
+			item := v.items[i]
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+
+			ivs := o.check(e.typ, item, itemPath)
+			// faulty items are consumed, and their violations
+			// reported, if they are in a mandatory position, or if
+			// no following entry is a better fit for them
+			if len(ivs) != 0 && n >= e.min && (laterAccepts(k, item) ||
+				(k != len(seq)-1 && !o.shallowMatch(e.typ, item))) {
+				break
+			}
+
+			vs = append(vs, ivs...)
+			i++
+			n++
+		}
+
+		if n < e.min {
+			vs = append(vs, cddlViolation{
+				Path:    path,
+				Message: fmt.Sprintf("missing array element of type %s", cddlTypeName(e.typ)),
+			})
+		}
+	}
+
+	for ; i < len(v.items); i++ {
+		vs = append(vs, cddlViolation{Path: fmt.Sprintf("%s[%d]", path, i), Message: "unexpected array element"})
+	}
+
+	return vs
+}
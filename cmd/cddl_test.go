@@ -0,0 +1,195 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	cbor "github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustMarshalCBOR(t *testing.T, v interface{}) []byte {
+	data, err := cbor.Marshal(v)
+	require.NoError(t, err)
+	return data
+}
+
+func Test_parseCDDL_errors(t *testing.T) {
+	tvs := []struct {
+		src      string
+		expected string
+	}{
+		{"a = b", `CDDL rule a: undefined name "b"`},
+		{"a = uint\na = tstr", "t.cddl:2: rule a: redefined"},
+		{"a<T> = [ T ]", "t.cddl:1: rule a: generic rules are not supported"},
+		{"a = { b => ~c }", `t.cddl:1: "~" is not supported`},
+		{"a = { 1 => uint", `t.cddl:1: expecting "}", found end of file`},
+		{"a = #3.1", "t.cddl:1: only major type 6 (#6.n) is supported"},
+	}
+
+	for _, tv := range tvs {
+		_, err := parseCDDL(map[string]string{"t.cddl": tv.src})
+		assert.EqualError(t, err, tv.expected, tv.src)
+	}
+}
+
+func Test_loadCDDLSpec(t *testing.T) {
+	spec, err := loadCDDLSpec()
+	require.NoError(t, err)
+
+	for _, r := range []string{"corim", "comid", "concise-ta-store-map", "concise-swid-tag"} {
+		assert.NotNil(t, spec.lookup(r), r)
+	}
+}
+
+func Test_cddlSpec_check(t *testing.T) {
+	spec, err := parseCDDL(map[string]string{"t.cddl": `
+		top = {
+		  &(name: 0) => tstr
+		  ? &(digest: 1) => [ alg: int, val: bstr .size (4..8) ]
+		  ? &(nested: 2) => bytes .cbor inner
+		  ? &(kind: 3) => &(foo: 1, bar: 2)
+		  * tstr => uint
+		  * $$top-extension
+		}
+		inner = #6.600([ + uint ])
+	`})
+	require.NoError(t, err)
+
+	tvs := []struct {
+		desc     string
+		data     interface{}
+		expected []string
+	}{
+		{
+			"valid",
+			map[interface{}]interface{}{
+				0: "x", 1: []interface{}{1, []byte{1, 2, 3, 4}}, "a": 1,
+				2: mustMarshalCBOR(t, cbor.Tag{Number: 600, Content: []uint{1, 2}}),
+				3: 2,
+			},
+			nil,
+		},
+		{
+			"missing and unknown keys",
+			map[interface{}]interface{}{9: true, "a": -1},
+			[]string{
+				"missing mandatory key name (0)",
+				"a: got negative integer, want uint",
+				"unexpected key 9",
+			},
+		},
+		{
+			"wrong array elements",
+			map[int]interface{}{0: "x", 1: []interface{}{"sha-256", []byte{1}, 3}},
+			[]string{
+				"digest[0]: got text string, want int",
+				"digest[1]: size 1 does not match 4..8",
+				"digest[2]: unexpected array element",
+			},
+		},
+		{
+			"embedded CBOR and enumerations",
+			map[int]interface{}{0: "x", 2: mustMarshalCBOR(t, cbor.Tag{Number: 600, Content: []int{1, -2}}), 3: 4},
+			[]string{
+				"nested[1]: got negative integer, want uint",
+				"kind: 4 is not an allowed value",
+			},
+		},
+		{
+			"not a map",
+			[]int{1},
+			[]string{"got array, want top"},
+		},
+	}
+
+	for _, tv := range tvs {
+		err := spec.check(mustMarshalCBOR(t, tv.data), "top")
+		if tv.expected == nil {
+			assert.NoError(t, err, tv.desc)
+			continue
+		}
+
+		var vs cddlViolations
+		require.ErrorAs(t, err, &vs, tv.desc)
+
+		var actual []string
+		for _, v := range vs {
+			actual = append(actual, v.Error())
+		}
+		assert.Equal(t, tv.expected, actual, tv.desc)
+	}
+}
+
+func Test_cddlSpec_check_duplicate_key(t *testing.T) {
+	spec, err := parseCDDL(map[string]string{"t.cddl": "top = { * uint => uint }"})
+	require.NoError(t, err)
+
+	// {1: 1, 1: 2}
+	err = spec.check([]byte{0xa2, 0x01, 0x01, 0x01, 0x02}, "top")
+	assert.EqualError(t, err, "duplicate key 1")
+}
+
+func Test_cddlSpec_check_malformed(t *testing.T) {
+	spec, err := loadCDDLSpec()
+	require.NoError(t, err)
+
+	err = spec.check([]byte{0xa1, 0x01}, "comid")
+	assert.EqualError(t, err, "malformed CBOR: unexpected end of data at offset 2")
+
+	err = spec.check([]byte{0x01, 0x02}, "comid")
+	assert.EqualError(t, err, "malformed CBOR: 1 trailing byte(s)")
+}
+
+func Test_checkCDDL_library_encodings(t *testing.T) {
+	tvs := []struct {
+		file string
+		rule string
+	}{
+		{"../data/comid/comid-psa-refval.cbor", "comid"},
+		{"../data/comid/comid-psa-iakpub.cbor", "comid"},
+		{"../data/comid/comid-cca-refval.cbor", "comid"},
+		{"../data/comid/comid-dice-refval.cbor", "comid"},
+		{"../data/cots/vendor.cbor", "concise-ta-store-map"},
+		{"../data/cots/namedtastore.cbor", "concise-ta-store-map"},
+		{"../data/coswid/1.cbor", "concise-swid-tag"},
+		{"../data/corim/corim-full.cbor", "corim"},
+	}
+
+	for _, tv := range tvs {
+		data, err := os.ReadFile(tv.file)
+		require.NoError(t, err)
+
+		assert.NoError(t, checkCDDL(data, tv.rule), tv.file)
+	}
+
+	assert.NoError(t, checkCDDL(psaCorim(t), "corim"))
+}
+
+func Test_checkCDDL_unknown_key(t *testing.T) {
+	comid := map[int]interface{}{
+		1: map[int]interface{}{0: "tag-id"},
+		4: map[int]interface{}{
+			0: []interface{}{
+				[]interface{}{
+					map[int]interface{}{0: map[int]interface{}{1: "ACME"}},
+					[]interface{}{
+						map[int]interface{}{
+							1: map[int]interface{}{
+								2:  []interface{}{[]interface{}{1, make([]byte, 32)}},
+								99: true,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	err := checkCDDL(mustMarshalCBOR(t, comid), "comid")
+	assert.EqualError(t, err, "triples.reference-triples[0][1][0].mval: unexpected key 99")
+}
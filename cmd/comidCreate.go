@@ -105,7 +105,10 @@ func templateToCBOR(tmplFile, outputDir string) (string, error) {
 	}
 
 	if err = c.FromJSON(tmplData); err != nil {
-		return "", fmt.Errorf("error decoding template from %s: %w", tmplFile, err)
+		return "", fmt.Errorf(
+			"error decoding template from %s: %w",
+			tmplFile, locateTemplateErrors(tmplData, err, comidTemplateProbes),
+		)
 	}
 
 	if err = c.Valid(); err != nil {
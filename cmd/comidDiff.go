@@ -0,0 +1,807 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/comid"
+)
+
+const (
+	diffAdded   = "added"
+	diffRemoved = "removed"
+	diffChanged = "changed"
+)
+
+var comidDiffFormat string
+
+var comidDiffCmd = NewComidDiffCmd()
+
+func NewComidDiffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff <old.cbor> <new.cbor>",
+		Short: "show the differences between two CBOR-encoded CoMIDs",
+		Long: `show the differences between two CBOR-encoded CoMIDs
+
+	Compare the CoMIDs in files v1.cbor and v2.cbor, e.g., before and after a
+	firmware release.  Measurements are matched by environment and measurement
+	key (e.g., the label, version and signer ID of a PSA software component),
+	so that the order in which triples and measurements are encoded does not
+	matter.  Added, removed and changed digests (and other measured values),
+	attestation and identity keys, entities and linked tags are reported.
+
+	  cocli comid diff v1.cbor v2.cbor
+
+	Same as above, but report the differences in JSON.
+
+	  cocli comid diff v1.cbor v2.cbor --format=json
+	`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkComidDiffArgs(args); err != nil {
+				return err
+			}
+
+			a, err := loadComid(args[0])
+			if err != nil {
+				return err
+			}
+
+			b, err := loadComid(args[1])
+			if err != nil {
+				return err
+			}
+
+			d, err := diffComids(a, b)
+			if err != nil {
+				return err
+			}
+
+			return printComidDiff(os.Stdout, d, args[0], args[1], comidDiffFormat)
+		},
+	}
+
+	cmd.Flags().StringVarP(
+		&comidDiffFormat, "format", "o", "text", "output format: text or json",
+	)
+
+	return cmd
+}
+
+func checkComidDiffArgs(args []string) error {
+	if len(args) != 2 {
+		return errors.New("two CoMID files must be supplied")
+	}
+
+	return checkDiffFormat(comidDiffFormat)
+}
+
+func checkDiffFormat(format string) error {
+	switch format {
+	case "text", "json":
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q (want text or json)", format)
+}
+
+func loadComid(file string) (*comid.Comid, error) {
+	var c comid.Comid
+
+	data, err := afero.ReadFile(fs, file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading CoMID from %s: %w", file, err)
+	}
+
+	if err = c.FromCBOR(data); err != nil {
+		return nil, fmt.Errorf("error decoding CoMID from %s: %w", file, err)
+	}
+
+	return &c, nil
+}
+
+// diffChange is an added, removed or changed element.  From and To are the
+// old and new values (in JSON, for structured values), as applicable.
+type diffChange struct {
+	Op    string `json:"op"`
+	Field string `json:"field"`
+	From  string `json:"from,omitempty"`
+	To    string `json:"to,omitempty"`
+}
+
+// measurementDiff is an added, removed or changed measurement.  Added and
+// removed measurements carry their value, changed ones the list of changes.
+type measurementDiff struct {
+	Triples     string          `json:"triples"`
+	Environment json.RawMessage `json:"environment"`
+	Key         json.RawMessage `json:"key,omitempty"`
+	// Index is the (1-based) position of unkeyed measurements among those
+	// of the same environment
+	Index   int             `json:"index,omitempty"`
+	Op      string          `json:"op"`
+	From    json.RawMessage `json:"from,omitempty"`
+	To      json.RawMessage `json:"to,omitempty"`
+	Changes []diffChange    `json:"changes,omitempty"`
+}
+
+// keyDiff is an added or removed attestation or identity key
+type keyDiff struct {
+	Triples     string          `json:"triples"`
+	Environment json.RawMessage `json:"environment"`
+	Op          string          `json:"op"`
+	Key         json.RawMessage `json:"key"`
+}
+
+type comidDiff struct {
+	Header       []diffChange      `json:"header,omitempty"`
+	Entities     []diffChange      `json:"entities,omitempty"`
+	LinkedTags   []diffChange      `json:"linked-tags,omitempty"`
+	Measurements []measurementDiff `json:"measurements,omitempty"`
+	Keys         []keyDiff         `json:"keys,omitempty"`
+}
+
+func (o comidDiff) empty() bool {
+	return len(o.Header) == 0 && len(o.Entities) == 0 && len(o.LinkedTags) == 0 &&
+		len(o.Measurements) == 0 && len(o.Keys) == 0
+}
+
+// compactJSON returns the compact JSON encoding of v
+func compactJSON(v interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	if err := json.Compact(&b, data); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// diffValue appends the change (if any) between the old and new value of a
+// field, where an empty value stands for an absent field
+func diffValue(changes []diffChange, field, from, to string) []diffChange {
+	switch {
+	case from == to:
+		return changes
+	case from == "":
+		return append(changes, diffChange{Op: diffAdded, Field: field, To: to})
+	case to == "":
+		return append(changes, diffChange{Op: diffRemoved, Field: field, From: from})
+	}
+	return append(changes, diffChange{Op: diffChanged, Field: field, From: from, To: to})
+}
+
+// diffSets appends the elements only found in either the old or the new set,
+// preserving their order
+func diffSets(changes []diffChange, field string, from, to []string) []diffChange {
+	in := func(s string, l []string) bool {
+		for _, e := range l {
+			if e == s {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, s := range from {
+		if !in(s, to) {
+			changes = append(changes, diffChange{Op: diffRemoved, Field: field, From: s})
+		}
+	}
+
+	for _, s := range to {
+		if !in(s, from) {
+			changes = append(changes, diffChange{Op: diffAdded, Field: field, To: s})
+		}
+	}
+
+	return changes
+}
+
+// diffComids compares CoMIDs a (old) and b (new)
+func diffComids(a, b *comid.Comid) (*comidDiff, error) {
+	var (
+		d   comidDiff
+		err error
+	)
+
+	d.Header = diffComidHeader(a, b)
+
+	if d.Entities, err = diffComidEntities(a, b); err != nil {
+		return nil, err
+	}
+
+	if d.LinkedTags, err = diffComidLinkedTags(a, b); err != nil {
+		return nil, err
+	}
+
+	if d.Measurements, err = diffComidMeasurements(a, b); err != nil {
+		return nil, err
+	}
+
+	if d.Keys, err = diffComidKeys(a, b); err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+func diffComidHeader(a, b *comid.Comid) []diffChange {
+	var changes []diffChange
+
+	lang := func(c *comid.Comid) string {
+		if c.Language == nil {
+			return ""
+		}
+		return *c.Language
+	}
+
+	changes = diffValue(changes, "lang", lang(a), lang(b))
+	changes = diffValue(changes, "tag-identity.id", a.TagIdentity.TagID.String(), b.TagIdentity.TagID.String())
+	changes = diffValue(changes, "tag-identity.version",
+		fmt.Sprint(a.TagIdentity.TagVersion), fmt.Sprint(b.TagIdentity.TagVersion))
+
+	return changes
+}
+
+// namedValues is a list of values identified by name, in order of appearance
+type namedValues struct {
+	names  []string
+	values map[string]string
+}
+
+func (o *namedValues) add(name, value string) {
+	if o.values == nil {
+		o.values = make(map[string]string)
+	}
+
+	if _, ok := o.values[name]; !ok {
+		o.names = append(o.names, name)
+	}
+
+	o.values[name] = value
+}
+
+// diffNamedValues appends the changes between the old and new values with the
+// same name
+func diffNamedValues(changes []diffChange, from, to namedValues) []diffChange {
+	names := from.names
+	for _, n := range to.names {
+		if _, ok := from.values[n]; !ok {
+			names = append(names, n)
+		}
+	}
+
+	for _, n := range names {
+		changes = diffValue(changes, n, from.values[n], to.values[n])
+	}
+
+	return changes
+}
+
+func diffComidEntities(a, b *comid.Comid) ([]diffChange, error) {
+	collect := func(c *comid.Comid) (namedValues, error) {
+		var ret namedValues
+
+		if c.Entities == nil {
+			return ret, nil
+		}
+
+		for _, e := range c.Entities.Values {
+			j, err := compactJSON(e)
+			if err != nil {
+				return ret, fmt.Errorf("error encoding entity: %w", err)
+			}
+
+			name := ""
+			if e.Name != nil {
+				name = e.Name.String()
+			}
+
+			ret.add(name, string(j))
+		}
+
+		return ret, nil
+	}
+
+	from, err := collect(a)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := collect(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffNamedValues(nil, from, to), nil
+}
+
+func diffComidLinkedTags(a, b *comid.Comid) ([]diffChange, error) {
+	collect := func(c *comid.Comid) ([]string, error) {
+		var ret []string
+
+		if c.LinkedTags == nil {
+			return nil, nil
+		}
+
+		for _, lt := range *c.LinkedTags {
+			j, err := compactJSON(lt)
+			if err != nil {
+				return nil, fmt.Errorf("error encoding linked tag: %w", err)
+			}
+			ret = append(ret, string(j))
+		}
+
+		return ret, nil
+	}
+
+	from, err := collect(a)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := collect(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffSets(nil, "linked-tags", from, to), nil
+}
+
+// keyedMeasurement is a measurement along with what identifies it
+type keyedMeasurement struct {
+	triples string
+	env     json.RawMessage
+	key     json.RawMessage
+	index   int
+	m       comid.Measurement
+}
+
+func (o keyedMeasurement) group() string {
+	return o.triples + " " + string(o.env)
+}
+
+func (o keyedMeasurement) id() string {
+	return fmt.Sprintf("%s %s %d", o.group(), o.key, o.index)
+}
+
+// collectMeasurements returns the reference and endorsed values of a CoMID,
+// indexed by their identity, along with the list of identities in order of
+// appearance
+func collectMeasurements(c *comid.Comid) ([]string, map[string]keyedMeasurement, error) {
+	var (
+		ids     []string
+		ms      = make(map[string]keyedMeasurement)
+		unkeyed = make(map[string]int)
+	)
+
+	for _, vts := range comidValueTriples(c) {
+		for _, vt := range vts.Values {
+			env, err := compactJSON(vt.Environment)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error encoding environment: %w", err)
+			}
+
+			for _, m := range vt.Measurements.Values {
+				km := keyedMeasurement{triples: vts.name, env: env, m: m}
+
+				if m.Key != nil && m.Key.IsSet() {
+					if km.key, err = compactJSON(m.Key); err != nil {
+						return nil, nil, fmt.Errorf("error encoding measurement key: %w", err)
+					}
+				} else {
+					unkeyed[km.group()]++
+					km.index = unkeyed[km.group()]
+				}
+
+				id := km.id()
+				if _, ok := ms[id]; !ok {
+					ids = append(ids, id)
+				}
+				ms[id] = km
+			}
+		}
+	}
+
+	return ids, ms, nil
+}
+
+func diffComidMeasurements(a, b *comid.Comid) ([]measurementDiff, error) {
+	idsA, from, err := collectMeasurements(a)
+	if err != nil {
+		return nil, err
+	}
+
+	idsB, to, err := collectMeasurements(b)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := idsA
+	for _, id := range idsB {
+		if _, ok := from[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+
+	var ret []measurementDiff
+
+	for _, id := range ids {
+		ma, inA := from[id]
+		mb, inB := to[id]
+
+		km := ma
+		if !inA {
+			km = mb
+		}
+
+		md := measurementDiff{Triples: km.triples, Environment: km.env, Key: km.key, Index: km.index}
+
+		switch {
+		case !inA:
+			md.Op = diffAdded
+			if md.To, err = compactJSON(mb.m.Val); err != nil {
+				return nil, fmt.Errorf("error encoding measurement value: %w", err)
+			}
+		case !inB:
+			md.Op = diffRemoved
+			if md.From, err = compactJSON(ma.m.Val); err != nil {
+				return nil, fmt.Errorf("error encoding measurement value: %w", err)
+			}
+		default:
+			md.Op = diffChanged
+			if md.Changes, err = diffMeasurementValues(ma.m, mb.m); err != nil {
+				return nil, err
+			}
+			if len(md.Changes) == 0 {
+				continue
+			}
+		}
+
+		ret = append(ret, md)
+	}
+
+	// keep the measurements of the same environment together
+	groups := make(map[string]int)
+	for _, md := range ret {
+		g := md.Triples + " " + string(md.Environment)
+		if _, ok := groups[g]; !ok {
+			groups[g] = len(groups)
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return groups[ret[i].Triples+" "+string(ret[i].Environment)] <
+			groups[ret[j].Triples+" "+string(ret[j].Environment)]
+	})
+
+	return ret, nil
+}
+
+// measurementFields returns the JSON encoding of each of the measured values
+// and of the authorized-by key of a measurement
+func measurementFields(m comid.Measurement) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+
+	j, err := compactJSON(m.Val)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding measurement value: %w", err)
+	}
+
+	if err := json.Unmarshal(j, &fields); err != nil {
+		return nil, fmt.Errorf("error decoding measurement value: %w", err)
+	}
+
+	if m.AuthorizedBy != nil {
+		if fields["authorized-by"], err = compactJSON(m.AuthorizedBy); err != nil {
+			return nil, fmt.Errorf("error encoding authorized-by key: %w", err)
+		}
+	}
+
+	return fields, nil
+}
+
+// diffMeasurementValues compares the measured values of a (old) and b (new).
+// Digests are compared as sets, including those of integrity registers.
+func diffMeasurementValues(a, b comid.Measurement) ([]diffChange, error) {
+	from, err := measurementFields(a)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := measurementFields(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for n := range from {
+		names = append(names, n)
+	}
+	for n := range to {
+		if _, ok := from[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []diffChange
+
+	for _, n := range names {
+		switch n {
+		case "digests":
+			var da, db []string
+			if err := unmarshalIfSet(from[n], &da); err != nil {
+				return nil, err
+			}
+			if err := unmarshalIfSet(to[n], &db); err != nil {
+				return nil, err
+			}
+			changes = diffSets(changes, n, da, db)
+		case "integrity-registers":
+			type register struct {
+				Value []string `json:"value"`
+			}
+
+			var ra, rb map[string]register
+			if err := unmarshalIfSet(from[n], &ra); err != nil {
+				return nil, err
+			}
+			if err := unmarshalIfSet(to[n], &rb); err != nil {
+				return nil, err
+			}
+
+			var regs []string
+			for r := range ra {
+				regs = append(regs, r)
+			}
+			for r := range rb {
+				if _, ok := ra[r]; !ok {
+					regs = append(regs, r)
+				}
+			}
+			sort.Strings(regs)
+
+			for _, r := range regs {
+				changes = diffSets(changes, n+"."+r, ra[r].Value, rb[r].Value)
+			}
+		default:
+			changes = diffValue(changes, n, string(from[n]), string(to[n]))
+		}
+	}
+
+	return changes, nil
+}
+
+func unmarshalIfSet(data json.RawMessage, v interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error decoding measurement value: %w", err)
+	}
+
+	return nil
+}
+
+func diffComidKeys(a, b *comid.Comid) ([]keyDiff, error) {
+	type keySet struct {
+		triples string
+		env     json.RawMessage
+		keys    []string
+	}
+
+	var groups []string
+
+	collect := func(c *comid.Comid) (map[string]*keySet, error) {
+		ret := make(map[string]*keySet)
+
+		for _, kts := range []struct {
+			name string
+			kts  *comid.KeyTriples
+		}{
+			{"attester-verification-keys", c.Triples.AttestVerifKeys},
+			{"dev-identity-keys", c.Triples.DevIdentityKeys},
+		} {
+			if kts.kts == nil {
+				continue
+			}
+
+			for _, kt := range *kts.kts {
+				env, err := compactJSON(kt.Environment)
+				if err != nil {
+					return nil, fmt.Errorf("error encoding environment: %w", err)
+				}
+
+				g := kts.name + " " + string(env)
+				if _, ok := ret[g]; !ok {
+					ret[g] = &keySet{triples: kts.name, env: env}
+				}
+
+				if indexOf(groups, g) == -1 {
+					groups = append(groups, g)
+				}
+
+				for _, k := range kt.VerifKeys {
+					j, err := compactJSON(k)
+					if err != nil {
+						return nil, fmt.Errorf("error encoding key: %w", err)
+					}
+					ret[g].keys = append(ret[g].keys, string(j))
+				}
+			}
+		}
+
+		return ret, nil
+	}
+
+	from, err := collect(a)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := collect(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []keyDiff
+
+	for _, g := range groups {
+		var ka, kb []string
+
+		ks := from[g]
+		if ks != nil {
+			ka = ks.keys
+		}
+		if to[g] != nil {
+			kb = to[g].keys
+			ks = to[g]
+		}
+
+		for _, c := range diffSets(nil, "", ka, kb) {
+			k := c.To
+			if c.Op == diffRemoved {
+				k = c.From
+			}
+			ret = append(ret, keyDiff{Triples: ks.triples, Environment: ks.env, Op: c.Op, Key: json.RawMessage(k)})
+		}
+	}
+
+	return ret, nil
+}
+
+func printComidDiff(w io.Writer, d *comidDiff, fileA, fileB, format string) error {
+	if format == "json" {
+		j, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return fmt.Errorf("JSON encoding failed: %w", err)
+		}
+		fmt.Fprintln(w, string(j))
+		return nil
+	}
+
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", fileA, fileB)
+
+	if d.empty() {
+		fmt.Fprintln(w, "no differences")
+		return nil
+	}
+
+	writeComidDiff(w, d, "")
+
+	return nil
+}
+
+var diffOpSymbols = map[string]string{diffAdded: "+", diffRemoved: "-", diffChanged: "~"}
+
+// writeDiffChange writes a change as a single line, e.g., "~ lang: en-GB ->
+// en-US"
+func writeDiffChange(w io.Writer, indent string, c diffChange) {
+	switch c.Op {
+	case diffAdded:
+		fmt.Fprintf(w, "%s+ %s: %s\n", indent, c.Field, c.To)
+	case diffRemoved:
+		fmt.Fprintf(w, "%s- %s: %s\n", indent, c.Field, c.From)
+	default:
+		fmt.Fprintf(w, "%s~ %s: %s -> %s\n", indent, c.Field, c.From, c.To)
+	}
+}
+
+// writeComidDiff writes the differences in human-readable form, with each
+// line prefixed by indent
+func writeComidDiff(w io.Writer, d *comidDiff, indent string) {
+	for _, c := range d.Header {
+		writeDiffChange(w, indent, c)
+	}
+
+	for _, c := range d.Entities {
+		c.Field = "entity " + c.Field
+		writeDiffChange(w, indent, c)
+	}
+
+	for _, c := range d.LinkedTags {
+		writeDiffChange(w, indent, c)
+	}
+
+	group := ""
+	for _, md := range d.Measurements {
+		if g := md.Triples + " " + string(md.Environment); g != group {
+			fmt.Fprintf(w, "%s%s\n", indent, g)
+			group = g
+		}
+
+		what := "measurement " + string(md.Key)
+		if md.Key == nil {
+			what = fmt.Sprintf("unkeyed measurement #%d", md.Index)
+		}
+
+		switch md.Op {
+		case diffAdded:
+			fmt.Fprintf(w, "%s  + %s: %s\n", indent, what, md.To)
+		case diffRemoved:
+			fmt.Fprintf(w, "%s  - %s: %s\n", indent, what, md.From)
+		default:
+			fmt.Fprintf(w, "%s  ~ %s\n", indent, what)
+			for _, c := range md.Changes {
+				writeDiffChange(w, indent+"      ", c)
+			}
+		}
+	}
+
+	group = ""
+	for _, kd := range d.Keys {
+		if g := kd.Triples + " " + string(kd.Environment); g != group {
+			fmt.Fprintf(w, "%s%s\n", indent, g)
+			group = g
+		}
+
+		fmt.Fprintf(w, "%s  %s key %s\n", indent, diffOpSymbols[kd.Op], describeDiffKey(kd.Key))
+	}
+}
+
+// describeDiffKey returns the type of a crypto key followed by the start of
+// its value, stripped of any PEM armour
+func describeDiffKey(k json.RawMessage) string {
+	var tv struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+
+	if err := json.Unmarshal(k, &tv); err != nil {
+		return string(k)
+	}
+
+	var lines []string
+	for _, l := range strings.Split(tv.Value, "\n") {
+		if !strings.HasPrefix(l, "-----") {
+			lines = append(lines, strings.TrimSpace(l))
+		}
+	}
+
+	v := strings.Join(lines, "")
+	if len(v) > 40 {
+		v = v[:40] + "..."
+	}
+
+	return tv.Type + " " + v
+}
+
+func init() {
+	comidCmd.AddCommand(comidDiffCmd)
+}
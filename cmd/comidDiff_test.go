@@ -0,0 +1,155 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/swid"
+)
+
+func Test_ComidDiffCmd_wrong_number_of_args(t *testing.T) {
+	cmd := NewComidDiffCmd()
+
+	cmd.SetArgs([]string{"a.cbor"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "two CoMID files must be supplied")
+}
+
+func Test_ComidDiffCmd_unknown_format(t *testing.T) {
+	cmd := NewComidDiffCmd()
+
+	cmd.SetArgs([]string{"a.cbor", "b.cbor", "--format=yaml"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, `unknown output format "yaml" (want text or json)`)
+
+	comidDiffFormat = "text"
+}
+
+func Test_ComidDiffCmd_file_not_found(t *testing.T) {
+	cmd := NewComidDiffCmd()
+
+	fs = afero.NewMemMapFs()
+
+	cmd.SetArgs([]string{"a.cbor", "b.cbor"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "error loading CoMID from a.cbor: open a.cbor: file does not exist")
+}
+
+func Test_ComidDiffCmd_invalid_comid(t *testing.T) {
+	cmd := NewComidDiffCmd()
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "a.cbor", PSARefValCBOR, 0400))
+	require.NoError(t, afero.WriteFile(fs, "b.cbor", []byte{0xff, 0xff}, 0400))
+
+	cmd.SetArgs([]string{"a.cbor", "b.cbor"})
+
+	err := cmd.Execute()
+	assert.ErrorContains(t, err, "error decoding CoMID from b.cbor: ")
+}
+
+func Test_ComidDiffCmd_ok(t *testing.T) {
+	cmd := NewComidDiffCmd()
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "a.cbor", PSARefValCBOR, 0400))
+	require.NoError(t, afero.WriteFile(fs, "b.cbor", PSARefValCBOR, 0400))
+
+	cmd.SetArgs([]string{"a.cbor", "b.cbor"})
+
+	err := cmd.Execute()
+	assert.NoError(t, err)
+}
+
+func Test_diffComids_ignores_order(t *testing.T) {
+	a := lintTestComid(t)
+	b := lintTestComid(t)
+
+	ms := b.Triples.ReferenceValues.Values[0].Measurements.Values
+	ms[0], ms[2] = ms[2], ms[0]
+
+	d, err := diffComids(a, b)
+	require.NoError(t, err)
+	assert.True(t, d.empty())
+}
+
+func Test_diffComids_measurements(t *testing.T) {
+	a := lintTestComid(t)
+	b := lintTestComid(t)
+
+	b.TagIdentity.TagVersion = 2
+
+	vt := &b.Triples.ReferenceValues.Values[0]
+	vt.Measurements.Values[0].Val.Digests = &comid.Digests{
+		swid.HashEntry{HashAlgID: swid.Sha256, HashValue: make([]byte, 32)},
+	}
+	// drop the last measurement
+	vt.Measurements.Values = vt.Measurements.Values[:2]
+
+	d, err := diffComids(a, b)
+	require.NoError(t, err)
+
+	assert.Equal(t,
+		[]diffChange{{Op: diffChanged, Field: "tag-identity.version", From: "0", To: "2"}},
+		d.Header,
+	)
+
+	require.Len(t, d.Measurements, 2)
+
+	assert.Equal(t, diffChanged, d.Measurements[0].Op)
+	assert.Contains(t, string(d.Measurements[0].Key), `"label":"BL"`)
+	assert.Equal(t, []diffChange{
+		{Op: diffRemoved, Field: "digests", From: "sha-256;h0KPxSKAPTEGXnvOPPA/5HUJZjHl4Hu9eg/eYMTPJcc="},
+		{Op: diffAdded, Field: "digests", To: "sha-256;AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+	}, d.Measurements[0].Changes)
+
+	assert.Equal(t, diffRemoved, d.Measurements[1].Op)
+	assert.Contains(t, string(d.Measurements[1].Key), `"label":"ARoT"`)
+	assert.JSONEq(t,
+		`{"digests":["sha-256;o6XnFfDMV0pzw/m+u2vCTzL/1bZ7OHJEwskJ2neaFHg="]}`,
+		string(d.Measurements[1].From),
+	)
+
+	var out bytes.Buffer
+	writeComidDiff(&out, d, "")
+	assert.Contains(t, out.String(), "~ tag-identity.version: 0 -> 2\n")
+	assert.Contains(t, out.String(), "      + digests: sha-256;AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n")
+}
+
+func Test_diffComids_keys(t *testing.T) {
+	loadIakpub := func(file string) *comid.Comid {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+
+		var c comid.Comid
+		require.NoError(t, c.FromCBOR(data))
+
+		return &c
+	}
+
+	a := loadIakpub("../data/comid/comid-psa-iakpub.cbor")
+	b := loadIakpub("../data/comid/comid-psa-integ-iakpub.cbor")
+
+	d, err := diffComids(a, b)
+	require.NoError(t, err)
+
+	require.Len(t, d.Keys, 2)
+	assert.Equal(t, "dev-identity-keys", d.Keys[0].Triples)
+	assert.Equal(t, diffRemoved, d.Keys[0].Op)
+	assert.Equal(t, diffAdded, d.Keys[1].Op)
+
+	var out bytes.Buffer
+	writeComidDiff(&out, d, "")
+	assert.Contains(t, out.String(), "  - key pkix-base64-key MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEFn0t...\n")
+}
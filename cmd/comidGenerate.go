@@ -0,0 +1,204 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/comid"
+)
+
+// comidGenerateFlags holds the environment, tag identity and output flags
+// that are common to the comid generate sub-commands.  Each sub-command has
+// its own, so that it keeps its own defaults
+type comidGenerateFlags struct {
+	ClassIDType string
+	ClassID     string
+	Vendor      string
+	Model       string
+	TagID       string
+	TagVersion  uint
+	Lang        string
+	Output      string
+}
+
+var comidGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "generate CBOR-encoded CoMIDs from build artefacts",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Help() // nolint: errcheck
+			os.Exit(0)
+		}
+	},
+}
+
+// register adds the common flags to cmd, with classIDType as the default type
+// of the class ID and output as the default name of the generated CoMID file
+func (o *comidGenerateFlags) register(cmd *cobra.Command, classIDType, output string) {
+	cmd.Flags().StringVar(
+		&o.ClassIDType, "class-id-type", classIDType,
+		"type of the environment class ID (psa.impl-id, uuid, oid, int or bytes)",
+	)
+
+	cmd.Flags().StringVar(
+		&o.ClassID, "class-id", "", "environment class ID",
+	)
+
+	cmd.Flags().StringVar(
+		&o.Vendor, "vendor", "", "environment vendor",
+	)
+
+	cmd.Flags().StringVar(
+		&o.Model, "model", "", "environment model",
+	)
+
+	cmd.Flags().StringVar(
+		&o.TagID, "tag-id", "", "CoMID tag identifier (default: a random UUID)",
+	)
+
+	cmd.Flags().UintVar(
+		&o.TagVersion, "tag-version", 0, "CoMID tag version",
+	)
+
+	cmd.Flags().StringVar(
+		&o.Lang, "lang", "en-GB", "CoMID language tag",
+	)
+
+	cmd.Flags().StringVarP(
+		&o.Output, "output", "o", output, "name of the generated CoMID file",
+	)
+}
+
+// environment returns the environment described by the --class-id, --vendor
+// and --model flags or, if no class ID was given on the command line, the
+// fallback environment (e.g., one found in a manifest) with the vendor and
+// model overridden by the flags, if set
+func (o comidGenerateFlags) environment(fallback *comid.Environment) (*comid.Environment, error) {
+	if o.ClassID == "" {
+		if fallback == nil {
+			return nil, errors.New("no environment supplied (use --class-id or a manifest)")
+		}
+		if fallback.Class != nil {
+			if o.Vendor != "" {
+				fallback.Class.SetVendor(o.Vendor)
+			}
+			if o.Model != "" {
+				fallback.Class.SetModel(o.Model)
+			}
+		}
+		if err := fallback.Valid(); err != nil {
+			return nil, fmt.Errorf("invalid environment: %w", err)
+		}
+		return fallback, nil
+	}
+
+	classID, err := comid.NewClassID(o.ClassID, o.ClassIDType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid class ID: %w", err)
+	}
+
+	class := &comid.Class{ClassID: classID}
+	if o.Vendor != "" {
+		class.SetVendor(o.Vendor)
+	}
+	if o.Model != "" {
+		class.SetModel(o.Model)
+	}
+
+	env := &comid.Environment{Class: class}
+	if err := env.Valid(); err != nil {
+		return nil, fmt.Errorf("invalid environment: %w", err)
+	}
+
+	return env, nil
+}
+
+// newComid returns an empty CoMID with the language and tag version set from
+// the command line and the supplied tag ID (a random UUID if empty)
+func (o comidGenerateFlags) newComid(tagID string) (*comid.Comid, error) {
+	if tagID == "" {
+		tagID = uuid.NewString()
+	}
+
+	c := comid.NewComid()
+	if o.Lang != "" {
+		c.SetLanguage(o.Lang)
+	}
+
+	if c.SetTagIdentity(tagID, o.TagVersion) == nil {
+		return nil, fmt.Errorf("invalid tag identity %q", tagID)
+	}
+
+	return c, nil
+}
+
+// saveGeneratedComid validates the supplied CoMID and writes its CBOR
+// encoding to file
+func saveGeneratedComid(c *comid.Comid, file string) error {
+	if err := c.Valid(); err != nil {
+		return fmt.Errorf("error validating generated CoMID: %w", err)
+	}
+
+	data, err := c.ToCBOR()
+	if err != nil {
+		return fmt.Errorf("error encoding generated CoMID to CBOR: %w", err)
+	}
+
+	if err = afero.WriteFile(fs, file, data, 0644); err != nil {
+		return fmt.Errorf("error saving CBOR file %s: %w", file, err)
+	}
+
+	fmt.Printf(">> created %q\n", file)
+
+	return nil
+}
+
+// cryptoKeyFromPEMOrJWK returns the pkix-base64-key corresponding to the
+// supplied PEM-encoded or JWK public key
+func cryptoKeyFromPEMOrJWK(data []byte) (*comid.CryptoKey, error) {
+	data = bytes.TrimSpace(data)
+
+	if !bytes.HasPrefix(data, []byte("{")) {
+		return comid.NewPKIXBase64Key(string(data))
+	}
+
+	k, err := jwk.ParseKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// private JWKs are accepted too: only their public part is used
+	if k, err = k.PublicKey(); err != nil {
+		return nil, err
+	}
+
+	var pub interface{}
+	if err = k.Raw(&pub); err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	return comid.NewPKIXBase64Key(
+		string(bytes.TrimSpace(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))),
+	)
+}
+
+func init() {
+	comidCmd.AddCommand(comidGenerateCmd)
+}
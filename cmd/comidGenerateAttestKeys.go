@@ -0,0 +1,344 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/comid"
+)
+
+var (
+	comidGenerateAttestKeysFlags      comidGenerateFlags
+	comidGenerateAttestKeysInputs     []string
+	comidGenerateAttestKeysKeyDirs    []string
+	comidGenerateAttestKeysMaxTriples int
+)
+
+// attestKeyRecord is an instance ID and its attestation public key, together
+// with the location (file and line) they were read from
+type attestKeyRecord struct {
+	where      string
+	InstanceID string          `json:"instance-id"`
+	Key        json.RawMessage `json:"key"`
+}
+
+var comidGenerateAttestKeysCmd = NewComidGenerateAttestKeysCmd()
+
+func NewComidGenerateAttestKeysCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "attest-keys",
+		Short: "generate CoMIDs with the attestation keys of a batch of devices",
+		Long: `generate CoMIDs with the attestation keys of a batch of devices
+
+	Each device becomes an attester-verification-keys triple whose environment
+	has the device's instance ID (a UEID, in hex or base64) and, optionally, the
+	class given with any of --class-id, --vendor and --model.  Devices are read
+	from:
+
+	  * CSV files (.csv) with "instance-id,key" records, where the key is a
+	    (quoted) PEM public key or a JWK; a header line is skipped;
+	  * JSON Lines files (.jsonl) with {"instance-id": ..., "key": ...} objects,
+	    where the key is a PEM string or a JWK object;
+	  * directories of PEM files (.pem), each named after the instance ID (in
+	    hex) of the device whose public key it contains.
+
+	Generate iak.cbor with the keys of the devices listed in batch-42.csv:
+
+		cocli comid generate attest-keys --input=batch-42.csv \
+			--class-id=YWNtZS1pbXBsZW1lbnRhdGlvbi1pZC0wMDAwMDAwMDE= \
+			--vendor=ACME --model=RoadRunner \
+			--output=iak.cbor
+
+	Generate iak-1.cbor, iak-2.cbor, ... with at most 500 keys each, from the
+	PEM files in the keys/ directory:
+
+		cocli comid generate attest-keys --key-dir=keys \
+			--max-triples=500 --output=iak.cbor
+	`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkComidGenerateAttestKeysArgs(); err != nil {
+				return err
+			}
+
+			records, err := loadAttestKeyRecords(comidGenerateAttestKeysInputs, comidGenerateAttestKeysKeyDirs)
+			if err != nil {
+				return err
+			}
+
+			if len(records) == 0 {
+				return errors.New("no attestation keys found")
+			}
+
+			comids, err := generateAttestKeysComids(records, comidGenerateAttestKeysMaxTriples)
+			if err != nil {
+				return err
+			}
+
+			for i, c := range comids {
+				if err = saveGeneratedComid(c, attestKeysOutputFile(i, len(comids))); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(
+		&comidGenerateAttestKeysInputs, "input", "i", []string{},
+		"a CSV (.csv) or JSON Lines (.jsonl) file of instance IDs and public keys",
+	)
+
+	cmd.Flags().StringArrayVarP(
+		&comidGenerateAttestKeysKeyDirs, "key-dir", "K", []string{},
+		"a directory of PEM public keys named after their instance ID",
+	)
+
+	cmd.Flags().IntVar(
+		&comidGenerateAttestKeysMaxTriples, "max-triples", 1000,
+		"maximum number of attester-verification-keys triples per CoMID",
+	)
+
+	comidGenerateAttestKeysFlags.register(cmd, comid.ImplIDType, "attest-keys.cbor")
+
+	return cmd
+}
+
+func checkComidGenerateAttestKeysArgs() error {
+	if len(comidGenerateAttestKeysInputs) == 0 && len(comidGenerateAttestKeysKeyDirs) == 0 {
+		return errors.New("no inputs or key directories supplied")
+	}
+
+	for _, input := range comidGenerateAttestKeysInputs {
+		switch filepath.Ext(input) {
+		case ".csv", ".jsonl":
+		default:
+			return fmt.Errorf("unsupported input %s (want a .csv or .jsonl file)", input)
+		}
+	}
+
+	if comidGenerateAttestKeysMaxTriples <= 0 {
+		return fmt.Errorf("invalid --max-triples %d (want a positive number)", comidGenerateAttestKeysMaxTriples)
+	}
+
+	return nil
+}
+
+func loadAttestKeyRecords(inputs, keyDirs []string) ([]attestKeyRecord, error) {
+	var records []attestKeyRecord
+
+	for _, input := range inputs {
+		data, err := afero.ReadFile(fs, input)
+		if err != nil {
+			return nil, fmt.Errorf("error loading %s: %w", input, err)
+		}
+
+		var r []attestKeyRecord
+		if filepath.Ext(input) == ".csv" {
+			r, err = parseAttestKeysCSV(input, data)
+		} else {
+			r, err = parseAttestKeysJSONL(input, data)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, r...)
+	}
+
+	for _, file := range filesList(nil, keyDirs, ".pem") {
+		data, err := afero.ReadFile(fs, file)
+		if err != nil {
+			return nil, fmt.Errorf("error loading %s: %w", file, err)
+		}
+
+		key, _ := json.Marshal(string(data))
+
+		records = append(records, attestKeyRecord{
+			where:      file,
+			InstanceID: strings.TrimSuffix(filepath.Base(file), ".pem"),
+			Key:        key,
+		})
+	}
+
+	return records, nil
+}
+
+func parseAttestKeysCSV(file string, data []byte) ([]attestKeyRecord, error) {
+	var records []attestKeyRecord
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+
+	for {
+		fields, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s: %w", file, err)
+		}
+
+		line, _ := r.FieldPos(0)
+
+		if len(records) == 0 && line == 1 && fields[0] == "instance-id" {
+			continue
+		}
+
+		key, _ := json.Marshal(fields[1])
+
+		records = append(records, attestKeyRecord{
+			where:      fmt.Sprintf("%s:%d", file, line),
+			InstanceID: fields[0],
+			Key:        key,
+		})
+	}
+
+	return records, nil
+}
+
+func parseAttestKeysJSONL(file string, data []byte) ([]attestKeyRecord, error) {
+	var records []attestKeyRecord
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(nil, 1024*1024)
+
+	for line := 1; s.Scan(); line++ {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+
+		r := attestKeyRecord{where: fmt.Sprintf("%s:%d", file, line)}
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("error decoding %s: %w", r.where, err)
+		}
+
+		records = append(records, r)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("error decoding %s: %w", file, err)
+	}
+
+	return records, nil
+}
+
+// attestKeyTriple returns the attester-verification-keys triple for the
+// supplied record, with class as the class of its environment
+func attestKeyTriple(r attestKeyRecord, class *comid.Class) (*comid.KeyTriple, error) {
+	instID, err := decodeHexOrBase64(r.InstanceID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid instance ID: %w", err)
+	}
+
+	inst, err := comid.NewUEIDInstance(instID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid instance ID: %w", err)
+	}
+
+	// the key is either a JSON string (PEM or stringified JWK) or a JWK object
+	keyData := []byte(r.Key)
+
+	var s string
+	if json.Unmarshal(r.Key, &s) == nil {
+		keyData = []byte(s)
+	}
+
+	key, err := cryptoKeyFromPEMOrJWK(keyData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+
+	return &comid.KeyTriple{
+		Environment: comid.Environment{Class: class, Instance: inst},
+		VerifKeys:   comid.CryptoKeys{key},
+	}, nil
+}
+
+// generateAttestKeysComids returns the CoMIDs with the attestation keys of
+// the supplied records, each with at most maxTriples triples
+func generateAttestKeysComids(records []attestKeyRecord, maxTriples int) ([]*comid.Comid, error) {
+	var (
+		class *comid.Class
+		o     = comidGenerateAttestKeysFlags
+	)
+
+	if o.ClassID != "" || o.Vendor != "" || o.Model != "" {
+		env, err := o.environment(&comid.Environment{Class: &comid.Class{}})
+		if err != nil {
+			return nil, err
+		}
+		class = env.Class
+	}
+
+	var (
+		comids []*comid.Comid
+		seen   = map[string]string{}
+		n      = (len(records) + maxTriples - 1) / maxTriples
+	)
+
+	for i, r := range records {
+		if i%maxTriples == 0 {
+			tagID := comidGenerateAttestKeysFlags.TagID
+			if tagID != "" && n > 1 {
+				tagID = fmt.Sprintf("%s-%d", tagID, len(comids)+1)
+			}
+
+			c, err := comidGenerateAttestKeysFlags.newComid(tagID)
+			if err != nil {
+				return nil, err
+			}
+			comids = append(comids, c)
+		}
+
+		kt, err := attestKeyTriple(r, class)
+		if err != nil {
+			return nil, fmt.Errorf("error in %s: %w", r.where, err)
+		}
+
+		instID := kt.Environment.Instance.String()
+		if prev, ok := seen[instID]; ok {
+			return nil, fmt.Errorf("error in %s: duplicate instance ID (also in %s)", r.where, prev)
+		}
+		seen[instID] = r.where
+
+		if comids[len(comids)-1].AddAttestVerifKey(*kt) == nil {
+			return nil, fmt.Errorf("error in %s: invalid attestation key triple", r.where)
+		}
+	}
+
+	return comids, nil
+}
+
+// attestKeysOutputFile returns the name of the i-th of n generated CoMIDs,
+// i.e., the --output file name if there is only one, or the --output file
+// name suffixed with "-<i+1>" otherwise
+func attestKeysOutputFile(i, n int) string {
+	output := comidGenerateAttestKeysFlags.Output
+	if n == 1 {
+		return output
+	}
+
+	ext := filepath.Ext(output)
+
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(output, ext), i+1, ext)
+}
+
+func init() {
+	comidGenerateCmd.AddCommand(comidGenerateAttestKeysCmd)
+}
@@ -0,0 +1,188 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resetComidGenerateAttestKeysFlags() {
+	comidGenerateAttestKeysFlags = defaultComidGenerateFlags("attest-keys.cbor")
+	comidGenerateAttestKeysInputs, comidGenerateAttestKeysKeyDirs = nil, nil
+	comidGenerateAttestKeysMaxTriples = 1000
+}
+
+func testPublicKeyPEM(t *testing.T) (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func testPublicKeyJWK(key *ecdsa.PrivateKey) string {
+	return fmt.Sprintf(`{"kty":"EC","crv":"P-256","x":%q,"y":%q}`,
+		base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	)
+}
+
+// testUEID returns the hex encoding of a 33 bytes random UEID
+func testUEID(n byte) string {
+	ueid := make([]byte, 33)
+	ueid[0], ueid[32] = 0x01, n
+	return hex.EncodeToString(ueid)
+}
+
+func Test_ComidGenerateAttestKeysCmd_bad_args(t *testing.T) {
+	resetComidGenerateAttestKeysFlags()
+	cmd := NewComidGenerateAttestKeysCmd()
+	cmd.SetArgs([]string{})
+	assert.EqualError(t, cmd.Execute(), "no inputs or key directories supplied")
+
+	resetComidGenerateAttestKeysFlags()
+	cmd = NewComidGenerateAttestKeysCmd()
+	cmd.SetArgs([]string{"--input=keys.txt"})
+	assert.EqualError(t, cmd.Execute(), "unsupported input keys.txt (want a .csv or .jsonl file)")
+
+	resetComidGenerateAttestKeysFlags()
+	cmd = NewComidGenerateAttestKeysCmd()
+	cmd.SetArgs([]string{"--input=keys.csv", "--max-triples=0"})
+	assert.EqualError(t, cmd.Execute(), "invalid --max-triples 0 (want a positive number)")
+}
+
+func Test_ComidGenerateAttestKeysCmd_csv_and_jsonl(t *testing.T) {
+	resetComidGenerateAttestKeysFlags()
+
+	_, pem1 := testPublicKeyPEM(t)
+	key2, _ := testPublicKeyPEM(t)
+	_, pem3 := testPublicKeyPEM(t)
+
+	csvData := fmt.Sprintf("instance-id,key\n%s,\"%s\"\n", testUEID(1), pem1)
+
+	jwk, err := json.Marshal(json.RawMessage(testPublicKeyJWK(key2)))
+	require.NoError(t, err)
+	pem3JSON, err := json.Marshal(pem3)
+	require.NoError(t, err)
+	jsonlData := fmt.Sprintf(
+		"{\"instance-id\": %q, \"key\": %s}\n\n{\"instance-id\": %q, \"key\": %s}\n",
+		testUEID(2), jwk, testUEID(3), pem3JSON,
+	)
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "batch.csv", []byte(csvData), 0400))
+	require.NoError(t, afero.WriteFile(fs, "batch.jsonl", []byte(jsonlData), 0400))
+
+	cmd := NewComidGenerateAttestKeysCmd()
+	cmd.SetArgs([]string{
+		"--input=batch.csv", "--input=batch.jsonl",
+		"--class-id=YWNtZS1pbXBsZW1lbnRhdGlvbi1pZC0wMDAwMDAwMDE=", "--model=RoadRunner",
+		"--max-triples=2", "--tag-id=batch", "--output=iak.cbor",
+	})
+	require.NoError(t, cmd.Execute())
+
+	c1 := loadGeneratedComid(t, "iak-1.cbor")
+	assert.Equal(t, "batch-1", c1.TagIdentity.TagID.String())
+	require.Len(t, *c1.Triples.AttestVerifKeys, 2)
+
+	kt := (*c1.Triples.AttestVerifKeys)[1]
+	assert.Equal(t, "RoadRunner", *kt.Environment.Class.Model)
+
+	pub, err := kt.VerifKeys[0].PublicKey()
+	require.NoError(t, err)
+	assert.True(t, key2.PublicKey.Equal(pub))
+
+	c2 := loadGeneratedComid(t, "iak-2.cbor")
+	assert.Equal(t, "batch-2", c2.TagIdentity.TagID.String())
+	require.Len(t, *c2.Triples.AttestVerifKeys, 1)
+	assert.Equal(t, mustHexDecode(testUEID(3)), (*c2.Triples.AttestVerifKeys)[0].Environment.Instance.Bytes())
+}
+
+func Test_ComidGenerateAttestKeysCmd_key_dir(t *testing.T) {
+	resetComidGenerateAttestKeysFlags()
+
+	_, pem1 := testPublicKeyPEM(t)
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "keys/"+testUEID(1)+".pem", []byte(pem1), 0400))
+
+	cmd := NewComidGenerateAttestKeysCmd()
+	cmd.SetArgs([]string{"--key-dir=keys"})
+	require.NoError(t, cmd.Execute())
+
+	c := loadGeneratedComid(t, "attest-keys.cbor")
+	require.Len(t, *c.Triples.AttestVerifKeys, 1)
+
+	kt := (*c.Triples.AttestVerifKeys)[0]
+	assert.Nil(t, kt.Environment.Class)
+	assert.Equal(t, mustHexDecode(testUEID(1)), kt.Environment.Instance.Bytes())
+}
+
+func Test_ComidGenerateAttestKeysCmd_vendor_and_model(t *testing.T) {
+	resetComidGenerateAttestKeysFlags()
+
+	_, pem1 := testPublicKeyPEM(t)
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "keys/"+testUEID(1)+".pem", []byte(pem1), 0400))
+
+	cmd := NewComidGenerateAttestKeysCmd()
+	cmd.SetArgs([]string{"--key-dir=keys", "--vendor=ACME", "--model=RoadRunner"})
+	require.NoError(t, cmd.Execute())
+
+	c := loadGeneratedComid(t, "attest-keys.cbor")
+	require.Len(t, *c.Triples.AttestVerifKeys, 1)
+
+	class := (*c.Triples.AttestVerifKeys)[0].Environment.Class
+	require.NotNil(t, class)
+	assert.Nil(t, class.ClassID)
+	assert.Equal(t, "ACME", *class.Vendor)
+	assert.Equal(t, "RoadRunner", *class.Model)
+}
+
+func Test_generateAttestKeysComids_errors(t *testing.T) {
+	resetComidGenerateAttestKeysFlags()
+
+	_, pem1 := testPublicKeyPEM(t)
+	key, _ := json.Marshal(pem1)
+
+	_, err := generateAttestKeysComids([]attestKeyRecord{
+		{where: "a.csv:1", InstanceID: testUEID(1), Key: key},
+		{where: "b.csv:2", InstanceID: testUEID(1), Key: key},
+	}, 10)
+	assert.EqualError(t, err, "error in b.csv:2: duplicate instance ID (also in a.csv:1)")
+
+	_, err = generateAttestKeysComids([]attestKeyRecord{
+		{where: "a.csv:1", InstanceID: testUEID(1), Key: json.RawMessage(`"not a key"`)},
+	}, 10)
+	assert.ErrorContains(t, err, "error in a.csv:1: invalid key: ")
+
+	_, err = generateAttestKeysComids([]attestKeyRecord{
+		{where: "a.csv:1", InstanceID: "xyz!", Key: key},
+	}, 10)
+	assert.EqualError(t, err, `error in a.csv:1: invalid instance ID: "xyz!" is neither hex nor base64`)
+}
+
+func mustHexDecode(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
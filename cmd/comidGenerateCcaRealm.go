@@ -0,0 +1,255 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/swid"
+)
+
+// realmRPVSize is the size of the realm personalization value
+const realmRPVSize = 64
+
+var (
+	comidGenerateCcaRealmFlags             comidGenerateFlags
+	comidGenerateCcaRealmRIM               string
+	comidGenerateCcaRealmREMs              []string
+	comidGenerateCcaRealmRPV               string
+	comidGenerateCcaRealmHashAlg           string
+	comidGenerateCcaRealmLaunchDescription string
+)
+
+var comidGenerateCcaRealmCmd = NewComidGenerateCcaRealmCmd()
+
+func NewComidGenerateCcaRealmCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cca-realm",
+		Short: "generate a CCA realm CoMID from the realm's RIM, REMs and personalization value",
+		Long: `generate a CCA realm CoMID from the realm's RIM, REMs and personalization value
+
+	The realm is identified by its class UUID and its realm initial measurement
+	(RIM), which is used as the environment instance.  The RIM and the realm
+	extensible measurements (REMs, at most four, given in order rem0..rem3) are
+	recorded as integrity registers, and the realm personalization value (RPV),
+	if any, as raw-value.  The generated CoMID follows the CCA realm profile and
+	is ready to be bundled with the corim-cca-realm.json template.
+
+	Generate cca-realm.cbor for a realm measured with SHA-256:
+
+		cocli comid generate cca-realm \
+			--class-id=cd1f0e55-26f9-460d-b9d8-f7fde171787c \
+			--vendor="Workload Client Ltd" \
+			--hash-alg=sha-256 \
+			--rim=<hex or base64> \
+			--rem=<hex or base64> --rem=<hex or base64> \
+			--rpv=<hex or base64>
+
+	Instead of --rim, the RIM can be computed from a realm launch description
+	listing the realm parameters and the measured RMI commands (RIPAS_INIT,
+	DATA_CREATE and REC_CREATE) in the order the host issues them, following
+	the measurement descriptors of the RMM specification:
+
+		cocli comid generate cca-realm \
+			--class-id=cd1f0e55-26f9-460d-b9d8-f7fde171787c \
+			--launch-description=realm.json --output=realm.cbor
+
+	where realm.json looks like:
+
+		{
+		  "realm": { "s2sz": 40, "flags": 0 },
+		  "steps": [
+		    { "ripas": { "base": "0x80000000", "top": "0x90000000" } },
+		    { "data": { "file": "Image", "ipa": "0x80000000" } },
+		    { "data": { "file": "initrd", "ipa": "0x88000000", "unmeasured": true } },
+		    { "rec": { "pc": "0x80000000", "gprs": [ "0x87f00000" ], "runnable": true } }
+		  ]
+		}
+
+	Integers may be given as JSON numbers or as strings; file paths are
+	relative to the directory containing the launch description.
+	`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkComidGenerateCcaRealmArgs(); err != nil {
+				return err
+			}
+
+			rim, err := ccaRealmRIM()
+			if err != nil {
+				return err
+			}
+
+			env, err := comidGenerateCcaRealmFlags.environment(nil)
+			if err != nil {
+				return err
+			}
+
+			c, err := ccaRealmComid(env, rim)
+			if err != nil {
+				return err
+			}
+
+			return saveGeneratedComid(c, comidGenerateCcaRealmFlags.Output)
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&comidGenerateCcaRealmRIM, "rim", "", "the realm initial measurement (hex or base64)",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&comidGenerateCcaRealmREMs, "rem", []string{},
+		"a realm extensible measurement (hex or base64), repeat for rem0..rem3",
+	)
+
+	cmd.Flags().StringVar(
+		&comidGenerateCcaRealmRPV, "rpv", "", "the 64 bytes realm personalization value (hex or base64)",
+	)
+
+	cmd.Flags().StringVar(
+		&comidGenerateCcaRealmHashAlg, "hash-alg", "sha-256",
+		"hash algorithm of the realm measurements (sha-256 or sha-512)",
+	)
+
+	cmd.Flags().StringVarP(
+		&comidGenerateCcaRealmLaunchDescription, "launch-description", "l", "",
+		"a JSON realm launch description to compute the RIM from",
+	)
+
+	// the CCA realm profile mandates a UUID class ID
+	comidGenerateCcaRealmFlags.register(cmd, comid.UUIDType, "cca-realm.cbor")
+
+	return cmd
+}
+
+func checkComidGenerateCcaRealmArgs() error {
+	if comidGenerateCcaRealmRIM == "" && comidGenerateCcaRealmLaunchDescription == "" {
+		return errors.New("no RIM or realm launch description supplied")
+	}
+
+	if comidGenerateCcaRealmRIM != "" && comidGenerateCcaRealmLaunchDescription != "" {
+		return errors.New("only one of --rim and --launch-description can be supplied")
+	}
+
+	if len(comidGenerateCcaRealmREMs) > 4 {
+		return fmt.Errorf("%d REMs supplied, want at most 4", len(comidGenerateCcaRealmREMs))
+	}
+
+	// the RMM only measures realms with the algorithms it supports
+	if _, ok := realmHashAlgs[comidGenerateCcaRealmHashAlg]; !ok {
+		return fmt.Errorf(
+			"unsupported hash algorithm %q (want sha-256 or sha-512)",
+			comidGenerateCcaRealmHashAlg,
+		)
+	}
+
+	return nil
+}
+
+// ccaRealmRIM returns the RIM supplied on the command line or computed from
+// the realm launch description
+func ccaRealmRIM() ([]byte, error) {
+	if comidGenerateCcaRealmRIM != "" {
+		return ccaRealmDigest("rim", comidGenerateCcaRealmRIM)
+	}
+
+	d, err := loadRealmLaunchDescription(comidGenerateCcaRealmLaunchDescription)
+	if err != nil {
+		return nil, err
+	}
+
+	rim, err := d.computeRIM(comidGenerateCcaRealmHashAlg)
+	if err != nil {
+		return nil, fmt.Errorf("error computing RIM from %s: %w", comidGenerateCcaRealmLaunchDescription, err)
+	}
+
+	return rim, nil
+}
+
+// ccaRealmDigest decodes the value of the named register and checks that its
+// size matches the hash algorithm
+func ccaRealmDigest(name, s string) ([]byte, error) {
+	digest, err := decodeHexOrBase64(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+
+	if want := refvalDigestAlgs[comidGenerateCcaRealmHashAlg].new().Size(); len(digest) != want {
+		return nil, fmt.Errorf(
+			"%s is %d bytes, want %d for %s", name, len(digest), want, comidGenerateCcaRealmHashAlg,
+		)
+	}
+
+	return digest, nil
+}
+
+// ccaRealmComid returns a CoMID with a single reference-values triple for the
+// realm, whose instance is the RIM
+func ccaRealmComid(env *comid.Environment, rim []byte) (*comid.Comid, error) {
+	inst, err := comid.NewBytesInstance(rim)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RIM instance: %w", err)
+	}
+	env.Instance = inst
+
+	algID := refvalDigestAlgs[comidGenerateCcaRealmHashAlg].id
+
+	regs := comid.NewIntegrityRegisters()
+	if err := regs.AddDigest("rim", swid.HashEntry{HashAlgID: algID, HashValue: rim}); err != nil {
+		return nil, err
+	}
+
+	for i, s := range comidGenerateCcaRealmREMs {
+		name := fmt.Sprintf("rem%d", i)
+
+		rem, err := ccaRealmDigest(name, s)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := regs.AddDigest(name, swid.HashEntry{HashAlgID: algID, HashValue: rem}); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &comid.Measurement{}
+	m.Val.IntegrityRegisters = regs
+
+	if comidGenerateCcaRealmRPV != "" {
+		rpv, err := decodeHexOrBase64(comidGenerateCcaRealmRPV)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rpv: %w", err)
+		}
+
+		if len(rpv) != realmRPVSize {
+			return nil, fmt.Errorf("rpv is %d bytes, want %d", len(rpv), realmRPVSize)
+		}
+
+		m.SetRawValueBytes(rpv, nil)
+	}
+
+	c, err := comidGenerateCcaRealmFlags.newComid(comidGenerateCcaRealmFlags.TagID)
+	if err != nil {
+		return nil, err
+	}
+
+	vt := comid.ValueTriple{Environment: *env, Measurements: *comid.NewMeasurements().Add(m)}
+	if c.AddReferenceValue(vt) == nil {
+		return nil, errors.New("error adding reference values to the CoMID")
+	}
+
+	if problems := checkCCARealmComid(c, nil); len(problems) != 0 {
+		return nil, fmt.Errorf("cca-realm profile violation(s): %s", strings.Join(problems, "; "))
+	}
+
+	return c, nil
+}
+
+func init() {
+	comidGenerateCmd.AddCommand(comidGenerateCcaRealmCmd)
+}
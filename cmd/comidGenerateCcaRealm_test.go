@@ -0,0 +1,165 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/swid"
+)
+
+const testRealmClassID = "cd1f0e55-26f9-460d-b9d8-f7fde171787c"
+
+var (
+	testRealmRIM  = bytes.Repeat([]byte{0x01}, 32)
+	testRealmREM0 = bytes.Repeat([]byte{0x02}, 32)
+	testRealmRPV  = bytes.Repeat([]byte{0x03}, 64)
+)
+
+func resetComidGenerateCcaRealmFlags() {
+	comidGenerateCcaRealmFlags = defaultComidGenerateFlags("cca-realm.cbor")
+	comidGenerateCcaRealmFlags.ClassIDType = comid.UUIDType
+	comidGenerateCcaRealmRIM, comidGenerateCcaRealmREMs, comidGenerateCcaRealmRPV = "", nil, ""
+	comidGenerateCcaRealmHashAlg, comidGenerateCcaRealmLaunchDescription = "sha-256", ""
+}
+
+func Test_ComidGenerateCcaRealmCmd_no_rim(t *testing.T) {
+	resetComidGenerateCcaRealmFlags()
+	cmd := NewComidGenerateCcaRealmCmd()
+
+	cmd.SetArgs([]string{"--class-id=" + testRealmClassID})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no RIM or realm launch description supplied")
+}
+
+func Test_ComidGenerateCcaRealmCmd_rim_and_launch_description(t *testing.T) {
+	resetComidGenerateCcaRealmFlags()
+	cmd := NewComidGenerateCcaRealmCmd()
+
+	cmd.SetArgs([]string{"--rim=" + hex.EncodeToString(testRealmRIM), "--launch-description=realm.json"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "only one of --rim and --launch-description can be supplied")
+}
+
+func Test_ComidGenerateCcaRealmCmd_unsupported_hash_alg(t *testing.T) {
+	resetComidGenerateCcaRealmFlags()
+	cmd := NewComidGenerateCcaRealmCmd()
+
+	cmd.SetArgs([]string{"--rim=" + hex.EncodeToString(testRealmRIM), "--hash-alg=sha-384"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, `unsupported hash algorithm "sha-384" (want sha-256 or sha-512)`)
+}
+
+func Test_ComidGenerateCcaRealmCmd_bad_sizes(t *testing.T) {
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{
+			[]string{"--rim=" + hex.EncodeToString(testRealmRIM), "--hash-alg=sha-512"},
+			"rim is 32 bytes, want 64 for sha-512",
+		},
+		{
+			[]string{"--rim=" + hex.EncodeToString(testRealmRIM), "--rem=0102"},
+			"rem0 is 2 bytes, want 32 for sha-256",
+		},
+		{
+			[]string{"--rim=" + hex.EncodeToString(testRealmRIM), "--rpv=0102"},
+			"rpv is 2 bytes, want 64",
+		},
+	} {
+		resetComidGenerateCcaRealmFlags()
+		fs = afero.NewMemMapFs()
+
+		cmd := NewComidGenerateCcaRealmCmd()
+		cmd.SetArgs(append(tc.args, "--class-id="+testRealmClassID))
+
+		err := cmd.Execute()
+		assert.EqualError(t, err, tc.expected)
+	}
+}
+
+func Test_ComidGenerateCcaRealmCmd_not_uuid(t *testing.T) {
+	resetComidGenerateCcaRealmFlags()
+	fs = afero.NewMemMapFs()
+
+	cmd := NewComidGenerateCcaRealmCmd()
+	cmd.SetArgs([]string{
+		"--rim=" + hex.EncodeToString(testRealmRIM),
+		"--class-id=YWNtZS1pbXBsZW1lbnRhdGlvbi1pZC0wMDAwMDAwMDE=", "--class-id-type=psa.impl-id",
+	})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err,
+		"cca-realm profile violation(s): reference-values[0]: environment class id must be a uuid")
+}
+
+func Test_ComidGenerateCcaRealmCmd_ok(t *testing.T) {
+	resetComidGenerateCcaRealmFlags()
+	fs = afero.NewMemMapFs()
+
+	cmd := NewComidGenerateCcaRealmCmd()
+	cmd.SetArgs([]string{
+		"--class-id=" + testRealmClassID, "--vendor=Workload Client Ltd",
+		"--rim=" + hex.EncodeToString(testRealmRIM),
+		"--rem=" + hex.EncodeToString(testRealmREM0),
+		"--rpv=" + hex.EncodeToString(testRealmRPV),
+	})
+	require.NoError(t, cmd.Execute())
+
+	c := loadGeneratedComid(t, "cca-realm.cbor")
+	require.Len(t, c.Triples.ReferenceValues.Values, 1)
+
+	rv := c.Triples.ReferenceValues.Values[0]
+	assert.Equal(t, comid.UUIDType, rv.Environment.Class.ClassID.Type())
+	assert.Equal(t, testRealmRIM, rv.Environment.Instance.Bytes())
+
+	m := rv.Measurements.Values[0]
+	assert.Equal(t,
+		comid.Digests{swid.HashEntry{HashAlgID: swid.Sha256, HashValue: testRealmRIM}},
+		m.Val.IntegrityRegisters.IndexMap["rim"],
+	)
+	assert.Equal(t,
+		comid.Digests{swid.HashEntry{HashAlgID: swid.Sha256, HashValue: testRealmREM0}},
+		m.Val.IntegrityRegisters.IndexMap["rem0"],
+	)
+	assert.NotContains(t, m.Val.IntegrityRegisters.IndexMap, "rem1")
+
+	rpv, err := m.Val.RawValue.GetBytes()
+	require.NoError(t, err)
+	assert.Equal(t, testRealmRPV, rpv)
+}
+
+func Test_ComidGenerateCcaRealmCmd_launch_description(t *testing.T) {
+	resetComidGenerateCcaRealmFlags()
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "realm.json", []byte(`{
+		"realm": { "s2sz": 40 },
+		"steps": [ { "ripas": { "base": "0x80000000", "top": "0x90000000" } } ]
+	}`), 0400))
+
+	cmd := NewComidGenerateCcaRealmCmd()
+	cmd.SetArgs([]string{
+		"--class-id=" + testRealmClassID, "--launch-description=realm.json",
+		"--hash-alg=sha-512", "--output=realm.cbor",
+	})
+	require.NoError(t, cmd.Execute())
+
+	d, err := loadRealmLaunchDescription("realm.json")
+	require.NoError(t, err)
+	rim, err := d.computeRIM("sha-512")
+	require.NoError(t, err)
+
+	c := loadGeneratedComid(t, "realm.cbor")
+	assert.Equal(t, rim, c.Triples.ReferenceValues.Values[0].Environment.Instance.Bytes())
+}
@@ -0,0 +1,401 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/google/uuid"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/swid"
+)
+
+var (
+	comidGenerateDiceFlags    comidGenerateFlags
+	comidGenerateDiceChains   []string
+	comidGenerateDiceEndorsed bool
+)
+
+// TCG DICE certificate extensions
+var (
+	oidDiceTcbInfo      = asn1.ObjectIdentifier{2, 23, 133, 5, 4, 1}
+	oidDiceMultiTcbInfo = asn1.ObjectIdentifier{2, 23, 133, 5, 4, 5}
+)
+
+// diceHashAlgs maps the OIDs of the FWID hash algorithms onto their named
+// information hash algorithm IDs
+var diceHashAlgs = map[string]uint64{
+	"2.16.840.1.101.3.4.2.1":  swid.Sha256,
+	"2.16.840.1.101.3.4.2.2":  swid.Sha384,
+	"2.16.840.1.101.3.4.2.3":  swid.Sha512,
+	"2.16.840.1.101.3.4.2.8":  swid.Sha3_256,
+	"2.16.840.1.101.3.4.2.9":  swid.Sha3_384,
+	"2.16.840.1.101.3.4.2.10": swid.Sha3_512,
+}
+
+// diceOperationalFlags maps the bits of the DICE OperationalFlags onto CoMID
+// operational flags.  Most DICE bits are negated (e.g., notSecure), in which
+// case a set bit means that the CoMID flag is false.
+var diceOperationalFlags = []struct {
+	flag    comid.Flag
+	negated bool
+}{
+	{comid.FlagIsConfigured, true},         // notConfigured
+	{comid.FlagIsSecure, true},             // notSecure
+	{comid.FlagIsRecovery, false},          // recovery
+	{comid.FlagIsDebug, false},             // debug
+	{comid.FlagIsReplayProtected, true},    // notReplayProtected
+	{comid.FlagIsIntegrityProtected, true}, // notIntegrityProtected
+	{comid.FlagIsRuntimeMeasured, true},    // notRuntimeMeasured
+	{comid.FlagIsImmutable, true},          // notImmutable
+	{comid.FlagIsTcb, true},                // notTcb
+}
+
+type diceFWID struct {
+	HashAlg asn1.ObjectIdentifier
+	Digest  []byte
+}
+
+// diceTcbInfo is the DiceTcbInfo structure of the TCG DICE Attestation
+// Architecture
+type diceTcbInfo struct {
+	Vendor     string         `asn1:"optional,tag:0,utf8"`
+	Model      string         `asn1:"optional,tag:1,utf8"`
+	Version    string         `asn1:"optional,tag:2,utf8"`
+	SVN        *big.Int       `asn1:"optional,tag:3"`
+	Layer      *big.Int       `asn1:"optional,tag:4"`
+	Index      *big.Int       `asn1:"optional,tag:5"`
+	FWIDs      []diceFWID     `asn1:"optional,tag:6"`
+	Flags      asn1.BitString `asn1:"optional,tag:7"`
+	VendorInfo []byte         `asn1:"optional,tag:8"`
+	Type       []byte         `asn1:"optional,tag:9"`
+	FlagsMask  asn1.BitString `asn1:"optional,tag:10"`
+}
+
+// locatedTcbInfo is a TCB info together with the certificate it was found in
+type locatedTcbInfo struct {
+	where string
+	diceTcbInfo
+}
+
+// locatedCert is a certificate together with the file (and position in the
+// file) it was read from
+type locatedCert struct {
+	where string
+	*x509.Certificate
+}
+
+var comidGenerateDiceCmd = NewComidGenerateDiceCmd()
+
+func NewComidGenerateDiceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dice",
+		Short: "generate a DICE CoMID from the TCB info in a DICE certificate chain",
+		Long: `generate a DICE CoMID from the TCB info in a DICE certificate chain
+
+	The TcbInfo and MultiTcbInfo extensions (TCG DICE OIDs 2.23.133.5.4.1 and
+	2.23.133.5.4.5) of the certificates in the supplied PEM or DER files are
+	turned into one triple per TCB info, in chain order.  The environment class
+	is made of the TCB's vendor, model, layer and index, and the measured values
+	of its version, SVN, FWIDs and operational flags.  Vendor and model flags
+	apply to the TCBs that do not specify them.  The class ID is the --class-id,
+	if given, or else a name-based UUID derived from the vendor and model.
+
+	Generate dice.cbor with reference values from the chain in chain.pem:
+
+		cocli comid generate dice --chain=chain.pem --output=dice.cbor
+
+	Generate endorsements.cbor with endorsed values from the DER certificates
+	of the first two layers:
+
+		cocli comid generate dice --chain=l0.der --chain=l1.der \
+			--endorsed --output=endorsements.cbor
+	`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkComidGenerateDiceArgs(); err != nil {
+				return err
+			}
+
+			certs, err := loadDiceChain(comidGenerateDiceChains)
+			if err != nil {
+				return err
+			}
+
+			tcbs, err := diceTcbInfos(certs)
+			if err != nil {
+				return err
+			}
+
+			if len(tcbs) == 0 {
+				return errors.New("no DICE TCB info found in the certificate chain")
+			}
+
+			c, err := generateDiceComid(tcbs, comidGenerateDiceEndorsed)
+			if err != nil {
+				return err
+			}
+
+			return saveGeneratedComid(c, comidGenerateDiceFlags.Output)
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(
+		&comidGenerateDiceChains, "chain", "c", []string{},
+		"a file with one or more DICE certificates (PEM or DER)",
+	)
+
+	cmd.Flags().BoolVar(
+		&comidGenerateDiceEndorsed, "endorsed", false,
+		"generate endorsed-values instead of reference-values triples",
+	)
+
+	// the DICE profile mandates a UUID or OID class ID
+	comidGenerateDiceFlags.register(cmd, comid.UUIDType, "dice.cbor")
+
+	return cmd
+}
+
+func checkComidGenerateDiceArgs() error {
+	if len(comidGenerateDiceChains) == 0 {
+		return errors.New("no certificate chain supplied")
+	}
+	return nil
+}
+
+// loadDiceChain returns the certificates found in the supplied PEM or DER
+// files, in order
+func loadDiceChain(files []string) ([]locatedCert, error) {
+	var certs []locatedCert
+
+	for _, file := range files {
+		data, err := afero.ReadFile(fs, file)
+		if err != nil {
+			return nil, fmt.Errorf("error loading certificates from %s: %w", file, err)
+		}
+
+		var der []byte
+
+		rest := data
+		for {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+			if block.Type == "CERTIFICATE" {
+				der = append(der, block.Bytes...)
+			}
+		}
+
+		if der == nil {
+			der = data
+		}
+
+		parsed, err := x509.ParseCertificates(der)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding certificates from %s: %w", file, err)
+		}
+
+		for i, cert := range parsed {
+			certs = append(certs, locatedCert{fmt.Sprintf("%s[%d]", file, i), cert})
+		}
+	}
+
+	return certs, nil
+}
+
+// diceTcbInfos returns the TCB infos in the TcbInfo and MultiTcbInfo
+// extensions of the supplied certificates
+func diceTcbInfos(certs []locatedCert) ([]locatedTcbInfo, error) {
+	var tcbs []locatedTcbInfo
+
+	for _, cert := range certs {
+		for _, ext := range cert.Extensions {
+			var (
+				infos []diceTcbInfo
+				rest  []byte
+				err   error
+			)
+
+			switch {
+			case ext.Id.Equal(oidDiceTcbInfo):
+				var info diceTcbInfo
+				rest, err = asn1.Unmarshal(ext.Value, &info)
+				infos = append(infos, info)
+			case ext.Id.Equal(oidDiceMultiTcbInfo):
+				rest, err = asn1.Unmarshal(ext.Value, &infos)
+			default:
+				continue
+			}
+
+			if err == nil && len(rest) != 0 {
+				err = errors.New("trailing data")
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("error decoding %s extension of %s: %w", ext.Id, cert.where, err)
+			}
+
+			for _, info := range infos {
+				tcbs = append(tcbs, locatedTcbInfo{cert.where, info})
+			}
+		}
+	}
+
+	return tcbs, nil
+}
+
+// generateDiceComid returns a CoMID with one reference-values (or
+// endorsed-values) triple per supplied TCB info
+func generateDiceComid(tcbs []locatedTcbInfo, endorsed bool) (*comid.Comid, error) {
+	c, err := comidGenerateDiceFlags.newComid(comidGenerateDiceFlags.TagID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tcb := range tcbs {
+		vt, err := diceValueTriple(tcb.diceTcbInfo)
+		if err != nil {
+			return nil, fmt.Errorf("error in TCB info of %s: %w", tcb.where, err)
+		}
+
+		if endorsed {
+			c = c.AddEndorsedValue(*vt)
+		} else {
+			c = c.AddReferenceValue(*vt)
+		}
+
+		if c == nil {
+			return nil, fmt.Errorf("error in TCB info of %s: invalid triple", tcb.where)
+		}
+	}
+
+	return c, nil
+}
+
+// diceClassID returns the class ID of the TCBs of the supplied vendor and
+// model: a name-based (SHA-1) UUID of vendor and model, so that the same TCB
+// always gets the same class ID, as required by the DICE profile
+func diceClassID(vendor, model string) (*comid.ClassID, error) {
+	if vendor == "" && model == "" {
+		return nil, errors.New("no class ID (use --class-id, or --vendor and --model for TCBs without them)")
+	}
+
+	id := uuid.NewSHA1(uuid.NameSpaceOID, []byte(vendor+"\x00"+model))
+
+	return comid.NewUUIDClassID(id)
+}
+
+func diceValueTriple(info diceTcbInfo) (*comid.ValueTriple, error) {
+	class := &comid.Class{}
+
+	vendor := firstNonEmpty(info.Vendor, comidGenerateDiceFlags.Vendor)
+	model := firstNonEmpty(info.Model, comidGenerateDiceFlags.Model)
+
+	if comidGenerateDiceFlags.ClassID != "" {
+		classID, err := comid.NewClassID(comidGenerateDiceFlags.ClassID, comidGenerateDiceFlags.ClassIDType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid class ID: %w", err)
+		}
+		class.ClassID = classID
+	} else {
+		classID, err := diceClassID(vendor, model)
+		if err != nil {
+			return nil, err
+		}
+		class.ClassID = classID
+	}
+
+	if vendor != "" {
+		class.SetVendor(vendor)
+	}
+
+	if model != "" {
+		class.SetModel(model)
+	}
+
+	if info.Layer != nil {
+		if !info.Layer.IsUint64() {
+			return nil, fmt.Errorf("invalid layer %s", info.Layer)
+		}
+		class.SetLayer(info.Layer.Uint64())
+	}
+
+	if info.Index != nil {
+		if !info.Index.IsUint64() {
+			return nil, fmt.Errorf("invalid index %s", info.Index)
+		}
+		class.SetIndex(info.Index.Uint64())
+	}
+
+	if err := class.Valid(); err != nil {
+		return nil, fmt.Errorf("invalid class: %w", err)
+	}
+
+	m := &comid.Measurement{}
+
+	if info.Version != "" {
+		m.SetVersion(info.Version, swid.VersionSchemeAlphaNumeric)
+	}
+
+	if info.SVN != nil {
+		if !info.SVN.IsUint64() {
+			return nil, fmt.Errorf("invalid SVN %s", info.SVN)
+		}
+		m.SetSVN(info.SVN.Uint64())
+	}
+
+	for i, fwid := range info.FWIDs {
+		alg, ok := diceHashAlgs[fwid.HashAlg.String()]
+		if !ok {
+			return nil, fmt.Errorf("fwids[%d]: unsupported hash algorithm %s", i, fwid.HashAlg)
+		}
+
+		if m.AddDigest(alg, fwid.Digest) == nil {
+			return nil, fmt.Errorf("fwids[%d]: invalid %s digest", i, hashAlgName(alg))
+		}
+	}
+
+	if info.Flags.BitLength > 0 {
+		for i, f := range diceOperationalFlags {
+			if info.FlagsMask.BitLength > 0 && info.FlagsMask.At(i) == 0 {
+				continue
+			}
+
+			if (info.Flags.At(i) == 1) != f.negated {
+				m.SetFlagsTrue(f.flag)
+			} else {
+				m.SetFlagsFalse(f.flag)
+			}
+		}
+	}
+
+	if m.Val.Valid() != nil {
+		return nil, errors.New("no version, SVN, FWIDs or flags to use as measured values")
+	}
+
+	return &comid.ValueTriple{
+		Environment:  comid.Environment{Class: class},
+		Measurements: *comid.NewMeasurements().Add(m),
+	}, nil
+}
+
+func firstNonEmpty(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func init() {
+	comidGenerateCmd.AddCommand(comidGenerateDiceCmd)
+}
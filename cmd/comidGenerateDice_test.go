@@ -0,0 +1,189 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/swid"
+)
+
+var oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+
+func resetComidGenerateDiceFlags() {
+	comidGenerateDiceFlags = defaultComidGenerateFlags("dice.cbor")
+	comidGenerateDiceFlags.ClassIDType = comid.UUIDType
+	comidGenerateDiceChains, comidGenerateDiceEndorsed = nil, false
+}
+
+// testDiceCert returns the DER encoding of a self-signed certificate with the
+// supplied extension
+func testDiceCert(t *testing.T, id asn1.ObjectIdentifier, val interface{}) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	ext, err := asn1.Marshal(val)
+	require.NoError(t, err)
+
+	tmpl := x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: "DICE test"},
+		ExtraExtensions: []pkix.Extension{{Id: id, Value: ext}},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, key.Public(), key)
+	require.NoError(t, err)
+
+	return der
+}
+
+func testDiceTcbInfos() (diceTcbInfo, []diceTcbInfo) {
+	fmc := diceTcbInfo{
+		Vendor: "ACME",
+		Model:  "FMC",
+		SVN:    big.NewInt(10),
+		Layer:  big.NewInt(0),
+		Index:  big.NewInt(0),
+		FWIDs:  []diceFWID{{HashAlg: oidSHA256, Digest: testBLDigest}},
+		// notSecure and debug set, only those two bits are meaningful
+		Flags:     asn1.BitString{Bytes: []byte{0x50}, BitLength: 4},
+		FlagsMask: asn1.BitString{Bytes: []byte{0x50}, BitLength: 4},
+	}
+
+	l1 := []diceTcbInfo{
+		{Model: "L1", Version: "1.2.3", Layer: big.NewInt(1), Index: big.NewInt(0)},
+		{Model: "L1", SVN: big.NewInt(2), Layer: big.NewInt(1), Index: big.NewInt(1)},
+	}
+
+	return fmc, l1
+}
+
+func Test_ComidGenerateDiceCmd_no_chain(t *testing.T) {
+	resetComidGenerateDiceFlags()
+	cmd := NewComidGenerateDiceCmd()
+
+	cmd.SetArgs([]string{"--endorsed"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no certificate chain supplied")
+}
+
+func Test_ComidGenerateDiceCmd_no_tcb_info(t *testing.T) {
+	resetComidGenerateDiceFlags()
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "cert.der",
+		testDiceCert(t, asn1.ObjectIdentifier{1, 2, 3}, "not DICE"), 0400))
+
+	cmd := NewComidGenerateDiceCmd()
+	cmd.SetArgs([]string{"--chain=cert.der"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no DICE TCB info found in the certificate chain")
+}
+
+func Test_ComidGenerateDiceCmd_pem_chain(t *testing.T) {
+	resetComidGenerateDiceFlags()
+
+	fmc, l1 := testDiceTcbInfos()
+
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testDiceCert(t, oidDiceTcbInfo, fmc)})
+	chain = append(chain, pem.EncodeToMemory(
+		&pem.Block{Type: "CERTIFICATE", Bytes: testDiceCert(t, oidDiceMultiTcbInfo, l1)},
+	)...)
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "chain.pem", chain, 0400))
+
+	cmd := NewComidGenerateDiceCmd()
+	cmd.SetArgs([]string{"--chain=chain.pem", "--vendor=Default Vendor"})
+	require.NoError(t, cmd.Execute())
+
+	c := loadGeneratedComid(t, "dice.cbor")
+	require.NotNil(t, c.Triples.ReferenceValues)
+	assert.Nil(t, c.Triples.EndorsedValues)
+
+	rvs := c.Triples.ReferenceValues.Values
+	require.Len(t, rvs, 3)
+
+	// layer 0, from the TcbInfo extension
+	assert.Equal(t, "ACME", *rvs[0].Environment.Class.Vendor)
+	assert.Equal(t, "FMC", *rvs[0].Environment.Class.Model)
+	assert.Equal(t, uint64(0), *rvs[0].Environment.Class.Layer)
+
+	m := rvs[0].Measurements.Values[0]
+	assert.Nil(t, m.Key)
+	assert.Equal(t, comid.Digests{swid.HashEntry{HashAlgID: swid.Sha256, HashValue: testBLDigest}}, *m.Val.Digests)
+	assert.Equal(t, comid.TaggedSVN(10), *m.Val.SVN.Value.(*comid.TaggedSVN))
+	require.NotNil(t, m.Val.Flags)
+	assert.False(t, *m.Val.Flags.IsSecure)
+	assert.True(t, *m.Val.Flags.IsDebug)
+	assert.Nil(t, m.Val.Flags.IsConfigured)
+
+	// layer 1, from the MultiTcbInfo extension
+	assert.Equal(t, "Default Vendor", *rvs[1].Environment.Class.Vendor)
+
+	// the class IDs are derived from the vendor and model
+	classID, err := diceClassID("ACME", "FMC")
+	require.NoError(t, err)
+	assert.Equal(t, classID, rvs[0].Environment.Class.ClassID)
+	assert.Equal(t, comid.UUIDType, classID.Type())
+	assert.Equal(t, rvs[1].Environment.Class.ClassID, rvs[2].Environment.Class.ClassID)
+	assert.NotEqual(t, rvs[0].Environment.Class.ClassID, rvs[1].Environment.Class.ClassID)
+	assert.Equal(t, "1.2.3", rvs[1].Measurements.Values[0].Val.Ver.Version)
+	assert.Equal(t, uint64(1), *rvs[2].Environment.Class.Index)
+}
+
+func Test_ComidGenerateDiceCmd_der_endorsed(t *testing.T) {
+	resetComidGenerateDiceFlags()
+
+	fmc, _ := testDiceTcbInfos()
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "l0.der", testDiceCert(t, oidDiceTcbInfo, fmc), 0400))
+
+	cmd := NewComidGenerateDiceCmd()
+	cmd.SetArgs([]string{"--chain=l0.der", "--endorsed", "--output=ev.cbor"})
+	require.NoError(t, cmd.Execute())
+
+	c := loadGeneratedComid(t, "ev.cbor")
+	assert.Nil(t, c.Triples.ReferenceValues)
+	require.NotNil(t, c.Triples.EndorsedValues)
+	assert.Len(t, c.Triples.EndorsedValues.Values, 1)
+
+	// with the derived class ID, the CoMID follows the DICE profile
+	data, err := afero.ReadFile(fs, "ev.cbor")
+	require.NoError(t, err)
+	p, err := lookupComidProfile("dice")
+	require.NoError(t, err)
+	assert.NoError(t, checkComidProfile(p, c, data))
+}
+
+func Test_diceValueTriple_errors(t *testing.T) {
+	resetComidGenerateDiceFlags()
+
+	_, err := diceValueTriple(diceTcbInfo{SVN: big.NewInt(1)})
+	assert.EqualError(t, err, "no class ID (use --class-id, or --vendor and --model for TCBs without them)")
+
+	_, err = diceValueTriple(diceTcbInfo{Model: "FMC"})
+	assert.EqualError(t, err, "no version, SVN, FWIDs or flags to use as measured values")
+
+	_, err = diceValueTriple(diceTcbInfo{
+		Model: "FMC",
+		FWIDs: []diceFWID{{HashAlg: asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}, Digest: make([]byte, 20)}},
+	})
+	assert.EqualError(t, err, "fwids[0]: unsupported hash algorithm 1.3.14.3.2.26")
+}
@@ -0,0 +1,223 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/swid"
+)
+
+var (
+	comidGenerateFromEventlogFlags      comidGenerateFlags
+	comidGenerateFromEventlogFile       string
+	comidGenerateFromEventlogPCRs       []uint
+	comidGenerateFromEventlogEventTypes []string
+)
+
+var comidGenerateFromEventlogCmd = NewComidGenerateFromEventlogCmd()
+
+func NewComidGenerateFromEventlogCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "from-eventlog",
+		Short: "generate TPM reference values from a TCG measured-boot event log",
+		Long: `generate TPM reference values from a TCG measured-boot event log
+
+	The binary (crypto-agile) TCG PC Client event log is parsed and its events
+	grouped by PCR.  Each PCR becomes a measurement keyed by the PCR index,
+	whose digests are those of the PCR's events and whose integrity registers
+	hold the final value of the PCR in each bank, obtained by replaying the
+	whole log.  Only the SHA-256, SHA-384 and SHA-512 banks are used.
+
+	Generate eventlog.cbor with reference values for all the PCRs in the
+	event log of the local machine:
+
+		cocli comid generate from-eventlog \
+			--eventlog=/sys/kernel/security/tpm0/binary_bios_measurements \
+			--class-id=5c1fb6e5-5b3f-4bf7-a4a1-d1c5fbd2b12c --class-id-type=uuid
+
+	Generate boot.cbor with the digests of the boot applications measured into
+	PCR 4 (its final values still account for all events):
+
+		cocli comid generate from-eventlog --eventlog=eventlog.bin \
+			--class-id=5c1fb6e5-5b3f-4bf7-a4a1-d1c5fbd2b12c --class-id-type=uuid \
+			--pcr=4 --event-type=EV_EFI_BOOT_SERVICES_APPLICATION \
+			--output=boot.cbor
+	`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkComidGenerateFromEventlogArgs(); err != nil {
+				return err
+			}
+
+			eventTypes, err := parseEventTypes(comidGenerateFromEventlogEventTypes)
+			if err != nil {
+				return err
+			}
+
+			data, err := afero.ReadFile(fs, comidGenerateFromEventlogFile)
+			if err != nil {
+				return fmt.Errorf("error loading event log from %s: %w", comidGenerateFromEventlogFile, err)
+			}
+
+			log, err := parseEventLog(data)
+			if err != nil {
+				return fmt.Errorf("error decoding event log from %s: %w", comidGenerateFromEventlogFile, err)
+			}
+
+			env, err := comidGenerateFromEventlogFlags.environment(nil)
+			if err != nil {
+				return err
+			}
+
+			c, err := eventLogToComid(log, env, comidGenerateFromEventlogPCRs, eventTypes)
+			if err != nil {
+				return err
+			}
+
+			return saveGeneratedComid(c, comidGenerateFromEventlogFlags.Output)
+		},
+	}
+
+	cmd.Flags().StringVarP(
+		&comidGenerateFromEventlogFile, "eventlog", "e", "",
+		"a binary TCG PC Client event log (crypto-agile format)",
+	)
+
+	cmd.Flags().UintSliceVar(
+		&comidGenerateFromEventlogPCRs, "pcr", []uint{},
+		"only include the supplied PCR(s) (repeatable or comma-separated)",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&comidGenerateFromEventlogEventTypes, "event-type", []string{},
+		"only include the digests of events of this type, e.g., EV_IPL or 0x80000003",
+	)
+
+	comidGenerateFromEventlogFlags.register(cmd, comid.ImplIDType, "eventlog.cbor")
+
+	return cmd
+}
+
+func checkComidGenerateFromEventlogArgs() error {
+	if comidGenerateFromEventlogFile == "" {
+		return errors.New("no event log supplied")
+	}
+	return nil
+}
+
+func parseEventTypes(names []string) (map[uint32]bool, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	types := map[uint32]bool{}
+	for _, name := range names {
+		t, err := parseEventType(name)
+		if err != nil {
+			return nil, err
+		}
+		types[t] = true
+	}
+
+	return types, nil
+}
+
+// eventLogToComid returns a CoMID with one measurement per PCR extended by the
+// event log, restricted to the supplied PCRs and event types, if any
+func eventLogToComid(
+	log *eventLog, env *comid.Environment, pcrFilter []uint, typeFilter map[uint32]bool,
+) (*comid.Comid, error) {
+	finals := log.replay()
+
+	var pcrs []uint32
+	for pcr := range finals {
+		if len(pcrFilter) == 0 || containsUint(pcrFilter, uint(pcr)) {
+			pcrs = append(pcrs, pcr)
+		}
+	}
+
+	if len(pcrs) == 0 {
+		return nil, errors.New("no PCR left to generate reference values for")
+	}
+
+	sort.Slice(pcrs, func(i, j int) bool { return pcrs[i] < pcrs[j] })
+
+	measurements := comid.NewMeasurements()
+
+	for _, pcr := range pcrs {
+		m, err := comid.NewMeasurement(uint64(pcr), comid.UintType)
+		if err != nil {
+			return nil, fmt.Errorf("PCR %d: %w", pcr, err)
+		}
+
+		for _, ev := range log.Events {
+			if ev.PCR != pcr || ev.Type == evNoAction || (typeFilter != nil && !typeFilter[ev.Type]) {
+				continue
+			}
+
+			for _, alg := range sortedBanks(ev.Digests) {
+				addDigestOnce(m, tpmHashAlgs[alg].algID, ev.Digests[alg])
+			}
+		}
+
+		regs := comid.NewIntegrityRegisters()
+		for _, alg := range sortedBanks(finals[pcr]) {
+			he := swid.HashEntry{HashAlgID: tpmHashAlgs[alg].algID, HashValue: finals[pcr][alg]}
+			if err := regs.AddDigest(uint64(pcr), he); err != nil {
+				return nil, fmt.Errorf("PCR %d: %w", pcr, err)
+			}
+		}
+
+		if len(regs.IndexMap) == 0 {
+			return nil, fmt.Errorf("PCR %d: no SHA-256, SHA-384 or SHA-512 bank in the event log", pcr)
+		}
+
+		m.Val.IntegrityRegisters = regs
+		measurements.Add(m)
+	}
+
+	c, err := comidGenerateFromEventlogFlags.newComid(comidGenerateFromEventlogFlags.TagID)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.AddReferenceValue(comid.ValueTriple{Environment: *env, Measurements: *measurements}) == nil {
+		return nil, errors.New("error adding reference values to the CoMID")
+	}
+
+	return c, nil
+}
+
+// addDigestOnce adds the digest to the measurement unless it is already there
+// (e.g., the EV_SEPARATOR digests that are the same for every PCR)
+func addDigestOnce(m *comid.Measurement, algID uint64, digest []byte) {
+	if m.Val.Digests != nil {
+		for _, d := range *m.Val.Digests {
+			if d.HashAlgID == algID && bytes.Equal(d.HashValue, digest) {
+				return
+			}
+		}
+	}
+
+	m.AddDigest(algID, digest)
+}
+
+func containsUint(l []uint, v uint) bool {
+	for _, e := range l {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	comidGenerateCmd.AddCommand(comidGenerateFromEventlogCmd)
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/swid"
+)
+
+func resetComidGenerateFromEventlogFlags() {
+	comidGenerateFromEventlogFlags = defaultComidGenerateFlags("eventlog.cbor")
+	comidGenerateFromEventlogFile = ""
+	comidGenerateFromEventlogPCRs, comidGenerateFromEventlogEventTypes = nil, nil
+}
+
+func eventlogTestFS(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "eventlog.bin", testEventLog(
+		testEvent{0, 0x00000008, []byte("CRTM version")},
+		testEvent{0, 0x00000004, []byte{0, 0, 0, 0}},
+		testEvent{4, 0x80000007, []byte("Calling EFI Application from Boot Option")},
+		testEvent{4, 0x00000004, []byte{0, 0, 0, 0}},
+		testEvent{4, 0x80000003, []byte("bootloader")},
+		testEvent{4, 0x80000003, []byte("kernel")},
+	), 0400))
+}
+
+func Test_ComidGenerateFromEventlogCmd_no_eventlog(t *testing.T) {
+	resetComidGenerateFromEventlogFlags()
+	cmd := NewComidGenerateFromEventlogCmd()
+
+	cmd.SetArgs([]string{"--pcr=0"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no event log supplied")
+}
+
+func Test_ComidGenerateFromEventlogCmd_bad_event_type(t *testing.T) {
+	resetComidGenerateFromEventlogFlags()
+	cmd := NewComidGenerateFromEventlogCmd()
+
+	cmd.SetArgs([]string{"--eventlog=eventlog.bin", "--event-type=EV_BOGUS"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, `unknown event type "EV_BOGUS"`)
+}
+
+func Test_ComidGenerateFromEventlogCmd_all(t *testing.T) {
+	resetComidGenerateFromEventlogFlags()
+	eventlogTestFS(t)
+
+	cmd := NewComidGenerateFromEventlogCmd()
+	cmd.SetArgs([]string{
+		"--eventlog=eventlog.bin",
+		"--class-id=5c1fb6e5-5b3f-4bf7-a4a1-d1c5fbd2b12c", "--class-id-type=uuid",
+	})
+	require.NoError(t, cmd.Execute())
+
+	c := loadGeneratedComid(t, "eventlog.cbor")
+	ms := c.Triples.ReferenceValues.Values[0].Measurements.Values
+	require.Len(t, ms, 2)
+
+	assert.Equal(t, "0", ms[0].Key.Value.String())
+	assert.Len(t, *ms[0].Val.Digests, 2)
+
+	// the separator digest is recorded once per PCR
+	assert.Equal(t, "4", ms[1].Key.Value.String())
+	assert.Len(t, *ms[1].Val.Digests, 4)
+
+	pcr4 := testExtend(make([]byte, 32),
+		[]byte("Calling EFI Application from Boot Option"), []byte{0, 0, 0, 0},
+		[]byte("bootloader"), []byte("kernel"),
+	)
+	assert.Equal(t,
+		comid.Digests{swid.HashEntry{HashAlgID: swid.Sha256, HashValue: pcr4}},
+		ms[1].Val.IntegrityRegisters.IndexMap[uint64(4)],
+	)
+}
+
+func Test_ComidGenerateFromEventlogCmd_filters(t *testing.T) {
+	resetComidGenerateFromEventlogFlags()
+	eventlogTestFS(t)
+
+	cmd := NewComidGenerateFromEventlogCmd()
+	cmd.SetArgs([]string{
+		"--eventlog=eventlog.bin",
+		"--class-id=5c1fb6e5-5b3f-4bf7-a4a1-d1c5fbd2b12c", "--class-id-type=uuid",
+		"--pcr=4,7", "--event-type=EV_EFI_BOOT_SERVICES_APPLICATION",
+	})
+	require.NoError(t, cmd.Execute())
+
+	c := loadGeneratedComid(t, "eventlog.cbor")
+	ms := c.Triples.ReferenceValues.Values[0].Measurements.Values
+	require.Len(t, ms, 1)
+
+	bl := sha256.Sum256([]byte("bootloader"))
+	kernel := sha256.Sum256([]byte("kernel"))
+	assert.Equal(t, comid.Digests{
+		swid.HashEntry{HashAlgID: swid.Sha256, HashValue: bl[:]},
+		swid.HashEntry{HashAlgID: swid.Sha256, HashValue: kernel[:]},
+	}, *ms[0].Val.Digests)
+
+	// the final value accounts for the events that are filtered out
+	assert.Len(t, ms[0].Val.IntegrityRegisters.IndexMap[uint64(4)], 1)
+}
+
+func Test_ComidGenerateFromEventlogCmd_no_pcr_left(t *testing.T) {
+	resetComidGenerateFromEventlogFlags()
+	eventlogTestFS(t)
+
+	cmd := NewComidGenerateFromEventlogCmd()
+	cmd.SetArgs([]string{
+		"--eventlog=eventlog.bin", "--class-id=5c1fb6e5-5b3f-4bf7-a4a1-d1c5fbd2b12c",
+		"--class-id-type=uuid", "--pcr=9",
+	})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no PCR left to generate reference values for")
+}
+
+func Test_ComidGenerateFromEventlogCmd_default_output(t *testing.T) {
+	resetComidGenerateFromEventlogFlags()
+	eventlogTestFS(t)
+
+	cmd := NewComidGenerateFromEventlogCmd()
+	// registering another sub-command leaves the defaults of this one alone
+	_ = NewComidGenerateRefvalCmd()
+
+	cmd.SetArgs([]string{
+		"--eventlog=eventlog.bin",
+		"--class-id=5c1fb6e5-5b3f-4bf7-a4a1-d1c5fbd2b12c", "--class-id-type=uuid",
+	})
+	require.NoError(t, cmd.Execute())
+
+	exists, err := afero.Exists(fs, "eventlog.cbor")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
@@ -0,0 +1,337 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/swid"
+)
+
+var (
+	comidGenerateFromPSATokenFlags    comidGenerateFlags
+	comidGenerateFromPSATokenFile     string
+	comidGenerateFromPSATokenIAK      string
+	comidGenerateFromPSATokenTemplate string
+)
+
+var comidGenerateFromPSATokenCmd = NewComidGenerateFromPSATokenCmd()
+
+func NewComidGenerateFromPSATokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "from-psa-token",
+		Short: "derive PSA reference values from a known-good PSA attestation token",
+		Long: `derive PSA reference values from a known-good PSA attestation token
+
+	The software components of the token become psa.refval-id measurements, and
+	its implementation ID the psa.impl-id class of the environment (its instance
+	ID is not used, the reference values apply to the device type).  Both the CBOR-encoded CoMID and the matching
+	JSON template (which can be edited and fed to "cocli comid create") are
+	saved.
+
+	Derive psa-refval.cbor and psa-refval.json from token.cbor, after checking
+	the token signature with the IAK in iak.pem (a JWK is also accepted):
+
+		cocli comid generate from-psa-token --token=token.cbor --iak=iak.pem
+
+	Derive acme.cbor and acme-template.json, setting the vendor and model of
+	the environment class:
+
+		cocli comid generate from-psa-token --token=token.cbor \
+			--vendor=ACME --model=RoadRunner \
+			--output=acme.cbor --template=acme-template.json
+	`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkComidGenerateFromPSATokenArgs(); err != nil {
+				return err
+			}
+
+			e, err := loadEvidence(comidGenerateFromPSATokenFile)
+			if err != nil {
+				return err
+			}
+
+			if comidGenerateFromPSATokenIAK != "" {
+				pub, err := loadIAK(comidGenerateFromPSATokenIAK)
+				if err != nil {
+					return err
+				}
+
+				if err = e.verifySignature(pub); err != nil {
+					return fmt.Errorf(
+						"error verifying %s with key %s: %w",
+						comidGenerateFromPSATokenFile, comidGenerateFromPSATokenIAK, err,
+					)
+				}
+				fmt.Printf(">> %q signature verified\n", comidGenerateFromPSATokenFile)
+			}
+
+			c, err := psaTokenToComid(e)
+			if err != nil {
+				return err
+			}
+
+			if err = saveGeneratedComid(c, comidGenerateFromPSATokenFlags.Output); err != nil {
+				return err
+			}
+
+			return savePSATokenTemplate(e, c)
+		},
+	}
+
+	cmd.Flags().StringVarP(
+		&comidGenerateFromPSATokenFile, "token", "t", "",
+		"a PSA attestation token (COSE Sign1) or its JSON claims",
+	)
+
+	cmd.Flags().StringVarP(
+		&comidGenerateFromPSATokenIAK, "iak", "k", "",
+		"initial attestation key (PEM or JWK) used to check the token signature",
+	)
+
+	cmd.Flags().StringVarP(
+		&comidGenerateFromPSATokenTemplate, "template", "T", "",
+		"name of the generated JSON template (default: the output file name with a .json extension)",
+	)
+
+	comidGenerateFromPSATokenFlags.register(cmd, comid.ImplIDType, "psa-refval.cbor")
+
+	return cmd
+}
+
+func checkComidGenerateFromPSATokenArgs() error {
+	if comidGenerateFromPSATokenFile == "" {
+		return errors.New("no token supplied")
+	}
+	return nil
+}
+
+// loadIAK loads a public key in PEM or JWK format
+func loadIAK(file string) (crypto.PublicKey, error) {
+	data, err := afero.ReadFile(fs, file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading IAK from %s: %w", file, err)
+	}
+
+	var (
+		k   *comid.CryptoKey
+		pub crypto.PublicKey
+	)
+
+	if k, err = cryptoKeyFromPEMOrJWK(data); err == nil {
+		pub, err = k.PublicKey()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error decoding IAK from %s: %w", file, err)
+	}
+
+	return pub, nil
+}
+
+// swComponentDigestAlg returns the hash algorithm of the measurement value of
+// a software component, from its measurement description (e.g., "sha-256" or
+// "SHA256") or, if the description is absent, from the value's length
+func swComponentDigestAlg(sc swComponentClaims) (uint64, error) {
+	if sc.MeasurementDesc != "" {
+		name := strings.ToLower(sc.MeasurementDesc)
+		if !strings.Contains(name, "-") {
+			name = strings.Replace(name, "sha", "sha-", 1)
+		}
+
+		if alg := swid.AlgIDFromString(name); alg != 0 {
+			return alg, nil
+		}
+
+		return 0, fmt.Errorf("unknown measurement description %q", sc.MeasurementDesc)
+	}
+
+	switch n := len(sc.MeasurementValue); n {
+	case 32:
+		return swid.Sha256, nil
+	case 48:
+		return swid.Sha384, nil
+	case 64:
+		return swid.Sha512, nil
+	default:
+		return 0, fmt.Errorf("unexpected measurement value length %d (want 32, 48 or 64)", n)
+	}
+}
+
+// psaTokenEnvironment returns the environment of the reference values derived
+// from the evidence: its implementation ID is the psa.impl-id class.  The
+// instance ID is left out, as the reference values describe the device type,
+// not the device that produced the token.
+func psaTokenEnvironment(e *evidence) (*comid.Environment, error) {
+	classID, err := comid.NewImplIDClassID(e.ImplID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid implementation ID: %w", err)
+	}
+
+	return comidGenerateFromPSATokenFlags.environment(
+		&comid.Environment{Class: &comid.Class{ClassID: classID}},
+	)
+}
+
+// psaTokenToComid returns a CoMID with the software components of the
+// evidence as reference values of its implementation ID
+func psaTokenToComid(e *evidence) (*comid.Comid, error) {
+	if len(e.SwComponents) == 0 {
+		return nil, errors.New("no software components found in token")
+	}
+
+	env, err := psaTokenEnvironment(e)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := comidGenerateFromPSATokenFlags.newComid(comidGenerateFromPSATokenFlags.TagID)
+	if err != nil {
+		return nil, err
+	}
+
+	measurements := comid.NewMeasurements()
+
+	for i, sc := range e.SwComponents {
+		id := comid.PSARefValID{SignerID: sc.SignerID}
+		if sc.MeasurementType != "" {
+			id.SetLabel(sc.MeasurementType)
+		}
+		if sc.Version != "" {
+			id.SetVersion(sc.Version)
+		}
+
+		m, err := comid.NewPSAMeasurement(id)
+		if err != nil {
+			return nil, fmt.Errorf("software-components[%d]: %w", i, err)
+		}
+
+		alg, err := swComponentDigestAlg(sc)
+		if err != nil {
+			return nil, fmt.Errorf("software-components[%d]: %w", i, err)
+		}
+
+		if m.AddDigest(alg, sc.MeasurementValue) == nil {
+			return nil, fmt.Errorf(
+				"software-components[%d]: invalid %s measurement value", i, hashAlgName(alg),
+			)
+		}
+
+		measurements.Add(m)
+	}
+
+	if c.AddReferenceValue(comid.ValueTriple{Environment: *env, Measurements: *measurements}) == nil {
+		return nil, errors.New("error adding reference values to the CoMID")
+	}
+
+	return c, nil
+}
+
+// psaTokenTemplate is the JSON template, in the format of those in
+// data/comid/templates, of the reference values derived from a PSA token
+type psaTokenTemplate struct {
+	Lang        string `json:"lang,omitempty"`
+	TagIdentity struct {
+		ID      string `json:"id"`
+		Version uint   `json:"version"`
+	} `json:"tag-identity"`
+	Triples struct {
+		ReferenceValues []psaTokenTemplateRefVal `json:"reference-values"`
+	} `json:"triples"`
+}
+
+type psaTokenTemplateRefVal struct {
+	Environment  comid.Environment             `json:"environment"`
+	Measurements []psaTokenTemplateMeasurement `json:"measurements"`
+}
+
+type psaTokenTemplateMeasurement struct {
+	Key struct {
+		Type  string `json:"type"`
+		Value struct {
+			Label    string `json:"label,omitempty"`
+			Version  string `json:"version,omitempty"`
+			SignerID []byte `json:"signer-id"`
+		} `json:"value"`
+	} `json:"key"`
+	Value struct {
+		Digests []string `json:"digests"`
+	} `json:"value"`
+}
+
+// newPSATokenTemplate returns the template of the CoMID derived from the
+// evidence, with the software components of the token as measurements
+func newPSATokenTemplate(e *evidence, c *comid.Comid) (*psaTokenTemplate, error) {
+	var tmpl psaTokenTemplate
+
+	tmpl.Lang = comidGenerateFromPSATokenFlags.Lang
+	tmpl.TagIdentity.ID = c.TagIdentity.TagID.String()
+	tmpl.TagIdentity.Version = c.TagIdentity.TagVersion
+
+	rv := psaTokenTemplateRefVal{Environment: c.Triples.ReferenceValues.Values[0].Environment}
+
+	for i, sc := range e.SwComponents {
+		alg, err := swComponentDigestAlg(sc)
+		if err != nil {
+			return nil, fmt.Errorf("software-components[%d]: %w", i, err)
+		}
+
+		var m psaTokenTemplateMeasurement
+		m.Key.Type = comid.PSARefValIDType
+		m.Key.Value.Label = sc.MeasurementType
+		m.Key.Value.Version = sc.Version
+		m.Key.Value.SignerID = sc.SignerID
+		m.Value.Digests = []string{
+			hashAlgName(alg) + ":" + base64.StdEncoding.EncodeToString(sc.MeasurementValue),
+		}
+
+		rv.Measurements = append(rv.Measurements, m)
+	}
+
+	tmpl.Triples.ReferenceValues = []psaTokenTemplateRefVal{rv}
+
+	return &tmpl, nil
+}
+
+// savePSATokenTemplate saves the JSON template of the CoMID derived from the
+// evidence
+func savePSATokenTemplate(e *evidence, c *comid.Comid) error {
+	output := comidGenerateFromPSATokenFlags.Output
+
+	file := comidGenerateFromPSATokenTemplate
+	if file == "" {
+		file = makeFileName(filepath.Dir(output), output, ".json")
+	}
+
+	tmpl, err := newPSATokenTemplate(e, c)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(tmpl, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding template to JSON: %w", err)
+	}
+
+	if err = afero.WriteFile(fs, file, data, 0644); err != nil {
+		return fmt.Errorf("error saving template file %s: %w", file, err)
+	}
+
+	fmt.Printf(">> created %q\n", file)
+
+	return nil
+}
+
+func init() {
+	comidGenerateCmd.AddCommand(comidGenerateFromPSATokenCmd)
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/swid"
+)
+
+func resetComidGenerateFromPSATokenFlags() {
+	comidGenerateFromPSATokenFlags = defaultComidGenerateFlags("psa-refval.cbor")
+	comidGenerateFromPSATokenFile, comidGenerateFromPSATokenIAK, comidGenerateFromPSATokenTemplate = "", "", ""
+}
+
+// psaTokenTestFS writes a PSA token signed with key, and the PEM encoding of
+// the public part of iak, to an in-memory file system
+func psaTokenTestFS(t *testing.T, key, iak *ecdsa.PrivateKey) {
+	der, err := x509.MarshalPKIXPublicKey(iak.Public())
+	require.NoError(t, err)
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "token.cbor", signTestToken(t, key, testPlatformClaims()), 0400))
+	require.NoError(t, afero.WriteFile(fs, "iak.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0400))
+}
+
+func Test_ComidGenerateFromPSATokenCmd_no_token(t *testing.T) {
+	resetComidGenerateFromPSATokenFlags()
+	cmd := NewComidGenerateFromPSATokenCmd()
+
+	cmd.SetArgs([]string{"--iak=iak.pem"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no token supplied")
+}
+
+func Test_ComidGenerateFromPSATokenCmd_ok(t *testing.T) {
+	resetComidGenerateFromPSATokenFlags()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	psaTokenTestFS(t, key, key)
+
+	cmd := NewComidGenerateFromPSATokenCmd()
+	cmd.SetArgs([]string{"--token=token.cbor", "--iak=iak.pem", "--vendor=ACME", "--output=out/psa.cbor"})
+
+	require.NoError(t, cmd.Execute())
+
+	c := loadGeneratedComid(t, "out/psa.cbor")
+	rv := c.Triples.ReferenceValues.Values[0]
+	assert.Equal(t, comid.ImplIDType, rv.Environment.Class.ClassID.Type())
+	assert.Equal(t, testImplID, rv.Environment.Class.ClassID.Bytes())
+	assert.Equal(t, "ACME", *rv.Environment.Class.Vendor)
+	assert.Nil(t, rv.Environment.Instance)
+
+	require.Len(t, rv.Measurements.Values, 1)
+	m := rv.Measurements.Values[0]
+	id, ok := m.Key.Value.(*comid.TaggedPSARefValID)
+	require.True(t, ok)
+	assert.Equal(t, "BL", *id.Label)
+	assert.Equal(t, "2.1.0", *id.Version)
+	assert.Equal(t, testSignerID, id.SignerID)
+	assert.Equal(t, comid.Digests{swid.HashEntry{HashAlgID: swid.Sha256, HashValue: testBLDigest}}, *m.Val.Digests)
+
+	// the template is the JSON equivalent of the CoMID
+	tmpl, err := afero.ReadFile(fs, "out/psa.json")
+	require.NoError(t, err)
+
+	assert.Contains(t, string(tmpl), `"type": "psa.impl-id"`)
+	assert.NotContains(t, string(tmpl), `"instance"`)
+	assert.Contains(t, string(tmpl), `"sha-256:`+base64.StdEncoding.EncodeToString(testBLDigest)+`"`)
+
+	var fromTmpl comid.Comid
+	require.NoError(t, fromTmpl.FromJSON(tmpl))
+	assert.Equal(t, c.TagIdentity, fromTmpl.TagIdentity)
+	assert.Equal(t, c.Triples.ReferenceValues, fromTmpl.Triples.ReferenceValues)
+}
+
+func Test_ComidGenerateFromPSATokenCmd_wrong_iak(t *testing.T) {
+	resetComidGenerateFromPSATokenFlags()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	psaTokenTestFS(t, key, other)
+
+	cmd := NewComidGenerateFromPSATokenCmd()
+	cmd.SetArgs([]string{"--token=token.cbor", "--iak=iak.pem"})
+
+	err = cmd.Execute()
+	assert.ErrorContains(t, err, "error verifying token.cbor with key iak.pem: ")
+
+	exists, _ := afero.Exists(fs, "psa-refval.cbor")
+	assert.False(t, exists)
+}
+
+func Test_swComponentDigestAlg(t *testing.T) {
+	alg, err := swComponentDigestAlg(swComponentClaims{MeasurementDesc: "SHA384"})
+	require.NoError(t, err)
+	assert.Equal(t, swid.Sha384, alg)
+
+	alg, err = swComponentDigestAlg(swComponentClaims{MeasurementValue: make([]byte, 64)})
+	require.NoError(t, err)
+	assert.Equal(t, swid.Sha512, alg)
+
+	_, err = swComponentDigestAlg(swComponentClaims{MeasurementDesc: "md5"})
+	assert.EqualError(t, err, `unknown measurement description "md5"`)
+
+	_, err = swComponentDigestAlg(swComponentClaims{MeasurementValue: make([]byte, 20)})
+	assert.EqualError(t, err, "unexpected measurement value length 20 (want 32, 48 or 64)")
+}
@@ -0,0 +1,320 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/swid"
+)
+
+var (
+	comidGenerateRefvalFlags    comidGenerateFlags
+	comidGenerateRefvalBinaries []string
+	comidGenerateRefvalSignerID string
+	comidGenerateRefvalManifest string
+	comidGenerateRefvalAlgs     []string
+)
+
+// refvalDigestAlgs are the hash algorithms that can be used to measure the
+// supplied binaries
+var refvalDigestAlgs = map[string]struct {
+	id  uint64
+	new func() hash.Hash
+}{
+	"sha-256": {swid.Sha256, sha256.New},
+	"sha-384": {swid.Sha384, sha512.New384},
+	"sha-512": {swid.Sha512, sha512.New},
+}
+
+// refvalComponent describes a firmware binary and the PSA refval-id under
+// which its digests are recorded
+type refvalComponent struct {
+	File     string `json:"file"`
+	Label    string `json:"label,omitempty"`
+	Version  string `json:"version,omitempty"`
+	SignerID string `json:"signer-id,omitempty"`
+}
+
+// refvalManifest is the format of the file supplied with --manifest.  File
+// paths are relative to the directory containing the manifest.
+type refvalManifest struct {
+	Environment *comid.Environment `json:"environment,omitempty"`
+	Components  []refvalComponent  `json:"components"`
+}
+
+var comidGenerateRefvalCmd = NewComidGenerateRefvalCmd()
+
+func NewComidGenerateRefvalCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "refval",
+		Short: "generate a CoMID with the reference values of the supplied binaries",
+		Long: `generate a CoMID with the reference values of the supplied binaries
+
+	Each binary is measured with the selected hash algorithm(s) and recorded in
+	a reference-values triple, keyed by a PSA refval-id made of the binary's
+	label, version and signer ID.  Binaries are given on the command line as
+	<path>[,label=<label>][,version=<version>][,signer-id=<hex or base64>].
+	A --signer-id applies to any binary that does not specify its own.
+
+	Generate refval.cbor with the SHA-256 digests of the bootloader and the
+	runtime, under the PSA implementation ID given with --class-id:
+
+		cocli comid generate refval \
+			--class-id=YWNtZS1pbXBsZW1lbnRhdGlvbi1pZC0wMDAwMDAwMDE= \
+			--vendor="ACME" --model="RoadRunner" \
+			--signer-id=acbb11c7e4da217205523ce4ce1a245ae1a239ae3c6bfd9e7871f7e5d8bae86b \
+			--binary=build/bl.bin,label=BL,version=2.1.0 \
+			--binary=build/prot.bin,label=PRoT,version=1.3.5
+
+	Generate fw.cbor with SHA-256 and SHA-512 digests of the components listed
+	in a manifest:
+
+		cocli comid generate refval --manifest=fw.json \
+			--alg=sha-256 --alg=sha-512 --output=fw.cbor
+
+	where fw.json looks like:
+
+		{
+		  "environment": {
+		    "class": {
+		      "id": {
+		        "type": "psa.impl-id",
+		        "value": "YWNtZS1pbXBsZW1lbnRhdGlvbi1pZC0wMDAwMDAwMDE="
+		      }
+		    }
+		  },
+		  "components": [
+		    {
+		      "file": "bl.bin",
+		      "label": "BL",
+		      "version": "2.1.0",
+		      "signer-id": "rLsRx+TaIXIFUjzkzhokWuGiOa48a/2eeHH35di66Gs="
+		    }
+		  ]
+		}
+
+	Environment flags take precedence over the manifest's environment.
+	`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkComidGenerateRefvalArgs(); err != nil {
+				return err
+			}
+
+			var manifest refvalManifest
+			if comidGenerateRefvalManifest != "" {
+				m, err := loadRefvalManifest(comidGenerateRefvalManifest)
+				if err != nil {
+					return err
+				}
+				manifest = *m
+			}
+
+			components := manifest.Components
+			for _, b := range comidGenerateRefvalBinaries {
+				rc, err := parseRefvalBinary(b)
+				if err != nil {
+					return err
+				}
+				components = append(components, *rc)
+			}
+
+			if len(components) == 0 {
+				return errors.New("no binaries supplied")
+			}
+
+			env, err := comidGenerateRefvalFlags.environment(manifest.Environment)
+			if err != nil {
+				return err
+			}
+
+			c, err := generateRefvalComid(env, components, comidGenerateRefvalAlgs)
+			if err != nil {
+				return err
+			}
+
+			return saveGeneratedComid(c, comidGenerateRefvalFlags.Output)
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(
+		&comidGenerateRefvalBinaries, "binary", "b", []string{},
+		"a binary to measure: <path>[,label=<label>][,version=<version>][,signer-id=<id>]",
+	)
+
+	cmd.Flags().StringVar(
+		&comidGenerateRefvalSignerID, "signer-id", "",
+		"signer ID (hex or base64) for the binaries that do not specify one",
+	)
+
+	cmd.Flags().StringVarP(
+		&comidGenerateRefvalManifest, "manifest", "m", "",
+		"a JSON manifest listing the binaries to measure and the environment",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&comidGenerateRefvalAlgs, "alg", []string{"sha-256"},
+		"hash algorithm used to measure the binaries (sha-256, sha-384 or sha-512)",
+	)
+
+	comidGenerateRefvalFlags.register(cmd, comid.ImplIDType, "refval.cbor")
+
+	return cmd
+}
+
+func checkComidGenerateRefvalArgs() error {
+	if len(comidGenerateRefvalBinaries) == 0 && comidGenerateRefvalManifest == "" {
+		return errors.New("no binaries or manifest supplied")
+	}
+
+	if len(comidGenerateRefvalAlgs) == 0 {
+		return errors.New("no hash algorithm supplied")
+	}
+
+	for _, alg := range comidGenerateRefvalAlgs {
+		if _, ok := refvalDigestAlgs[alg]; !ok {
+			return fmt.Errorf("unsupported hash algorithm %q (want sha-256, sha-384 or sha-512)", alg)
+		}
+	}
+
+	return nil
+}
+
+func loadRefvalManifest(file string) (*refvalManifest, error) {
+	data, err := afero.ReadFile(fs, file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading manifest from %s: %w", file, err)
+	}
+
+	var m refvalManifest
+	if err = json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error decoding manifest from %s: %w", file, err)
+	}
+
+	dir := filepath.Dir(file)
+	for i := range m.Components {
+		if m.Components[i].File == "" {
+			return nil, fmt.Errorf("error in manifest %s: components[%d]: missing file", file, i)
+		}
+		if !filepath.IsAbs(m.Components[i].File) {
+			m.Components[i].File = filepath.Join(dir, m.Components[i].File)
+		}
+	}
+
+	return &m, nil
+}
+
+// parseRefvalBinary parses a --binary argument of the form
+// <path>[,label=<label>][,version=<version>][,signer-id=<id>]
+func parseRefvalBinary(s string) (*refvalComponent, error) {
+	parts := strings.Split(s, ",")
+
+	rc := refvalComponent{File: parts[0]}
+	if rc.File == "" {
+		return nil, fmt.Errorf("malformed binary %q: missing path", s)
+	}
+
+	for _, p := range parts[1:] {
+		k, v, ok := strings.Cut(p, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed binary %q: %q is not a <key>=<value> pair", s, p)
+		}
+
+		switch k {
+		case "label":
+			rc.Label = v
+		case "version":
+			rc.Version = v
+		case "signer-id":
+			rc.SignerID = v
+		default:
+			return nil, fmt.Errorf("malformed binary %q: unknown key %q (want label, version or signer-id)", s, k)
+		}
+	}
+
+	return &rc, nil
+}
+
+// generateRefvalComid measures the supplied components and returns a CoMID
+// with their reference values under env
+func generateRefvalComid(
+	env *comid.Environment, components []refvalComponent, algs []string,
+) (*comid.Comid, error) {
+	c, err := comidGenerateRefvalFlags.newComid(comidGenerateRefvalFlags.TagID)
+	if err != nil {
+		return nil, err
+	}
+
+	measurements := comid.NewMeasurements()
+
+	for _, rc := range components {
+		m, err := refvalMeasurement(rc, algs)
+		if err != nil {
+			return nil, err
+		}
+		measurements.Add(m)
+	}
+
+	if c.AddReferenceValue(comid.ValueTriple{Environment: *env, Measurements: *measurements}) == nil {
+		return nil, errors.New("error adding reference values to the CoMID")
+	}
+
+	return c, nil
+}
+
+func refvalMeasurement(rc refvalComponent, algs []string) (*comid.Measurement, error) {
+	signer := rc.SignerID
+	if signer == "" {
+		signer = comidGenerateRefvalSignerID
+	}
+	if signer == "" {
+		return nil, fmt.Errorf("no signer ID for %s", rc.File)
+	}
+
+	signerID, err := decodeHexOrBase64(signer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signer ID for %s: %w", rc.File, err)
+	}
+
+	id := comid.PSARefValID{SignerID: signerID}
+	if rc.Label != "" {
+		id.SetLabel(rc.Label)
+	}
+	if rc.Version != "" {
+		id.SetVersion(rc.Version)
+	}
+
+	m, err := comid.NewPSAMeasurement(id)
+	if err != nil {
+		return nil, fmt.Errorf("error creating measurement for %s: %w", rc.File, err)
+	}
+
+	data, err := afero.ReadFile(fs, rc.File)
+	if err != nil {
+		return nil, fmt.Errorf("error loading binary from %s: %w", rc.File, err)
+	}
+
+	for _, alg := range algs {
+		a := refvalDigestAlgs[alg]
+		h := a.new()
+		h.Write(data)
+		m.AddDigest(a.id, h.Sum(nil))
+	}
+
+	return m, nil
+}
+
+func init() {
+	comidGenerateCmd.AddCommand(comidGenerateRefvalCmd)
+}
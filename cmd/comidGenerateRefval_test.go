@@ -0,0 +1,183 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/swid"
+)
+
+const testSignerIDHex = "acbb11c7e4da217205523ce4ce1a245ae1a239ae3c6bfd9e7871f7e5d8bae86b"
+
+// defaultComidGenerateFlags returns the defaults of the common comid generate
+// flags, with output as the name of the generated CoMID file
+func defaultComidGenerateFlags(output string) comidGenerateFlags {
+	return comidGenerateFlags{ClassIDType: comid.ImplIDType, Lang: "en-GB", Output: output}
+}
+
+func resetComidGenerateRefvalFlags() {
+	comidGenerateRefvalFlags = defaultComidGenerateFlags("refval.cbor")
+	comidGenerateRefvalBinaries, comidGenerateRefvalManifest, comidGenerateRefvalSignerID = nil, "", ""
+	comidGenerateRefvalAlgs = []string{"sha-256"}
+}
+
+func loadGeneratedComid(t *testing.T, file string) *comid.Comid {
+	data, err := afero.ReadFile(fs, file)
+	require.NoError(t, err)
+
+	var c comid.Comid
+	require.NoError(t, c.FromCBOR(data))
+
+	return &c
+}
+
+func Test_ComidGenerateRefvalCmd_no_binaries(t *testing.T) {
+	resetComidGenerateRefvalFlags()
+	cmd := NewComidGenerateRefvalCmd()
+
+	cmd.SetArgs([]string{"--class-id=YWNtZS1pbXBsZW1lbnRhdGlvbi1pZC0wMDAwMDAwMDE="})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no binaries or manifest supplied")
+}
+
+func Test_ComidGenerateRefvalCmd_bad_alg(t *testing.T) {
+	resetComidGenerateRefvalFlags()
+	cmd := NewComidGenerateRefvalCmd()
+
+	cmd.SetArgs([]string{"--binary=bl.bin", "--alg=md5"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, `unsupported hash algorithm "md5" (want sha-256, sha-384 or sha-512)`)
+}
+
+func Test_ComidGenerateRefvalCmd_no_environment(t *testing.T) {
+	resetComidGenerateRefvalFlags()
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "bl.bin", []byte("bootloader"), 0400))
+
+	cmd := NewComidGenerateRefvalCmd()
+	cmd.SetArgs([]string{"--binary=bl.bin,signer-id=" + testSignerIDHex})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no environment supplied (use --class-id or a manifest)")
+}
+
+func Test_ComidGenerateRefvalCmd_no_signer_id(t *testing.T) {
+	resetComidGenerateRefvalFlags()
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "bl.bin", []byte("bootloader"), 0400))
+
+	cmd := NewComidGenerateRefvalCmd()
+	cmd.SetArgs([]string{
+		"--binary=bl.bin,label=BL",
+		"--class-id=YWNtZS1pbXBsZW1lbnRhdGlvbi1pZC0wMDAwMDAwMDE=",
+	})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no signer ID for bl.bin")
+}
+
+func Test_ComidGenerateRefvalCmd_binaries(t *testing.T) {
+	resetComidGenerateRefvalFlags()
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "build/bl.bin", []byte("bootloader"), 0400))
+	require.NoError(t, afero.WriteFile(fs, "build/prot.bin", []byte("prot"), 0400))
+
+	cmd := NewComidGenerateRefvalCmd()
+	cmd.SetArgs([]string{
+		"--class-id=YWNtZS1pbXBsZW1lbnRhdGlvbi1pZC0wMDAwMDAwMDE=",
+		"--vendor=ACME",
+		"--signer-id=" + testSignerIDHex,
+		"--binary=build/bl.bin,label=BL,version=2.1.0",
+		"--binary=build/prot.bin,label=PRoT,signer-id=rLsRx+TaIXIFUjzkzhokWuGiOa48a/2eeHH35di66Gs=",
+		"--alg=sha-256", "--alg=sha-512",
+		"--tag-id=fw-1.0", "--tag-version=2",
+		"--output=fw.cbor",
+	})
+
+	require.NoError(t, cmd.Execute())
+
+	c := loadGeneratedComid(t, "fw.cbor")
+	assert.Equal(t, "fw-1.0", c.TagIdentity.TagID.String())
+	assert.Equal(t, uint(2), c.TagIdentity.TagVersion)
+
+	require.NotNil(t, c.Triples.ReferenceValues)
+	require.Len(t, c.Triples.ReferenceValues.Values, 1)
+
+	rv := c.Triples.ReferenceValues.Values[0]
+	assert.Equal(t, "ACME", *rv.Environment.Class.Vendor)
+	require.Len(t, rv.Measurements.Values, 2)
+
+	bl := rv.Measurements.Values[0]
+	id, ok := bl.Key.Value.(*comid.TaggedPSARefValID)
+	require.True(t, ok)
+	assert.Equal(t, "BL", *id.Label)
+	assert.Equal(t, "2.1.0", *id.Version)
+	assert.Equal(t, testSignerID, id.SignerID)
+
+	s256 := sha256.Sum256([]byte("bootloader"))
+	s512 := sha512.Sum512([]byte("bootloader"))
+	assert.Equal(t, comid.Digests{
+		swid.HashEntry{HashAlgID: swid.Sha256, HashValue: s256[:]},
+		swid.HashEntry{HashAlgID: swid.Sha512, HashValue: s512[:]},
+	}, *bl.Val.Digests)
+}
+
+func Test_ComidGenerateRefvalCmd_manifest(t *testing.T) {
+	resetComidGenerateRefvalFlags()
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "fw/bl.bin", []byte("bootloader"), 0400))
+	require.NoError(t, afero.WriteFile(fs, "fw/manifest.json", []byte(`{
+		"environment": {
+			"class": {
+				"id": {
+					"type": "psa.impl-id",
+					"value": "YWNtZS1pbXBsZW1lbnRhdGlvbi1pZC0wMDAwMDAwMDE="
+				},
+				"model": "RoadRunner"
+			}
+		},
+		"components": [{
+			"file": "bl.bin",
+			"label": "BL",
+			"signer-id": "`+testSignerIDHex+`"
+		}]
+	}`), 0400))
+
+	cmd := NewComidGenerateRefvalCmd()
+	cmd.SetArgs([]string{"--manifest=fw/manifest.json", "--output=refval.cbor"})
+
+	require.NoError(t, cmd.Execute())
+
+	c := loadGeneratedComid(t, "refval.cbor")
+	rv := c.Triples.ReferenceValues.Values[0]
+	assert.Equal(t, "RoadRunner", *rv.Environment.Class.Model)
+	require.Len(t, rv.Measurements.Values, 1)
+
+	s256 := sha256.Sum256([]byte("bootloader"))
+	assert.Equal(t, s256[:], (*rv.Measurements.Values[0].Val.Digests)[0].HashValue)
+}
+
+func Test_parseRefvalBinary(t *testing.T) {
+	rc, err := parseRefvalBinary("bl.bin,label=BL,version=1.0,signer-id=abcd")
+	require.NoError(t, err)
+	assert.Equal(t, refvalComponent{File: "bl.bin", Label: "BL", Version: "1.0", SignerID: "abcd"}, *rc)
+
+	_, err = parseRefvalBinary(",label=BL")
+	assert.EqualError(t, err, `malformed binary ",label=BL": missing path`)
+
+	_, err = parseRefvalBinary("bl.bin,BL")
+	assert.EqualError(t, err, `malformed binary "bl.bin,BL": "BL" is not a <key>=<value> pair`)
+
+	_, err = parseRefvalBinary("bl.bin,colour=red")
+	assert.EqualError(t, err, `malformed binary "bl.bin,colour=red": unknown key "colour" (want label, version or signer-id)`)
+}
@@ -13,8 +13,10 @@ import (
 )
 
 var (
-	comidValidateFiles []string
-	comidValidateDirs  []string
+	comidValidateFiles   []string
+	comidValidateDirs    []string
+	comidValidateProfile string
+	comidValidateCDDL    bool
 )
 
 var comidValidateCmd = NewComidValidateCmd()
@@ -33,6 +35,18 @@ func NewComidValidateCmd() *cobra.Command {
 	directory.
 	
 	  cocli comid validate --file=c1.cbor --file=c2.cbor --dir=comids
+
+	Validate CoMID in file c.cbor, also applying the semantic rules of the PSA
+	profile.  The profile can be given either by name (psa, cca, cca-realm,
+	dice) or by its identifier (e.g., http://arm.com/psa/iot/1).
+
+	  cocli comid validate --file=c.cbor --profile=psa
+
+	Check the CoMID in file c.cbor against the CoMID CDDL, reporting any
+	mismatch (e.g., an unknown map key) by its path in the CoMID.  This is a
+	stricter check of the encoding, which is not applied otherwise.
+
+	  cocli comid validate --file=c.cbor --cddl
 	`,
 
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -40,6 +54,15 @@ func NewComidValidateCmd() *cobra.Command {
 				return err
 			}
 
+			var profile *comidProfile
+			if comidValidateProfile != "" {
+				p, err := lookupComidProfile(comidValidateProfile)
+				if err != nil {
+					return err
+				}
+				profile = p
+			}
+
 			filesList := filesList(comidValidateFiles, comidValidateDirs, ".cbor")
 			if len(filesList) == 0 {
 				return errors.New("no files found")
@@ -47,7 +70,12 @@ func NewComidValidateCmd() *cobra.Command {
 
 			errs := 0
 			for _, file := range filesList {
-				err := validateComid(file)
+				var err error
+				if comidValidateCDDL {
+					err = validateComidCDDL(file)
+				} else {
+					err = validateComid(file, profile)
+				}
 				if err != nil {
 					fmt.Printf("[invalid] %q: %v\n", file, err)
 					errs++
@@ -71,10 +99,18 @@ func NewComidValidateCmd() *cobra.Command {
 		&comidValidateDirs, "dir", "d", []string{}, "a directory containing CoMID files (in CBOR format)",
 	)
 
+	cmd.Flags().StringVarP(
+		&comidValidateProfile, "profile", "p", "", "also apply the rules of this profile (psa, cca, cca-realm, dice or a profile identifier)",
+	)
+
+	cmd.Flags().BoolVar(
+		&comidValidateCDDL, "cddl", false, "check the conformance of the encoding to the CoMID CDDL instead",
+	)
+
 	return cmd
 }
 
-func validateComid(file string) error {
+func validateComid(file string, profile *comidProfile) error {
 	var (
 		data []byte
 		err  error
@@ -93,6 +129,26 @@ func validateComid(file string) error {
 		return fmt.Errorf("error validating CoMID %s: %w", file, err)
 	}
 
+	if profile != nil {
+		if err = checkComidProfile(profile, &c, data); err != nil {
+			return fmt.Errorf("error validating CoMID %s: %w", file, err)
+		}
+	}
+
+	return nil
+}
+
+// validateComidCDDL checks the raw CBOR in file against the CoMID CDDL
+func validateComidCDDL(file string) error {
+	data, err := afero.ReadFile(fs, file)
+	if err != nil {
+		return fmt.Errorf("error loading CoMID from %s: %w", file, err)
+	}
+
+	if err = checkCDDL(data, "comid"); err != nil {
+		return fmt.Errorf("error checking CoMID %s against the CDDL: %w", file, err)
+	}
+
 	return nil
 }
 
@@ -100,6 +156,11 @@ func checkComidValidateArgs() error {
 	if len(comidValidateFiles) == 0 && len(comidValidateDirs) == 0 {
 		return errors.New("no files supplied")
 	}
+
+	if comidValidateCDDL && comidValidateProfile != "" {
+		return errors.New("--cddl and --profile cannot be used together")
+	}
+
 	return nil
 }
 
@@ -4,6 +4,7 @@
 package cmd
 
 import (
+	"os"
 	"testing"
 
 	"github.com/spf13/afero"
@@ -114,3 +115,128 @@ func Test_ComidValidateCmd_file_with_valid_comid_from_dir(t *testing.T) {
 	err = cmd.Execute()
 	assert.NoError(t, err)
 }
+
+func Test_ComidValidateCmd_unknown_profile(t *testing.T) {
+	cmd := NewComidValidateCmd()
+
+	args := []string{
+		"--file=ok.cbor",
+		"--profile=unknown",
+	}
+	cmd.SetArgs(args)
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, `unknown profile "unknown" (supported: psa, cca, cca-realm, dice, or one of their identifiers)`)
+}
+
+func Test_ComidValidateCmd_file_with_valid_comid_psa_profile(t *testing.T) {
+	cmd := NewComidValidateCmd()
+
+	fs = afero.NewOsFs()
+
+	args := []string{
+		"--file=../data/comid/comid-psa-refval.cbor",
+		"--profile=http://arm.com/psa/iot/1",
+	}
+	cmd.SetArgs(args)
+
+	err := cmd.Execute()
+	assert.NoError(t, err)
+}
+
+func Test_ComidValidateCmd_file_with_bad_impl_id_psa_profile(t *testing.T) {
+	var err error
+
+	cmd := NewComidValidateCmd()
+
+	// PSARefValCBOR carries a 33 bytes implementation ID, which is
+	// structurally valid but breaks the PSA profile
+	fs = afero.NewMemMapFs()
+	err = afero.WriteFile(fs, "bad-impl-id.cbor", PSARefValCBOR, 0400)
+	require.NoError(t, err)
+
+	args := []string{
+		"--file=bad-impl-id.cbor",
+		"--profile=psa",
+	}
+	cmd.SetArgs(args)
+
+	err = cmd.Execute()
+	assert.EqualError(t, err, "1/1 validation(s) failed")
+}
+
+func Test_ComidValidateCmd_file_with_comid_violating_profile(t *testing.T) {
+	var err error
+
+	cmd := NewComidValidateCmd()
+
+	fs = afero.NewMemMapFs()
+	err = afero.WriteFile(fs, "ok.cbor", PSARefValCBOR, 0400)
+	require.NoError(t, err)
+
+	args := []string{
+		"--file=ok.cbor",
+		"--profile=cca-realm",
+	}
+	cmd.SetArgs(args)
+
+	err = cmd.Execute()
+	assert.EqualError(t, err, "1/1 validation(s) failed")
+}
+
+func Test_ComidValidateCmd_cddl_and_profile(t *testing.T) {
+	cmd := NewComidValidateCmd()
+
+	args := []string{
+		"--file=ok.cbor",
+		"--cddl",
+		"--profile=psa",
+	}
+	cmd.SetArgs(args)
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "--cddl and --profile cannot be used together")
+}
+
+func Test_ComidValidateCmd_file_with_valid_comid_cddl(t *testing.T) {
+	cmd := NewComidValidateCmd()
+
+	data, err := os.ReadFile("../data/comid/comid-psa-refval.cbor")
+	require.NoError(t, err)
+
+	fs = afero.NewMemMapFs()
+	err = afero.WriteFile(fs, "ok.cbor", data, 0400)
+	require.NoError(t, err)
+
+	args := []string{
+		"--file=ok.cbor",
+		"--cddl",
+	}
+	cmd.SetArgs(args)
+
+	err = cmd.Execute()
+	assert.NoError(t, err)
+}
+
+func Test_ComidValidateCmd_file_with_comid_violating_cddl(t *testing.T) {
+	var err error
+
+	cmd := NewComidValidateCmd()
+
+	// tag-identity with an unknown key: {1: {0: "x", 7: 1}, 4: {}}
+	fs = afero.NewMemMapFs()
+	err = afero.WriteFile(fs, "bad.cbor", []byte{0xa2, 0x01, 0xa2, 0x00, 0x61, 0x78, 0x07, 0x01, 0x04, 0xa0}, 0400)
+	require.NoError(t, err)
+
+	err = validateComidCDDL("bad.cbor")
+	assert.EqualError(t, err, "error checking CoMID bad.cbor against the CDDL: tag-identity: unexpected key 7")
+
+	args := []string{
+		"--file=bad.cbor",
+		"--cddl",
+	}
+	cmd.SetArgs(args)
+
+	err = cmd.Execute()
+	assert.EqualError(t, err, "1/1 validation(s) failed")
+}
@@ -4,9 +4,13 @@
 package cmd
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/spf13/afero"
@@ -42,6 +46,23 @@ func filesList(files, dirs []string, ext string) []string {
 	return l
 }
 
+// recursiveFilesList is like filesList, except that the supplied directories
+// are searched recursively
+func recursiveFilesList(files, dirs []string, ext string) []string {
+	l := filesList(files, nil, ext)
+
+	for _, dir := range dirs {
+		_ = afero.Walk(fs, dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && filepath.Ext(path) == ext {
+				l = append(l, path)
+			}
+			return nil
+		})
+	}
+
+	return l
+}
+
 type FromCBORLoader interface {
 	FromCBOR([]byte) error
 }
@@ -75,8 +96,77 @@ func printCoswid(cbor []byte, heading string) error {
 	return printJSONFromCBOR(&swid.SoftwareIdentity{}, cbor, heading)
 }
 
+// printCots prints the supplied CoTS with its TAs and CA certificates decoded,
+// followed by a warning for each certificate that is not currently valid
 func printCots(cbor []byte, heading string) error {
-	return printJSONFromCBOR(&cots.ConciseTaStore{}, cbor, heading)
+	if isCBORArray(cbor) {
+		return printCotsList(cbor, heading)
+	}
+
+	var cts cots.ConciseTaStore
+
+	if err := cts.FromCBOR(cbor); err != nil {
+		return fmt.Errorf("CBOR decoding failed: %w", err)
+	}
+
+	d := newCotsDisplay(&cts)
+
+	j, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return fmt.Errorf("JSON encoding failed: %w", err)
+	}
+
+	fmt.Println(heading)
+	fmt.Println(string(j))
+
+	for _, w := range d.warnings() {
+		fmt.Printf(">> WARNING: %s\n", w)
+	}
+
+	return nil
+}
+
+// printCotsList prints a concise-ta-stores list, prefixing the warnings with
+// the index of the CoTS they refer to
+func printCotsList(cbor []byte, heading string) error {
+	var stores cots.ConciseTaStores
+
+	if err := stores.FromCBOR(cbor); err != nil {
+		return fmt.Errorf("CBOR decoding failed: %w", err)
+	}
+
+	var (
+		displays []*cotsDisplay
+		warnings []string
+	)
+
+	for i := range stores {
+		d := newCotsDisplay(&stores[i])
+		displays = append(displays, d)
+
+		for _, w := range d.warnings() {
+			warnings = append(warnings, fmt.Sprintf("stores[%d]: %s", i, w))
+		}
+	}
+
+	j, err := json.MarshalIndent(displays, "", "  ")
+	if err != nil {
+		return fmt.Errorf("JSON encoding failed: %w", err)
+	}
+
+	fmt.Println(heading)
+	fmt.Println(string(j))
+
+	for _, w := range warnings {
+		fmt.Printf(">> WARNING: %s\n", w)
+	}
+
+	return nil
+}
+
+// isCBORArray tells whether the data starts with a CBOR array
+func isCBORArray(data []byte) bool {
+	return len(data) != 0 && data[0]>>5 == 4
 }
 
 func makeFileName(dirName, baseName, ext string) string {
@@ -90,3 +180,31 @@ func makeFileName(dirName, baseName, ext string) string {
 		)+ext,
 	)
 }
+
+// sortedRegisterIndices returns the indices of the integrity registers in a
+// stable order
+func sortedRegisterIndices(r *comid.IntegrityRegisters) []comid.IRegisterIndex {
+	ret := make([]comid.IRegisterIndex, 0, len(r.IndexMap))
+	for idx := range r.IndexMap {
+		ret = append(ret, idx)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return fmt.Sprint(ret[i]) < fmt.Sprint(ret[j])
+	})
+
+	return ret
+}
+
+// decodeHexOrBase64 decodes s as hex or, failing that, as standard base64
+func decodeHexOrBase64(s string) ([]byte, error) {
+	if v, err := hex.DecodeString(s); err == nil && len(v) > 0 {
+		return v, nil
+	}
+
+	if v, err := base64.StdEncoding.DecodeString(s); err == nil && len(v) > 0 {
+		return v, nil
+	}
+
+	return nil, fmt.Errorf("%q is neither hex nor base64", s)
+}
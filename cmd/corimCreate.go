@@ -137,7 +137,10 @@ func corimTemplateToCBOR(tmplFile string, comidFiles, coswidFiles, cotsFiles []s
 	}
 
 	if err = c.FromJSON(tmplData); err != nil {
-		return "", fmt.Errorf("error decoding template from %s: %w", tmplFile, err)
+		return "", fmt.Errorf(
+			"error decoding template from %s: %w",
+			tmplFile, locateTemplateErrors(tmplData, err, corimTemplateProbes),
+		)
 	}
 
 	// append CoMID(s)
@@ -96,7 +96,7 @@ func Test_CorimCreateCmd_template_with_invalid_json(t *testing.T) {
 	cmd.SetArgs(args)
 
 	err = cmd.Execute()
-	assert.EqualError(t, err, "error decoding template from invalid.json: invalid character '.' looking for beginning of value")
+	assert.EqualError(t, err, "error decoding template from invalid.json: 1:1: invalid character '.' looking for beginning of value")
 }
 
 func Test_CorimCreateCmd_with_a_bad_comid(t *testing.T) {
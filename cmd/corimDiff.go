@@ -0,0 +1,440 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/corim"
+)
+
+var corimDiffFormat string
+
+var corimDiffCmd = NewCorimDiffCmd()
+
+func NewCorimDiffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff <old.cbor> <new.cbor>",
+		Short: "show the differences between two signed or unsigned CoRIMs",
+		Long: `show the differences between two signed or unsigned CoRIMs
+
+	Compare the CoRIMs in files v1.cbor and v2.cbor, e.g., to review a new
+	release of an endorsement bundle.  Changes to the CoRIM header (id,
+	profile, validity, entities and dependent RIMs) and to the signer metadata
+	are reported, along with the embedded tags that were added, removed or
+	modified.  Tags are matched by their tag identifier; for modified CoMIDs,
+	the differences are reported down to the individual measurements (see
+	"cocli comid diff").
+
+	  cocli corim diff v1.cbor v2.cbor
+
+	Same as above, but report the differences in JSON.
+
+	  cocli corim diff v1.cbor v2.cbor --format=json
+	`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkCorimDiffArgs(args); err != nil {
+				return err
+			}
+
+			a, err := loadCorimTags(args[0])
+			if err != nil {
+				return err
+			}
+
+			b, err := loadCorimTags(args[1])
+			if err != nil {
+				return err
+			}
+
+			d, err := diffCorims(a, b)
+			if err != nil {
+				return err
+			}
+
+			return printCorimDiff(os.Stdout, d, args[0], args[1], corimDiffFormat)
+		},
+	}
+
+	cmd.Flags().StringVarP(
+		&corimDiffFormat, "format", "o", "text", "output format: text or json",
+	)
+
+	return cmd
+}
+
+func checkCorimDiffArgs(args []string) error {
+	if len(args) != 2 {
+		return errors.New("two CoRIM files must be supplied")
+	}
+
+	return checkDiffFormat(corimDiffFormat)
+}
+
+// loadCorimTags loads a signed or unsigned CoRIM and decodes its tags.  The
+// CoRIM is returned first, followed by each of its tags.
+func loadCorimTags(file string) ([]endorsement, error) {
+	data, err := afero.ReadFile(fs, file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading CoRIM from %s: %w", file, err)
+	}
+
+	u, meta, err := loadCorim(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding CoRIM from %s: %w", file, err)
+	}
+
+	ret := []endorsement{{File: file, Data: data, Corim: u, Meta: meta}}
+
+	for i, t := range u.Tags {
+		e, err := decodeCorimTag(t)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s:tags[%d]: %w", file, i, err)
+		}
+		e.File = file
+		e.Loc = fmt.Sprintf("tags[%d]", i)
+		ret = append(ret, *e)
+	}
+
+	return ret, nil
+}
+
+// tagDiff is an added, removed or modified tag.  For modified CoMIDs, Comid
+// holds the detailed differences.
+type tagDiff struct {
+	Kind  string     `json:"kind"`
+	ID    string     `json:"id"`
+	Op    string     `json:"op"`
+	Comid *comidDiff `json:"comid,omitempty"`
+}
+
+type corimDiff struct {
+	Header   []diffChange `json:"header,omitempty"`
+	Entities []diffChange `json:"entities,omitempty"`
+	Meta     []diffChange `json:"meta,omitempty"`
+	Tags     []tagDiff    `json:"tags,omitempty"`
+}
+
+func (o corimDiff) empty() bool {
+	return len(o.Header) == 0 && len(o.Entities) == 0 && len(o.Meta) == 0 && len(o.Tags) == 0
+}
+
+// diffCorims compares the CoRIMs a (old) and b (new), as returned by
+// loadCorimTags
+func diffCorims(a, b []endorsement) (*corimDiff, error) {
+	var (
+		d   corimDiff
+		err error
+	)
+
+	if d.Header, err = diffCorimHeader(a[0].Corim, b[0].Corim); err != nil {
+		return nil, err
+	}
+
+	if d.Entities, err = diffCorimEntities(a[0].Corim, b[0].Corim); err != nil {
+		return nil, err
+	}
+
+	if d.Meta, err = diffCorimMeta(a[0].Meta, b[0].Meta); err != nil {
+		return nil, err
+	}
+
+	if d.Tags, err = diffCorimTags(a[1:], b[1:]); err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// jsonString returns the compact JSON encoding of v, or the empty string if
+// v is absent
+func jsonString(v interface{}, absent bool) (string, error) {
+	if absent {
+		return "", nil
+	}
+
+	j, err := compactJSON(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(j), nil
+}
+
+func diffCorimHeader(a, b *corim.UnsignedCorim) ([]diffChange, error) {
+	changes := diffValue(nil, "corim-id", a.ID.String(), b.ID.String())
+
+	pa, err := jsonString(a.Profile, a.Profile == nil)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding profile: %w", err)
+	}
+
+	pb, err := jsonString(b.Profile, b.Profile == nil)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding profile: %w", err)
+	}
+
+	changes = diffValue(changes, "profile", pa, pb)
+
+	va, err := jsonString(a.RimValidity, a.RimValidity == nil)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding validity: %w", err)
+	}
+
+	vb, err := jsonString(b.RimValidity, b.RimValidity == nil)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding validity: %w", err)
+	}
+
+	changes = diffValue(changes, "validity", va, vb)
+
+	rims := func(u *corim.UnsignedCorim) ([]string, error) {
+		var ret []string
+
+		if u.DependentRims == nil {
+			return nil, nil
+		}
+
+		for _, l := range *u.DependentRims {
+			j, err := compactJSON(l)
+			if err != nil {
+				return nil, fmt.Errorf("error encoding dependent RIM: %w", err)
+			}
+			ret = append(ret, string(j))
+		}
+
+		return ret, nil
+	}
+
+	ra, err := rims(a)
+	if err != nil {
+		return nil, err
+	}
+
+	rb, err := rims(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffSets(changes, "dependent-rims", ra, rb), nil
+}
+
+func diffCorimEntities(a, b *corim.UnsignedCorim) ([]diffChange, error) {
+	collect := func(u *corim.UnsignedCorim) (namedValues, error) {
+		var ret namedValues
+
+		if u.Entities == nil {
+			return ret, nil
+		}
+
+		for _, e := range u.Entities.Values {
+			j, err := compactJSON(e)
+			if err != nil {
+				return ret, fmt.Errorf("error encoding entity: %w", err)
+			}
+
+			name := ""
+			if e.Name != nil {
+				name = e.Name.String()
+			}
+
+			ret.add(name, string(j))
+		}
+
+		return ret, nil
+	}
+
+	from, err := collect(a)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := collect(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffNamedValues(nil, from, to), nil
+}
+
+// diffCorimMeta compares the metadata of signed CoRIMs.  A nil meta stands
+// for an unsigned CoRIM.
+func diffCorimMeta(a, b *corim.Meta) ([]diffChange, error) {
+	signed := func(m *corim.Meta) string {
+		return fmt.Sprint(m != nil)
+	}
+
+	changes := diffValue(nil, "signed", signed(a), signed(b))
+
+	fields := func(m *corim.Meta) (map[string]string, error) {
+		ret := make(map[string]string)
+
+		if m == nil {
+			return ret, nil
+		}
+
+		ret["signer.name"] = m.Signer.Name
+
+		if m.Signer.URI != nil {
+			ret["signer.uri"] = string(*m.Signer.URI)
+		}
+
+		v, err := jsonString(m.Validity, m.Validity == nil)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding validity: %w", err)
+		}
+		ret["validity"] = v
+
+		return ret, nil
+	}
+
+	fa, err := fields(a)
+	if err != nil {
+		return nil, err
+	}
+
+	fb, err := fields(b)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range []string{"signer.name", "signer.uri", "validity"} {
+		changes = diffValue(changes, f, fa[f], fb[f])
+	}
+
+	return changes, nil
+}
+
+// corimTagID returns the identifier of an embedded tag, or its location in
+// the CoRIM for CoTS without a tag identity
+func corimTagID(e endorsement) string {
+	switch {
+	case e.Comid != nil:
+		return e.Comid.TagIdentity.TagID.String()
+	case e.Cots != nil && e.Cots.TagIdentity != nil:
+		return e.Cots.TagIdentity.TagID.String()
+	case e.Coswid != nil:
+		return e.Coswid.TagID.String()
+	}
+	return e.Loc
+}
+
+func diffCorimTags(a, b []endorsement) ([]tagDiff, error) {
+	var ids []string
+
+	collect := func(tags []endorsement) map[string]endorsement {
+		ret := make(map[string]endorsement)
+
+		for _, e := range tags {
+			id := e.Kind() + " " + corimTagID(e)
+			if indexOf(ids, id) == -1 {
+				ids = append(ids, id)
+			}
+			ret[id] = e
+		}
+
+		return ret
+	}
+
+	from, to := collect(a), collect(b)
+
+	var ret []tagDiff
+
+	for _, id := range ids {
+		ea, inA := from[id]
+		eb, inB := to[id]
+
+		e := ea
+		if !inA {
+			e = eb
+		}
+
+		td := tagDiff{Kind: e.Kind(), ID: corimTagID(e)}
+
+		switch {
+		case !inA:
+			td.Op = diffAdded
+		case !inB:
+			td.Op = diffRemoved
+		case ea.Comid != nil:
+			d, err := diffComids(ea.Comid, eb.Comid)
+			if err != nil {
+				return nil, fmt.Errorf("error comparing CoMID %s: %w", td.ID, err)
+			}
+			if d.empty() {
+				continue
+			}
+			td.Op, td.Comid = diffChanged, d
+		default:
+			ja, err := compactJSON(ea)
+			if err != nil {
+				return nil, fmt.Errorf("error encoding %s %s: %w", td.Kind, td.ID, err)
+			}
+			jb, err := compactJSON(eb)
+			if err != nil {
+				return nil, fmt.Errorf("error encoding %s %s: %w", td.Kind, td.ID, err)
+			}
+			if string(ja) == string(jb) {
+				continue
+			}
+			td.Op = diffChanged
+		}
+
+		ret = append(ret, td)
+	}
+
+	return ret, nil
+}
+
+func printCorimDiff(w io.Writer, d *corimDiff, fileA, fileB, format string) error {
+	if format == "json" {
+		j, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return fmt.Errorf("JSON encoding failed: %w", err)
+		}
+		fmt.Fprintln(w, string(j))
+		return nil
+	}
+
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", fileA, fileB)
+
+	if d.empty() {
+		fmt.Fprintln(w, "no differences")
+		return nil
+	}
+
+	for _, c := range d.Header {
+		writeDiffChange(w, "", c)
+	}
+
+	for _, c := range d.Entities {
+		c.Field = "entity " + c.Field
+		writeDiffChange(w, "", c)
+	}
+
+	for _, c := range d.Meta {
+		c.Field = "meta." + c.Field
+		writeDiffChange(w, "", c)
+	}
+
+	for _, td := range d.Tags {
+		fmt.Fprintf(w, "%s tag %s %s\n", diffOpSymbols[td.Op], td.Kind, td.ID)
+		if td.Comid != nil {
+			writeComidDiff(w, td.Comid, "    ")
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	corimCmd.AddCommand(corimDiffCmd)
+}
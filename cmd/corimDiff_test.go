@@ -0,0 +1,131 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/corim/corim"
+)
+
+func Test_CorimDiffCmd_wrong_number_of_args(t *testing.T) {
+	cmd := NewCorimDiffCmd()
+
+	cmd.SetArgs([]string{"a.cbor", "b.cbor", "c.cbor"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "two CoRIM files must be supplied")
+}
+
+func Test_CorimDiffCmd_not_a_corim(t *testing.T) {
+	cmd := NewCorimDiffCmd()
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "a.cbor", psaCorim(t), 0400))
+	require.NoError(t, afero.WriteFile(fs, "b.cbor", []byte{0xa0}, 0400))
+
+	cmd.SetArgs([]string{"a.cbor", "b.cbor"})
+
+	err := cmd.Execute()
+	assert.ErrorContains(t, err, "error decoding CoRIM from b.cbor: ")
+}
+
+func Test_CorimDiffCmd_ok(t *testing.T) {
+	cmd := NewCorimDiffCmd()
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "a.cbor", psaCorim(t), 0400))
+	require.NoError(t, afero.WriteFile(fs, "b.cbor", psaCorim(t), 0400))
+
+	cmd.SetArgs([]string{"a.cbor", "b.cbor", "--format=json"})
+
+	err := cmd.Execute()
+	assert.NoError(t, err)
+
+	corimDiffFormat = "text"
+}
+
+func diffTestCorim(t *testing.T, id string, comids ...*comid.Comid) []endorsement {
+	u := corim.NewUnsignedCorim().SetID(id)
+	require.NotNil(t, u)
+
+	for _, c := range comids {
+		require.NotNil(t, u.AddComid(*c))
+	}
+
+	data, err := u.ToCBOR()
+	require.NoError(t, err)
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "c.cbor", data, 0400))
+
+	e, err := loadCorimTags("c.cbor")
+	require.NoError(t, err)
+
+	return e
+}
+
+func Test_diffCorims(t *testing.T) {
+	data, err := os.ReadFile("../data/comid/comid-psa-iakpub.cbor")
+	require.NoError(t, err)
+
+	var iak comid.Comid
+	require.NoError(t, iak.FromCBOR(data))
+
+	refval := lintTestComid(t)
+	a := diffTestCorim(t, "corim-v1", refval)
+
+	refval.Triples.ReferenceValues.Values[0].Measurements.Values[0].Val.SVN = comid.MustNewSVN(2, comid.ExactValueType)
+	b := diffTestCorim(t, "corim-v2", refval, &iak)
+
+	d, err := diffCorims(a, b)
+	require.NoError(t, err)
+
+	assert.Equal(t,
+		[]diffChange{{Op: diffChanged, Field: "corim-id", From: "corim-v1", To: "corim-v2"}},
+		d.Header,
+	)
+	assert.Empty(t, d.Meta)
+
+	require.Len(t, d.Tags, 2)
+
+	assert.Equal(t, "43bbe37f-2e61-4b33-aed3-53cff1428b16", d.Tags[0].ID)
+	assert.Equal(t, diffChanged, d.Tags[0].Op)
+	require.NotNil(t, d.Tags[0].Comid)
+	require.Len(t, d.Tags[0].Comid.Measurements, 1)
+	assert.Equal(t,
+		[]diffChange{{Op: diffAdded, Field: "svn", To: `{"type":"exact-value","value":2}`}},
+		d.Tags[0].Comid.Measurements[0].Changes,
+	)
+
+	assert.Equal(t, tagDiff{Kind: "CoMID", ID: "366d0a0a-5988-45ed-8488-2f2a544f6242", Op: diffAdded}, d.Tags[1])
+
+	var out bytes.Buffer
+	require.NoError(t, printCorimDiff(&out, d, "a.cbor", "b.cbor", "text"))
+	assert.Contains(t, out.String(), "~ tag CoMID 43bbe37f-2e61-4b33-aed3-53cff1428b16\n")
+	assert.Contains(t, out.String(), "          + svn: {\"type\":\"exact-value\",\"value\":2}\n")
+	assert.Contains(t, out.String(), "+ tag CoMID 366d0a0a-5988-45ed-8488-2f2a544f6242\n")
+}
+
+func Test_diffCorimMeta(t *testing.T) {
+	a := &corim.Meta{Signer: corim.Signer{Name: "ACME"}}
+	b := &corim.Meta{Signer: corim.Signer{Name: "ACME Ltd."}}
+
+	changes, err := diffCorimMeta(a, b)
+	require.NoError(t, err)
+	assert.Equal(t, []diffChange{{Op: diffChanged, Field: "signer.name", From: "ACME", To: "ACME Ltd."}}, changes)
+
+	changes, err = diffCorimMeta(nil, a)
+	require.NoError(t, err)
+	assert.Equal(t, []diffChange{
+		{Op: diffChanged, Field: "signed", From: "false", To: "true"},
+		{Op: diffAdded, Field: "signer.name", To: "ACME"},
+	}, changes)
+}
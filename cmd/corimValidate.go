@@ -0,0 +1,205 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/corim"
+)
+
+var (
+	corimValidateCorimFile *string
+	corimValidateProfile   *string
+	corimValidateCDDL      *bool
+)
+
+var corimValidateCmd = NewCorimValidateCmd()
+
+func NewCorimValidateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "validate a CBOR-encoded CoRIM and the tags it embeds",
+		Long: `validate a CBOR-encoded CoRIM and the tags it embeds
+
+	Validate the (signed or unsigned) CoRIM in corim.cbor.  If the CoRIM has a
+	profile field naming a known profile, the embedded CoMIDs are also checked
+	against the profile's rules.
+
+	  cocli corim validate --file=corim.cbor
+
+	Validate the CoRIM in corim.cbor applying the rules of the CCA platform
+	profile, regardless of the CoRIM profile field.
+
+	  cocli corim validate --file=corim.cbor --profile=cca
+
+	Check the CoRIM in corim.cbor, including the signature envelope and the
+	CoMID, CoSWID and CoTS tags it embeds, against the CDDL.  Any mismatch
+	(e.g., an unknown map key) is reported by its path in the CoRIM.
+
+	  cocli corim validate --file=corim.cbor --cddl
+	`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkCorimValidateArgs(); err != nil {
+				return err
+			}
+
+			validate := func() error {
+				return validateCorim(*corimValidateCorimFile, *corimValidateProfile)
+			}
+			if *corimValidateCDDL {
+				validate = func() error { return validateCorimCDDL(*corimValidateCorimFile) }
+			}
+
+			if err := validate(); err != nil {
+				return err
+			}
+			fmt.Printf("[valid] %q\n", *corimValidateCorimFile)
+
+			return nil
+		},
+	}
+
+	corimValidateCorimFile = cmd.Flags().StringP("file", "f", "", "a CoRIM file (in CBOR format)")
+	corimValidateProfile = cmd.Flags().StringP("profile", "p", "",
+		"apply the rules of this profile (psa, cca, cca-realm, dice or a profile identifier) instead of the one in the CoRIM")
+	corimValidateCDDL = cmd.Flags().Bool("cddl", false,
+		"check the conformance of the encoding to the CoRIM CDDL instead")
+
+	return cmd
+}
+
+func checkCorimValidateArgs() error {
+	if corimValidateCorimFile == nil || *corimValidateCorimFile == "" {
+		return errors.New("no CoRIM supplied")
+	}
+
+	if corimValidateCDDL != nil && *corimValidateCDDL &&
+		corimValidateProfile != nil && *corimValidateProfile != "" {
+		return errors.New("--cddl and --profile cannot be used together")
+	}
+
+	return nil
+}
+
+// loadCorim decodes the supplied buffer as a signed CoRIM, falling back to an
+// unsigned CoRIM.  The returned Meta is nil if the CoRIM is unsigned.
+func loadCorim(data []byte) (*corim.UnsignedCorim, *corim.Meta, error) {
+	var s corim.SignedCorim
+	if err := s.FromCOSE(data); err == nil {
+		return &s.UnsignedCorim, &s.Meta, nil
+	}
+
+	var u corim.UnsignedCorim
+	if err := u.FromCBOR(data); err != nil {
+		return nil, nil, err
+	}
+
+	return &u, nil, nil
+}
+
+func validateCorim(corimFile, profileName string) error {
+	var (
+		corimCBOR []byte
+		profile   *comidProfile
+		err       error
+	)
+
+	if profileName != "" {
+		if profile, err = lookupComidProfile(profileName); err != nil {
+			return err
+		}
+	}
+
+	if corimCBOR, err = afero.ReadFile(fs, corimFile); err != nil {
+		return fmt.Errorf("error loading CoRIM from %s: %w", corimFile, err)
+	}
+
+	u, meta, err := loadCorim(corimCBOR)
+	if err != nil {
+		return fmt.Errorf("error decoding CoRIM (signed or unsigned) from %s: %w", corimFile, err)
+	}
+
+	if err = u.Valid(); err != nil {
+		return fmt.Errorf("error validating CoRIM %s: %w", corimFile, err)
+	}
+
+	if meta != nil {
+		if err = meta.Valid(); err != nil {
+			return fmt.Errorf("error validating CoRIM Meta %s: %w", corimFile, err)
+		}
+	}
+
+	// fall back to the profile declared in the CoRIM, if we know about it
+	if profile == nil && u.Profile != nil {
+		if id, err := u.Profile.Get(); err == nil {
+			if profile, err = lookupComidProfile(id); err != nil {
+				fmt.Printf(">> WARNING: %s: %v, profile checks skipped\n", corimFile, err)
+			}
+		}
+	}
+
+	errs := 0
+	for i, t := range u.Tags {
+		if err := validateTag(t, profile); err != nil {
+			fmt.Printf("[invalid] tag at index %d: %v\n", i, err)
+			errs++
+		}
+	}
+
+	if errs != 0 {
+		return fmt.Errorf("%d/%d tag validation(s) failed in %s", errs, len(u.Tags), corimFile)
+	}
+
+	return nil
+}
+
+// validateCorimCDDL checks the raw CBOR in corimFile against the CoRIM CDDL
+func validateCorimCDDL(corimFile string) error {
+	corimCBOR, err := afero.ReadFile(fs, corimFile)
+	if err != nil {
+		return fmt.Errorf("error loading CoRIM from %s: %w", corimFile, err)
+	}
+
+	if err = checkCDDL(corimCBOR, "corim"); err != nil {
+		return fmt.Errorf("error checking CoRIM %s against the CDDL: %w", corimFile, err)
+	}
+
+	return nil
+}
+
+// validateTag decodes and validates a single CoRIM tag.  If profile is not
+// nil, CoMIDs are also checked against its rules.
+func validateTag(t corim.Tag, profile *comidProfile) error {
+	e, err := decodeCorimTag(t)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case e.Comid != nil:
+		if err := e.Comid.Valid(); err != nil {
+			return fmt.Errorf("error validating CoMID: %w", err)
+		}
+		if profile != nil {
+			if err := checkComidProfile(profile, e.Comid, e.Data); err != nil {
+				return fmt.Errorf("error validating CoMID: %w", err)
+			}
+		}
+	case e.Cots != nil:
+		if err := e.Cots.Valid(); err != nil {
+			return fmt.Errorf("error validating CoTS: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	corimCmd.AddCommand(corimValidateCmd)
+}
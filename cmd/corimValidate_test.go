@@ -0,0 +1,190 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/corim/corim"
+)
+
+// psaCorim returns an unsigned CoRIM wrapping the PSA reference values CoMID
+// from the data/ directory
+func psaCorim(t *testing.T) []byte {
+	return psaCorimWithProfile(t, "http://arm.com/psa/iot/1")
+}
+
+// psaCorimWithProfile is like psaCorim, with the supplied profile
+func psaCorimWithProfile(t *testing.T, profile string) []byte {
+	data, err := os.ReadFile("../data/comid/comid-psa-refval.cbor")
+	require.NoError(t, err)
+
+	var c comid.Comid
+	require.NoError(t, c.FromCBOR(data))
+
+	u := corim.NewUnsignedCorim().
+		SetID("5c57e8f4-46cd-421b-91c9-08cf93e13cfc").
+		SetProfile(profile).
+		AddComid(c)
+	require.NotNil(t, u)
+
+	cbor, err := u.ToCBOR()
+	require.NoError(t, err)
+
+	return cbor
+}
+
+func Test_CorimValidateCmd_unknown_argument(t *testing.T) {
+	cmd := NewCorimValidateCmd()
+
+	args := []string{"--unknown-argument=val"}
+	cmd.SetArgs(args)
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "unknown flag: --unknown-argument")
+}
+
+func Test_CorimValidateCmd_mandatory_args_missing_corim_file(t *testing.T) {
+	cmd := NewCorimValidateCmd()
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no CoRIM supplied")
+}
+
+func Test_CorimValidateCmd_non_existent_corim_file(t *testing.T) {
+	cmd := NewCorimValidateCmd()
+
+	args := []string{
+		"--file=nonexistent.cbor",
+	}
+	cmd.SetArgs(args)
+
+	fs = afero.NewMemMapFs()
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "error loading CoRIM from nonexistent.cbor: open nonexistent.cbor: file does not exist")
+}
+
+func Test_CorimValidateCmd_invalid_unsigned_corim(t *testing.T) {
+	cmd := NewCorimValidateCmd()
+
+	args := []string{
+		"--file=invalid.cbor",
+	}
+	cmd.SetArgs(args)
+
+	fs = afero.NewMemMapFs()
+	err := afero.WriteFile(fs, "invalid.cbor", testCorimInvalid, 0644)
+	require.NoError(t, err)
+
+	err = cmd.Execute()
+	assert.EqualError(t, err, `error decoding CoRIM (signed or unsigned) from invalid.cbor: missing mandatory field "Tags" (1)`)
+}
+
+func Test_CorimValidateCmd_ok(t *testing.T) {
+	cmd := NewCorimValidateCmd()
+
+	args := []string{
+		"--file=ok.cbor",
+	}
+	cmd.SetArgs(args)
+
+	fs = afero.NewMemMapFs()
+	err := afero.WriteFile(fs, "ok.cbor", psaCorim(t), 0644)
+	require.NoError(t, err)
+
+	err = cmd.Execute()
+	assert.NoError(t, err)
+}
+
+func Test_CorimValidateCmd_bad_tag(t *testing.T) {
+	cmd := NewCorimValidateCmd()
+
+	args := []string{
+		"--file=bad-tag.cbor",
+	}
+	cmd.SetArgs(args)
+
+	fs = afero.NewMemMapFs()
+	err := afero.WriteFile(fs, "bad-tag.cbor", testSignedCorimValid, 0644)
+	require.NoError(t, err)
+
+	err = cmd.Execute()
+	assert.EqualError(t, err, "1/1 tag validation(s) failed in bad-tag.cbor")
+}
+
+func Test_CorimValidateCmd_profile_violation(t *testing.T) {
+	cmd := NewCorimValidateCmd()
+
+	args := []string{
+		"--file=ok.cbor",
+		"--profile=dice",
+	}
+	cmd.SetArgs(args)
+
+	fs = afero.NewMemMapFs()
+	err := afero.WriteFile(fs, "ok.cbor", psaCorim(t), 0644)
+	require.NoError(t, err)
+
+	err = cmd.Execute()
+	assert.EqualError(t, err, "1/1 tag validation(s) failed in ok.cbor")
+}
+
+func Test_CorimValidateCmd_unknown_profile(t *testing.T) {
+	cmd := NewCorimValidateCmd()
+
+	args := []string{
+		"--file=ok.cbor",
+	}
+	cmd.SetArgs(args)
+
+	// an unknown profile is reported, and its checks skipped
+	fs = afero.NewMemMapFs()
+	err := afero.WriteFile(fs, "ok.cbor", psaCorimWithProfile(t, "http://example.com/unknown"), 0644)
+	require.NoError(t, err)
+
+	err = cmd.Execute()
+	assert.NoError(t, err)
+}
+
+func Test_CorimValidateCmd_cddl_ok(t *testing.T) {
+	cmd := NewCorimValidateCmd()
+
+	args := []string{
+		"--file=ok.cbor",
+		"--cddl",
+	}
+	cmd.SetArgs(args)
+
+	fs = afero.NewMemMapFs()
+	err := afero.WriteFile(fs, "ok.cbor", psaCorim(t), 0644)
+	require.NoError(t, err)
+
+	err = cmd.Execute()
+	assert.NoError(t, err)
+}
+
+func Test_CorimValidateCmd_cddl_violation(t *testing.T) {
+	cmd := NewCorimValidateCmd()
+
+	args := []string{
+		"--file=signed.cbor",
+		"--cddl",
+	}
+	cmd.SetArgs(args)
+
+	fs = afero.NewMemMapFs()
+	err := afero.WriteFile(fs, "signed.cbor", testSignedCorimValid, 0644)
+	require.NoError(t, err)
+
+	// the PSA implementation ID is encoded as a text string
+	err = cmd.Execute()
+	assert.EqualError(t, err, "error checking CoRIM signed.cbor against the CDDL: "+
+		"[2].tags[0].triples.reference-triples[0][0].class.class-id: got text string, want implementation-id-type")
+}
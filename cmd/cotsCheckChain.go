@@ -0,0 +1,538 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/cots"
+)
+
+var (
+	cotsCheckChainCotsFile      string
+	cotsCheckChainCertFile      string
+	cotsCheckChainIntermediates []string
+	cotsCheckChainPurpose       string
+	cotsCheckChainEnvFile       string
+)
+
+// check-chain result statuses
+const (
+	chainCheckOK      = "ok"
+	chainCheckFail    = "fail"
+	chainCheckSkipped = "skipped"
+)
+
+var cotsCheckChainCmd = NewCotsCheckChainCmd()
+
+func NewCotsCheckChainCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "check-chain",
+		Short: "check whether a certificate chain is anchored by the TAs of a CoTS",
+		Long: `check whether a certificate chain is anchored by the TAs of a CoTS
+
+	The CoTS applies if one of its environments matches the supplied ones (an
+	environment template, as used by cots create) and, if it lists purposes,
+	the supplied purpose is among them.  The leaf certificate is then
+	validated against each TA in turn, using the supplied intermediates and the
+	CA certificates of the CoTS.  TAs that are bare public keys anchor the
+	chain if they signed one of its certificates.  The subject (sub) and issuer
+	(iss) of the permitted and excluded claims are checked against the leaf
+	certificate; other claims cannot be evaluated and are reported as such.
+
+	Check that the CoTS in store.cbor accepts the device certificate in
+	leaf.pem, issued by the intermediate CA in ica.pem, for EAT signing by an
+	environment described in env.json:
+
+	  cocli cots check-chain --cots=store.cbor --cert=leaf.pem \
+	                         --intermediates=ica.pem \
+	                         --purpose=eat --env=env.json
+
+	The certificate file may also be a PEM bundle with the leaf first, followed
+	by its intermediates.
+	`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkCotsCheckChainArgs(); err != nil {
+				return err
+			}
+
+			store, err := loadCots(cotsCheckChainCotsFile)
+			if err != nil {
+				return err
+			}
+
+			certs, err := loadCertificates(cotsCheckChainCertFile)
+			if err != nil {
+				return err
+			}
+
+			leaf, intermediates := certs[0], certs[1:]
+			for _, file := range cotsCheckChainIntermediates {
+				certs, err := loadCertificates(file)
+				if err != nil {
+					return err
+				}
+				intermediates = append(intermediates, certs...)
+			}
+
+			var envs cots.EnvironmentGroups
+			if cotsCheckChainEnvFile != "" {
+				data, err := afero.ReadFile(fs, cotsCheckChainEnvFile)
+				if err != nil {
+					return fmt.Errorf("error loading environments from %s: %w", cotsCheckChainEnvFile, err)
+				}
+				if err := envs.FromJSON(data); err != nil {
+					return fmt.Errorf("error decoding environments from %s: %w", cotsCheckChainEnvFile, err)
+				}
+			}
+
+			results, anchor := checkChain(store, leaf, intermediates, cotsCheckChainPurpose, envs)
+
+			for _, r := range results {
+				fmt.Printf("[%s] %s: %s\n", r.Status, r.Check, r.Detail)
+			}
+
+			if anchor < 0 {
+				return fmt.Errorf("chain of %q not accepted by %s", leaf.Subject.String(), cotsCheckChainCotsFile)
+			}
+
+			fmt.Printf(">> chain of %q anchored by tas[%d]\n", leaf.Subject.String(), anchor)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(
+		&cotsCheckChainCotsFile, "cots", "c", "", "a CoTS file (in CBOR format)",
+	)
+
+	cmd.Flags().StringVar(
+		&cotsCheckChainCertFile, "cert", "", "the leaf certificate (DER or PEM, optionally followed by its intermediates)",
+	)
+
+	cmd.Flags().StringArrayVarP(
+		&cotsCheckChainIntermediates, "intermediates", "i", []string{},
+		"a file of intermediate certificates (DER or PEM bundle)",
+	)
+
+	cmd.Flags().StringVarP(
+		&cotsCheckChainPurpose, "purpose", "u", "",
+		"the purpose the chain is used for: cots,corim,comid,coswid,eat,certificate",
+	)
+
+	cmd.Flags().StringVarP(
+		&cotsCheckChainEnvFile, "env", "e", "", "an environment template file (in JSON format)",
+	)
+
+	return cmd
+}
+
+func checkCotsCheckChainArgs() error {
+	if cotsCheckChainCotsFile == "" {
+		return errors.New("no CoTS supplied")
+	}
+
+	if cotsCheckChainCertFile == "" {
+		return errors.New("no certificate supplied")
+	}
+
+	return nil
+}
+
+func loadCots(file string) (*cots.ConciseTaStore, error) {
+	data, err := afero.ReadFile(fs, file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading CoTS from %s: %w", file, err)
+	}
+
+	var store cots.ConciseTaStore
+	if err := store.FromCBOR(data); err != nil {
+		return nil, fmt.Errorf("error decoding CoTS from %s: %w", file, err)
+	}
+
+	return &store, nil
+}
+
+// loadCertificates returns the certificates in a DER file or a PEM bundle
+func loadCertificates(file string) ([]*x509.Certificate, error) {
+	data, err := afero.ReadFile(fs, file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading certificates from %s: %w", file, err)
+	}
+
+	ders, err := pemBundleCerts(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding certificates from %s: %w", file, err)
+	}
+
+	var certs []*x509.Certificate
+	for _, der := range ders {
+		// already checked by pemBundleCerts
+		cert, _ := x509.ParseCertificate(der)
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
+
+type chainCheckResult struct {
+	Check  string
+	Status string
+	Detail string
+}
+
+// checkChain checks whether the CoTS applies to the supplied purpose and
+// environments, and which of its TAs, if any, anchors the chain of the leaf
+// certificate.  It returns the results of each check and the index of the
+// anchoring TA, or -1 if the chain is not accepted.
+func checkChain(
+	store *cots.ConciseTaStore, leaf *x509.Certificate, intermediates []*x509.Certificate,
+	purpose string, envs cots.EnvironmentGroups,
+) ([]chainCheckResult, int) {
+	results := []chainCheckResult{
+		checkStoreEnvironments(store.Environments, envs),
+		checkStorePurposes(store.Purposes, purpose),
+	}
+	results = append(results, checkStoreClaims(store, leaf)...)
+
+	accepted := true
+	for _, r := range results {
+		if r.Status == chainCheckFail {
+			accepted = false
+		}
+	}
+
+	if store.Keys != nil {
+		for _, ca := range store.Keys.Cas {
+			if cert, err := x509.ParseCertificate(ca); err == nil {
+				intermediates = append(intermediates, cert)
+			}
+		}
+	}
+
+	anchor := -1
+
+	if !accepted || store.Keys == nil {
+		return results, anchor
+	}
+
+	for i, ta := range store.Keys.Tas {
+		check := fmt.Sprintf("tas[%d] (%s)", i, taLabel(ta))
+
+		chain, err := anchorChain(ta, leaf, intermediates)
+		if err != nil {
+			results = append(results, chainCheckResult{check, chainCheckFail, err.Error()})
+			continue
+		}
+
+		results = append(results, chainCheckResult{check, chainCheckOK, "anchors " + chainString(chain)})
+
+		if anchor < 0 {
+			anchor = i
+		}
+	}
+
+	return results, anchor
+}
+
+func checkStoreEnvironments(storeEnvs, envs cots.EnvironmentGroups) chainCheckResult {
+	const check = "environments"
+
+	if len(envs) == 0 {
+		return chainCheckResult{check, chainCheckSkipped, "no environment supplied"}
+	}
+
+	for i, se := range storeEnvs {
+		for _, e := range envs {
+			if envGroupMatches(se, e) {
+				return chainCheckResult{check, chainCheckOK, fmt.Sprintf("environments[%d] applies", i)}
+			}
+		}
+	}
+
+	return chainCheckResult{check, chainCheckFail, "no environment of the CoTS applies"}
+}
+
+// envGroupMatches checks whether the environment group of a CoTS applies to
+// the supplied one: the attributes set in the CoTS environment must all have
+// the same value in the supplied environment
+func envGroupMatches(pattern, eg cots.EnvironmentGroup) bool {
+	switch {
+	case pattern.Environment != nil:
+		if eg.Environment == nil {
+			return false
+		}
+		want := map[string]string{}
+		for k, v := range findEnvAttrs(*pattern.Environment) {
+			if v != "" {
+				want[k] = v
+			}
+		}
+		return findMatchEnv(*eg.Environment, want)
+	case pattern.NamedTaStore != nil:
+		return eg.NamedTaStore != nil && *eg.NamedTaStore == *pattern.NamedTaStore
+	case pattern.SwidTag != nil:
+		if eg.SwidTag == nil {
+			return false
+		}
+		a, _ := json.Marshal(pattern.SwidTag)
+		b, _ := json.Marshal(eg.SwidTag)
+		return string(a) == string(b)
+	}
+
+	return false
+}
+
+func checkStorePurposes(purposes []string, purpose string) chainCheckResult {
+	const check = "purposes"
+
+	switch {
+	case len(purposes) == 0:
+		return chainCheckResult{check, chainCheckOK, "the CoTS applies to any purpose"}
+	case purpose == "":
+		return chainCheckResult{check, chainCheckSkipped, "no purpose supplied"}
+	}
+
+	for _, p := range purposes {
+		if p == purpose {
+			return chainCheckResult{check, chainCheckOK, fmt.Sprintf("%q is listed", purpose)}
+		}
+	}
+
+	return chainCheckResult{
+		check, chainCheckFail, fmt.Sprintf("%q is not among %s", purpose, strings.Join(purposes, ", ")),
+	}
+}
+
+// checkStoreClaims checks the subject and issuer of the leaf certificate
+// against the permitted and excluded claims of the CoTS
+func checkStoreClaims(store *cots.ConciseTaStore, leaf *x509.Certificate) []chainCheckResult {
+	var (
+		results     []chainCheckResult
+		unevaluated = map[string]bool{}
+	)
+
+	evaluate := func(c cots.EatCWTClaim) (subOK, issOK *bool) {
+		for _, name := range claimNames(c) {
+			if name != "sub" && name != "iss" {
+				unevaluated[name] = true
+			}
+		}
+		if c.Subject != nil {
+			ok := *c.Subject == leaf.Subject.String() || *c.Subject == leaf.Subject.CommonName
+			subOK = &ok
+		}
+		if c.Issuer != nil {
+			ok := *c.Issuer == leaf.Issuer.String() || *c.Issuer == leaf.Issuer.CommonName
+			issOK = &ok
+		}
+		return subOK, issOK
+	}
+
+	if len(store.PermClaims) != 0 {
+		constrained, permitted := false, false
+		for _, c := range store.PermClaims {
+			subOK, issOK := evaluate(c)
+			if subOK == nil && issOK == nil {
+				continue
+			}
+			constrained = true
+			if (subOK == nil || *subOK) && (issOK == nil || *issOK) {
+				permitted = true
+			}
+		}
+
+		switch {
+		case !constrained:
+		case permitted:
+			results = append(results, chainCheckResult{"permclaims", chainCheckOK, "the leaf subject and issuer are permitted"})
+		default:
+			results = append(results, chainCheckResult{"permclaims", chainCheckFail, "the leaf subject or issuer is not permitted"})
+		}
+	}
+
+	if len(store.ExclClaims) != 0 {
+		constrained, excluded := false, false
+		for _, c := range store.ExclClaims {
+			subOK, issOK := evaluate(c)
+			if subOK == nil && issOK == nil {
+				continue
+			}
+			constrained = true
+			if (subOK == nil || *subOK) && (issOK == nil || *issOK) {
+				excluded = true
+			}
+		}
+
+		switch {
+		case !constrained:
+		case excluded:
+			results = append(results, chainCheckResult{"exclclaims", chainCheckFail, "the leaf subject or issuer is excluded"})
+		default:
+			results = append(results, chainCheckResult{"exclclaims", chainCheckOK, "the leaf subject and issuer are not excluded"})
+		}
+	}
+
+	if len(unevaluated) != 0 {
+		var names []string
+		for name := range unevaluated {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		results = append(results, chainCheckResult{
+			"claims", chainCheckSkipped,
+			"cannot be evaluated against a certificate chain: " + strings.Join(names, ", "),
+		})
+	}
+
+	return results
+}
+
+// claimNames returns the names of the claims set in c, as in its JSON
+// serialization
+func claimNames(c cots.EatCWTClaim) []string {
+	var names []string
+	for name := range claimsToJSON(c) {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// anchorChain returns the chain from the leaf to the supplied TA.  TAs with
+// a certificate are used as roots.  TAs that are bare public keys anchor the
+// chain if they signed one of its certificates, which is then used as root.
+func anchorChain(ta cots.TrustAnchor, leaf *x509.Certificate, intermediates []*x509.Certificate) ([]*x509.Certificate, error) {
+	var (
+		root    *x509.Certificate
+		pubKey  []byte
+		pathLen *int
+	)
+
+	switch ta.Format {
+	case cots.TaFormatCertificate:
+		cert, err := x509.ParseCertificate(ta.Data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TA: %w", err)
+		}
+		root = cert
+	case cots.TaFormatSubjectPublicKeyInfo:
+		pubKey = ta.Data
+	case cots.TaFormatTrustAnchorInfo:
+		tai, err := parseTrustAnchorInfo(ta.Data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TA: %w", err)
+		}
+		pubKey = tai.PubKey
+		if tai.CertPath != nil {
+			root = tai.CertPath.Certificate
+			pathLen = tai.CertPath.PathLenConstraint
+		}
+	default:
+		return nil, fmt.Errorf("unknown TA format %d", ta.Format)
+	}
+
+	if root == nil {
+		var err error
+		if root, err = keySignedCertificate(pubKey, append([]*x509.Certificate{leaf}, intermediates...)); err != nil {
+			return nil, err
+		}
+	}
+
+	chain, err := verifyChain(leaf, root, intermediates)
+	if err != nil {
+		return nil, err
+	}
+
+	// the TA and the leaf are not counted
+	if pathLen != nil && len(chain)-2 > *pathLen {
+		return nil, fmt.Errorf(
+			"chain has %d intermediate(s), more than the TA path length constraint (%d)", len(chain)-2, *pathLen,
+		)
+	}
+
+	return chain, nil
+}
+
+// keySignedCertificate returns the first of the supplied certificates signed
+// with the supplied public key
+func keySignedCertificate(spki []byte, certs []*x509.Certificate) (*x509.Certificate, error) {
+	pub, err := x509.ParsePKIXPublicKey(spki)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TA public key: %w", err)
+	}
+
+	// a certificate carrying the key, without constraints of its own
+	issuer := &x509.Certificate{PublicKey: pub}
+
+	for _, c := range certs {
+		if issuer.CheckSignature(c.SignatureAlgorithm, c.RawTBSCertificate, c.Signature) == nil {
+			return c, nil
+		}
+	}
+
+	return nil, errors.New("the TA key did not sign any certificate of the chain")
+}
+
+func verifyChain(leaf, root *x509.Certificate, intermediates []*x509.Certificate) ([]*x509.Certificate, error) {
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	inters := x509.NewCertPool()
+	for _, c := range intermediates {
+		inters.AddCert(c)
+	}
+
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: inters,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return chains[0], nil
+}
+
+func chainString(chain []*x509.Certificate) string {
+	var names []string
+	for _, c := range chain {
+		names = append(names, fmt.Sprintf("%q", c.Subject.String()))
+	}
+	return strings.Join(names, " <- ")
+}
+
+// taLabel returns a short description of a TA: the subject of its
+// certificate, its title, or the fingerprint of its public key
+func taLabel(ta cots.TrustAnchor) string {
+	d := decodeTrustAnchor(ta)
+
+	switch {
+	case d.Certificate != nil:
+		return "certificate " + d.Certificate.Subject
+	case d.SPKI != nil:
+		return "public key " + d.SPKI.Fingerprint[:16]
+	case d.TrustAnchorInfo != nil && d.TrustAnchorInfo.Title != "":
+		return "TrustAnchorInfo " + d.TrustAnchorInfo.Title
+	case d.TrustAnchorInfo != nil && d.TrustAnchorInfo.CertPath != nil:
+		return "TrustAnchorInfo " + d.TrustAnchorInfo.CertPath.TaName
+	case d.TrustAnchorInfo != nil:
+		return "TrustAnchorInfo " + d.TrustAnchorInfo.PublicKey.Fingerprint[:16]
+	}
+
+	return d.Format
+}
+
+func init() {
+	cotsCmd.AddCommand(cotsCheckChainCmd)
+}
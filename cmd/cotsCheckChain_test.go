@@ -0,0 +1,281 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/corim/cots"
+)
+
+// testIssueCert returns a certificate for name issued by parent (self-signed
+// if parent is nil) and its private key
+func testIssueCert(
+	t *testing.T, name string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey,
+) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+	}
+	if isCA {
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	}
+
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert, key
+}
+
+type testChain struct {
+	root, ica, leaf *x509.Certificate
+}
+
+func newTestChain(t *testing.T) testChain {
+	root, rootKey := testIssueCert(t, "Test Root", true, nil, nil)
+	ica, icaKey := testIssueCert(t, "Test ICA", true, root, rootKey)
+	leaf, _ := testIssueCert(t, "Test Device", false, ica, icaKey)
+
+	return testChain{root, ica, leaf}
+}
+
+func testVendorEnv(vendor string) *comid.Environment {
+	return &comid.Environment{Class: &comid.Class{Vendor: &vendor}}
+}
+
+func testStore(tas ...cots.TrustAnchor) *cots.ConciseTaStore {
+	s := cots.NewConciseTaStore()
+	s.AddEnvironmentGroup(cots.EnvironmentGroup{Environment: testVendorEnv("ACME")})
+	s.SetKeys(cots.TasAndCas{Tas: tas})
+	return s
+}
+
+func Test_checkChain_certificate_ta(t *testing.T) {
+	c := newTestChain(t)
+	other, _ := testIssueCert(t, "Other Root", true, nil, nil)
+
+	store := testStore(
+		cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: other.Raw},
+		cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: c.root.Raw},
+	)
+
+	results, anchor := checkChain(store, c.leaf, []*x509.Certificate{c.ica}, "eat", nil)
+	assert.Equal(t, 1, anchor)
+	assert.Equal(t, []chainCheckResult{
+		{"environments", chainCheckSkipped, "no environment supplied"},
+		{"purposes", chainCheckOK, "the CoTS applies to any purpose"},
+		{"tas[0] (certificate CN=Other Root)", chainCheckFail, "x509: certificate signed by unknown authority"},
+		{"tas[1] (certificate CN=Test Root)", chainCheckOK, `anchors "CN=Test Device" <- "CN=Test ICA" <- "CN=Test Root"`},
+	}, results)
+
+	// without the intermediate
+	_, anchor = checkChain(store, c.leaf, nil, "eat", nil)
+	assert.Equal(t, -1, anchor)
+}
+
+func Test_checkChain_store_ca(t *testing.T) {
+	c := newTestChain(t)
+
+	store := testStore(cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: c.root.Raw})
+	store.Keys.Cas = [][]byte{c.ica.Raw}
+
+	_, anchor := checkChain(store, c.leaf, nil, "", nil)
+	assert.Equal(t, 0, anchor)
+}
+
+func Test_checkChain_key_ta(t *testing.T) {
+	c := newTestChain(t)
+
+	store := testStore(
+		cots.TrustAnchor{Format: cots.TaFormatSubjectPublicKeyInfo, Data: c.root.RawSubjectPublicKeyInfo},
+	)
+
+	results, anchor := checkChain(store, c.leaf, []*x509.Certificate{c.ica}, "", nil)
+	require.Equal(t, 0, anchor)
+	assert.Equal(t, chainCheckOK, results[2].Status)
+	assert.Equal(t, `anchors "CN=Test Device" <- "CN=Test ICA"`, results[2].Detail)
+
+	store = testStore(
+		cots.TrustAnchor{Format: cots.TaFormatSubjectPublicKeyInfo, Data: c.leaf.RawSubjectPublicKeyInfo},
+	)
+
+	results, anchor = checkChain(store, c.leaf, []*x509.Certificate{c.ica}, "", nil)
+	assert.Equal(t, -1, anchor)
+	assert.Equal(t, "the TA key did not sign any certificate of the chain", results[2].Detail)
+}
+
+func Test_checkChain_ta_info_path_length(t *testing.T) {
+	c := newTestChain(t)
+
+	// testTrustAnchorInfo sets a path length constraint of 3
+	store := testStore(
+		cots.TrustAnchor{Format: cots.TaFormatTrustAnchorInfo, Data: testTrustAnchorInfo(t, c.root)},
+	)
+
+	results, anchor := checkChain(store, c.leaf, []*x509.Certificate{c.ica}, "", nil)
+	assert.Equal(t, 0, anchor)
+	assert.Equal(t, "tas[0] (TrustAnchorInfo Test TA)", results[2].Check)
+}
+
+func Test_checkChain_not_applicable(t *testing.T) {
+	c := newTestChain(t)
+
+	store := testStore(cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: c.root.Raw})
+	store.AddPurpose("corim")
+
+	envs := cots.EnvironmentGroups{
+		{Environment: testVendorEnv("Other")},
+	}
+
+	results, anchor := checkChain(store, c.leaf, []*x509.Certificate{c.ica}, "eat", envs)
+	assert.Equal(t, -1, anchor)
+	assert.Equal(t, []chainCheckResult{
+		{"environments", chainCheckFail, "no environment of the CoTS applies"},
+		{"purposes", chainCheckFail, `"eat" is not among corim`},
+	}, results)
+
+	model := "Widget"
+	envs[0].Environment = testVendorEnv("ACME")
+	envs[0].Environment.Class.Model = &model
+
+	results, anchor = checkChain(store, c.leaf, []*x509.Certificate{c.ica}, "corim", envs)
+	assert.Equal(t, 0, anchor)
+	assert.Equal(t, chainCheckResult{"environments", chainCheckOK, "environments[0] applies"}, results[0])
+}
+
+func Test_checkChain_claims(t *testing.T) {
+	c := newTestChain(t)
+
+	sub, iss, label := "Test Device", "CN=Other ICA", "firmware"
+
+	store := testStore(cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: c.root.Raw})
+	store.AddExclClaims(cots.EatCWTClaim{SoftwareNameLabel: &label})
+	store.ExclClaims[0].Subject = &sub
+
+	results, anchor := checkChain(store, c.leaf, []*x509.Certificate{c.ica}, "", nil)
+	assert.Equal(t, -1, anchor)
+	assert.Equal(t, []chainCheckResult{
+		{"environments", chainCheckSkipped, "no environment supplied"},
+		{"purposes", chainCheckOK, "the CoTS applies to any purpose"},
+		{"exclclaims", chainCheckFail, "the leaf subject or issuer is excluded"},
+		{"claims", chainCheckSkipped, "cannot be evaluated against a certificate chain: swname"},
+	}, results)
+
+	store.ExclClaims = nil
+	store.AddPermClaims(cots.EatCWTClaim{})
+	store.PermClaims[0].Issuer = &iss
+
+	results, anchor = checkChain(store, c.leaf, []*x509.Certificate{c.ica}, "", nil)
+	assert.Equal(t, -1, anchor)
+	assert.Equal(t, chainCheckResult{"permclaims", chainCheckFail, "the leaf subject or issuer is not permitted"}, results[2])
+
+	iss = "Test ICA"
+
+	_, anchor = checkChain(store, c.leaf, []*x509.Certificate{c.ica}, "", nil)
+	assert.Equal(t, 0, anchor)
+}
+
+func Test_CotsCheckChainCmd_no_cots(t *testing.T) {
+	cmd := NewCotsCheckChainCmd()
+
+	cmd.SetArgs([]string{"--cert=leaf.pem"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no CoTS supplied")
+}
+
+func Test_CotsCheckChainCmd_no_cert(t *testing.T) {
+	cmd := NewCotsCheckChainCmd()
+
+	cmd.SetArgs([]string{"--cots=store.cbor", "--cert="})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no certificate supplied")
+}
+
+func Test_CotsCheckChainCmd_ok(t *testing.T) {
+	c := newTestChain(t)
+
+	store, err := testStore(cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: c.root.Raw}).ToCBOR()
+	require.NoError(t, err)
+
+	bundle := append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.leaf.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.ica.Raw})...,
+	)
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "store.cbor", store, 0644))
+	require.NoError(t, afero.WriteFile(fs, "leaf.pem", bundle, 0644))
+	require.NoError(t, afero.WriteFile(fs, "root.der", c.root.Raw, 0644))
+	require.NoError(t, afero.WriteFile(fs, "env.json", []byte(`[{"environment":{"class":{"vendor":"ACME"}}}]`), 0644))
+
+	cmd := NewCotsCheckChainCmd()
+	cmd.SetArgs([]string{"--cots=store.cbor", "--cert=leaf.pem", "--purpose=eat", "--env=env.json"})
+	assert.NoError(t, cmd.Execute())
+
+	// a TA certificate anchors itself
+	cmd = NewCotsCheckChainCmd()
+	cmd.SetArgs([]string{"--cots=store.cbor", "--cert=root.der"})
+	assert.NoError(t, cmd.Execute())
+}
+
+func Test_CotsCheckChainCmd_not_anchored(t *testing.T) {
+	c := newTestChain(t)
+	other, _ := testIssueCert(t, "Other Root", true, nil, nil)
+
+	store, err := testStore(cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: other.Raw}).ToCBOR()
+	require.NoError(t, err)
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "store.cbor", store, 0644))
+	require.NoError(t, afero.WriteFile(fs, "leaf.der", c.leaf.Raw, 0644))
+	require.NoError(t, afero.WriteFile(fs, "ica.der", c.ica.Raw, 0644))
+
+	cmd := NewCotsCheckChainCmd()
+	cmd.SetArgs([]string{"--cots=store.cbor", "--cert=leaf.der", "--intermediates=ica.der"})
+
+	err = cmd.Execute()
+	assert.EqualError(t, err, `chain of "CN=Test Device" not accepted by store.cbor`)
+}
+
+func Test_CotsCheckChainCmd_bad_files(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "rubbish", []byte("rubbish"), 0644))
+
+	cmd := NewCotsCheckChainCmd()
+	cmd.SetArgs([]string{"--cots=missing.cbor", "--cert=leaf.pem"})
+	assert.EqualError(t, cmd.Execute(), "error loading CoTS from missing.cbor: open missing.cbor: file does not exist")
+
+	cmd = NewCotsCheckChainCmd()
+	cmd.SetArgs([]string{"--cots=rubbish", "--cert=leaf.pem"})
+	assert.ErrorContains(t, cmd.Execute(), "error decoding CoTS from rubbish: ")
+}
@@ -0,0 +1,390 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	cbor "github.com/fxamacker/cbor/v2"
+	"github.com/veraison/corim/cots"
+	"github.com/veraison/eat"
+)
+
+// claimKind is the JSON type of the value of a claim, as accepted by
+// cots.EatCWTClaim
+type claimKind string
+
+const (
+	claimString         claimKind = "a string"
+	claimBytes          claimKind = "a base64 string"
+	claimUint           claimKind = "an unsigned integer"
+	claimInt            claimKind = "an integer"
+	claimBool           claimKind = "a boolean"
+	claimObject         claimKind = "an object"
+	claimBytesOrArray   claimKind = "a base64 string or an array of base64 strings"
+	claimStringOrArray  claimKind = "a string or an array of strings"
+	claimVersionWithSch claimKind = "an object with Version and Scheme"
+)
+
+type claimSpec struct {
+	Key  int
+	Kind claimKind
+}
+
+// eatClaims are the CWT (RFC 8392) and EAT claims known to cots.EatCWTClaim,
+// by JSON name, with their CBOR key
+var eatClaims = map[string]claimSpec{
+	"iss":            {1, claimString},
+	"sub":            {2, claimString},
+	"aud":            {3, claimStringOrArray},
+	"exp":            {4, claimInt},
+	"nbf":            {5, claimInt},
+	"iat":            {6, claimInt},
+	"cti":            {7, claimBytes},
+	"nonce":          {10, claimBytesOrArray},
+	"ueid":           {11, claimBytes},
+	"origination":    {12, claimString},
+	"oemid":          {13, claimBytes},
+	"security-level": {14, claimUint},
+	"secure-boot":    {15, claimBool},
+	"debug-disable":  {16, claimUint},
+	"location":       {17, claimObject},
+	"eat-profile":    {18, claimString},
+	"uptime":         {19, claimUint},
+	"submods":        {20, claimObject},
+	"hwmodel":        {259, claimBytes},
+	"hwvers":         {260, claimVersionWithSch},
+	"swname":         {998, claimString},
+	"swversion":      {999, claimVersionWithSch},
+}
+
+// check tells whether the JSON value has the expected type
+func (o claimKind) check(value json.RawMessage) bool {
+	var v interface{}
+	if json.Unmarshal(value, &v) != nil {
+		return false
+	}
+
+	isBytes := func(v interface{}) bool {
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		_, err := base64.StdEncoding.DecodeString(s)
+		return err == nil
+	}
+
+	isArrayOf := func(v interface{}, ok func(interface{}) bool) bool {
+		a, isArray := v.([]interface{})
+		if !isArray || len(a) == 0 {
+			return false
+		}
+		for _, e := range a {
+			if !ok(e) {
+				return false
+			}
+		}
+		return true
+	}
+
+	isString := func(v interface{}) bool {
+		_, ok := v.(string)
+		return ok
+	}
+
+	switch o {
+	case claimString:
+		return isString(v)
+	case claimBytes:
+		return isBytes(v)
+	case claimUint:
+		n, ok := v.(float64)
+		return ok && n >= 0 && n == float64(uint64(n))
+	case claimInt:
+		n, ok := v.(float64)
+		return ok && n == float64(int64(n))
+	case claimBool:
+		_, ok := v.(bool)
+		return ok
+	case claimObject:
+		_, ok := v.(map[string]interface{})
+		return ok
+	case claimBytesOrArray:
+		return isBytes(v) || isArrayOf(v, isBytes)
+	case claimStringOrArray:
+		return isString(v) || isArrayOf(v, isString)
+	case claimVersionWithSch:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		_, hasVersion := m["Version"]
+		return hasVersion
+	}
+
+	return false
+}
+
+// parse returns the JSON value of a claim given on the command line.  Strings
+// are taken verbatim, numbers and booleans are parsed, nonces and audiences
+// are one or more comma-separated strings, and a version is either a version string or
+// a JSON object.  Only objects are taken as raw JSON.
+func (o claimKind) parse(value string) (json.RawMessage, error) {
+	var v interface{}
+
+	switch o {
+	case claimString, claimBytes:
+		v = value
+	case claimUint:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not %s", value, o)
+		}
+		v = n
+	case claimInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not %s", value, o)
+		}
+		v = n
+	case claimBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not %s", value, o)
+		}
+		v = b
+	case claimBytesOrArray, claimStringOrArray:
+		if vs := strings.Split(value, ","); len(vs) > 1 {
+			v = vs
+		} else {
+			v = value
+		}
+	case claimVersionWithSch:
+		if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+			v = map[string]string{"Version": value}
+			break
+		}
+		fallthrough
+	default:
+		if !json.Valid([]byte(value)) {
+			return nil, fmt.Errorf("%s is not %s", value, o)
+		}
+		return json.RawMessage(value), nil
+	}
+
+	return json.Marshal(v)
+}
+
+// checkClaimsJSON checks a JSON claims template against the known claims.
+// Values of the wrong type are errors; unknown claims, which would be dropped
+// silently, are warnings.
+func checkClaimsJSON(data []byte) (errs, warnings []string) {
+	var m map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &m); err != nil {
+		return []string{fmt.Sprintf("not a JSON object: %v", err)}, nil
+	}
+
+	for _, name := range sortedKeys(m) {
+		spec, ok := eatClaims[name]
+		if !ok {
+			warnings = append(warnings, unknownClaim(name))
+			continue
+		}
+
+		if !spec.Kind.check(m[name]) {
+			errs = append(errs, fmt.Sprintf("claim %q: %s is not %s", name, m[name], spec.Kind))
+		}
+	}
+
+	if len(errs) == 0 {
+		if _, err := claimsFromJSON(data); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	return errs, warnings
+}
+
+// claimsFromJSON decodes JSON claims.  An array of audiences, which
+// cots.EatCWTClaim only supports in CBOR, is decoded separately.
+func claimsFromJSON(data []byte) (*cots.EatCWTClaim, error) {
+	var (
+		m   map[string]json.RawMessage
+		aud []string
+		c   cots.EatCWTClaim
+	)
+
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	if v, ok := m["aud"]; ok && json.Unmarshal(v, &aud) == nil {
+		delete(m, "aud")
+		data, _ = json.Marshal(m)
+	}
+
+	if err := c.FromJSON(data); err != nil {
+		return nil, err
+	}
+
+	if aud != nil {
+		a := make(eat.Audience, len(aud))
+		for i, s := range aud {
+			if err := a[i].FromString(s); err != nil {
+				return nil, fmt.Errorf("aud[%d]: %w", i, err)
+			}
+		}
+		c.Audience = &a
+	}
+
+	return &c, nil
+}
+
+// claimsToJSON returns the JSON values of the claims set in c, by name.  An
+// array of audiences, which cots.EatCWTClaim only supports in CBOR, is
+// encoded separately.
+func claimsToJSON(c cots.EatCWTClaim) map[string]json.RawMessage {
+	var (
+		m   map[string]json.RawMessage
+		aud []string
+	)
+
+	if c.Audience != nil && len(*c.Audience) > 1 {
+		for _, s := range *c.Audience {
+			aud = append(aud, s.String())
+		}
+		c.Audience = nil
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil || json.Unmarshal(data, &m) != nil {
+		return nil
+	}
+
+	if aud != nil {
+		m["aud"], _ = json.Marshal(aud)
+	}
+
+	return m
+}
+
+// checkClaimsCBOR warns about the unknown claim keys of the permitted and
+// excluded claims of a CBOR-encoded CoTS, which are dropped when decoding
+func checkClaimsCBOR(data []byte) []string {
+	var (
+		raw struct {
+			PermClaims []map[interface{}]cbor.RawMessage `cbor:"4,keyasint,omitempty"`
+			ExclClaims []map[interface{}]cbor.RawMessage `cbor:"5,keyasint,omitempty"`
+		}
+		warnings []string
+	)
+
+	if cbor.Unmarshal(data, &raw) != nil {
+		return nil
+	}
+
+	known := map[string]bool{}
+	for _, spec := range eatClaims {
+		known[fmt.Sprint(spec.Key)] = true
+	}
+
+	check := func(what string, claims []map[interface{}]cbor.RawMessage) {
+		for i, c := range claims {
+			var keys []string
+			for k := range c {
+				if key := fmt.Sprint(k); !known[key] {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				warnings = append(warnings, fmt.Sprintf("%s[%d]: unknown claim key %s", what, i, key))
+			}
+		}
+	}
+
+	check("permclaims", raw.PermClaims)
+	check("exclclaims", raw.ExclClaims)
+
+	return warnings
+}
+
+// conflictingClaims returns a line for each claim that has the same value in
+// the permitted and in the excluded claims
+func conflictingClaims(perm, excl cots.EatCWTClaims) []string {
+	var conflicts []string
+
+	for i, p := range perm {
+		pm := claimsToJSON(p)
+		for j, e := range excl {
+			em := claimsToJSON(e)
+			for _, name := range sortedKeys(pm) {
+				if v, ok := em[name]; ok && bytes.Equal(v, pm[name]) {
+					conflicts = append(conflicts, fmt.Sprintf(
+						"claim %q is both permitted (permclaims[%d]) and excluded (exclclaims[%d]) with value %s",
+						name, i, j, v,
+					))
+				}
+			}
+		}
+	}
+
+	return conflicts
+}
+
+// unknownClaim describes an unknown claim name, suggesting the closest known
+// one if it looks like a typo
+func unknownClaim(name string) string {
+	best, bestDist := "", 3
+	for known := range eatClaims {
+		if d := editDistance(name, known); d < bestDist || (d == bestDist && known < best) {
+			best, bestDist = known, d
+		}
+	}
+
+	if best != "" {
+		return fmt.Sprintf("unknown claim %q (did you mean %q?)", name, best)
+	}
+
+	return fmt.Sprintf("unknown claim %q", name)
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
+
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/cots"
+)
+
+func Test_checkClaimsJSON(t *testing.T) {
+	errs, warnings := checkClaimsJSON([]byte(`{
+		"iss": "CN=Test",
+		"aud": "verifier",
+		"exp": 1700000000,
+		"nonce": "AAECAwQFBgc=",
+		"secure-boot": true,
+		"swversion": { "Version": "1.0" }
+	}`))
+	assert.Empty(t, errs)
+	assert.Empty(t, warnings)
+
+	errs, warnings = checkClaimsJSON([]byte(`{ "aud": [ "verifier", "relying-party" ] }`))
+	assert.Empty(t, errs)
+	assert.Empty(t, warnings)
+
+	errs, warnings = checkClaimsJSON([]byte(`{
+		"uptime": -1,
+		"aud": 1,
+		"secure-boot": "yes",
+		"ueid": "not base64!",
+		"exp": 1.5,
+		"swnmae": "firmware",
+		"colour": "blue"
+	}`))
+	assert.Equal(t, []string{
+		`claim "aud": 1 is not a string or an array of strings`,
+		`claim "exp": 1.5 is not an integer`,
+		`claim "secure-boot": "yes" is not a boolean`,
+		`claim "ueid": "not base64!" is not a base64 string`,
+		`claim "uptime": -1 is not an unsigned integer`,
+	}, errs)
+	assert.Equal(t, []string{
+		`unknown claim "colour"`,
+		`unknown claim "swnmae" (did you mean "swname"?)`,
+	}, warnings)
+
+	errs, _ = checkClaimsJSON([]byte(`[]`))
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0], "not a JSON object: ")
+}
+
+func Test_claimKind_parse(t *testing.T) {
+	for _, tc := range []struct {
+		kind     claimKind
+		value    string
+		expected string
+	}{
+		{claimString, "123", `"123"`},
+		{claimString, `"quoted"`, `"\"quoted\""`},
+		{claimUint, "10", `10`},
+		{claimInt, "-10", `-10`},
+		{claimBool, "false", `false`},
+		{claimBytesOrArray, "AAECAwQFBgc=", `"AAECAwQFBgc="`},
+		{claimBytesOrArray, "AAECAwQFBgc=,AQIDBAUGBwg=", `["AAECAwQFBgc=","AQIDBAUGBwg="]`},
+		{claimStringOrArray, "verifier", `"verifier"`},
+		{claimStringOrArray, "verifier,relying-party", `["verifier","relying-party"]`},
+		{claimVersionWithSch, "1.0", `{"Version":"1.0"}`},
+		{claimVersionWithSch, `{"Version":"1.0","Scheme":16384}`, `{"Version":"1.0","Scheme":16384}`},
+		{claimObject, `{"lat":1}`, `{"lat":1}`},
+	} {
+		v, err := tc.kind.parse(tc.value)
+		require.NoError(t, err, tc.value)
+		assert.JSONEq(t, tc.expected, string(v), tc.value)
+	}
+
+	_, err := claimBool.parse("yes")
+	assert.EqualError(t, err, "yes is not a boolean")
+}
+
+func Test_conflictingClaims(t *testing.T) {
+	fw, other, revoked := "firmware", "other", "CN=Revoked"
+
+	perm := cots.EatCWTClaims{{SoftwareNameLabel: &fw}, {}}
+	perm[1].Subject = &revoked
+	excl := cots.EatCWTClaims{{SoftwareNameLabel: &other}}
+	excl[0].Subject = &revoked
+
+	assert.Equal(t, []string{
+		`claim "sub" is both permitted (permclaims[1]) and excluded (exclclaims[0]) with value "CN=Revoked"`,
+	}, conflictingClaims(perm, excl))
+
+	assert.Empty(t, conflictingClaims(perm, nil))
+
+	aud, err := claimsFromJSON([]byte(`{"aud":["verifier","relying-party"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`claim "aud" is both permitted (permclaims[0]) and excluded (exclclaims[0]) with value ["verifier","relying-party"]`,
+	}, conflictingClaims(cots.EatCWTClaims{*aud}, cots.EatCWTClaims{*aud}))
+}
+
+func Test_editDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("iss", "iss"))
+	assert.Equal(t, 2, editDistance("swnmae", "swname"))
+	assert.Equal(t, 3, editDistance("", "sub"))
+}
@@ -4,13 +4,17 @@
 package cmd
 
 import (
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
+	"github.com/veraison/corim/comid"
 	"github.com/veraison/corim/cots"
 )
 
@@ -21,13 +25,18 @@ var (
 	cotsCreateTagUUID           *bool
 	cotsCreateTagVersion        *uint
 	cotsCreateCtsEnvFile        *string
+	cotsCreateCtsEnvFlags       ctsEnvFlags
 	cotsCreateCtsPermClaimsFile *string
+	cotsCreateCtsPermClaims     []string
 	cotsCreateCtsExclClaimsFile *string
+	cotsCreateCtsExclClaims     []string
 	cotsCreateCtsPurposes       []string
 	cotsCreateCtsTaDirs         []string
 	cotsCreateCtsTaFiles        []string
 	cotsCreateCtsCaDirs         []string
 	cotsCreateCtsCaFiles        []string
+	cotsCreateCtsInferFormat    *bool
+	cotsCreateCtsManifestFile   *string
 	cotsCreateCtsOutputFile     *string
 )
 
@@ -64,6 +73,46 @@ func NewCotsCreateCtsCmd() *cobra.Command {
 					--tafile=tas_dir \
 					--cafile=cas_dir \
 					--output=cots.cbor
+
+	The format of each TA is detected from its content, and the command fails if
+	it does not match the file extension (.der for certificates, .spki for
+	SubjectPublicKeyInfo and .ta for TrustAnchorInfo).  With --infer-format, TA
+	files are accepted whatever their name, and their format is only taken
+	from their content.
+
+	cocli cots create --environment=env-template.json \
+					--tas=tas_dir \
+					--infer-format
+
+	TA and CA files with a .pem or .crt extension may contain a bundle of
+	PEM-encoded certificates, each of which is added individually.  PEM public
+	keys in TA files are added as SubjectPublicKeyInfo TAs.
+
+	cocli cots create --environment=env-template.json \
+					--tafile=roots.pem \
+					--cafile=intermediates.crt
+
+	Simple environments and claims can be given with flags instead of, or in
+	addition to, template files.  The environment flags describe a CoMID
+	environment (--vendor, --model, --class-id, --instance) and, with
+	--swname, an abbreviated SWID tag of software created by --vendor.  Claims
+	are given as name=value, using the names of the claims templates; values
+	are parsed according to the claim (e.g., swname=123 is a string, uptime=10
+	a number and swversion=1.0 a version), objects being given as JSON.  The
+	result is saved to cots.cbor.
+
+	cocli cots create --vendor="Zesty Hands, Inc." \
+					--class-id-type=oid --class-id=1.2.3.4 \
+					--permclaim=swname="Bitter Paper" \
+					--exclclaim=uptime=0 \
+					--tafile=roots.pem
+
+	To create a concise-ta-stores list with several CoTSs, each with its own
+	environments, purposes, claims, TAs/CAs and tag identity, describe them in
+	a manifest (see the README for its format).  The result is saved to
+	stores.cbor.
+
+	cocli cots create --manifest=stores.json
 	`,
 
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -71,19 +120,25 @@ func NewCotsCreateCtsCmd() *cobra.Command {
 				return err
 			}
 
-			certFilesList := filesList(cotsCreateCtsTaFiles, cotsCreateCtsTaDirs, ".der")
-			taiFilesList := filesList(cotsCreateCtsTaFiles, cotsCreateCtsTaDirs, ".ta")
-			spkiFilesList := filesList(cotsCreateCtsTaFiles, cotsCreateCtsTaDirs, ".spki")
-			tasFilesList := append(certFilesList, taiFilesList...)
-			tasFilesList = append(tasFilesList, spkiFilesList...)
-			casFilesList := filesList(cotsCreateCtsCaFiles, cotsCreateCtsCaDirs, ".der")
+			if *cotsCreateCtsManifestFile != "" {
+				cborFile, err := ctsManifestToCBOR(*cotsCreateCtsManifestFile, cotsCreateCtsOutputFile)
+				if err != nil {
+					return err
+				}
+				fmt.Printf(">> created %q\n", cborFile)
+
+				return nil
+			}
+
+			tasFilesList := ctsTaFilesList(cotsCreateCtsTaFiles, cotsCreateCtsTaDirs, *cotsCreateCtsInferFormat)
+			casFilesList := ctsCaFilesList(cotsCreateCtsCaFiles, cotsCreateCtsCaDirs)
 
 			if len(tasFilesList) == 0 {
 				return errors.New("no TA files found")
 			}
 
-			cborFile, err := ctsTemplateToCBOR(*cotsCreateLanguage, *cotsCreateTagID, *cotsCreateTagUUID, *cotsCreateTagUUIDStr, cotsCreateTagVersion, *cotsCreateCtsEnvFile, *cotsCreateCtsPermClaimsFile, *cotsCreateCtsExclClaimsFile, cotsCreateCtsPurposes,
-				tasFilesList, casFilesList, cotsCreateCtsOutputFile)
+			cborFile, err := ctsTemplateToCBOR(*cotsCreateLanguage, *cotsCreateTagID, *cotsCreateTagUUID, *cotsCreateTagUUIDStr, cotsCreateTagVersion, *cotsCreateCtsEnvFile, cotsCreateCtsEnvFlags, *cotsCreateCtsPermClaimsFile, cotsCreateCtsPermClaims, *cotsCreateCtsExclClaimsFile, cotsCreateCtsExclClaims, cotsCreateCtsPurposes,
+				tasFilesList, casFilesList, *cotsCreateCtsInferFormat, cotsCreateCtsOutputFile)
 			if err != nil {
 				return err
 			}
@@ -102,24 +157,40 @@ func NewCotsCreateCtsCmd() *cobra.Command {
 	cotsCreateCtsPermClaimsFile = cmd.Flags().StringP("permclaims", "p", "", "a permitted claims template file (in JSON format)")
 	cotsCreateCtsExclClaimsFile = cmd.Flags().StringP("exclclaims", "x", "", "an excluded claims template file (in JSON format)")
 
+	cmd.Flags().StringVar(&cotsCreateCtsEnvFlags.Vendor, "vendor", "", "the vendor of the environment")
+	cmd.Flags().StringVar(&cotsCreateCtsEnvFlags.Model, "model", "", "the model of the environment")
+	cmd.Flags().StringVar(&cotsCreateCtsEnvFlags.ClassID, "class-id", "", "the class ID of the environment")
+	cmd.Flags().StringVar(&cotsCreateCtsEnvFlags.ClassIDType, "class-id-type", comid.UUIDType, "the type of the class ID: uuid, oid, psa.impl-id or int")
+	cmd.Flags().StringVar(&cotsCreateCtsEnvFlags.Instance, "instance", "", "the instance ID (UEID) of the environment (hex or base64)")
+	cmd.Flags().StringVar(&cotsCreateCtsEnvFlags.SwName, "swname", "", "the name of the software created by --vendor")
+
+	cmd.Flags().StringArrayVar(
+		&cotsCreateCtsPermClaims, "permclaim", []string{}, "a permitted claim, as name=value (e.g. swname=\"Bitter Paper\"), added to --permclaims",
+	)
+	cmd.Flags().StringArrayVar(
+		&cotsCreateCtsExclClaims, "exclclaim", []string{}, "an excluded claim, as name=value, added to --exclclaims",
+	)
+
 	cmd.Flags().StringArrayVarP(
 		&cotsCreateCtsPurposes, "purpose", "u", []string{}, "string value indicating purpose: cots,corim,comid,coswid,eat,certificate",
 	)
 
 	cmd.Flags().StringArrayVarP(
-		&cotsCreateCtsTaDirs, "tas", "t", []string{}, "a directory containing binary DER-encoded trust anchor files",
+		&cotsCreateCtsTaDirs, "tas", "t", []string{}, "a directory containing binary DER-encoded trust anchor files or PEM bundles",
 	)
 	cmd.Flags().StringArrayVarP(
-		&cotsCreateCtsTaFiles, "tafile", "f", []string{}, "a DER-encoded trust anchor file",
+		&cotsCreateCtsTaFiles, "tafile", "f", []string{}, "a DER-encoded trust anchor file or a PEM bundle of certificates and public keys",
 	)
 
 	cmd.Flags().StringArrayVarP(
-		&cotsCreateCtsCaDirs, "cas", "c", []string{}, "a directory containing binary DER-encoded X.509 CA certificate files",
+		&cotsCreateCtsCaDirs, "cas", "c", []string{}, "a directory containing binary DER-encoded X.509 CA certificate files or PEM bundles",
 	)
 	cmd.Flags().StringArrayVarP(
-		&cotsCreateCtsCaFiles, "cafile", "", []string{}, "a DER-encoded certificate file",
+		&cotsCreateCtsCaFiles, "cafile", "", []string{}, "a DER-encoded certificate file or a PEM certificate bundle",
 	)
 
+	cotsCreateCtsInferFormat = cmd.Flags().BoolP("infer-format", "", false, "detect the format of TA files from their content, accepting files with any name")
+	cotsCreateCtsManifestFile = cmd.Flags().StringP("manifest", "m", "", "a manifest describing several CoTSs (in JSON format), mutually exclusive from the other CoTS flags")
 	cotsCreateCtsOutputFile = cmd.Flags().StringP("output", "o", "", "name of the generated CoTS file")
 
 	return cmd
@@ -131,16 +202,16 @@ func IsValidUUID(u string) bool {
 }
 
 func checkctsCreateCtsArgs() error {
-	if cotsCreateCtsEnvFile == nil || *cotsCreateCtsEnvFile == "" {
-		return errors.New("no environment template supplied")
+	if *cotsCreateCtsManifestFile != "" {
+		return checkCtsCreateManifestArgs()
 	}
 
-	if (*cotsCreateTagUUID && *cotsCreateTagID != "") || (*cotsCreateTagUUID && *cotsCreateTagUUIDStr != "") || (*cotsCreateTagUUIDStr != "" && *cotsCreateTagID != "") {
-		return errors.New("only one of --uuid, --uuid-str and --id can be used at the same time")
+	if *cotsCreateCtsEnvFile == "" && !cotsCreateCtsEnvFlags.isSet() {
+		return errors.New("no environment template or environment flags supplied")
 	}
 
-	if *cotsCreateTagUUIDStr != "" && !IsValidUUID(*cotsCreateTagUUIDStr) {
-		return errors.New("--uuid-str does not contain a valid UUID")
+	if err := checkCtsTagID(*cotsCreateTagID, *cotsCreateTagUUID, *cotsCreateTagUUIDStr); err != nil {
+		return err
 	}
 
 	if len(cotsCreateCtsTaFiles)+len(cotsCreateCtsTaDirs) == 0 {
@@ -150,27 +221,84 @@ func checkctsCreateCtsArgs() error {
 	return nil
 }
 
-func ctsTemplateToCBOR(language string, tagID string, genUUID bool, uuidStr string, version *uint, envFile string, permClaimsFile string, exclClaimsFile string, purposes, taFiles, caFiles []string, outputFile *string) (string, error) {
+func checkCtsTagID(tagID string, genUUID bool, uuidStr string) error {
+	if (genUUID && tagID != "") || (genUUID && uuidStr != "") || (uuidStr != "" && tagID != "") {
+		return errors.New("only one of --uuid, --uuid-str and --id can be used at the same time")
+	}
+
+	if uuidStr != "" && !IsValidUUID(uuidStr) {
+		return errors.New("--uuid-str does not contain a valid UUID")
+	}
+
+	return nil
+}
+
+// ctsTaFilesList returns the TA files among the supplied files and
+// directories: those with a TA or PEM extension, or any file if the format of
+// TAs is inferred from their content
+func ctsTaFilesList(files, dirs []string, inferFormat bool) []string {
+	if inferFormat {
+		return anyFilesList(files, dirs)
+	}
+
+	certFilesList := filesList(files, dirs, ".der")
+	taiFilesList := filesList(files, dirs, ".ta")
+	spkiFilesList := filesList(files, dirs, ".spki")
+	tasFilesList := append(certFilesList, taiFilesList...)
+	tasFilesList = append(tasFilesList, spkiFilesList...)
+
+	return append(tasFilesList, pemFilesList(files, dirs)...)
+}
+
+// ctsCaFilesList returns the DER and PEM CA files among the supplied files
+// and directories
+func ctsCaFilesList(files, dirs []string) []string {
+	casFilesList := filesList(files, dirs, ".der")
+	return append(casFilesList, pemFilesList(files, dirs)...)
+}
+
+func ctsTemplateToCBOR(language string, tagID string, genUUID bool, uuidStr string, version *uint, envFile string, envFlags ctsEnvFlags, permClaimsFile string, permClaims []string, exclClaimsFile string, exclClaims []string, purposes, taFiles, caFiles []string, inferFormat bool, outputFile *string) (string, error) {
 	var (
-		envData        []byte
-		env            cots.EnvironmentGroups
-		permClaimsData []byte
-		permClaims     cots.EatCWTClaim
-		exclClaimsData []byte
-		exclClaims     cots.EatCWTClaim
-		err            error
-		ctsCBOR        []byte
-		ctsFile        string
+		err     error
+		ctsCBOR []byte
+		ctsFile string
 	)
 
-	cts := cots.ConciseTaStore{}
+	cts, err := newCts(language, tagID, genUUID, uuidStr, version, envFile, envFlags, permClaimsFile, permClaims, exclClaimsFile, exclClaims, purposes, taFiles, caFiles, inferFormat)
+	if err != nil {
+		return "", err
+	}
 
-	if envData, err = afero.ReadFile(fs, envFile); err != nil {
-		return "", fmt.Errorf("error loading template from %s: %w", envFile, err)
+	ctsCBOR, err = cts.ToCBOR()
+	if err != nil {
+		return "", fmt.Errorf("error encoding CoTS to CBOR: %w", err)
 	}
 
-	if err = env.FromJSON(envData); err != nil {
-		return "", fmt.Errorf("error decoding template from %s: %w", envFile, err)
+	if outputFile == nil || *outputFile == "" {
+		ctsFile = "cots.cbor"
+		if envFile != "" {
+			ctsFile = makeFileName("", envFile, ".cbor")
+		}
+	} else {
+		ctsFile = *outputFile
+	}
+
+	err = afero.WriteFile(fs, ctsFile, ctsCBOR, 0644)
+	if err != nil {
+		return "", fmt.Errorf("error saving CoTS to file %s: %w", ctsFile, err)
+	}
+
+	return ctsFile, nil
+}
+
+// newCts returns a validated CoTS made from the supplied templates, flags and
+// TA/CA files
+func newCts(language string, tagID string, genUUID bool, uuidStr string, version *uint, envFile string, envFlags ctsEnvFlags, permClaimsFile string, permClaims []string, exclClaimsFile string, exclClaims []string, purposes, taFiles, caFiles []string, inferFormat bool) (*cots.ConciseTaStore, error) {
+	cts := cots.ConciseTaStore{}
+
+	env, err := loadCtsEnvironments(envFile, envFlags)
+	if err != nil {
+		return nil, err
 	}
 
 	cts.Environments = env
@@ -191,89 +319,252 @@ func ctsTemplateToCBOR(language string, tagID string, genUUID bool, uuidStr stri
 		cts.SetTagIdentity(b, version)
 	}
 
-	if permClaimsFile != "" {
-		if permClaimsData, err = afero.ReadFile(fs, permClaimsFile); err != nil {
-			return "", fmt.Errorf("error loading template from %s: %w", permClaimsFile, err)
-		}
+	perm, err := loadClaims(permClaimsFile, permClaims)
+	if err != nil {
+		return nil, err
+	}
+	if perm != nil {
+		cts.AddPermClaims(*perm)
+	}
 
-		if err = permClaims.FromJSON(permClaimsData); err != nil {
-			return "", fmt.Errorf("error decoding template from %s: %w", permClaimsFile, err)
-		}
-		cts.AddPermClaims(permClaims)
+	excl, err := loadClaims(exclClaimsFile, exclClaims)
+	if err != nil {
+		return nil, err
+	}
+	if excl != nil {
+		cts.AddExclClaims(*excl)
 	}
-	if exclClaimsFile != "" {
-		if exclClaimsData, err = afero.ReadFile(fs, exclClaimsFile); err != nil {
-			return "", fmt.Errorf("error loading template from %s: %w", exclClaimsFile, err)
-		}
 
-		if err = exclClaims.FromJSON(exclClaimsData); err != nil {
-			return "", fmt.Errorf("error decoding template from %s: %w", exclClaimsFile, err)
-		}
-		cts.AddExclClaims(exclClaims)
+	if conflicts := conflictingClaims(cts.PermClaims, cts.ExclClaims); len(conflicts) != 0 {
+		return nil, fmt.Errorf("error validating CoTS: %s", strings.Join(conflicts, "; "))
 	}
+
 	if 0 != len(purposes) {
 		cts.Purposes = purposes
 	}
 
-	k := cots.TasAndCas{}
-	cts.Keys = &k
-	for _, taFile := range taFiles {
-		var (
-			tadata      []byte
-			trustAnchor cots.TrustAnchor
-		)
+	tas, err := loadCtsTas(taFiles, inferFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	cas, err := loadCtsCas(caFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	cts.Keys = &cots.TasAndCas{Tas: tas, Cas: cas}
+
+	// check the result
+	if err = cts.Valid(); err != nil {
+		return nil, fmt.Errorf("error validating CoTS: %w", err)
+	}
+
+	return &cts, nil
+}
 
-		tadata, err = afero.ReadFile(fs, taFile)
+// loadCtsEnvironments returns the environment groups of the template file, if
+// any, followed by those described by the environment flags
+func loadCtsEnvironments(envFile string, envFlags ctsEnvFlags) (cots.EnvironmentGroups, error) {
+	var env cots.EnvironmentGroups
+
+	if envFile != "" {
+		envData, err := afero.ReadFile(fs, envFile)
 		if err != nil {
-			return "", fmt.Errorf("error loading TA from %s: %w", taFile, err)
+			return nil, fmt.Errorf("error loading template from %s: %w", envFile, err)
 		}
-		if ".der" == filepath.Ext(taFile) {
-			trustAnchor.Format = cots.TaFormatCertificate
+
+		if err = env.FromJSON(envData); err != nil {
+			return nil, fmt.Errorf("error decoding template from %s: %w", envFile, err)
 		}
-		if ".spki" == filepath.Ext(taFile) {
-			trustAnchor.Format = cots.TaFormatSubjectPublicKeyInfo
+	}
+
+	flagsEnv, err := envFlags.environmentGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(env, flagsEnv...), nil
+}
+
+// loadCtsTas returns the TAs in the supplied files, checking that their
+// format matches their extension unless inferFormat is set
+func loadCtsTas(taFiles []string, inferFormat bool) ([]cots.TrustAnchor, error) {
+	var tas []cots.TrustAnchor
+
+	for _, taFile := range taFiles {
+		tadata, err := afero.ReadFile(fs, taFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading TA from %s: %w", taFile, err)
+		}
+		if isPEMFile(taFile) || (inferFormat && isPEM(tadata)) {
+			bundle, err := pemBundleTAs(tadata)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding TAs from %s: %w", taFile, err)
+			}
+			tas = append(tas, bundle...)
+			continue
 		}
-		if ".ta" == filepath.Ext(taFile) {
-			trustAnchor.Format = cots.TaFormatTrustAnchorInfo
+
+		format, err := detectTaFormat(tadata)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding TA from %s: %w", taFile, err)
+		}
+
+		if expected, ok := taFormatExts[filepath.Ext(taFile)]; ok && !inferFormat && expected != format {
+			return nil, fmt.Errorf(
+				"TA file %s has a %s extension but contains a %s (rename it or use --infer-format)",
+				taFile, filepath.Ext(taFile), taFormatName(format),
+			)
 		}
-		trustAnchor.Data = tadata
-		cts.Keys.Tas = append(cts.Keys.Tas, trustAnchor)
+
+		tas = append(tas, cots.TrustAnchor{Format: format, Data: tadata})
 	}
 
-	for _, caFile := range caFiles {
-		var (
-			cadata []byte
-		)
+	return tas, nil
+}
 
-		cadata, err = afero.ReadFile(fs, caFile)
+// loadCtsCas returns the CA certificates in the supplied DER files and PEM
+// bundles
+func loadCtsCas(caFiles []string) ([][]byte, error) {
+	var cas [][]byte
+
+	for _, caFile := range caFiles {
+		cadata, err := afero.ReadFile(fs, caFile)
 		if err != nil {
-			return "", fmt.Errorf("error loading CA from %s: %w", caFile, err)
+			return nil, fmt.Errorf("error loading CA from %s: %w", caFile, err)
 		}
-		cts.Keys.Cas = append(cts.Keys.Cas, cadata)
+		if isPEMFile(caFile) {
+			certs, err := pemBundleCerts(cadata)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding CAs from %s: %w", caFile, err)
+			}
+			cas = append(cas, certs...)
+			continue
+		}
+		cas = append(cas, cadata)
 	}
 
-	// check the result
-	if err = cts.Valid(); err != nil {
-		return "", fmt.Errorf("error validating CoTS: %w", err)
+	return cas, nil
+}
+
+// anyFilesList returns the supplied files and the files found in the supplied
+// directories, whatever their extension
+func anyFilesList(files, dirs []string) []string {
+	var l []string
+
+	for _, file := range files {
+		if _, err := fs.Stat(file); err == nil {
+			l = append(l, file)
+		}
 	}
 
-	ctsCBOR, err = cts.ToCBOR()
+	for _, dir := range dirs {
+		filesInfo, err := afero.ReadDir(fs, dir)
+		if err != nil {
+			continue
+		}
+
+		for _, fileInfo := range filesInfo {
+			if !fileInfo.IsDir() {
+				l = append(l, filepath.Join(dir, fileInfo.Name()))
+			}
+		}
+	}
+
+	return l
+}
+
+// pemFilesList returns the files with a .pem or .crt extension among the
+// supplied files and directories
+func pemFilesList(files, dirs []string) []string {
+	return append(filesList(files, dirs, ".pem"), filesList(files, dirs, ".crt")...)
+}
+
+func isPEMFile(file string) bool {
+	ext := filepath.Ext(file)
+	return ext == ".pem" || ext == ".crt"
+}
+
+func isPEM(data []byte) bool {
+	block, _ := pem.Decode(data)
+	return block != nil
+}
+
+// pemBundleTAs splits a bundle of PEM certificates and public keys into
+// certificate and SubjectPublicKeyInfo TAs
+func pemBundleTAs(data []byte) ([]cots.TrustAnchor, error) {
+	var tas []cots.TrustAnchor
+
+	blocks, err := pemBundleBlocks(data)
 	if err != nil {
-		return "", fmt.Errorf("error encoding CoTS to CBOR: %w", err)
+		return nil, err
 	}
 
-	if outputFile == nil || *outputFile == "" {
-		ctsFile = makeFileName("", envFile, ".cbor")
-	} else {
-		ctsFile = *outputFile
+	for i, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+				return nil, fmt.Errorf("PEM block %d: %w", i, err)
+			}
+			tas = append(tas, cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: block.Bytes})
+		case "PUBLIC KEY":
+			if _, err := x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+				return nil, fmt.Errorf("PEM block %d: %w", i, err)
+			}
+			tas = append(tas, cots.TrustAnchor{Format: cots.TaFormatSubjectPublicKeyInfo, Data: block.Bytes})
+		default:
+			return nil, fmt.Errorf("PEM block %d: unsupported type %q (want CERTIFICATE or PUBLIC KEY)", i, block.Type)
+		}
 	}
 
-	err = afero.WriteFile(fs, ctsFile, ctsCBOR, 0644)
+	return tas, nil
+}
+
+// pemBundleCerts splits a bundle of PEM certificates into DER certificates
+func pemBundleCerts(data []byte) ([][]byte, error) {
+	var certs [][]byte
+
+	blocks, err := pemBundleBlocks(data)
 	if err != nil {
-		return "", fmt.Errorf("error saving CoTS to file %s: %w", ctsFile, err)
+		return nil, err
 	}
 
-	return ctsFile, nil
+	for i, block := range blocks {
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("PEM block %d: unsupported type %q (want CERTIFICATE)", i, block.Type)
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return nil, fmt.Errorf("PEM block %d: %w", i, err)
+		}
+		certs = append(certs, block.Bytes)
+	}
+
+	return certs, nil
+}
+
+// pemBundleBlocks returns the PEM blocks in data, skipping any text found
+// around them (e.g., the subject and issuer lines written by openssl).  A .crt
+// file holding a single DER certificate is returned as one CERTIFICATE block.
+func pemBundleBlocks(data []byte) ([]*pem.Block, error) {
+	var blocks []*pem.Block
+
+	for rest := data; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+
+	if len(blocks) == 0 {
+		if _, err := x509.ParseCertificate(data); err == nil {
+			return []*pem.Block{{Type: "CERTIFICATE", Bytes: data}}, nil
+		}
+		return nil, errors.New("no PEM blocks found")
+	}
+
+	return blocks, nil
 }
 
 func init() {
@@ -4,10 +4,14 @@
 package cmd
 
 import (
+	"encoding/asn1"
+	"encoding/pem"
 	"testing"
 
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/cots"
 )
 
 func Test_CotsCreateCtsCmd_unknown_argument(t *testing.T) {
@@ -26,7 +30,7 @@ func Test_CotsCreateCtsCmd_no_templates(t *testing.T) {
 	// no args
 
 	err := cmd.Execute()
-	assert.EqualError(t, err, "no environment template supplied")
+	assert.EqualError(t, err, "no environment template or environment flags supplied")
 }
 
 func Test_CotsCreateCtsCmd_no_files_found(t *testing.T) {
@@ -38,7 +42,7 @@ func Test_CotsCreateCtsCmd_no_files_found(t *testing.T) {
 	cmd.SetArgs(args)
 
 	err := cmd.Execute()
-	assert.EqualError(t, err, "no environment template supplied")
+	assert.EqualError(t, err, "no environment template or environment flags supplied")
 }
 
 func Test_CotsCreateCtsCmd_env_not_found_no_tas(t *testing.T) {
@@ -144,3 +148,109 @@ func Test_CotsCreateCtsCmd_ok(t *testing.T) {
 	err := cmd.Execute()
 	assert.Nil(t, err)
 }
+
+// testCertPEM returns the PEM encoding of a self-signed certificate
+func testCertPEM(t *testing.T) []byte {
+	der := testDiceCert(t, asn1.ObjectIdentifier{1, 2, 3}, "test")
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func Test_CotsCreateCtsCmd_pem_bundles(t *testing.T) {
+	fs = afero.NewMemMapFs()
+
+	_, pubPEM := testPublicKeyPEM(t)
+
+	tas := append([]byte("subject=CN = root 1\n"), testCertPEM(t)...)
+	tas = append(tas, testCertPEM(t)...)
+	tas = append(tas, pubPEM...)
+
+	require.NoError(t, afero.WriteFile(fs, "env.json", []byte(`[{"environment":{"class":{"vendor":"ACME"}}}]`), 0400))
+	require.NoError(t, afero.WriteFile(fs, "tas/roots.pem", tas, 0400))
+	require.NoError(t, afero.WriteFile(fs, "tas/ignored.txt", []byte("not a TA"), 0400))
+	require.NoError(t, afero.WriteFile(fs, "cas.crt", append(testCertPEM(t), testCertPEM(t)...), 0400))
+
+	cmd := NewCotsCreateCtsCmd()
+	cmd.SetArgs([]string{
+		"--output=output.cbor", "--environment=env.json", "--tas=tas", "--cafile=cas.crt",
+	})
+	require.NoError(t, cmd.Execute())
+
+	data, err := afero.ReadFile(fs, "output.cbor")
+	require.NoError(t, err)
+
+	var cts cots.ConciseTaStore
+	require.NoError(t, cts.FromCBOR(data))
+
+	require.Len(t, cts.Keys.Tas, 3)
+	assert.Equal(t, cots.TaFormatCertificate, cts.Keys.Tas[0].Format)
+	assert.Equal(t, cots.TaFormatCertificate, cts.Keys.Tas[1].Format)
+	assert.Equal(t, cots.TaFormatSubjectPublicKeyInfo, cts.Keys.Tas[2].Format)
+	assert.Len(t, cts.Keys.Cas, 2)
+}
+
+func Test_CotsCreateCtsCmd_bad_pem_bundle(t *testing.T) {
+	fs = afero.NewMemMapFs()
+
+	_, pubPEM := testPublicKeyPEM(t)
+
+	require.NoError(t, afero.WriteFile(fs, "env.json", []byte(`[{"environment":{"class":{"vendor":"ACME"}}}]`), 0400))
+	require.NoError(t, afero.WriteFile(fs, "roots.pem", testCertPEM(t), 0400))
+	require.NoError(t, afero.WriteFile(fs, "empty.pem", []byte("nothing here"), 0400))
+	require.NoError(t, afero.WriteFile(fs, "cas.pem", []byte(pubPEM), 0400))
+
+	cmd := NewCotsCreateCtsCmd()
+	cmd.SetArgs([]string{"--output=output.cbor", "--environment=env.json", "--tafile=empty.pem"})
+	err := cmd.Execute()
+	assert.EqualError(t, err, "error decoding TAs from empty.pem: no PEM blocks found")
+
+	cmd = NewCotsCreateCtsCmd()
+	cmd.SetArgs([]string{
+		"--output=output.cbor", "--environment=env.json", "--tafile=roots.pem", "--cafile=cas.pem",
+	})
+	err = cmd.Execute()
+	assert.EqualError(t, err,
+		`error decoding CAs from cas.pem: PEM block 0: unsupported type "PUBLIC KEY" (want CERTIFICATE)`)
+}
+
+func Test_CotsCreateCtsCmd_format_mismatch(t *testing.T) {
+	spki, err := afero.ReadFile(afero.NewOsFs(), "../data/cots/worthlesssea.spki")
+	require.NoError(t, err)
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "env.json", []byte(`[{"environment":{"class":{"vendor":"ACME"}}}]`), 0400))
+	require.NoError(t, afero.WriteFile(fs, "tas/key.der", spki, 0400))
+
+	cmd := NewCotsCreateCtsCmd()
+	cmd.SetArgs([]string{"--output=output.cbor", "--environment=env.json", "--tas=tas"})
+	err = cmd.Execute()
+	assert.EqualError(t, err,
+		"TA file tas/key.der has a .der extension but contains a SubjectPublicKeyInfo (rename it or use --infer-format)")
+
+	require.NoError(t, afero.WriteFile(fs, "tas/root", testCertPEM(t), 0400))
+
+	cmd = NewCotsCreateCtsCmd()
+	cmd.SetArgs([]string{"--output=output.cbor", "--environment=env.json", "--tas=tas", "--infer-format"})
+	require.NoError(t, cmd.Execute())
+
+	data, err := afero.ReadFile(fs, "output.cbor")
+	require.NoError(t, err)
+
+	var cts cots.ConciseTaStore
+	require.NoError(t, cts.FromCBOR(data))
+
+	require.Len(t, cts.Keys.Tas, 2)
+	assert.Equal(t, cots.TaFormatSubjectPublicKeyInfo, cts.Keys.Tas[0].Format)
+	assert.Equal(t, cots.TaFormatCertificate, cts.Keys.Tas[1].Format)
+}
+
+func Test_CotsCreateCtsCmd_undecodable_ta(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "env.json", []byte(`[{"environment":{"class":{"vendor":"ACME"}}}]`), 0400))
+	require.NoError(t, afero.WriteFile(fs, "rubbish.ta", []byte("rubbish"), 0400))
+
+	cmd := NewCotsCreateCtsCmd()
+	cmd.SetArgs([]string{"--output=output.cbor", "--environment=env.json", "--tafile=rubbish.ta"})
+	err := cmd.Execute()
+	assert.EqualError(t, err,
+		"error decoding TA from rubbish.ta: not a certificate, SubjectPublicKeyInfo or TrustAnchorInfo")
+}
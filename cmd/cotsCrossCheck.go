@@ -0,0 +1,448 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/corim/cots"
+)
+
+var (
+	cotsCrossCheckComidFiles []string
+	cotsCrossCheckComidDirs  []string
+	cotsCrossCheckCotsFiles  []string
+	cotsCrossCheckCotsDirs   []string
+)
+
+// cross-check findings
+const (
+	crossCheckNoStore      = "no-store"
+	crossCheckMismatch     = "env-mismatch"
+	crossCheckUnreferenced = "unreferenced"
+	crossCheckSkipped      = "skipped"
+)
+
+// crossCheckKey is an attestation or identity key of a CoMID, with the
+// environment of its triple
+type crossCheckKey struct {
+	Where string
+	Env   comid.Environment
+	Key   comid.CryptoKey
+}
+
+// crossCheckStore is a CoTS, stand-alone, in a list or embedded in a CoRIM
+type crossCheckStore struct {
+	Where string
+	Store *cots.ConciseTaStore
+}
+
+type crossCheckFinding struct {
+	Kind   string
+	Where  string
+	Detail string
+}
+
+var cotsCrossCheckCmd = NewCotsCrossCheckCmd()
+
+func NewCotsCrossCheckCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cross-check",
+		Short: "check the consistency of CoMID attestation and identity keys with CoTS trust anchors",
+		Long: `check the consistency of CoMID attestation and identity keys with CoTS trust anchors
+
+	Compare the attester-verification-keys and dev-identity-keys triples of the
+	supplied CoMIDs (stand-alone or embedded in CoRIMs) with the supplied CoTSs
+	(stand-alone, in concise-ta-stores lists or embedded in CoRIMs), and report:
+
+	  * [no-store] keys whose environment is not covered by any CoTS;
+	  * [env-mismatch] keys anchored by a TA of a CoTS whose environments do not
+	    cover the environment of the key;
+	  * [unreferenced] TAs that anchor none of the keys.
+
+	A key is anchored by a TA if it is the TA's public key, or if its
+	certificate (path) chains up to the TA, possibly through the CA
+	certificates of the CoTS.  Keys that are neither public keys nor
+	certificates (e.g., thumbprints) are reported as [skipped].
+
+	  cocli cots cross-check --comid=iak.cbor --cots=vendor.cbor
+
+	  cocli cots cross-check --comid-dir=comids --cots-dir=cots
+	`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkCotsCrossCheckArgs(); err != nil {
+				return err
+			}
+
+			comidFiles := filesList(cotsCrossCheckComidFiles, cotsCrossCheckComidDirs, ".cbor")
+			if len(comidFiles) == 0 {
+				return errors.New("no CoMID files found")
+			}
+
+			cotsFiles := filesList(cotsCrossCheckCotsFiles, cotsCrossCheckCotsDirs, ".cbor")
+			if len(cotsFiles) == 0 {
+				return errors.New("no CoTS files found")
+			}
+
+			keys, err := loadCrossCheckKeys(comidFiles)
+			if err != nil {
+				return err
+			}
+
+			stores, err := loadCrossCheckStores(cotsFiles)
+			if err != nil {
+				return err
+			}
+
+			findings := crossCheck(keys, stores)
+
+			issues := 0
+			for _, f := range findings {
+				fmt.Printf("[%s] %s: %s\n", f.Kind, f.Where, f.Detail)
+				if f.Kind != crossCheckSkipped {
+					issues++
+				}
+			}
+
+			tas := 0
+			for _, s := range stores {
+				tas += len(s.Store.Keys.Tas)
+			}
+
+			fmt.Printf(">> %d key(s), %d CoTS(s) with %d TA(s)\n", len(keys), len(stores), tas)
+
+			if issues != 0 {
+				return fmt.Errorf("%d inconsistenc(ies) found", issues)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(
+		&cotsCrossCheckComidFiles, "comid", "m", []string{}, "a CoMID or CoRIM file (in CBOR format)",
+	)
+	cmd.Flags().StringArrayVarP(
+		&cotsCrossCheckComidDirs, "comid-dir", "M", []string{}, "a directory containing CoMID or CoRIM files (in CBOR format)",
+	)
+	cmd.Flags().StringArrayVarP(
+		&cotsCrossCheckCotsFiles, "cots", "c", []string{}, "a CoTS, concise-ta-stores or CoRIM file (in CBOR format)",
+	)
+	cmd.Flags().StringArrayVarP(
+		&cotsCrossCheckCotsDirs, "cots-dir", "C", []string{}, "a directory containing CoTS, concise-ta-stores or CoRIM files (in CBOR format)",
+	)
+
+	return cmd
+}
+
+func checkCotsCrossCheckArgs() error {
+	if len(cotsCrossCheckComidFiles)+len(cotsCrossCheckComidDirs) == 0 {
+		return errors.New("no CoMID files or folders supplied")
+	}
+
+	if len(cotsCrossCheckCotsFiles)+len(cotsCrossCheckCotsDirs) == 0 {
+		return errors.New("no CoTS files or folders supplied")
+	}
+
+	return nil
+}
+
+// loadCrossCheckKeys returns the keys of the attestation and identity key
+// triples of the CoMIDs in the supplied files
+func loadCrossCheckKeys(files []string) ([]crossCheckKey, error) {
+	var keys []crossCheckKey
+
+	for _, file := range files {
+		endorsements, errs, err := loadEndorsements(file)
+		if err != nil {
+			return nil, err
+		}
+		if len(errs) != 0 {
+			return nil, errs[0]
+		}
+
+		for _, e := range endorsements {
+			if e.Comid == nil {
+				continue
+			}
+
+			for _, t := range []struct {
+				name    string
+				triples *comid.KeyTriples
+			}{
+				{"attester-verification-keys", e.Comid.Triples.AttestVerifKeys},
+				{"dev-identity-keys", e.Comid.Triples.DevIdentityKeys},
+			} {
+				if t.triples == nil {
+					continue
+				}
+				for i, kt := range *t.triples {
+					for j, k := range kt.VerifKeys {
+						keys = append(keys, crossCheckKey{
+							Where: fmt.Sprintf("%s: %s[%d].verification-keys[%d]", e.Where(), t.name, i, j),
+							Env:   kt.Environment,
+							Key:   *k,
+						})
+					}
+				}
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// loadCrossCheckStores returns the CoTSs in the supplied files
+func loadCrossCheckStores(files []string) ([]crossCheckStore, error) {
+	var stores []crossCheckStore
+
+	for _, file := range files {
+		data, err := afero.ReadFile(fs, file)
+		if err != nil {
+			return nil, fmt.Errorf("error loading CoTS from %s: %w", file, err)
+		}
+
+		if isCBORArray(data) {
+			var list cots.ConciseTaStores
+			if err := list.FromCBOR(data); err != nil {
+				return nil, fmt.Errorf("error decoding CoTSs from %s: %w", file, err)
+			}
+			for i := range list {
+				stores = append(stores, crossCheckStore{fmt.Sprintf("%s: stores[%d]", file, i), &list[i]})
+			}
+			continue
+		}
+
+		endorsements, errs, err := loadEndorsements(file)
+		if err != nil {
+			return nil, err
+		}
+		if len(errs) != 0 {
+			return nil, errs[0]
+		}
+
+		for _, e := range endorsements {
+			if e.Cots != nil {
+				stores = append(stores, crossCheckStore{e.Where(), e.Cots})
+			}
+		}
+	}
+
+	for _, s := range stores {
+		if err := s.Store.Valid(); err != nil {
+			return nil, fmt.Errorf("error validating CoTS %s: %w", s.Where, err)
+		}
+	}
+
+	return stores, nil
+}
+
+// crossCheck compares the keys with the TAs of the stores
+func crossCheck(keys []crossCheckKey, stores []crossCheckStore) []crossCheckFinding {
+	var findings []crossCheckFinding
+
+	// referenced[i][j] is set if the TA j of store i anchors any key
+	referenced := make([][]bool, len(stores))
+	for i, s := range stores {
+		referenced[i] = make([]bool, len(s.Store.Keys.Tas))
+	}
+
+	for _, k := range keys {
+		findings = append(findings, crossCheckKeyFindings(k, stores, referenced)...)
+	}
+
+	for i, s := range stores {
+		for j, ta := range s.Store.Keys.Tas {
+			if !referenced[i][j] {
+				findings = append(findings, crossCheckFinding{
+					crossCheckUnreferenced, fmt.Sprintf("%s: tas[%d]", s.Where, j),
+					fmt.Sprintf("%s anchors none of the keys", taLabel(ta)),
+				})
+			}
+		}
+	}
+
+	return findings
+}
+
+// crossCheckKeyFindings checks that the key is covered by a CoTS, and that
+// the CoTSs whose TAs anchor it cover its environment, marking these TAs as
+// referenced
+func crossCheckKeyFindings(k crossCheckKey, stores []crossCheckStore, referenced [][]bool) []crossCheckFinding {
+	var findings []crossCheckFinding
+
+	env := findEnvString(k.Env)
+
+	covered := false
+	for _, s := range stores {
+		if storeCovers(s.Store, k.Env) {
+			covered = true
+			break
+		}
+	}
+
+	if !covered {
+		findings = append(findings, crossCheckFinding{
+			crossCheckNoStore, k.Where, fmt.Sprintf("no CoTS covers environment %s", env),
+		})
+	}
+
+	pub, certs, err := keyMaterial(k.Key)
+	if err != nil {
+		return append(findings, crossCheckFinding{crossCheckSkipped, k.Where, err.Error()})
+	}
+
+	for i, s := range stores {
+		for j, ta := range s.Store.Keys.Tas {
+			if !keyAnchoredBy(pub, certs, ta, s.Store.Keys.Cas) {
+				continue
+			}
+
+			referenced[i][j] = true
+
+			if !storeCovers(s.Store, k.Env) {
+				findings = append(findings, crossCheckFinding{
+					crossCheckMismatch, k.Where, fmt.Sprintf(
+						"anchored by %s: tas[%d] (%s), whose environments do not cover %s",
+						s.Where, j, taLabel(ta), env,
+					),
+				})
+			}
+		}
+	}
+
+	return findings
+}
+
+// storeCovers tells whether the CoTS applies to the environment: one of its
+// environments matches it, or it has none
+func storeCovers(store *cots.ConciseTaStore, env comid.Environment) bool {
+	if len(store.Environments) == 0 {
+		return true
+	}
+
+	eg := cots.EnvironmentGroup{Environment: &env}
+
+	for _, se := range store.Environments {
+		if envGroupMatches(se, eg) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keyMaterial returns the public key of a CoMID key and, for certificate
+// keys, its certificate path
+func keyMaterial(key comid.CryptoKey) (crypto.PublicKey, []*x509.Certificate, error) {
+	certs, err := keyCertificates(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(certs) != 0 {
+		return certs[0].PublicKey, certs, nil
+	}
+
+	pub, err := key.PublicKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s key cannot be checked: %w", key.Type(), err)
+	}
+
+	return pub, nil, nil
+}
+
+// keyAnchoredBy tells whether the key is the public key of the TA, or whether
+// its certificate path chains up to the TA through the supplied CAs
+func keyAnchoredBy(pub crypto.PublicKey, certs []*x509.Certificate, ta cots.TrustAnchor, cas [][]byte) bool {
+	if taPub, err := taPublicKey(ta); err == nil {
+		if k, ok := taPub.(interface{ Equal(crypto.PublicKey) bool }); ok && k.Equal(pub) {
+			return true
+		}
+	}
+
+	if len(certs) == 0 {
+		return false
+	}
+
+	intermediates := append([]*x509.Certificate{}, certs[1:]...)
+	for _, ca := range cas {
+		if c, err := x509.ParseCertificate(ca); err == nil {
+			intermediates = append(intermediates, c)
+		}
+	}
+
+	_, err := anchorChain(ta, certs[0], intermediates)
+
+	return err == nil
+}
+
+// keyCertificates returns the certificate, or certificate path, of a
+// PKIX certificate key, and nil for other keys.  Decoded keys hold pointers to
+// their values, constructed ones the values themselves.
+func keyCertificates(key comid.CryptoKey) ([]*x509.Certificate, error) {
+	var data string
+
+	switch v := key.Value.(type) {
+	case comid.TaggedPKIXBase64Cert:
+		data = string(v)
+	case *comid.TaggedPKIXBase64Cert:
+		data = string(*v)
+	case comid.TaggedPKIXBase64CertPath:
+		data = string(v)
+	case *comid.TaggedPKIXBase64CertPath:
+		data = string(*v)
+	default:
+		return nil, nil
+	}
+
+	blocks, err := pemBundleBlocks([]byte(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s key cannot be decoded: %w", key.Type(), err)
+	}
+
+	var certs []*x509.Certificate
+	for _, b := range blocks {
+		c, err := x509.ParseCertificate(b.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s key cannot be decoded: %w", key.Type(), err)
+		}
+		certs = append(certs, c)
+	}
+
+	return certs, nil
+}
+
+// taPublicKey returns the public key of the TA, whatever its format
+func taPublicKey(ta cots.TrustAnchor) (crypto.PublicKey, error) {
+	switch ta.Format {
+	case cots.TaFormatCertificate:
+		cert, err := x509.ParseCertificate(ta.Data)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case cots.TaFormatSubjectPublicKeyInfo:
+		return x509.ParsePKIXPublicKey(ta.Data)
+	case cots.TaFormatTrustAnchorInfo:
+		tai, err := parseTrustAnchorInfo(ta.Data)
+		if err != nil {
+			return nil, err
+		}
+		return x509.ParsePKIXPublicKey(tai.PubKey)
+	}
+
+	return nil, fmt.Errorf("unknown TA format %d", ta.Format)
+}
+
+func init() {
+	cotsCmd.AddCommand(cotsCrossCheckCmd)
+}
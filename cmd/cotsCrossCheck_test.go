@@ -0,0 +1,135 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/corim/cots"
+)
+
+// testCrossCheckFiles writes:
+//   - comid.cbor, with the certificate of the device of the chain as ACME
+//     attestation key, and a raw public key as identity key of vendor Other
+//   - acme.cbor, a CoTS for ACME with the root of the chain (and its
+//     intermediate as CA) and an unrelated root as TAs
+//   - stores.cbor, a list with a CoTS for Zesty holding the identity key
+func testCrossCheckFiles(t *testing.T) {
+	c := newTestChain(t)
+	other, _ := testIssueCert(t, "Other Root", true, nil, nil)
+
+	idKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	idSPKI, err := x509.MarshalPKIXPublicKey(idKey.Public())
+	require.NoError(t, err)
+
+	leafPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.leaf.Raw})
+	idPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: idSPKI})
+
+	m := comid.NewComid().SetTagIdentity("keys", 0)
+	require.NotNil(t, m.AddAttestVerifKey(comid.KeyTriple{
+		Environment: *testVendorEnv("ACME"),
+		VerifKeys:   comid.CryptoKeys{comid.MustNewPKIXBase64Cert(string(leafPEM))},
+	}))
+	require.NotNil(t, m.AddDevIdentityKey(comid.KeyTriple{
+		Environment: *testVendorEnv("Other"),
+		VerifKeys:   comid.CryptoKeys{comid.MustNewPKIXBase64Key(string(idPEM))},
+	}))
+	comidCBOR, err := m.ToCBOR()
+	require.NoError(t, err)
+
+	acme := testStore(
+		cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: c.root.Raw},
+		cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: other.Raw},
+	)
+	acme.Keys.Cas = [][]byte{c.ica.Raw}
+	acmeCBOR, err := acme.ToCBOR()
+	require.NoError(t, err)
+
+	zesty := cots.NewConciseTaStore()
+	zesty.AddEnvironmentGroup(cots.EnvironmentGroup{Environment: testVendorEnv("Zesty")})
+	zesty.SetKeys(cots.TasAndCas{Tas: []cots.TrustAnchor{{Format: cots.TaFormatSubjectPublicKeyInfo, Data: idSPKI}}})
+	storesCBOR, err := cots.ConciseTaStores{*zesty}.ToCBOR()
+	require.NoError(t, err)
+
+	fs = afero.NewMemMapFs()
+	for name, data := range map[string][]byte{
+		"comid.cbor":  comidCBOR,
+		"acme.cbor":   acmeCBOR,
+		"stores.cbor": storesCBOR,
+	} {
+		require.NoError(t, afero.WriteFile(fs, name, data, 0644))
+	}
+}
+
+func Test_CotsCrossCheckCmd_no_files(t *testing.T) {
+	for expected, args := range map[string][]string{
+		"no CoMID files or folders supplied": {"--cots=acme.cbor"},
+		"no CoTS files or folders supplied":  {"--comid=comid.cbor"},
+		"no CoMID files found":               {"--comid=unknown.cbor", "--cots=acme.cbor"},
+	} {
+		cmd := NewCotsCrossCheckCmd()
+		cmd.SetArgs(args)
+
+		err := cmd.Execute()
+		assert.EqualError(t, err, expected)
+	}
+}
+
+func Test_crossCheck(t *testing.T) {
+	testCrossCheckFiles(t)
+
+	keys, err := loadCrossCheckKeys([]string{"comid.cbor"})
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+
+	stores, err := loadCrossCheckStores([]string{"acme.cbor", "stores.cbor"})
+	require.NoError(t, err)
+	require.Len(t, stores, 2)
+
+	findings := crossCheck(keys, stores)
+	require.Len(t, findings, 3)
+
+	assert.Equal(t, crossCheckFinding{
+		crossCheckNoStore, "comid.cbor: dev-identity-keys[0].verification-keys[0]",
+		"no CoTS covers environment vendor=Other",
+	}, findings[0])
+
+	assert.Equal(t, crossCheckMismatch, findings[1].Kind)
+	assert.Equal(t, "comid.cbor: dev-identity-keys[0].verification-keys[0]", findings[1].Where)
+	assert.Regexp(t, `^anchored by stores.cbor: stores\[0\]: tas\[0\] \(public key [0-9a-f]{16}\), whose environments do not cover vendor=Other$`, findings[1].Detail)
+
+	assert.Equal(t, crossCheckFinding{
+		crossCheckUnreferenced, "acme.cbor: tas[1]", "certificate CN=Other Root anchors none of the keys",
+	}, findings[2])
+}
+
+func Test_CotsCrossCheckCmd(t *testing.T) {
+	testCrossCheckFiles(t)
+
+	cmd := NewCotsCrossCheckCmd()
+	cmd.SetArgs([]string{"--comid=comid.cbor", "--cots=acme.cbor", "--cots=stores.cbor"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "3 inconsistenc(ies) found")
+}
+
+func Test_storeCovers(t *testing.T) {
+	store := testStore()
+	assert.True(t, storeCovers(store, *testVendorEnv("ACME")))
+	assert.False(t, storeCovers(store, *testVendorEnv("Zesty")))
+
+	// a CoTS without environments applies to any
+	store.Environments = cots.EnvironmentGroups{}
+	assert.True(t, storeCovers(store, *testVendorEnv("Zesty")))
+}
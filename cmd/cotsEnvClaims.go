@@ -0,0 +1,162 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/afero"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/corim/cots"
+	"github.com/veraison/swid"
+)
+
+// ctsEnvFlags are the cots create flags describing an environment
+type ctsEnvFlags struct {
+	Vendor      string
+	Model       string
+	ClassID     string
+	ClassIDType string
+	Instance    string
+	SwName      string
+}
+
+func (o ctsEnvFlags) isSet() bool {
+	return o.Vendor != "" || o.Model != "" || o.ClassID != "" || o.Instance != "" || o.SwName != ""
+}
+
+// environmentGroups returns the environment groups described by the flags: a
+// CoMID environment with the class and instance attributes, and, if a
+// software name is supplied, an abbreviated SWID tag created by the vendor
+func (o ctsEnvFlags) environmentGroups() (cots.EnvironmentGroups, error) {
+	var groups cots.EnvironmentGroups
+
+	if o.ClassID != "" || o.Instance != "" || (o.SwName == "" && (o.Vendor != "" || o.Model != "")) {
+		env := comid.Environment{}
+
+		if o.ClassID != "" || o.Vendor != "" || o.Model != "" {
+			env.Class = &comid.Class{}
+		}
+
+		if o.ClassID != "" {
+			classID, err := comid.NewClassID(o.ClassID, o.ClassIDType)
+			if err != nil {
+				return nil, fmt.Errorf("invalid class ID: %w", err)
+			}
+			env.Class.ClassID = classID
+		}
+		if o.Vendor != "" {
+			env.Class.SetVendor(o.Vendor)
+		}
+		if o.Model != "" {
+			env.Class.SetModel(o.Model)
+		}
+
+		if o.Instance != "" {
+			ueid, err := decodeHexOrBase64(o.Instance)
+			if err != nil {
+				return nil, fmt.Errorf("invalid instance ID: %w", err)
+			}
+			inst, err := comid.NewUEIDInstance(ueid)
+			if err != nil {
+				return nil, fmt.Errorf("invalid instance ID: %w", err)
+			}
+			env.Instance = inst
+		}
+
+		if err := env.Valid(); err != nil {
+			return nil, fmt.Errorf("invalid environment: %w", err)
+		}
+
+		groups = append(groups, cots.EnvironmentGroup{Environment: &env})
+	}
+
+	if o.SwName != "" {
+		if o.Vendor == "" {
+			return nil, errors.New("a software name needs a vendor, the creator of the software")
+		}
+
+		entity, err := swid.NewEntity(o.Vendor, swid.RoleSoftwareCreator)
+		if err != nil {
+			return nil, fmt.Errorf("invalid software creator: %w", err)
+		}
+
+		tag := cots.AbbreviatedSwidTag{SoftwareName: o.SwName, Entities: swid.Entities{*entity}}
+
+		groups = append(groups, cots.EnvironmentGroup{SwidTag: &tag})
+	}
+
+	return groups, nil
+}
+
+// loadClaims returns the claims in the template file, if any, with the
+// supplied name=value claims added, their values parsed according to the
+// kind of the claim (see claimKind.parse).  Claims are checked against the known
+// CWT/EAT claims: unknown claims are errors on the command line, and are
+// dropped with a warning from the template.  It returns nil if there are no
+// claims.
+func loadClaims(file string, claims []string) (*cots.EatCWTClaim, error) {
+	m := map[string]json.RawMessage{}
+
+	if file != "" {
+		data, err := afero.ReadFile(fs, file)
+		if err != nil {
+			return nil, fmt.Errorf("error loading template from %s: %w", file, err)
+		}
+
+		errs, warnings := checkClaimsJSON(data)
+		if len(errs) != 0 {
+			return nil, fmt.Errorf("error decoding template from %s: %s", file, strings.Join(errs, "; "))
+		}
+
+		for _, w := range warnings {
+			fmt.Printf(">> WARNING: %s: %s\n", file, w)
+		}
+
+		_ = json.Unmarshal(data, &m)
+		for name := range m {
+			if _, ok := eatClaims[name]; !ok {
+				delete(m, name)
+			}
+		}
+	}
+
+	if file == "" && len(claims) == 0 {
+		return nil, nil
+	}
+
+	for _, claim := range claims {
+		name, value, ok := strings.Cut(claim, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid claim %q (want name=value)", claim)
+		}
+
+		spec, ok := eatClaims[name]
+		if !ok {
+			return nil, errors.New(unknownClaim(name))
+		}
+
+		v, err := spec.Kind.parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid claims: claim %q: %w", name, err)
+		}
+		m[name] = v
+	}
+
+	data, _ := json.Marshal(m)
+
+	if errs, _ := checkClaimsJSON(data); len(errs) != 0 {
+		return nil, fmt.Errorf("invalid claims: %s", strings.Join(errs, "; "))
+	}
+
+	c, err := claimsFromJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+
+	return c, nil
+}
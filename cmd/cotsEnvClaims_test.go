@@ -0,0 +1,170 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/corim/cots"
+)
+
+func Test_ctsEnvFlags_environmentGroups(t *testing.T) {
+	groups, err := ctsEnvFlags{
+		Vendor:      "ACME",
+		Model:       "Widget",
+		ClassID:     "1.2.3.4",
+		ClassIDType: comid.OIDType,
+		Instance:    "02deadbeefdeadbeef",
+	}.environmentGroups()
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+
+	env := groups[0].Environment
+	require.NotNil(t, env)
+	assert.Equal(t, "1.2.3.4", env.Class.ClassID.String())
+	assert.Equal(t, "ACME", *env.Class.Vendor)
+	assert.Equal(t, "Widget", *env.Class.Model)
+	assert.Equal(t, "At6tvu/erb7v", env.Instance.String())
+}
+
+func Test_ctsEnvFlags_swname(t *testing.T) {
+	// the vendor only names the software creator
+	groups, err := ctsEnvFlags{Vendor: "ACME", SwName: "firmware"}.environmentGroups()
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+
+	tag := groups[0].SwidTag
+	require.NotNil(t, tag)
+	assert.Equal(t, "firmware", tag.SoftwareName)
+	assert.Equal(t, "ACME", tag.Entities[0].EntityName)
+	assert.NoError(t, groups.Valid())
+
+	groups, err = ctsEnvFlags{Vendor: "ACME", ClassID: "1.2.3.4", ClassIDType: comid.OIDType, SwName: "firmware"}.environmentGroups()
+	require.NoError(t, err)
+	assert.Len(t, groups, 2)
+
+	_, err = ctsEnvFlags{SwName: "firmware"}.environmentGroups()
+	assert.EqualError(t, err, "a software name needs a vendor, the creator of the software")
+}
+
+func Test_ctsEnvFlags_invalid(t *testing.T) {
+	_, err := ctsEnvFlags{ClassID: "1.2.3.4", ClassIDType: comid.UUIDType}.environmentGroups()
+	assert.ErrorContains(t, err, "invalid class ID: ")
+
+	_, err = ctsEnvFlags{Instance: "not hex"}.environmentGroups()
+	assert.ErrorContains(t, err, "invalid instance ID: ")
+}
+
+func Test_loadClaims(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "claims.json", []byte(`{"swname":"Bitter Paper","uptime":5}`), 0644))
+
+	c, err := loadClaims("", nil)
+	require.NoError(t, err)
+	assert.Nil(t, c)
+
+	// flags override and extend the template
+	c, err = loadClaims("claims.json", []string{"uptime=10", "iss=CN=Test", "sub=42", "secure-boot=true"})
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	assert.Equal(t, "Bitter Paper", *c.SoftwareNameLabel)
+	assert.Equal(t, uint(10), *c.Uptime)
+	assert.Equal(t, "CN=Test", *c.Issuer)
+	assert.Equal(t, "42", *c.Subject)
+	assert.True(t, *c.SecureBoot)
+
+	// values are parsed according to the kind of the claim
+	c, err = loadClaims("", []string{"swname=123", "swversion=1.0", "hwvers={\"Version\":\"2.0\",\"Scheme\":1}"})
+	require.NoError(t, err)
+	assert.Equal(t, "123", *c.SoftwareNameLabel)
+	assert.Equal(t, "1.0", c.SoftwareVersionScheme.Version)
+	assert.Equal(t, "2.0", c.HardwareVersionScheme.Version)
+
+	// audiences are a string or an array of strings
+	c, err = loadClaims("", []string{"aud=verifier,relying-party"})
+	require.NoError(t, err)
+	require.Len(t, *c.Audience, 2)
+	assert.Equal(t, "relying-party", (*c.Audience)[1].String())
+
+	for claims, expected := range map[string]string{
+		"swname":      `invalid claim "swname" (want name=value)`,
+		"=x":          `invalid claim "=x" (want name=value)`,
+		"colour=blue": `unknown claim "colour"`,
+		"uptime=-1":   `invalid claims: claim "uptime": -1 is not an unsigned integer`,
+		"exp=soon":    `invalid claims: claim "exp": soon is not an integer`,
+		"location=x":  `invalid claims: claim "location": x is not an object`,
+	} {
+		_, err = loadClaims("", []string{claims})
+		assert.EqualError(t, err, expected, claims)
+	}
+}
+
+func Test_CotsCreateCtsCmd_env_and_claims_flags(t *testing.T) {
+	c := newTestChain(t)
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "root.der", c.root.Raw, 0644))
+
+	cmd := NewCotsCreateCtsCmd()
+	cmd.SetArgs([]string{
+		"--vendor=ACME",
+		"--class-id=31fb5abf-023e-4992-aa4e-95f9c1503bfa",
+		"--permclaim=swname=firmware",
+		"--exclclaim=sub=CN=Revoked",
+		"--tafile=root.der",
+	})
+	require.NoError(t, cmd.Execute())
+
+	data, err := afero.ReadFile(fs, "cots.cbor")
+	require.NoError(t, err)
+
+	var store cots.ConciseTaStore
+	require.NoError(t, store.FromCBOR(data))
+
+	require.Len(t, store.Environments, 1)
+	assert.Equal(t, "31fb5abf-023e-4992-aa4e-95f9c1503bfa", store.Environments[0].Environment.Class.ClassID.String())
+	assert.Equal(t, "firmware", *store.PermClaims[0].SoftwareNameLabel)
+	assert.Equal(t, "CN=Revoked", *store.ExclClaims[0].Subject)
+}
+
+func Test_loadClaims_template_checks(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "typo.json", []byte(`{"swname":"firmware","swnmae":"other"}`), 0644))
+	require.NoError(t, afero.WriteFile(fs, "bad.json", []byte(`{"secure-boot":"yes"}`), 0644))
+
+	// unknown claims are dropped with a warning
+	c, err := loadClaims("typo.json", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "firmware", *c.SoftwareNameLabel)
+
+	_, err = loadClaims("bad.json", nil)
+	assert.EqualError(t, err, `error decoding template from bad.json: claim "secure-boot": "yes" is not a boolean`)
+
+	_, err = loadClaims("", []string{"swnmae=firmware"})
+	assert.EqualError(t, err, `unknown claim "swnmae" (did you mean "swname"?)`)
+}
+
+func Test_CotsCreateCtsCmd_conflicting_claims(t *testing.T) {
+	c := newTestChain(t)
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "root.der", c.root.Raw, 0644))
+
+	cmd := NewCotsCreateCtsCmd()
+	cmd.SetArgs([]string{
+		"--vendor=ACME",
+		"--permclaim=sub=CN=Device",
+		"--exclclaim=sub=CN=Device",
+		"--tafile=root.der",
+	})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err,
+		`error validating CoTS: claim "sub" is both permitted (permclaims[0]) and excluded (exclclaims[0]) with value "CN=Device"`,
+	)
+}
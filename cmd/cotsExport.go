@@ -0,0 +1,320 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/cots"
+)
+
+var (
+	cotsExportFile      string
+	cotsExportOutputDir string
+	cotsExportFormat    string
+	cotsExportBundle    string
+	cotsExportJWKS      string
+)
+
+var cotsExportCmd = NewCotsExportCmd()
+
+func NewCotsExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "export the trust anchors and CA certificates of a CoTS to PEM or DER files",
+		Long: `export the trust anchors and CA certificates of a CoTS to PEM or DER files
+
+	Each TA and CA is saved to its own file, named after its index and the
+	common name of its subject, if any (e.g., ta-0-Example_Root.pem).  TAs
+	that are certificates, or TrustAnchorInfo with a certificate, are exported
+	as certificates; the others as public keys.  DER files use the extensions
+	understood by cots create: .der for certificates and .spki for public keys.
+
+	Export the TAs and CAs in vendor.cbor as PEM files in the current directory
+
+	  cocli cots export --file=vendor.cbor
+
+	Export them as DER files in directory my-dir, which must exist
+
+	  cocli cots export --file=vendor.cbor --format=der --output-dir=my-dir
+
+	Export them as a single PEM bundle, and their public keys as a JWK set
+
+	  cocli cots export --file=vendor.cbor --bundle=vendor.pem \
+	                    --jwks=vendor.jwks
+	`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkCotsExportArgs(); err != nil {
+				return err
+			}
+
+			store, err := loadCots(cotsExportFile)
+			if err != nil {
+				return err
+			}
+
+			keys, err := cotsExportKeys(store)
+			if err != nil {
+				return fmt.Errorf("error exporting from %s: %w", cotsExportFile, err)
+			}
+
+			if len(keys) == 0 {
+				return fmt.Errorf("no TAs or CAs found in %s", cotsExportFile)
+			}
+
+			if cotsExportBundle != "" {
+				err = saveExportBundle(keys, cotsExportBundle)
+			} else {
+				err = saveExportFiles(keys, cotsExportOutputDir, cotsExportFormat)
+			}
+			if err != nil {
+				return err
+			}
+
+			if cotsExportJWKS != "" {
+				return saveExportJWKS(keys, cotsExportJWKS)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(
+		&cotsExportFile, "file", "f", "", "a CoTS file (in CBOR format)",
+	)
+
+	cmd.Flags().StringVarP(
+		&cotsExportOutputDir, "output-dir", "o", ".", "folder to which TAs and CAs are saved",
+	)
+
+	cmd.Flags().StringVar(
+		&cotsExportFormat, "format", "pem", "format of the exported files: pem or der",
+	)
+
+	cmd.Flags().StringVarP(
+		&cotsExportBundle, "bundle", "b", "", "save all TAs and CAs to this PEM bundle instead",
+	)
+
+	cmd.Flags().StringVar(
+		&cotsExportJWKS, "jwks", "", "also save the public keys to this JWK set file",
+	)
+
+	return cmd
+}
+
+func checkCotsExportArgs() error {
+	if cotsExportFile == "" {
+		return errors.New("no CoTS supplied")
+	}
+
+	if cotsExportFormat != "pem" && cotsExportFormat != "der" {
+		return fmt.Errorf("unsupported format %q (want pem or der)", cotsExportFormat)
+	}
+
+	return nil
+}
+
+// exportedKey is a TA or CA ready to be saved: either a certificate or a
+// bare SubjectPublicKeyInfo
+type exportedKey struct {
+	Name        string
+	Certificate *x509.Certificate
+	SPKI        []byte
+	PublicKey   crypto.PublicKey
+}
+
+func (o exportedKey) pemBlock() *pem.Block {
+	if o.Certificate != nil {
+		return &pem.Block{Type: "CERTIFICATE", Bytes: o.Certificate.Raw}
+	}
+	return &pem.Block{Type: "PUBLIC KEY", Bytes: o.SPKI}
+}
+
+func (o exportedKey) fileName(format string) string {
+	switch {
+	case format == "pem":
+		return o.Name + ".pem"
+	case o.Certificate != nil:
+		return o.Name + ".der"
+	default:
+		return o.Name + ".spki"
+	}
+}
+
+// cotsExportKeys returns the TAs and CAs of the CoTS, in order
+func cotsExportKeys(store *cots.ConciseTaStore) ([]exportedKey, error) {
+	var keys []exportedKey
+
+	if store.Keys == nil {
+		return nil, nil
+	}
+
+	for i, ta := range store.Keys.Tas {
+		k, err := taExportKey(ta)
+		if err != nil {
+			return nil, fmt.Errorf("tas[%d]: %w", i, err)
+		}
+		k.Name = exportName("ta", i, k.Name)
+		keys = append(keys, k)
+	}
+
+	for i, ca := range store.Keys.Cas {
+		cert, err := x509.ParseCertificate(ca)
+		if err != nil {
+			return nil, fmt.Errorf("cas[%d]: %w", i, err)
+		}
+		keys = append(keys, exportedKey{
+			Name:        exportName("ca", i, cert.Subject.CommonName),
+			Certificate: cert,
+			PublicKey:   cert.PublicKey,
+		})
+	}
+
+	return keys, nil
+}
+
+// taExportKey returns the certificate or the public key of a TA, named after
+// the common name of its subject or its title
+func taExportKey(ta cots.TrustAnchor) (exportedKey, error) {
+	var spki []byte
+
+	switch ta.Format {
+	case cots.TaFormatCertificate:
+		cert, err := x509.ParseCertificate(ta.Data)
+		if err != nil {
+			return exportedKey{}, err
+		}
+		return exportedKey{Name: cert.Subject.CommonName, Certificate: cert, PublicKey: cert.PublicKey}, nil
+	case cots.TaFormatSubjectPublicKeyInfo:
+		spki = ta.Data
+	case cots.TaFormatTrustAnchorInfo:
+		tai, err := parseTrustAnchorInfo(ta.Data)
+		if err != nil {
+			return exportedKey{}, err
+		}
+		if tai.CertPath != nil && tai.CertPath.Certificate != nil {
+			cert := tai.CertPath.Certificate
+			return exportedKey{Name: cert.Subject.CommonName, Certificate: cert, PublicKey: cert.PublicKey}, nil
+		}
+		k, err := spkiExportKey(tai.PubKey)
+		k.Name = tai.Title
+		return k, err
+	default:
+		return exportedKey{}, fmt.Errorf("unknown TA format %d", ta.Format)
+	}
+
+	return spkiExportKey(spki)
+}
+
+func spkiExportKey(spki []byte) (exportedKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(spki)
+	if err != nil {
+		return exportedKey{}, err
+	}
+
+	return exportedKey{SPKI: spki, PublicKey: pub}, nil
+}
+
+// exportName returns the base name of an exported file, e.g. ta-0-Example_Root
+func exportName(kind string, index int, label string) string {
+	name := fmt.Sprintf("%s-%d", kind, index)
+
+	label = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, label)
+
+	if label != "" {
+		name += "-" + label
+	}
+
+	return name
+}
+
+func saveExportFiles(keys []exportedKey, outputDir, format string) error {
+	for _, k := range keys {
+		data := k.pemBlock().Bytes
+		if format == "pem" {
+			data = pem.EncodeToMemory(k.pemBlock())
+		}
+
+		file := filepath.Join(outputDir, k.fileName(format))
+		if err := afero.WriteFile(fs, file, data, 0644); err != nil {
+			return fmt.Errorf("error saving %s: %w", file, err)
+		}
+
+		fmt.Printf(">> exported %q\n", file)
+	}
+
+	return nil
+}
+
+func saveExportBundle(keys []exportedKey, file string) error {
+	var data []byte
+
+	for _, k := range keys {
+		data = append(data, pem.EncodeToMemory(k.pemBlock())...)
+	}
+
+	if err := afero.WriteFile(fs, file, data, 0644); err != nil {
+		return fmt.Errorf("error saving %s: %w", file, err)
+	}
+
+	fmt.Printf(">> exported %d TA(s) and CA(s) to %q\n", len(keys), file)
+
+	return nil
+}
+
+// saveExportJWKS saves the public keys to a JWK set, using the base name of
+// the exported files as key IDs
+func saveExportJWKS(keys []exportedKey, file string) error {
+	set := jwk.NewSet()
+
+	for _, k := range keys {
+		key, err := jwk.FromRaw(k.PublicKey)
+		if err != nil {
+			return fmt.Errorf("error converting %s to JWK: %w", k.Name, err)
+		}
+
+		if err := key.Set(jwk.KeyIDKey, k.Name); err != nil {
+			return fmt.Errorf("error setting the key ID of %s: %w", k.Name, err)
+		}
+
+		if err := set.AddKey(key); err != nil {
+			return fmt.Errorf("error adding %s to the JWK set: %w", k.Name, err)
+		}
+	}
+
+	data, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding the JWK set: %w", err)
+	}
+
+	if err := afero.WriteFile(fs, file, data, 0644); err != nil {
+		return fmt.Errorf("error saving %s: %w", file, err)
+	}
+
+	fmt.Printf(">> exported %d public key(s) to %q\n", len(keys), file)
+
+	return nil
+}
+
+func init() {
+	cotsCmd.AddCommand(cotsExportCmd)
+}
@@ -0,0 +1,154 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/cots"
+)
+
+// testExportStore writes a CoTS with a certificate TA, a public key TA and a
+// CA to store.cbor and returns the chain its keys come from
+func testExportStore(t *testing.T) testChain {
+	c := newTestChain(t)
+
+	store := testStore(
+		cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: c.root.Raw},
+		cots.TrustAnchor{Format: cots.TaFormatSubjectPublicKeyInfo, Data: c.leaf.RawSubjectPublicKeyInfo},
+	)
+	store.Keys.Cas = [][]byte{c.ica.Raw}
+
+	data, err := store.ToCBOR()
+	require.NoError(t, err)
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "store.cbor", data, 0644))
+
+	return c
+}
+
+func Test_CotsExportCmd_no_cots(t *testing.T) {
+	cmd := NewCotsExportCmd()
+	cmd.SetArgs([]string{})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no CoTS supplied")
+}
+
+func Test_CotsExportCmd_bad_format(t *testing.T) {
+	cmd := NewCotsExportCmd()
+	cmd.SetArgs([]string{"--file=store.cbor", "--format=jwk"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, `unsupported format "jwk" (want pem or der)`)
+}
+
+func Test_CotsExportCmd_pem(t *testing.T) {
+	c := testExportStore(t)
+
+	cmd := NewCotsExportCmd()
+	cmd.SetArgs([]string{"--file=store.cbor", "--output-dir=out"})
+	require.NoError(t, cmd.Execute())
+
+	for file, expected := range map[string][]byte{
+		"out/ta-0-Test_Root.pem": c.root.Raw,
+		"out/ta-1.pem":           c.leaf.RawSubjectPublicKeyInfo,
+		"out/ca-0-Test_ICA.pem":  c.ica.Raw,
+	} {
+		data, err := afero.ReadFile(fs, file)
+		require.NoError(t, err, file)
+
+		blocks, err := pemBundleBlocks(data)
+		require.NoError(t, err, file)
+		require.Len(t, blocks, 1, file)
+		assert.Equal(t, expected, blocks[0].Bytes, file)
+	}
+}
+
+func Test_CotsExportCmd_der(t *testing.T) {
+	c := testExportStore(t)
+
+	cmd := NewCotsExportCmd()
+	cmd.SetArgs([]string{"--file=store.cbor", "--format=der"})
+	require.NoError(t, cmd.Execute())
+
+	for file, expected := range map[string][]byte{
+		"ta-0-Test_Root.der": c.root.Raw,
+		"ta-1.spki":          c.leaf.RawSubjectPublicKeyInfo,
+		"ca-0-Test_ICA.der":  c.ica.Raw,
+	} {
+		data, err := afero.ReadFile(fs, file)
+		require.NoError(t, err, file)
+		assert.Equal(t, expected, data, file)
+	}
+}
+
+func Test_CotsExportCmd_bundle_and_jwks(t *testing.T) {
+	c := testExportStore(t)
+
+	cmd := NewCotsExportCmd()
+	cmd.SetArgs([]string{"--file=store.cbor", "--bundle=store.pem", "--jwks=store.jwks"})
+	require.NoError(t, cmd.Execute())
+
+	data, err := afero.ReadFile(fs, "store.pem")
+	require.NoError(t, err)
+
+	tas, err := pemBundleTAs(data)
+	require.NoError(t, err)
+	assert.Equal(t, []cots.TrustAnchor{
+		{Format: cots.TaFormatCertificate, Data: c.root.Raw},
+		{Format: cots.TaFormatSubjectPublicKeyInfo, Data: c.leaf.RawSubjectPublicKeyInfo},
+		{Format: cots.TaFormatCertificate, Data: c.ica.Raw},
+	}, tas)
+
+	exists, err := afero.Exists(fs, "ta-0-Test_Root.pem")
+	require.NoError(t, err)
+	assert.False(t, exists, "no individual files with --bundle")
+
+	data, err = afero.ReadFile(fs, "store.jwks")
+	require.NoError(t, err)
+
+	set, err := jwk.Parse(data)
+	require.NoError(t, err)
+	require.Equal(t, 3, set.Len())
+
+	for i, want := range []struct {
+		kid  string
+		cert *x509.Certificate
+	}{
+		{"ta-0-Test_Root", c.root},
+		{"ta-1", c.leaf},
+		{"ca-0-Test_ICA", c.ica},
+	} {
+		key, ok := set.Key(i)
+		require.True(t, ok)
+		assert.Equal(t, want.kid, key.KeyID())
+
+		expected, err := jwk.FromRaw(want.cert.PublicKey)
+		require.NoError(t, err)
+
+		require.NoError(t, expected.Set(jwk.KeyIDKey, want.kid))
+		assert.True(t, jwk.Equal(expected, key), want.kid)
+	}
+}
+
+func Test_CotsExportCmd_bad_ta(t *testing.T) {
+	data, err := testStore(cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: []byte("rubbish")}).ToCBOR()
+	require.NoError(t, err)
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "bad.cbor", data, 0644))
+
+	cmd := NewCotsExportCmd()
+	cmd.SetArgs([]string{"--file=bad.cbor"})
+
+	err = cmd.Execute()
+	assert.ErrorContains(t, err, "error exporting from bad.cbor: tas[0]: x509: malformed certificate")
+}
@@ -0,0 +1,185 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/corim/cots"
+)
+
+// ctsManifestEntry describes one of the CoTSs of a manifest, using the names
+// of the corresponding cots create flags
+type ctsManifestEntry struct {
+	Language    string   `json:"language"`
+	TagID       string   `json:"id"`
+	TagUUID     bool     `json:"uuid"`
+	TagUUIDStr  string   `json:"uuid-str"`
+	TagVersion  *uint    `json:"tag-version"`
+	Environment string   `json:"environment"`
+	Vendor      string   `json:"vendor"`
+	Model       string   `json:"model"`
+	ClassID     string   `json:"class-id"`
+	ClassIDType string   `json:"class-id-type"`
+	Instance    string   `json:"instance"`
+	SwName      string   `json:"swname"`
+	PermClaims  string   `json:"permclaims"`
+	PermClaim   []string `json:"permclaim"`
+	ExclClaims  string   `json:"exclclaims"`
+	ExclClaim   []string `json:"exclclaim"`
+	Purposes    []string `json:"purposes"`
+	TaDirs      []string `json:"tas"`
+	TaFiles     []string `json:"tafiles"`
+	CaDirs      []string `json:"cas"`
+	CaFiles     []string `json:"cafiles"`
+	InferFormat bool     `json:"infer-format"`
+}
+
+func checkCtsCreateManifestArgs() error {
+	if *cotsCreateLanguage != "" || *cotsCreateTagID != "" || *cotsCreateTagUUID || *cotsCreateTagUUIDStr != "" ||
+		*cotsCreateCtsEnvFile != "" || *cotsCreateCtsPermClaimsFile != "" || *cotsCreateCtsExclClaimsFile != "" ||
+		cotsCreateCtsEnvFlags.isSet() || len(cotsCreateCtsPermClaims)+len(cotsCreateCtsExclClaims) != 0 ||
+		len(cotsCreateCtsPurposes) != 0 || *cotsCreateCtsInferFormat ||
+		len(cotsCreateCtsTaFiles)+len(cotsCreateCtsTaDirs)+len(cotsCreateCtsCaFiles)+len(cotsCreateCtsCaDirs) != 0 {
+		return errors.New("--manifest can only be used with --output, the CoTSs are described in the manifest")
+	}
+
+	return nil
+}
+
+// resolve makes the relative paths of the entry relative to dir
+func (o *ctsManifestEntry) resolve(dir string) {
+	path := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+
+	paths := func(ps []string) []string {
+		var ret []string
+		for _, p := range ps {
+			ret = append(ret, path(p))
+		}
+		return ret
+	}
+
+	o.Environment = path(o.Environment)
+	o.PermClaims = path(o.PermClaims)
+	o.ExclClaims = path(o.ExclClaims)
+	o.TaDirs = paths(o.TaDirs)
+	o.TaFiles = paths(o.TaFiles)
+	o.CaDirs = paths(o.CaDirs)
+	o.CaFiles = paths(o.CaFiles)
+}
+
+func (o ctsManifestEntry) envFlags() ctsEnvFlags {
+	classIDType := o.ClassIDType
+	if classIDType == "" {
+		classIDType = comid.UUIDType
+	}
+
+	return ctsEnvFlags{
+		Vendor:      o.Vendor,
+		Model:       o.Model,
+		ClassID:     o.ClassID,
+		ClassIDType: classIDType,
+		Instance:    o.Instance,
+		SwName:      o.SwName,
+	}
+}
+
+func (o ctsManifestEntry) toCts() (*cots.ConciseTaStore, error) {
+	if o.Environment == "" && !o.envFlags().isSet() {
+		return nil, errors.New("no environment template or environment flags supplied")
+	}
+
+	if err := checkCtsTagID(o.TagID, o.TagUUID, o.TagUUIDStr); err != nil {
+		return nil, err
+	}
+
+	tasFilesList := ctsTaFilesList(o.TaFiles, o.TaDirs, o.InferFormat)
+	if len(tasFilesList) == 0 {
+		return nil, errors.New("no TA files found")
+	}
+
+	casFilesList := ctsCaFilesList(o.CaFiles, o.CaDirs)
+
+	return newCts(
+		o.Language, o.TagID, o.TagUUID, o.TagUUIDStr, o.TagVersion, o.Environment, o.envFlags(),
+		o.PermClaims, o.PermClaim, o.ExclClaims, o.ExclClaim, o.Purposes, tasFilesList, casFilesList, o.InferFormat,
+	)
+}
+
+// loadCtsManifest loads a manifest, a JSON array of CoTS descriptions whose
+// paths are relative to the directory containing the manifest
+func loadCtsManifest(file string) ([]ctsManifestEntry, error) {
+	data, err := afero.ReadFile(fs, file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading manifest from %s: %w", file, err)
+	}
+
+	var entries []ctsManifestEntry
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("error decoding manifest from %s: %w", file, err)
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no CoTS described in manifest %s", file)
+	}
+
+	for i := range entries {
+		entries[i].resolve(filepath.Dir(file))
+	}
+
+	return entries, nil
+}
+
+// ctsManifestToCBOR saves the concise-ta-stores described by the manifest to
+// outputFile, or to a file named after the manifest
+func ctsManifestToCBOR(manifestFile string, outputFile *string) (string, error) {
+	var ctsFile string
+
+	entries, err := loadCtsManifest(manifestFile)
+	if err != nil {
+		return "", err
+	}
+
+	stores := cots.NewConciseTaStores()
+
+	for i, e := range entries {
+		cts, err := e.toCts()
+		if err != nil {
+			return "", fmt.Errorf("error creating CoTS %d of %s: %w", i, manifestFile, err)
+		}
+		*stores = append(*stores, *cts)
+	}
+
+	ctsCBOR, err := stores.ToCBOR()
+	if err != nil {
+		return "", fmt.Errorf("error encoding CoTSs to CBOR: %w", err)
+	}
+
+	if outputFile == nil || *outputFile == "" {
+		ctsFile = makeFileName("", manifestFile, ".cbor")
+	} else {
+		ctsFile = *outputFile
+	}
+
+	if err := afero.WriteFile(fs, ctsFile, ctsCBOR, 0644); err != nil {
+		return "", fmt.Errorf("error saving CoTSs to file %s: %w", ctsFile, err)
+	}
+
+	return ctsFile, nil
+}
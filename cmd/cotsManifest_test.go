@@ -0,0 +1,156 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/cots"
+)
+
+// testManifestFiles writes the templates and TAs referenced by the manifests
+// of the tests below to the in-memory file system
+func testManifestFiles(t *testing.T) testChain {
+	c := newTestChain(t)
+
+	fs = afero.NewMemMapFs()
+	for name, data := range map[string][]byte{
+		"m/env/vendor.json":   []byte(`[{"environment":{"class":{"vendor":"ACME"}}}]`),
+		"m/env/named.json":    []byte(`[{"namedtastore":"Miscellaneous TA Store"}]`),
+		"m/claims/perm.json":  []byte(`{"swname":"firmware"}`),
+		"m/tas/root.der":      c.root.Raw,
+		"m/cas/ica.der":       c.ica.Raw,
+		"m/keys/device.spki":  c.leaf.RawSubjectPublicKeyInfo,
+		"m/keys/ignored.json": []byte(`{}`),
+	} {
+		require.NoError(t, afero.WriteFile(fs, name, data, 0644))
+	}
+
+	return c
+}
+
+func Test_CotsCreateCtsCmd_manifest(t *testing.T) {
+	c := testManifestFiles(t)
+
+	require.NoError(t, afero.WriteFile(fs, "m/stores.json", []byte(`[
+		{
+			"environment": "env/vendor.json",
+			"purposes": [ "eat", "corim" ],
+			"tas": [ "tas" ],
+			"cafiles": [ "cas/ica.der" ],
+			"id": "acme"
+		},
+		{
+			"environment": "env/named.json",
+			"permclaims": "claims/perm.json",
+			"tas": [ "keys" ],
+			"uuid-str": "31fb5abf-023e-4992-aa4e-95f9c1503bfa",
+			"tag-version": 2,
+			"language": "en"
+		}
+	]`), 0644))
+
+	cmd := NewCotsCreateCtsCmd()
+	cmd.SetArgs([]string{"--manifest=m/stores.json"})
+	require.NoError(t, cmd.Execute())
+
+	// named after the manifest, in the current directory
+	data, err := afero.ReadFile(fs, "stores.cbor")
+	require.NoError(t, err)
+	assert.True(t, isCBORArray(data))
+
+	var stores cots.ConciseTaStores
+	require.NoError(t, stores.FromCBOR(data))
+	require.Len(t, stores, 2)
+
+	assert.Equal(t, []string{"eat", "corim"}, stores[0].Purposes)
+	assert.Equal(t, "ACME", *stores[0].Environments[0].Environment.Class.Vendor)
+	assert.Equal(t, "acme", stores[0].TagIdentity.TagID.String())
+	assert.Equal(t, []cots.TrustAnchor{{Format: cots.TaFormatCertificate, Data: c.root.Raw}}, stores[0].Keys.Tas)
+	assert.Equal(t, [][]byte{c.ica.Raw}, stores[0].Keys.Cas)
+
+	assert.Equal(t, "Miscellaneous TA Store", *stores[1].Environments[0].NamedTaStore)
+	assert.Equal(t, "firmware", *stores[1].PermClaims[0].SoftwareNameLabel)
+	assert.Equal(t, "31fb5abf-023e-4992-aa4e-95f9c1503bfa", stores[1].TagIdentity.TagID.String())
+	assert.Equal(t, uint(2), stores[1].TagIdentity.TagVersion)
+	assert.Equal(t, "en", *stores[1].Language)
+	assert.Equal(t,
+		[]cots.TrustAnchor{{Format: cots.TaFormatSubjectPublicKeyInfo, Data: c.leaf.RawSubjectPublicKeyInfo}},
+		stores[1].Keys.Tas,
+	)
+}
+
+func Test_CotsCreateCtsCmd_manifest_with_store_flags(t *testing.T) {
+	cmd := NewCotsCreateCtsCmd()
+	cmd.SetArgs([]string{"--manifest=m/stores.json", "--tafile=root.der"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "--manifest can only be used with --output, the CoTSs are described in the manifest")
+}
+
+func Test_CotsCreateCtsCmd_manifest_bad_entries(t *testing.T) {
+	testManifestFiles(t)
+
+	for manifest, expected := range map[string]string{
+		`[]`: "no CoTS described in manifest m/bad.json",
+		`[{"environment":"env/vendor.json","tafile":["tas/root.der"]}]`: `error decoding manifest from m/bad.json: json: unknown field "tafile"`,
+		`[{"tas":["tas"]}]`: "error creating CoTS 0 of m/bad.json: no environment template or environment flags supplied",
+		`[{"environment":"env/vendor.json","tas":["tas"]},{"environment":"env/vendor.json","tas":["cas/ica.der"]}]`: "error creating CoTS 1 of m/bad.json: no TA files found",
+		`[{"environment":"env/vendor.json","tas":["tas"],"id":"a","uuid":true}]`: "error creating CoTS 0 of m/bad.json: only one of --uuid, --uuid-str and --id can be used at the same time",
+	} {
+		require.NoError(t, afero.WriteFile(fs, "m/bad.json", []byte(manifest), 0644))
+
+		cmd := NewCotsCreateCtsCmd()
+		cmd.SetArgs([]string{"--manifest=m/bad.json", "--output=bad.cbor"})
+
+		err := cmd.Execute()
+		assert.EqualError(t, err, expected, manifest)
+	}
+}
+
+func Test_printCots_list(t *testing.T) {
+	c := newTestChain(t)
+
+	stores := cots.ConciseTaStores{
+		*testStore(cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: c.root.Raw}),
+		*testStore(cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: []byte("rubbish")}),
+	}
+
+	data, err := stores.ToCBOR()
+	require.NoError(t, err)
+
+	assert.NoError(t, printCots(data, ">> [stores.cbor]"))
+	assert.Error(t, printCots(append([]byte{0x82}, data[1:2]...), ">> [bad.cbor]"))
+}
+
+func Test_CotsCreateCtsCmd_manifest_env_and_claims(t *testing.T) {
+	testManifestFiles(t)
+
+	require.NoError(t, afero.WriteFile(fs, "m/flags.json", []byte(`[
+		{
+			"vendor": "ACME",
+			"class-id-type": "oid",
+			"class-id": "1.2.3.4",
+			"permclaim": [ "swname=firmware" ],
+			"tas": [ "tas" ]
+		}
+	]`), 0644))
+
+	cmd := NewCotsCreateCtsCmd()
+	cmd.SetArgs([]string{"--manifest=m/flags.json", "--output=flags.cbor"})
+	require.NoError(t, cmd.Execute())
+
+	data, err := afero.ReadFile(fs, "flags.cbor")
+	require.NoError(t, err)
+
+	var stores cots.ConciseTaStores
+	require.NoError(t, stores.FromCBOR(data))
+	require.Len(t, stores, 1)
+
+	assert.Equal(t, "1.2.3.4", stores[0].Environments[0].Environment.Class.ClassID.String())
+	assert.Equal(t, "firmware", *stores[0].PermClaims[0].SoftwareNameLabel)
+}
@@ -0,0 +1,558 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/corim/cots"
+)
+
+var (
+	cotsUpdateFile                *string
+	cotsUpdateTaDirs              []string
+	cotsUpdateTaFiles             []string
+	cotsUpdateCaDirs              []string
+	cotsUpdateCaFiles             []string
+	cotsUpdateInferFormat         *bool
+	cotsUpdateRemoveTas           []string
+	cotsUpdateRemoveCas           []string
+	cotsUpdatePurposes            []string
+	cotsUpdateRemovePurposes      []string
+	cotsUpdateEnvFile             *string
+	cotsUpdateEnvFlags            ctsEnvFlags
+	cotsUpdateReplaceEnvironments *bool
+	cotsUpdatePermClaimsFile      *string
+	cotsUpdatePermClaims          []string
+	cotsUpdateClearPermClaims     *bool
+	cotsUpdateExclClaimsFile      *string
+	cotsUpdateExclClaims          []string
+	cotsUpdateClearExclClaims     *bool
+	cotsUpdateTagVersion          *uint
+	cotsUpdateInPlace             *bool
+	cotsUpdateOutputFile          *string
+)
+
+var cotsUpdateCmd = NewCotsUpdateCmd()
+
+func NewCotsUpdateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "update the TAs/CAs, purposes, environments or claims of a CBOR-encoded CoTS",
+		Long: `update the TAs/CAs, purposes, environments or claims of a CBOR-encoded CoTS
+
+	Replace the TA with subject "CN=Old Root" of vendor.cbor with the one in
+	new-root.der.  The tag-version of the CoTS is incremented, and the result is
+	saved to vendor-v2.cbor (after the new tag-version); vendor.cbor is left
+	unchanged.
+
+	  cocli cots update --file=vendor.cbor \
+	                    --remove-ta="CN=Old Root" \
+	                    --tafile=new-root.der
+
+	TAs and CAs to remove are selected by file (the TAs/CAs it contains), by
+	SHA-256 fingerprint (as shown by cots display, or a prefix of at least 8
+	hex digits) or by subject (the full subject, its common name or the title
+	of a TrustAnchorInfo).
+
+	  cocli cots update --file=vendor.cbor \
+	                    --remove-ta=3a7bd3e2360a3d29 \
+	                    --remove-ca=old-intermediates.pem \
+	                    --in-place
+
+	Purposes are added with --purpose and removed with --remove-purpose.
+	Environments given with --environment or the environment flags are added
+	to the existing ones, or replace them with --replace-environments.  Claims
+	given with the claims templates or flags are added as a new set of
+	permitted or excluded claims; --clear-permclaims and --clear-exclclaims
+	drop the existing sets first.
+
+	  cocli cots update --file=vendor.cbor \
+	                    --purpose=corim --remove-purpose=eat \
+	                    --replace-environments --vendor="Zesty Hands, Inc." \
+	                    --clear-exclclaims --exclclaim=sub="CN=Revoked" \
+	                    --output=vendor-new.cbor
+	`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkCotsUpdateArgs(); err != nil {
+				return err
+			}
+
+			store, err := loadCots(*cotsUpdateFile)
+			if err != nil {
+				return err
+			}
+
+			if err = updateCts(store, cmd.Flags().Changed("tag-version")); err != nil {
+				return err
+			}
+
+			ctsCBOR, err := store.ToCBOR()
+			if err != nil {
+				return fmt.Errorf("error encoding CoTS to CBOR: %w", err)
+			}
+
+			ctsFile := *cotsUpdateOutputFile
+			if *cotsUpdateInPlace {
+				ctsFile = *cotsUpdateFile
+			} else if ctsFile == "" {
+				ctsFile = updatedCtsFileName(*cotsUpdateFile, store.TagIdentity)
+			}
+
+			if err = afero.WriteFile(fs, ctsFile, ctsCBOR, 0644); err != nil {
+				return fmt.Errorf("error saving CoTS to file %s: %w", ctsFile, err)
+			}
+
+			if *cotsUpdateInPlace {
+				fmt.Printf(">> updated %q\n", ctsFile)
+			} else {
+				fmt.Printf(">> created %q\n", ctsFile)
+			}
+
+			return nil
+		},
+	}
+
+	cotsUpdateFile = cmd.Flags().StringP("file", "f", "", "the CoTS file to update (in CBOR format)")
+
+	cmd.Flags().StringArrayVarP(
+		&cotsUpdateTaDirs, "tas", "t", []string{}, "a directory containing TA files to add",
+	)
+	cmd.Flags().StringArrayVar(
+		&cotsUpdateTaFiles, "tafile", []string{}, "a TA file to add (DER-encoded TA or PEM bundle)",
+	)
+	cmd.Flags().StringArrayVarP(
+		&cotsUpdateCaDirs, "cas", "c", []string{}, "a directory containing CA certificate files to add",
+	)
+	cmd.Flags().StringArrayVar(
+		&cotsUpdateCaFiles, "cafile", []string{}, "a CA certificate file to add (DER-encoded certificate or PEM bundle)",
+	)
+	cotsUpdateInferFormat = cmd.Flags().Bool("infer-format", false, "detect the format of TA files from their content, accepting files with any name")
+
+	cmd.Flags().StringArrayVar(
+		&cotsUpdateRemoveTas, "remove-ta", []string{}, "a TA to remove, by file, fingerprint or subject",
+	)
+	cmd.Flags().StringArrayVar(
+		&cotsUpdateRemoveCas, "remove-ca", []string{}, "a CA certificate to remove, by file, fingerprint or subject",
+	)
+
+	cmd.Flags().StringArrayVarP(
+		&cotsUpdatePurposes, "purpose", "u", []string{}, "a purpose to add: cots,corim,comid,coswid,eat,certificate",
+	)
+	cmd.Flags().StringArrayVar(
+		&cotsUpdateRemovePurposes, "remove-purpose", []string{}, "a purpose to remove",
+	)
+
+	cotsUpdateEnvFile = cmd.Flags().StringP("environment", "e", "", "an environment template file (in JSON format) to add")
+	cmd.Flags().StringVar(&cotsUpdateEnvFlags.Vendor, "vendor", "", "the vendor of an environment to add")
+	cmd.Flags().StringVar(&cotsUpdateEnvFlags.Model, "model", "", "the model of an environment to add")
+	cmd.Flags().StringVar(&cotsUpdateEnvFlags.ClassID, "class-id", "", "the class ID of an environment to add")
+	cmd.Flags().StringVar(&cotsUpdateEnvFlags.ClassIDType, "class-id-type", comid.UUIDType, "the type of the class ID: uuid, oid, psa.impl-id or int")
+	cmd.Flags().StringVar(&cotsUpdateEnvFlags.Instance, "instance", "", "the instance ID (UEID) of an environment to add (hex or base64)")
+	cmd.Flags().StringVar(&cotsUpdateEnvFlags.SwName, "swname", "", "the name of the software created by --vendor")
+	cotsUpdateReplaceEnvironments = cmd.Flags().Bool("replace-environments", false, "replace the environments of the CoTS with the supplied ones")
+
+	cotsUpdatePermClaimsFile = cmd.Flags().StringP("permclaims", "p", "", "a permitted claims template file (in JSON format) to add")
+	cmd.Flags().StringArrayVar(
+		&cotsUpdatePermClaims, "permclaim", []string{}, "a permitted claim, as name=value, added to --permclaims",
+	)
+	cotsUpdateClearPermClaims = cmd.Flags().Bool("clear-permclaims", false, "remove the existing permitted claims")
+
+	cotsUpdateExclClaimsFile = cmd.Flags().StringP("exclclaims", "x", "", "an excluded claims template file (in JSON format) to add")
+	cmd.Flags().StringArrayVar(
+		&cotsUpdateExclClaims, "exclclaim", []string{}, "an excluded claim, as name=value, added to --exclclaims",
+	)
+	cotsUpdateClearExclClaims = cmd.Flags().Bool("clear-exclclaims", false, "remove the existing excluded claims")
+
+	cotsUpdateTagVersion = cmd.Flags().Uint("tag-version", 0, "the new tag-version, greater than the current one (by default, the current one plus one)")
+	cotsUpdateInPlace = cmd.Flags().BoolP("in-place", "i", false, "overwrite the supplied CoTS file")
+	cotsUpdateOutputFile = cmd.Flags().StringP("output", "o", "", "name of the updated CoTS file")
+
+	return cmd
+}
+
+func checkCotsUpdateArgs() error {
+	if *cotsUpdateFile == "" {
+		return errors.New("no CoTS supplied")
+	}
+
+	if *cotsUpdateInPlace && *cotsUpdateOutputFile != "" {
+		return errors.New("--in-place and --output cannot be used together")
+	}
+
+	if *cotsUpdateReplaceEnvironments && *cotsUpdateEnvFile == "" && !cotsUpdateEnvFlags.isSet() {
+		return errors.New("--replace-environments needs an environment template or environment flags")
+	}
+
+	if len(cotsUpdateTaFiles)+len(cotsUpdateTaDirs)+len(cotsUpdateCaFiles)+len(cotsUpdateCaDirs) == 0 &&
+		len(cotsUpdateRemoveTas)+len(cotsUpdateRemoveCas) == 0 &&
+		len(cotsUpdatePurposes)+len(cotsUpdateRemovePurposes) == 0 &&
+		*cotsUpdateEnvFile == "" && !cotsUpdateEnvFlags.isSet() &&
+		*cotsUpdatePermClaimsFile == "" && len(cotsUpdatePermClaims) == 0 && !*cotsUpdateClearPermClaims &&
+		*cotsUpdateExclClaimsFile == "" && len(cotsUpdateExclClaims) == 0 && !*cotsUpdateClearExclClaims {
+		return errors.New("no changes supplied")
+	}
+
+	return nil
+}
+
+// updateCts applies the changes given by the flags to the CoTS, sets its new
+// tag-version and validates the result
+func updateCts(store *cots.ConciseTaStore, setVersion bool) error {
+	if store.Keys == nil {
+		store.Keys = &cots.TasAndCas{}
+	}
+
+	for _, sel := range cotsUpdateRemoveTas {
+		tas, removed, err := removeTas(store.Keys.Tas, sel)
+		if err != nil {
+			return err
+		}
+		for _, label := range removed {
+			fmt.Printf(">> removed TA %s\n", label)
+		}
+		store.Keys.Tas = tas
+	}
+
+	for _, sel := range cotsUpdateRemoveCas {
+		cas, removed, err := removeCas(store.Keys.Cas, sel)
+		if err != nil {
+			return err
+		}
+		for _, label := range removed {
+			fmt.Printf(">> removed CA %s\n", label)
+		}
+		store.Keys.Cas = cas
+	}
+
+	tas, err := loadCtsTas(ctsTaFilesList(cotsUpdateTaFiles, cotsUpdateTaDirs, *cotsUpdateInferFormat), *cotsUpdateInferFormat)
+	if err != nil {
+		return err
+	}
+	store.Keys.Tas = append(store.Keys.Tas, tas...)
+
+	cas, err := loadCtsCas(ctsCaFilesList(cotsUpdateCaFiles, cotsUpdateCaDirs))
+	if err != nil {
+		return err
+	}
+	store.Keys.Cas = append(store.Keys.Cas, cas...)
+
+	if store.Purposes, err = updatePurposes(store.Purposes, cotsUpdatePurposes, cotsUpdateRemovePurposes); err != nil {
+		return err
+	}
+
+	env, err := loadCtsEnvironments(*cotsUpdateEnvFile, cotsUpdateEnvFlags)
+	if err != nil {
+		return err
+	}
+	if *cotsUpdateReplaceEnvironments {
+		store.Environments = env
+	} else {
+		store.Environments = append(store.Environments, env...)
+	}
+
+	if *cotsUpdateClearPermClaims {
+		store.PermClaims = nil
+	}
+	perm, err := loadClaims(*cotsUpdatePermClaimsFile, cotsUpdatePermClaims)
+	if err != nil {
+		return err
+	}
+	if perm != nil {
+		store.AddPermClaims(*perm)
+	}
+
+	if *cotsUpdateClearExclClaims {
+		store.ExclClaims = nil
+	}
+	excl, err := loadClaims(*cotsUpdateExclClaimsFile, cotsUpdateExclClaims)
+	if err != nil {
+		return err
+	}
+	if excl != nil {
+		store.AddExclClaims(*excl)
+	}
+
+	if store.TagIdentity != nil {
+		if setVersion {
+			if *cotsUpdateTagVersion <= store.TagIdentity.TagVersion {
+				return fmt.Errorf(
+					"--tag-version %d is not greater than the current tag-version %d",
+					*cotsUpdateTagVersion, store.TagIdentity.TagVersion,
+				)
+			}
+			store.TagIdentity.TagVersion = *cotsUpdateTagVersion
+		} else {
+			store.TagIdentity.TagVersion++
+		}
+	} else if setVersion {
+		return errors.New("--tag-version cannot be used with a CoTS without tag identity")
+	}
+
+	if conflicts := conflictingClaims(store.PermClaims, store.ExclClaims); len(conflicts) != 0 {
+		return fmt.Errorf("error validating CoTS: %s", strings.Join(conflicts, "; "))
+	}
+
+	if err := store.Valid(); err != nil {
+		return fmt.Errorf("error validating CoTS: %w", err)
+	}
+
+	return nil
+}
+
+// updatedCtsFileName returns the default name of the updated CoTS: that of
+// the original file with the new tag-version, or an -updated suffix if the CoTS
+// has no tag identity
+func updatedCtsFileName(file string, tagIdentity *comid.TagIdentity) string {
+	suffix := "-updated"
+	if tagIdentity != nil {
+		suffix = fmt.Sprintf("-v%d", tagIdentity.TagVersion)
+	}
+
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+
+	return base + suffix + ".cbor"
+}
+
+// updatePurposes adds and removes the supplied purposes, keeping the order of
+// the existing ones
+func updatePurposes(purposes, add, remove []string) ([]string, error) {
+	for _, r := range remove {
+		i := indexOf(purposes, r)
+		if i == -1 {
+			return nil, fmt.Errorf("purpose %q not found in the CoTS", r)
+		}
+		purposes = append(purposes[:i:i], purposes[i+1:]...)
+	}
+
+	for _, a := range add {
+		if indexOf(purposes, a) == -1 {
+			purposes = append(purposes, a)
+		}
+	}
+
+	if len(purposes) == 0 {
+		return nil, nil
+	}
+
+	return purposes, nil
+}
+
+// removeTas removes the TAs selected by sel, a file holding the TAs, a
+// fingerprint or a subject, returning the remaining TAs and the labels of the
+// removed ones
+func removeTas(tas []cots.TrustAnchor, sel string) ([]cots.TrustAnchor, []string, error) {
+	var (
+		kept    []cots.TrustAnchor
+		removed []string
+	)
+
+	match := func(ta cots.TrustAnchor) bool { return taMatches(ta, sel) }
+
+	if _, err := fs.Stat(sel); err == nil {
+		fileTas, err := loadCtsTas([]string{sel}, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		match = func(ta cots.TrustAnchor) bool {
+			for _, f := range fileTas {
+				if bytes.Equal(f.Data, ta.Data) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	for _, ta := range tas {
+		if match(ta) {
+			removed = append(removed, taLabel(ta))
+			continue
+		}
+		kept = append(kept, ta)
+	}
+
+	if len(removed) == 0 {
+		return nil, nil, fmt.Errorf("no TA matches %q", sel)
+	}
+
+	return kept, removed, nil
+}
+
+// removeCas removes the CA certificates selected by sel, as for removeTas
+func removeCas(cas [][]byte, sel string) ([][]byte, []string, error) {
+	var (
+		kept    [][]byte
+		removed []string
+	)
+
+	match := func(ca []byte) bool { return caMatches(ca, sel) }
+
+	if _, err := fs.Stat(sel); err == nil {
+		data, err := afero.ReadFile(fs, sel)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error loading CA from %s: %w", sel, err)
+		}
+		fileCas := [][]byte{data}
+		if isPEM(data) {
+			if fileCas, err = pemBundleCerts(data); err != nil {
+				return nil, nil, fmt.Errorf("error decoding CAs from %s: %w", sel, err)
+			}
+		}
+		match = func(ca []byte) bool {
+			for _, f := range fileCas {
+				if bytes.Equal(f, ca) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	for _, ca := range cas {
+		if match(ca) {
+			label := "certificate " + fingerprint(ca)[:16]
+			if c := decodeCACertificate(ca).Certificate; c != nil {
+				label = "certificate " + c.Subject
+			}
+			removed = append(removed, label)
+			continue
+		}
+		kept = append(kept, ca)
+	}
+
+	if len(removed) == 0 {
+		return nil, nil, fmt.Errorf("no CA matches %q", sel)
+	}
+
+	return kept, removed, nil
+}
+
+// taMatches tells whether the TA has the fingerprint or name sel: that of its
+// certificate, its public key or its TrustAnchorInfo title and name
+func taMatches(ta cots.TrustAnchor, sel string) bool {
+	var (
+		d            = decodeTrustAnchor(ta)
+		fingerprints = []string{fingerprint(ta.Data)}
+	)
+
+	if d.SPKI != nil {
+		fingerprints = append(fingerprints, d.SPKI.Fingerprint)
+	}
+
+	if tai := d.TrustAnchorInfo; tai != nil {
+		if tai.Title != "" && tai.Title == sel {
+			return true
+		}
+		fingerprints = append(fingerprints, tai.PublicKey.Fingerprint)
+	}
+
+	if c := d.certificate(); c != nil {
+		fingerprints = append(fingerprints, c.Fingerprint)
+	}
+
+	return selectorMatches(sel, fingerprints, taNames(ta))
+}
+
+// taNames returns the subject of the certificate of the TA, if any, and the
+// TA name of a TrustAnchorInfo
+func taNames(ta cots.TrustAnchor) []pkix.Name {
+	switch ta.Format {
+	case cots.TaFormatCertificate:
+		if cert, err := x509.ParseCertificate(ta.Data); err == nil {
+			return []pkix.Name{cert.Subject}
+		}
+	case cots.TaFormatTrustAnchorInfo:
+		if tai, err := parseTrustAnchorInfo(ta.Data); err == nil && tai.CertPath != nil {
+			names := []pkix.Name{tai.CertPath.TaName}
+			if cert := tai.CertPath.Certificate; cert != nil {
+				names = append(names, cert.Subject)
+			}
+			return names
+		}
+	}
+
+	return nil
+}
+
+// caMatches tells whether the CA certificate has the fingerprint or name sel
+func caMatches(ca []byte, sel string) bool {
+	var names []pkix.Name
+
+	if cert, err := x509.ParseCertificate(ca); err == nil {
+		names = append(names, cert.Subject)
+	}
+
+	return selectorMatches(sel, []string{fingerprint(ca)}, names)
+}
+
+// selectorMatches tells whether sel is a prefix, of at least 8 hex digits, of
+// one of the fingerprints, or designates one of the names: either the whole
+// distinguished name (e.g., "CN=ACME Root,O=ACME") or its common name, with or
+// without "CN=" and RFC 4514 escaping (e.g., "Zesty Hands\, Inc. Root")
+func selectorMatches(sel string, fingerprints []string, names []pkix.Name) bool {
+	fp := strings.ToLower(strings.ReplaceAll(sel, ":", ""))
+
+	if len(fp) >= 8 && strings.Trim(fp, "0123456789abcdef") == "" {
+		for _, f := range fingerprints {
+			if strings.HasPrefix(f, fp) {
+				return true
+			}
+		}
+	}
+
+	cn := unescapeDNValue(strings.TrimPrefix(sel, "CN="))
+
+	for _, n := range names {
+		if n.String() == sel {
+			return true
+		}
+		if n.CommonName != "" && (n.CommonName == sel || n.CommonName == cn) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unescapeDNValue removes the RFC 4514 escaping (e.g., "\," or "\2C") from
+// an attribute value of a distinguished name
+func unescapeDNValue(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		if i+3 <= len(s) {
+			if h, err := hex.DecodeString(s[i+1 : i+3]); err == nil {
+				b.Write(h)
+				i += 2
+				continue
+			}
+		}
+
+		b.WriteByte(s[i+1])
+		i++
+	}
+
+	return b.String()
+}
+
+func init() {
+	cotsCmd.AddCommand(cotsUpdateCmd)
+}
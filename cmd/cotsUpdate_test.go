@@ -0,0 +1,208 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/x509/pkix"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/cots"
+)
+
+// testUpdateFiles writes a CoTS with tag identity "acme" version 1, holding
+// the root of the chain as TA and its intermediate as CA, to s.cbor, and the
+// root of another chain to new-root.der
+func testUpdateFiles(t *testing.T) (testChain, testChain) {
+	c, n := newTestChain(t), newTestChain(t)
+
+	store := testStore(cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: c.root.Raw})
+	store.Keys.Cas = [][]byte{c.ica.Raw}
+	store.Purposes = []string{"eat"}
+	version := uint(1)
+	store.SetTagIdentity("acme", &version)
+
+	data, err := store.ToCBOR()
+	require.NoError(t, err)
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "s.cbor", data, 0644))
+	require.NoError(t, afero.WriteFile(fs, "new-root.der", n.root.Raw, 0644))
+	require.NoError(t, afero.WriteFile(fs, "ica.der", c.ica.Raw, 0644))
+
+	return c, n
+}
+
+func Test_CotsUpdateCmd_bad_args(t *testing.T) {
+	for expected, args := range map[string][]string{
+		"no CoTS supplied":    {"--tafile=new-root.der"},
+		"no changes supplied": {"--file=s.cbor"},
+		"--in-place and --output cannot be used together":                           {"--file=s.cbor", "--in-place", "--output=x.cbor", "--purpose=eat"},
+		"--replace-environments needs an environment template or environment flags": {"--file=s.cbor", "--replace-environments"},
+	} {
+		cmd := NewCotsUpdateCmd()
+		cmd.SetArgs(args)
+
+		err := cmd.Execute()
+		assert.EqualError(t, err, expected)
+	}
+}
+
+func Test_CotsUpdateCmd_rotate_ta(t *testing.T) {
+	c, n := testUpdateFiles(t)
+
+	original, err := afero.ReadFile(fs, "s.cbor")
+	require.NoError(t, err)
+
+	cmd := NewCotsUpdateCmd()
+	cmd.SetArgs([]string{
+		"--file=s.cbor",
+		"--remove-ta=Test Root",
+		"--tafile=new-root.der",
+		"--remove-ca=ica.der",
+		"--purpose=corim",
+		"--remove-purpose=eat",
+	})
+	require.NoError(t, cmd.Execute())
+
+	// the original is left unchanged
+	data, err := afero.ReadFile(fs, "s.cbor")
+	require.NoError(t, err)
+	assert.Equal(t, original, data)
+
+	store, err := loadCots("s-v2.cbor")
+	require.NoError(t, err)
+
+	assert.Equal(t, uint(2), store.TagIdentity.TagVersion)
+	assert.Equal(t, "acme", store.TagIdentity.TagID.String())
+	assert.Equal(t, []cots.TrustAnchor{{Format: cots.TaFormatCertificate, Data: n.root.Raw}}, store.Keys.Tas)
+	assert.Empty(t, store.Keys.Cas)
+	assert.Equal(t, []string{"corim"}, store.Purposes)
+	assert.Equal(t, "ACME", *store.Environments[0].Environment.Class.Vendor)
+
+	// by fingerprint, in place and with an explicit tag-version
+	cmd = NewCotsUpdateCmd()
+	cmd.SetArgs([]string{
+		"--file=s.cbor",
+		"--remove-ta=" + fingerprint(c.root.Raw)[:12],
+		"--tafile=new-root.der",
+		"--tag-version=7",
+		"--in-place",
+	})
+	require.NoError(t, cmd.Execute())
+
+	store, err = loadCots("s.cbor")
+	require.NoError(t, err)
+	assert.Equal(t, uint(7), store.TagIdentity.TagVersion)
+	assert.Equal(t, []cots.TrustAnchor{{Format: cots.TaFormatCertificate, Data: n.root.Raw}}, store.Keys.Tas)
+	assert.Equal(t, [][]byte{c.ica.Raw}, store.Keys.Cas)
+}
+
+func Test_CotsUpdateCmd_environments_and_claims(t *testing.T) {
+	testUpdateFiles(t)
+
+	cmd := NewCotsUpdateCmd()
+	cmd.SetArgs([]string{
+		"--file=s.cbor",
+		"--replace-environments",
+		"--vendor=Zesty Hands, Inc.",
+		"--permclaim=swname=firmware",
+		"--output=out.cbor",
+	})
+	require.NoError(t, cmd.Execute())
+
+	store, err := loadCots("out.cbor")
+	require.NoError(t, err)
+	require.Len(t, store.Environments, 1)
+	assert.Equal(t, "Zesty Hands, Inc.", *store.Environments[0].Environment.Class.Vendor)
+	assert.Equal(t, "firmware", *store.PermClaims[0].SoftwareNameLabel)
+
+	cmd = NewCotsUpdateCmd()
+	cmd.SetArgs([]string{"--file=out.cbor", "--exclclaim=swname=firmware", "--output=bad.cbor"})
+
+	err = cmd.Execute()
+	assert.EqualError(t, err,
+		`error validating CoTS: claim "swname" is both permitted (permclaims[0]) and excluded (exclclaims[0]) with value "firmware"`,
+	)
+
+	// replacing the permitted claims resolves the conflict
+	cmd = NewCotsUpdateCmd()
+	cmd.SetArgs([]string{"--file=out.cbor", "--clear-permclaims", "--exclclaim=swname=firmware", "--output=ok.cbor"})
+	require.NoError(t, cmd.Execute())
+
+	store, err = loadCots("ok.cbor")
+	require.NoError(t, err)
+	assert.Empty(t, store.PermClaims)
+	assert.Equal(t, "firmware", *store.ExclClaims[0].SoftwareNameLabel)
+}
+
+func Test_CotsUpdateCmd_failures(t *testing.T) {
+	testUpdateFiles(t)
+
+	for expected, args := range map[string][]string{
+		`no TA matches "CN=Unknown"`:                                                   {"--remove-ta=CN=Unknown"},
+		`no CA matches "new-root.der"`:                                                 {"--remove-ca=new-root.der"},
+		`purpose "corim" not found in the CoTS`:                                        {"--remove-purpose=corim"},
+		"error validating CoTS: empty Keys":                                            {"--remove-ta=CN=Test Root"},
+		"--tag-version 1 is not greater than the current tag-version 1":                {"--purpose=corim", "--tag-version=1"},
+		"--tag-version 0 is not greater than the current tag-version 1":                {"--purpose=corim", "--tag-version=0"},
+		"error loading CoTS from unknown.cbor: open unknown.cbor: file does not exist": {"--file=unknown.cbor", "--purpose=eat"},
+	} {
+		cmd := NewCotsUpdateCmd()
+		cmd.SetArgs(append([]string{"--file=s.cbor", "--output=x.cbor"}, args...))
+
+		err := cmd.Execute()
+		assert.EqualError(t, err, expected, args)
+	}
+
+	exists, err := afero.Exists(fs, "x.cbor")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func Test_selectorMatches(t *testing.T) {
+	fps := []string{"405bbc1399c1a67404aa9de32f217d8f8ac0e6685cb050d2c42d8850163a36e1"}
+	names := []pkix.Name{{
+		CommonName:   "Example, Inc. Trust Anchor",
+		Organization: []string{"Example, Inc."},
+		Country:      []string{"US"},
+	}}
+
+	for sel, expected := range map[string]bool{
+		"405bbc13":       true,
+		"40:5B:BC:13:99": true,
+		"405bbc1":        false,
+		`CN=Example\, Inc. Trust Anchor,O=Example\, Inc.,C=US`: true,
+		"Example, Inc. Trust Anchor":                           true,
+		`Example\, Inc. Trust Anchor`:                          true,
+		`CN=Example\, Inc. Trust Anchor`:                       true,
+		`CN=Example\2C Inc. Trust Anchor`:                      true,
+		"Example":                                              false,
+		"Example, Inc.":                                        false,
+		`O=Example\, Inc.`:                                     false,
+	} {
+		assert.Equal(t, expected, selectorMatches(sel, fps, names), sel)
+	}
+}
+
+func Test_taMatches_trust_anchor_info(t *testing.T) {
+	data, err := os.ReadFile("../data/cots/Zesty Hands_ta.ta")
+	require.NoError(t, err)
+
+	ta := cots.TrustAnchor{Format: cots.TaFormatTrustAnchorInfo, Data: data}
+
+	for _, sel := range []string{
+		"Zesty Hands, Inc. Trust Anchor",
+		`Zesty Hands\, Inc. Trust Anchor`,
+		`CN=Zesty Hands\, Inc. Trust Anchor`,
+		`CN=Zesty Hands\, Inc. Trust Anchor,O=Zesty Hands\, Inc.,C=US`,
+	} {
+		assert.True(t, taMatches(ta, sel), sel)
+	}
+
+	assert.False(t, taMatches(ta, "Zesty Hands"))
+}
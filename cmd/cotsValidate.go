@@ -0,0 +1,159 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	cbor "github.com/fxamacker/cbor/v2"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/cots"
+)
+
+var (
+	cotsValidateFiles []string
+	cotsValidateDirs  []string
+)
+
+var cotsValidateCmd = NewCotsValidateCmd()
+
+func NewCotsValidateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "validate one or more CBOR-encoded CoTS(s)",
+		Long: `validate one or more CBOR-encoded CoTS(s)
+
+	Validate the CoTS, or the list of CoTSs, in file c.cbor.  Besides the
+	structure of the CoTS, the permitted and excluded claims are checked: a
+	claim that is both permitted and excluded with the same value makes the
+	CoTS invalid, and unknown claim keys, which are ignored when the CoTS is
+	used, are reported as warnings.
+
+	  cocli cots validate --file=c.cbor
+
+	Validate CoTSs in files c1.cbor, c2.cbor and any cbor file in the cots/
+	directory.
+
+	  cocli cots validate --file=c1.cbor --file=c2.cbor --dir=cots
+	`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkCotsValidateArgs(); err != nil {
+				return err
+			}
+
+			filesList := filesList(cotsValidateFiles, cotsValidateDirs, ".cbor")
+			if len(filesList) == 0 {
+				return errors.New("no files found")
+			}
+
+			errs := 0
+			for _, file := range filesList {
+				warnings, err := validateCots(file)
+				for _, w := range warnings {
+					fmt.Printf(">> WARNING: %s: %s\n", file, w)
+				}
+				if err != nil {
+					fmt.Printf("[invalid] %q: %v\n", file, err)
+					errs++
+					continue
+				}
+				fmt.Printf("[valid] %q\n", file)
+			}
+
+			if errs != 0 {
+				return fmt.Errorf("%d/%d validation(s) failed", errs, len(filesList))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(
+		&cotsValidateFiles, "file", "f", []string{}, "a CoTS file (in CBOR format)",
+	)
+
+	cmd.Flags().StringArrayVarP(
+		&cotsValidateDirs, "dir", "d", []string{}, "a directory containing CoTS files (in CBOR format)",
+	)
+
+	return cmd
+}
+
+// validateCots validates the CoTS, or list of CoTSs, in file, returning the
+// warnings about unknown claim keys
+func validateCots(file string) ([]string, error) {
+	data, err := afero.ReadFile(fs, file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading CoTS from %s: %w", file, err)
+	}
+
+	if !isCBORArray(data) {
+		return validateCotsCBOR(data, "")
+	}
+
+	var (
+		raws     []cbor.RawMessage
+		warnings []string
+	)
+
+	if err = cbor.Unmarshal(data, &raws); err != nil {
+		return nil, fmt.Errorf("error decoding CoTSs from %s: %w", file, err)
+	}
+
+	if len(raws) == 0 {
+		return nil, fmt.Errorf("error validating CoTSs %s: no CoTS in the list", file)
+	}
+
+	for i, raw := range raws {
+		w, err := validateCotsCBOR(raw, fmt.Sprintf("stores[%d]: ", i))
+		warnings = append(warnings, w...)
+		if err != nil {
+			return warnings, fmt.Errorf("stores[%d]: %w", i, err)
+		}
+	}
+
+	return warnings, nil
+}
+
+// validateCotsCBOR validates a single CBOR-encoded CoTS, prefixing its
+// warnings with prefix
+func validateCotsCBOR(data []byte, prefix string) ([]string, error) {
+	var (
+		cts      cots.ConciseTaStore
+		warnings []string
+	)
+
+	for _, w := range checkClaimsCBOR(data) {
+		warnings = append(warnings, prefix+w)
+	}
+
+	if err := cts.FromCBOR(data); err != nil {
+		return warnings, fmt.Errorf("error decoding CoTS: %w", err)
+	}
+
+	if err := cts.Valid(); err != nil {
+		return warnings, fmt.Errorf("error validating CoTS: %w", err)
+	}
+
+	if conflicts := conflictingClaims(cts.PermClaims, cts.ExclClaims); len(conflicts) != 0 {
+		return warnings, fmt.Errorf("error validating CoTS: %s", strings.Join(conflicts, "; "))
+	}
+
+	return warnings, nil
+}
+
+func checkCotsValidateArgs() error {
+	if len(cotsValidateFiles) == 0 && len(cotsValidateDirs) == 0 {
+		return errors.New("no files supplied")
+	}
+
+	return nil
+}
+
+func init() {
+	cotsCmd.AddCommand(cotsValidateCmd)
+}
@@ -0,0 +1,112 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"testing"
+
+	cbor "github.com/fxamacker/cbor/v2"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/cots"
+)
+
+// testCotsWithClaims returns the CBOR encoding of a CoTS with the given
+// permitted and excluded claims, which may use unknown keys
+func testCotsWithClaims(t *testing.T, perm, excl map[int]interface{}) []byte {
+	c := newTestChain(t)
+
+	data, err := testStore(cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: c.root.Raw}).ToCBOR()
+	require.NoError(t, err)
+
+	var m map[int]cbor.RawMessage
+	require.NoError(t, cbor.Unmarshal(data, &m))
+
+	for key, claims := range map[int]map[int]interface{}{4: perm, 5: excl} {
+		if claims != nil {
+			m[key], err = cbor.Marshal([]map[int]interface{}{claims})
+			require.NoError(t, err)
+		}
+	}
+
+	data, err = cbor.Marshal(m)
+	require.NoError(t, err)
+
+	return data
+}
+
+func Test_CotsValidateCmd_no_files(t *testing.T) {
+	cmd := NewCotsValidateCmd()
+	cmd.SetArgs([]string{})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no files supplied")
+}
+
+func Test_CotsValidateCmd_no_files_found(t *testing.T) {
+	cmd := NewCotsValidateCmd()
+	cmd.SetArgs([]string{"--file=unknown", "--dir=unsure"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no files found")
+}
+
+func Test_CotsValidateCmd_ok(t *testing.T) {
+	fs = afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "c.cbor", testCotsWithClaims(t, map[int]interface{}{998: "firmware"}, nil), 0644))
+
+	cmd := NewCotsValidateCmd()
+	cmd.SetArgs([]string{"--file=c.cbor"})
+	assert.NoError(t, cmd.Execute())
+}
+
+func Test_CotsValidateCmd_invalid(t *testing.T) {
+	fs = afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "invalid.cbor", []byte{0xff, 0xff}, 0644))
+	require.NoError(t, afero.WriteFile(fs, "conflict.cbor", testCotsWithClaims(t,
+		map[int]interface{}{2: "CN=Revoked"},
+		map[int]interface{}{2: "CN=Revoked"},
+	), 0644))
+
+	cmd := NewCotsValidateCmd()
+	cmd.SetArgs([]string{"--file=invalid.cbor", "--file=conflict.cbor"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "2/2 validation(s) failed")
+
+	_, err = validateCots("conflict.cbor")
+	assert.EqualError(t, err,
+		`error validating CoTS: claim "sub" is both permitted (permclaims[0]) and excluded (exclclaims[0]) with value "CN=Revoked"`,
+	)
+}
+
+func Test_validateCots_unknown_claim_keys(t *testing.T) {
+	fs = afero.NewMemMapFs()
+
+	data := testCotsWithClaims(t,
+		map[int]interface{}{998: "firmware", 500: "x"},
+		map[int]interface{}{-70000: 1},
+	)
+	require.NoError(t, afero.WriteFile(fs, "c.cbor", data, 0644))
+
+	warnings, err := validateCots("c.cbor")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"permclaims[0]: unknown claim key 500",
+		"exclclaims[0]: unknown claim key -70000",
+	}, warnings)
+
+	// in a list
+	list, err := cbor.Marshal([]cbor.RawMessage{data, data})
+	require.NoError(t, err)
+	require.NoError(t, afero.WriteFile(fs, "l.cbor", list, 0644))
+
+	warnings, err = validateCots("l.cbor")
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 4)
+	assert.Equal(t, "stores[1]: permclaims[0]: unknown claim key 500", warnings[2])
+}
@@ -0,0 +1,148 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/afero"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/corim/corim"
+	"github.com/veraison/corim/cots"
+	"github.com/veraison/swid"
+)
+
+// endorsement is one of the objects found in an endorsement file: a CoRIM, or
+// a CoMID, CoTS or CoSWID, either stand-alone or embedded in a CoRIM.  Exactly
+// one of the object fields is set.  Loc identifies embedded tags within the
+// enclosing CoRIM (e.g., "tags[2]") and is empty for top-level objects.
+type endorsement struct {
+	File string
+	Loc  string
+	// Data is the CBOR encoding of the object (for CoRIMs, the whole file)
+	Data []byte
+
+	Corim  *corim.UnsignedCorim
+	Meta   *corim.Meta
+	Comid  *comid.Comid
+	Cots   *cots.ConciseTaStore
+	Coswid *swid.SoftwareIdentity
+}
+
+// Kind returns a short name for the type of the endorsement object
+func (o endorsement) Kind() string {
+	switch {
+	case o.Corim != nil:
+		return "CoRIM"
+	case o.Comid != nil:
+		return "CoMID"
+	case o.Cots != nil:
+		return "CoTS"
+	case o.Coswid != nil:
+		return "CoSWID"
+	}
+	return "unknown"
+}
+
+// Where returns a human readable location for the endorsement object
+func (o endorsement) Where() string {
+	if o.Loc == "" {
+		return o.File
+	}
+	return o.File + ":" + o.Loc
+}
+
+// loadEndorsements reads the supplied file and detects whether it contains a
+// (signed or unsigned) CoRIM, a CoMID, a CoTS or a CoSWID.  For CoRIMs, the
+// CoRIM itself is returned first, followed by each of its embedded tags.
+// Embedded tags that cannot be decoded are reported via the returned error
+// slice, and do not prevent the others from being returned.
+func loadEndorsements(file string) ([]endorsement, []error, error) {
+	data, err := afero.ReadFile(fs, file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading %s: %w", file, err)
+	}
+
+	if u, meta, err := loadCorim(data); err == nil {
+		ret := []endorsement{{File: file, Data: data, Corim: u, Meta: meta}}
+		var errs []error
+
+		for i, t := range u.Tags {
+			e, err := decodeCorimTag(t)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s:tags[%d]: %w", file, i, err))
+				continue
+			}
+			e.File = file
+			e.Loc = fmt.Sprintf("tags[%d]", i)
+			ret = append(ret, *e)
+		}
+
+		return ret, errs, nil
+	}
+
+	e, err := decodeEndorsement(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", file, err)
+	}
+	e.File = file
+
+	return []endorsement{*e}, nil, nil
+}
+
+// decodeCorimTag decodes a tag embedded in a CoRIM, based on its CBOR tag
+func decodeCorimTag(t corim.Tag) (*endorsement, error) {
+	// need at least 3 bytes for the tag and 1 for the smallest bstr
+	if len(t) < 3+1 {
+		return nil, errors.New("malformed tag")
+	}
+
+	cborTag, cborData := t[:3], t[3:]
+
+	switch {
+	case bytes.Equal(cborTag, corim.ComidTag):
+		var c comid.Comid
+		if err := c.FromCBOR(cborData); err != nil {
+			return nil, fmt.Errorf("error decoding CoMID: %w", err)
+		}
+		return &endorsement{Data: cborData, Comid: &c}, nil
+	case bytes.Equal(cborTag, corim.CoswidTag):
+		var s swid.SoftwareIdentity
+		if err := s.FromCBOR(cborData); err != nil {
+			return nil, fmt.Errorf("error decoding CoSWID: %w", err)
+		}
+		return &endorsement{Data: cborData, Coswid: &s}, nil
+	case bytes.Equal(cborTag, cots.CotsTag):
+		var c cots.ConciseTaStore
+		if err := c.FromCBOR(cborData); err != nil {
+			return nil, fmt.Errorf("error decoding CoTS: %w", err)
+		}
+		return &endorsement{Data: cborData, Cots: &c}, nil
+	}
+
+	return nil, fmt.Errorf("unmatched CBOR tag: %x", cborTag)
+}
+
+// decodeEndorsement tries to decode the supplied (untagged) CBOR as a CoMID,
+// a CoTS or a CoSWID, in this order.
+func decodeEndorsement(data []byte) (*endorsement, error) {
+	var c comid.Comid
+	if err := c.FromCBOR(data); err == nil && c.Valid() == nil {
+		return &endorsement{Data: data, Comid: &c}, nil
+	}
+
+	var t cots.ConciseTaStore
+	if err := t.FromCBOR(data); err == nil && t.Valid() == nil {
+		return &endorsement{Data: data, Cots: &t}, nil
+	}
+
+	var s swid.SoftwareIdentity
+	if err := s.FromCBOR(data); err == nil && s.SoftwareName != "" {
+		return &endorsement{Data: data, Coswid: &s}, nil
+	}
+
+	return nil, errors.New("not a valid CoRIM, CoMID, CoTS or CoSWID")
+}
@@ -0,0 +1,311 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha256" // register the hash functions used to replay the log
+	_ "crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/veraison/swid"
+)
+
+// TCG PC Client event types
+const (
+	evNoAction      = 0x00000003
+	tcgSpecIDSig    = "Spec ID Event03\x00"
+	startupLocality = "StartupLocality\x00"
+)
+
+var eventTypeNames = map[uint32]string{
+	0x00000000: "EV_PREBOOT_CERT",
+	0x00000001: "EV_POST_CODE",
+	0x00000002: "EV_UNUSED",
+	0x00000003: "EV_NO_ACTION",
+	0x00000004: "EV_SEPARATOR",
+	0x00000005: "EV_ACTION",
+	0x00000006: "EV_EVENT_TAG",
+	0x00000007: "EV_S_CRTM_CONTENTS",
+	0x00000008: "EV_S_CRTM_VERSION",
+	0x00000009: "EV_CPU_MICROCODE",
+	0x0000000a: "EV_PLATFORM_CONFIG_FLAGS",
+	0x0000000b: "EV_TABLE_OF_DEVICES",
+	0x0000000c: "EV_COMPACT_HASH",
+	0x0000000d: "EV_IPL",
+	0x0000000e: "EV_IPL_PARTITION_DATA",
+	0x0000000f: "EV_NONHOST_CODE",
+	0x00000010: "EV_NONHOST_CONFIG",
+	0x00000011: "EV_NONHOST_INFO",
+	0x00000012: "EV_OMIT_BOOT_DEVICE_EVENTS",
+	0x80000001: "EV_EFI_VARIABLE_DRIVER_CONFIG",
+	0x80000002: "EV_EFI_VARIABLE_BOOT",
+	0x80000003: "EV_EFI_BOOT_SERVICES_APPLICATION",
+	0x80000004: "EV_EFI_BOOT_SERVICES_DRIVER",
+	0x80000005: "EV_EFI_RUNTIME_SERVICES_DRIVER",
+	0x80000006: "EV_EFI_GPT_EVENT",
+	0x80000007: "EV_EFI_ACTION",
+	0x80000008: "EV_EFI_PLATFORM_FIRMWARE_BLOB",
+	0x80000009: "EV_EFI_HANDOFF_TABLES",
+	0x8000000a: "EV_EFI_PLATFORM_FIRMWARE_BLOB2",
+	0x8000000b: "EV_EFI_HANDOFF_TABLES2",
+	0x8000000c: "EV_EFI_VARIABLE_BOOT2",
+	0x80000010: "EV_EFI_HCRTM_EVENT",
+	0x800000e0: "EV_EFI_VARIABLE_AUTHORITY",
+	0x800000e1: "EV_EFI_SPDM_FIRMWARE_BLOB",
+	0x800000e2: "EV_EFI_SPDM_FIRMWARE_CONFIG",
+}
+
+// tpmHashAlgs maps the TPM algorithm IDs of the PCR banks that can be
+// replayed onto the corresponding hash function and named information hash
+// algorithm ID
+var tpmHashAlgs = map[uint16]struct {
+	hash  crypto.Hash
+	algID uint64
+}{
+	0x000b: {crypto.SHA256, swid.Sha256},
+	0x000c: {crypto.SHA384, swid.Sha384},
+	0x000d: {crypto.SHA512, swid.Sha512},
+}
+
+// parseEventType parses an event type given by name (with or without the
+// "EV_" prefix, in any case) or by number
+func parseEventType(s string) (uint32, error) {
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "EV_") {
+		name = "EV_" + name
+	}
+
+	for t, n := range eventTypeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+
+	if t, err := strconv.ParseUint(s, 0, 32); err == nil {
+		return uint32(t), nil
+	}
+
+	return 0, fmt.Errorf("unknown event type %q", s)
+}
+
+type tpmEvent struct {
+	PCR     uint32
+	Type    uint32
+	Digests map[uint16][]byte
+	Data    []byte
+}
+
+// eventLog is a parsed crypto-agile TCG PC Client event log
+type eventLog struct {
+	// digest sizes of the PCR banks, by TPM algorithm ID
+	Banks  map[uint16]uint16
+	Events []tpmEvent
+	// initial value of PCR[0], set by the StartupLocality event
+	Locality byte
+}
+
+type eventLogReader struct {
+	*bytes.Reader
+}
+
+func (r eventLogReader) read(n int) ([]byte, error) {
+	if n > r.Len() {
+		return nil, fmt.Errorf("truncated at offset %d (want %d more bytes)", int(r.Size())-r.Len(), n)
+	}
+	b := make([]byte, n)
+	_, _ = r.Read(b)
+	return b, nil
+}
+
+func (r eventLogReader) uint32() (uint32, error) {
+	b, err := r.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (r eventLogReader) uint16() (uint16, error) {
+	b, err := r.read(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(b), nil
+}
+
+// parseEventLog parses a binary crypto-agile event log, whose first event is
+// a SHA-1 format TCG_PCR_EVENT carrying the TCG_EfiSpecIDEvent that lists the
+// PCR banks, followed by TCG_PCR_EVENT2 events
+func parseEventLog(data []byte) (*eventLog, error) {
+	r := eventLogReader{bytes.NewReader(data)}
+
+	// TCG_PCR_EVENT: pcrIndex, eventType, digest[20], eventSize, event
+	hdr, err := r.read(32)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding Spec ID event: %w", err)
+	}
+
+	if binary.LittleEndian.Uint32(hdr[4:8]) != evNoAction {
+		return nil, errors.New("not a crypto-agile event log (first event is not EV_NO_ACTION)")
+	}
+
+	specID, err := r.read(int(binary.LittleEndian.Uint32(hdr[28:32])))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding Spec ID event: %w", err)
+	}
+
+	banks, err := parseSpecIDEvent(specID)
+	if err != nil {
+		return nil, err
+	}
+
+	log := eventLog{Banks: banks}
+
+	for i := 1; r.Len() > 0; i++ {
+		ev, err := parseEvent2(r, banks)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding event %d: %w", i, err)
+		}
+
+		if ev.Type == evNoAction && ev.PCR == 0 &&
+			len(ev.Data) > len(startupLocality) && string(ev.Data[:len(startupLocality)]) == startupLocality {
+			log.Locality = ev.Data[len(startupLocality)]
+		}
+
+		log.Events = append(log.Events, *ev)
+	}
+
+	return &log, nil
+}
+
+func parseSpecIDEvent(data []byte) (map[uint16]uint16, error) {
+	// signature[16], platformClass, versions and errata[3], uintnSize,
+	// numberOfAlgorithms
+	if len(data) < 28 || string(data[:16]) != tcgSpecIDSig {
+		return nil, errors.New("not a crypto-agile event log (no Spec ID Event03 signature)")
+	}
+
+	n := int(binary.LittleEndian.Uint32(data[24:28]))
+	if len(data) < 28+4*n {
+		return nil, errors.New("error decoding Spec ID event: truncated algorithms list")
+	}
+
+	banks := map[uint16]uint16{}
+	for i := 0; i < n; i++ {
+		a := data[28+4*i:]
+		banks[binary.LittleEndian.Uint16(a)] = binary.LittleEndian.Uint16(a[2:])
+	}
+
+	return banks, nil
+}
+
+// parseEvent2 parses a TCG_PCR_EVENT2: pcrIndex, eventType, digests (count,
+// then algorithm ID and digest for each), eventSize, event
+func parseEvent2(r eventLogReader, banks map[uint16]uint16) (*tpmEvent, error) {
+	var (
+		ev  tpmEvent
+		err error
+	)
+
+	if ev.PCR, err = r.uint32(); err != nil {
+		return nil, err
+	}
+
+	if ev.Type, err = r.uint32(); err != nil {
+		return nil, err
+	}
+
+	count, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+
+	ev.Digests = map[uint16][]byte{}
+	for i := uint32(0); i < count; i++ {
+		alg, err := r.uint16()
+		if err != nil {
+			return nil, err
+		}
+
+		size, ok := banks[alg]
+		if !ok {
+			return nil, fmt.Errorf("digest with algorithm 0x%04x not in the Spec ID event", alg)
+		}
+
+		if ev.Digests[alg], err = r.read(int(size)); err != nil {
+			return nil, err
+		}
+	}
+
+	size, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+
+	if ev.Data, err = r.read(int(size)); err != nil {
+		return nil, err
+	}
+
+	return &ev, nil
+}
+
+// replay returns the final values of the PCRs extended by the event log, for
+// each of the supported banks
+func (o eventLog) replay() map[uint32]map[uint16][]byte {
+	pcrs := map[uint32]map[uint16][]byte{}
+
+	for _, ev := range o.Events {
+		if ev.Type == evNoAction {
+			continue
+		}
+
+		if pcrs[ev.PCR] == nil {
+			pcrs[ev.PCR] = map[uint16][]byte{}
+		}
+
+		for alg, digest := range ev.Digests {
+			a, ok := tpmHashAlgs[alg]
+			if !ok {
+				continue
+			}
+
+			pcr, ok := pcrs[ev.PCR][alg]
+			if !ok {
+				pcr = make([]byte, a.hash.Size())
+				if ev.PCR == 0 {
+					pcr[len(pcr)-1] = o.Locality
+				}
+			}
+
+			h := a.hash.New()
+			h.Write(pcr)
+			h.Write(digest)
+			pcrs[ev.PCR][alg] = h.Sum(nil)
+		}
+	}
+
+	return pcrs
+}
+
+// sortedBanks returns the TPM algorithm IDs of the supported banks in the
+// supplied map, in ascending order
+func sortedBanks[T any](m map[uint16]T) []uint16 {
+	var algs []uint16
+	for alg := range m {
+		if _, ok := tpmHashAlgs[alg]; ok {
+			algs = append(algs, alg)
+		}
+	}
+
+	sort.Slice(algs, func(i, j int) bool { return algs[i] < algs[j] })
+
+	return algs
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/sha1" // nolint: gosec
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testEvent struct {
+	pcr  uint32
+	typ  uint32
+	data []byte
+}
+
+// testEventLog returns a crypto-agile event log with SHA-1 and SHA-256 banks
+// and the supplied events, whose digests are those of their data
+func testEventLog(events ...testEvent) []byte {
+	le := binary.LittleEndian
+
+	specID := []byte(tcgSpecIDSig)
+	specID = le.AppendUint32(specID, 0)         // platformClass
+	specID = append(specID, 0, 2, 0, 2)         // versions, errata, uintnSize
+	specID = le.AppendUint32(specID, 2)         // numberOfAlgorithms
+	specID = le.AppendUint16(specID, 0x0004)    // SHA-1
+	specID = le.AppendUint16(specID, sha1.Size) // nolint: gosec
+	specID = le.AppendUint16(specID, 0x000b)    // SHA-256
+	specID = le.AppendUint16(specID, sha256.Size)
+	specID = append(specID, 0) // vendorInfoSize
+
+	log := le.AppendUint32(nil, 0)
+	log = le.AppendUint32(log, evNoAction)
+	log = append(log, make([]byte, 20)...)
+	log = le.AppendUint32(log, uint32(len(specID)))
+	log = append(log, specID...)
+
+	for _, ev := range events {
+		s1 := sha1.Sum(ev.data) // nolint: gosec
+		s256 := sha256.Sum256(ev.data)
+
+		log = le.AppendUint32(log, ev.pcr)
+		log = le.AppendUint32(log, ev.typ)
+		log = le.AppendUint32(log, 2)
+		log = le.AppendUint16(log, 0x0004)
+		log = append(log, s1[:]...)
+		log = le.AppendUint16(log, 0x000b)
+		log = append(log, s256[:]...)
+		log = le.AppendUint32(log, uint32(len(ev.data)))
+		log = append(log, ev.data...)
+	}
+
+	return log
+}
+
+// testExtend returns the SHA-256 PCR value after extending pcr with the digest
+// of each supplied data
+func testExtend(pcr []byte, data ...[]byte) []byte {
+	for _, d := range data {
+		digest := sha256.Sum256(d)
+		v := sha256.Sum256(append(append([]byte{}, pcr...), digest[:]...))
+		pcr = v[:]
+	}
+	return pcr
+}
+
+func Test_parseEventLog_and_replay(t *testing.T) {
+	locality := append([]byte(startupLocality), 3)
+
+	log, err := parseEventLog(testEventLog(
+		testEvent{0, evNoAction, locality},
+		testEvent{0, 0x00000008, []byte("CRTM version")},
+		testEvent{4, 0x80000003, []byte("bootloader")},
+		testEvent{0, 0x00000004, []byte{0, 0, 0, 0}},
+	))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[uint16]uint16{0x0004: 20, 0x000b: 32}, log.Banks)
+	assert.Len(t, log.Events, 4)
+	assert.Equal(t, byte(3), log.Locality)
+
+	pcrs := log.replay()
+	require.Len(t, pcrs, 2)
+
+	pcr0 := make([]byte, 32)
+	pcr0[31] = 3
+	assert.Equal(t, testExtend(pcr0, []byte("CRTM version"), []byte{0, 0, 0, 0}), pcrs[0][0x000b])
+	assert.Equal(t, testExtend(make([]byte, 32), []byte("bootloader")), pcrs[4][0x000b])
+
+	// the SHA-1 bank is not replayed
+	assert.NotContains(t, pcrs[4], uint16(0x0004))
+}
+
+func Test_parseEventLog_errors(t *testing.T) {
+	_, err := parseEventLog([]byte{1, 2, 3})
+	assert.EqualError(t, err, "error decoding Spec ID event: truncated at offset 0 (want 32 more bytes)")
+
+	log := testEventLog(testEvent{0, 0x00000004, []byte{0, 0, 0, 0}})
+
+	_, err = parseEventLog(log[:len(log)-2])
+	assert.ErrorContains(t, err, "error decoding event 1: truncated at offset ")
+
+	log[4] = 0x04
+	_, err = parseEventLog(log)
+	assert.EqualError(t, err, "not a crypto-agile event log (first event is not EV_NO_ACTION)")
+}
+
+func Test_parseEventType(t *testing.T) {
+	for _, s := range []string{"EV_IPL", "ev_ipl", "IPL", "0xd", "13"} {
+		typ, err := parseEventType(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, uint32(0x0d), typ, s)
+	}
+
+	_, err := parseEventType("EV_BOGUS")
+	assert.EqualError(t, err, `unknown event type "EV_BOGUS"`)
+}
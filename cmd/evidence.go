@@ -0,0 +1,394 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	cbor "github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+const (
+	evidencePSA = "psa"
+	evidenceCCA = "cca"
+
+	// CBOR tag and keys of the CCA attestation token collection
+	ccaTokenTag        = 399
+	ccaPlatformTokenID = 44234
+	ccaRealmTokenID    = 44241
+)
+
+// swComponentClaims is an entry of the PSA (or CCA platform) software
+// components claim
+type swComponentClaims struct {
+	MeasurementType  string `cbor:"1,keyasint,omitempty" json:"measurement-type,omitempty"`
+	MeasurementValue []byte `cbor:"2,keyasint" json:"measurement-value"`
+	Version          string `cbor:"4,keyasint,omitempty" json:"version,omitempty"`
+	SignerID         []byte `cbor:"5,keyasint" json:"signer-id"`
+	MeasurementDesc  string `cbor:"6,keyasint,omitempty" json:"measurement-description,omitempty"`
+}
+
+// String returns a short description of the software component, e.g.,
+// "BL 2.1.0"
+func (o swComponentClaims) String() string {
+	s := o.MeasurementType
+	if o.Version != "" {
+		s += " " + o.Version
+	}
+	if s == "" {
+		s = "unnamed component"
+	}
+	return s
+}
+
+// platformTokenClaims are the claims of a PSA token (either profile) or of a
+// CCA platform token that are relevant to appraisal
+type platformTokenClaims struct {
+	Profile        string              `cbor:"265,keyasint,omitempty"`
+	Challenge      []byte              `cbor:"10,keyasint,omitempty"`
+	ImplID         []byte              `cbor:"2396,keyasint,omitempty"`
+	InstID         []byte              `cbor:"256,keyasint,omitempty"`
+	SwComponents   []swComponentClaims `cbor:"2399,keyasint,omitempty"`
+	PlatformConfig []byte              `cbor:"2401,keyasint,omitempty"`
+
+	// PSA_IOT_PROFILE_1 claims
+	LegacyProfile      string              `cbor:"-75000,keyasint,omitempty"`
+	LegacyImplID       []byte              `cbor:"-75003,keyasint,omitempty"`
+	LegacySwComponents []swComponentClaims `cbor:"-75006,keyasint,omitempty"`
+	LegacyInstID       []byte              `cbor:"-75009,keyasint,omitempty"`
+}
+
+// realmTokenClaims are the claims of a CCA realm token that are relevant to
+// appraisal
+type realmTokenClaims struct {
+	Challenge              []byte   `cbor:"10,keyasint,omitempty" json:"cca-realm-challenge,omitempty"`
+	PersonalizationValue   []byte   `cbor:"44235,keyasint,omitempty" json:"cca-realm-personalization-value,omitempty"`
+	HashAlgID              string   `cbor:"44236,keyasint,omitempty" json:"cca-realm-hash-algo-id,omitempty"`
+	PublicKey              []byte   `cbor:"44237,keyasint,omitempty" json:"cca-realm-public-key,omitempty"`
+	InitialMeasurement     []byte   `cbor:"44238,keyasint,omitempty" json:"cca-realm-initial-measurement"`
+	ExtensibleMeasurements [][]byte `cbor:"44239,keyasint,omitempty" json:"cca-realm-extensible-measurements,omitempty"`
+	PublicKeyHashAlgID     string   `cbor:"44240,keyasint,omitempty" json:"cca-realm-public-key-hash-algo-id,omitempty"`
+}
+
+// psaJSONClaims is the JSON serialization of PSA token claims
+type psaJSONClaims struct {
+	Profile      string              `json:"eat-profile,omitempty"`
+	ImplID       []byte              `json:"psa-implementation-id"`
+	InstID       []byte              `json:"psa-instance-id,omitempty"`
+	SwComponents []swComponentClaims `json:"psa-software-components,omitempty"`
+}
+
+// ccaPlatformJSONClaims is the JSON serialization of CCA platform token claims
+type ccaPlatformJSONClaims struct {
+	Profile        string              `json:"cca-platform-profile,omitempty"`
+	ImplID         []byte              `json:"cca-platform-implementation-id"`
+	InstID         []byte              `json:"cca-platform-instance-id,omitempty"`
+	PlatformConfig []byte              `json:"cca-platform-config,omitempty"`
+	SwComponents   []swComponentClaims `json:"cca-platform-sw-components,omitempty"`
+}
+
+// ccaJSONClaims is the JSON serialization of the claims of a CCA token
+type ccaJSONClaims struct {
+	Platform *ccaPlatformJSONClaims `json:"cca-platform-token"`
+	Realm    *realmTokenClaims      `json:"cca-realm-delegated-token,omitempty"`
+}
+
+// evidence is the decoded content of a PSA token or of a CCA token
+type evidence struct {
+	Format         string
+	Profile        string
+	ImplID         []byte
+	InstID         []byte
+	SwComponents   []swComponentClaims
+	PlatformConfig []byte
+	Realm          *realmTokenClaims
+
+	// challenge is the challenge of the platform token, which binds a CCA
+	// platform token to the realm attestation key
+	challenge []byte
+
+	// platformToken and realmToken are the signed PSA or CCA platform token
+	// and CCA realm token, if the evidence was supplied as a raw token rather
+	// than as JSON claims
+	platformToken *cose.Sign1Message
+	realmToken    *cose.Sign1Message
+}
+
+// decodeEvidence decodes PSA or CCA evidence, supplied either as JSON claims
+// or as a raw (CBOR) token
+func decodeEvidence(data []byte) (*evidence, error) {
+	var (
+		e   *evidence
+		err error
+	)
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		e, err = decodeJSONEvidence(trimmed)
+	} else {
+		e, err = decodeTokenEvidence(data)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(e.ImplID) == 0 {
+		return nil, errors.New("no implementation ID found in evidence")
+	}
+
+	return e, nil
+}
+
+func decodeJSONEvidence(data []byte) (*evidence, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("error decoding JSON claims: %w", err)
+	}
+
+	_, hasPlatform := probe["cca-platform-token"]
+	_, hasRealm := probe["cca-realm-delegated-token"]
+
+	if hasPlatform || hasRealm {
+		var c ccaJSONClaims
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("error decoding CCA claims: %w", err)
+		}
+
+		if c.Platform == nil {
+			return nil, errors.New("no cca-platform-token found in CCA claims")
+		}
+
+		return &evidence{
+			Format:         evidenceCCA,
+			Profile:        c.Platform.Profile,
+			ImplID:         c.Platform.ImplID,
+			InstID:         c.Platform.InstID,
+			SwComponents:   c.Platform.SwComponents,
+			PlatformConfig: c.Platform.PlatformConfig,
+			Realm:          c.Realm,
+		}, nil
+	}
+
+	var c psaJSONClaims
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("error decoding PSA claims: %w", err)
+	}
+
+	return &evidence{
+		Format:       evidencePSA,
+		Profile:      c.Profile,
+		ImplID:       c.ImplID,
+		InstID:       c.InstID,
+		SwComponents: c.SwComponents,
+	}, nil
+}
+
+// decodeSign1 decodes a (tagged or untagged) COSE Sign1 message
+func decodeSign1(data []byte) (*cose.Sign1Message, error) {
+	var m cose.Sign1Message
+	if err := m.UnmarshalCBOR(data); err == nil {
+		return &m, nil
+	}
+
+	var u cose.UntaggedSign1Message
+	if err := u.UnmarshalCBOR(data); err != nil {
+		return nil, fmt.Errorf("not a COSE Sign1 message: %w", err)
+	}
+
+	return (*cose.Sign1Message)(&u), nil
+}
+
+func decodeTokenEvidence(data []byte) (*evidence, error) {
+	var collection map[int]cbor.RawMessage
+
+	// a CCA token is a (possibly tagged) map of the platform and realm tokens
+	content := data
+	var tag cbor.RawTag
+	if err := cbor.Unmarshal(data, &tag); err == nil && tag.Number == ccaTokenTag {
+		content = tag.Content
+	}
+
+	if err := cbor.Unmarshal(content, &collection); err == nil {
+		return decodeCCAToken(collection)
+	}
+
+	m, err := decodeSign1(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding token: %w", err)
+	}
+
+	var c platformTokenClaims
+	if err := cbor.Unmarshal(m.Payload, &c); err != nil {
+		return nil, fmt.Errorf("error decoding PSA claims: %w", err)
+	}
+
+	e := platformEvidence(c)
+	e.Format = evidencePSA
+	e.platformToken = m
+
+	return e, nil
+}
+
+func decodeCCAToken(collection map[int]cbor.RawMessage) (*evidence, error) {
+	var ptoken, rtoken []byte
+
+	if err := cbor.Unmarshal(collection[ccaPlatformTokenID], &ptoken); err != nil {
+		return nil, fmt.Errorf("error decoding CCA platform token: %w", err)
+	}
+
+	pm, err := decodeSign1(ptoken)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding CCA platform token: %w", err)
+	}
+
+	var pc platformTokenClaims
+	if err := cbor.Unmarshal(pm.Payload, &pc); err != nil {
+		return nil, fmt.Errorf("error decoding CCA platform claims: %w", err)
+	}
+
+	e := platformEvidence(pc)
+	e.Format = evidenceCCA
+	e.platformToken = pm
+
+	if raw, ok := collection[ccaRealmTokenID]; ok {
+		if err := cbor.Unmarshal(raw, &rtoken); err != nil {
+			return nil, fmt.Errorf("error decoding CCA realm token: %w", err)
+		}
+
+		rm, err := decodeSign1(rtoken)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding CCA realm token: %w", err)
+		}
+
+		var rc realmTokenClaims
+		if err := cbor.Unmarshal(rm.Payload, &rc); err != nil {
+			return nil, fmt.Errorf("error decoding CCA realm claims: %w", err)
+		}
+		e.Realm = &rc
+		e.realmToken = rm
+	}
+
+	return e, nil
+}
+
+// platformEvidence returns the evidence carried by the claims of a platform
+// token, taking PSA_IOT_PROFILE_1 claims into account
+func platformEvidence(c platformTokenClaims) *evidence {
+	e := evidence{
+		Profile:        c.Profile,
+		ImplID:         c.ImplID,
+		InstID:         c.InstID,
+		SwComponents:   c.SwComponents,
+		PlatformConfig: c.PlatformConfig,
+		challenge:      c.Challenge,
+	}
+
+	if e.Profile == "" {
+		e.Profile = c.LegacyProfile
+	}
+
+	if e.ImplID == nil {
+		e.ImplID = c.LegacyImplID
+	}
+
+	if e.InstID == nil {
+		e.InstID = c.LegacyInstID
+	}
+
+	if e.SwComponents == nil {
+		e.SwComponents = c.LegacySwComponents
+	}
+
+	return &e
+}
+
+// verifySignature checks the signature of the platform token against the
+// supplied public key
+func (o evidence) verifySignature(pub crypto.PublicKey) error {
+	if o.platformToken == nil {
+		return errors.New("no signed token (JSON claims carry no signature)")
+	}
+
+	if err := verifySign1(o.platformToken, pub); err != nil {
+		return fmt.Errorf("cannot verify the token signature: %w", err)
+	}
+
+	return nil
+}
+
+// verifyRealmToken checks the signature of the CCA realm token with the realm
+// attestation key (RAK) it carries, and that the RAK is the one the platform
+// token vouches for, i.e., that the platform token challenge is its hash
+func (o evidence) verifyRealmToken() error {
+	if o.Realm == nil || o.realmToken == nil {
+		return errors.New("no signed realm token (JSON claims carry no signature)")
+	}
+
+	rak, err := parseRealmPublicKey(o.Realm.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid realm public key: %w", err)
+	}
+
+	if err = verifySign1(o.realmToken, rak); err != nil {
+		return fmt.Errorf("realm token signature does not verify with the realm public key: %w", err)
+	}
+
+	alg, ok := refvalDigestAlgs[o.Realm.PublicKeyHashAlgID]
+	if !ok {
+		return fmt.Errorf("unsupported realm public key hash algorithm %q", o.Realm.PublicKeyHashAlgID)
+	}
+
+	h := alg.new()
+	h.Write(o.Realm.PublicKey)
+
+	if !bytes.Equal(h.Sum(nil), o.challenge) {
+		return errors.New("the platform token challenge is not the hash of the realm public key")
+	}
+
+	return nil
+}
+
+// verifySign1 checks the signature of a COSE Sign1 message against the
+// supplied public key, using the algorithm in its protected header
+func verifySign1(m *cose.Sign1Message, pub crypto.PublicKey) error {
+	alg, err := m.Headers.Protected.Algorithm()
+	if err != nil {
+		return err
+	}
+
+	verifier, err := cose.NewVerifier(alg, pub)
+	if err != nil {
+		return err
+	}
+
+	return m.Verify(nil, verifier)
+}
+
+// parseRealmPublicKey decodes a realm attestation key, either a COSE_Key or,
+// as in earlier versions of the CCA token, an uncompressed P-384 point
+func parseRealmPublicKey(data []byte) (crypto.PublicKey, error) {
+	var k cose.Key
+	if err := k.UnmarshalCBOR(data); err == nil {
+		return k.PublicKey()
+	}
+
+	if _, err := ecdh.P384().NewPublicKey(data); err != nil {
+		return nil, errors.New("neither a COSE_Key nor an uncompressed P-384 point")
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P384(),
+		X:     new(big.Int).SetBytes(data[1:49]),
+		Y:     new(big.Int).SetBytes(data[49:]),
+	}, nil
+}
@@ -0,0 +1,266 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	cbor "github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/go-cose"
+)
+
+var (
+	testImplID   = []byte("acme-implementation-id-000000001")
+	testSignerID = mustB64Decode("rLsRx+TaIXIFUjzkzhokWuGiOa48a/2eeHH35di66Gs=")
+	testBLDigest = mustB64Decode("h0KPxSKAPTEGXnvOPPA/5HUJZjHl4Hu9eg/eYMTPJcc=")
+	testInstID   = mustB64Decode("Ac7rrnuJJ6MiflMDz14PH3s0u1Qq1yUKwD+83jbsLxUI")
+)
+
+func mustB64Decode(s string) []byte {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// signTestToken returns a COSE Sign1 message wrapping the supplied claims,
+// signed with key
+func signTestToken(t *testing.T, key crypto.Signer, claims interface{}) []byte {
+	payload, err := cbor.Marshal(claims)
+	require.NoError(t, err)
+
+	alg := cose.AlgorithmES256
+	if k, ok := key.(*ecdsa.PrivateKey); ok && k.Curve == elliptic.P384() {
+		alg = cose.AlgorithmES384
+	}
+
+	signer, err := cose.NewSigner(alg, key)
+	require.NoError(t, err)
+
+	headers := cose.Headers{Protected: cose.ProtectedHeader{cose.HeaderLabelAlgorithm: alg}}
+
+	token, err := cose.Sign1(rand.Reader, signer, headers, payload, nil)
+	require.NoError(t, err)
+
+	return token
+}
+
+func testPlatformClaims() platformTokenClaims {
+	return platformTokenClaims{
+		Profile: "http://arm.com/psa/2.0.0",
+		ImplID:  testImplID,
+		InstID:  testInstID,
+		SwComponents: []swComponentClaims{
+			{MeasurementType: "BL", Version: "2.1.0", SignerID: testSignerID, MeasurementValue: testBLDigest},
+		},
+	}
+}
+
+func Test_decodeEvidence_psa_json(t *testing.T) {
+	data := []byte(`{
+		"eat-profile": "http://arm.com/psa/2.0.0",
+		"psa-implementation-id": "YWNtZS1pbXBsZW1lbnRhdGlvbi1pZC0wMDAwMDAwMDE=",
+		"psa-instance-id": "Ac7rrnuJJ6MiflMDz14PH3s0u1Qq1yUKwD+83jbsLxUI",
+		"psa-software-components": [{
+			"measurement-type": "BL",
+			"version": "2.1.0",
+			"signer-id": "rLsRx+TaIXIFUjzkzhokWuGiOa48a/2eeHH35di66Gs=",
+			"measurement-value": "h0KPxSKAPTEGXnvOPPA/5HUJZjHl4Hu9eg/eYMTPJcc="
+		}]
+	}`)
+
+	e, err := decodeEvidence(data)
+	require.NoError(t, err)
+
+	assert.Equal(t, evidencePSA, e.Format)
+	assert.Equal(t, testImplID, e.ImplID)
+	assert.Equal(t, testInstID, e.InstID)
+	assert.Equal(t, testPlatformClaims().SwComponents, e.SwComponents)
+	assert.Nil(t, e.platformToken)
+}
+
+func Test_decodeEvidence_cca_json(t *testing.T) {
+	data := []byte(`{
+		"cca-platform-token": {
+			"cca-platform-implementation-id": "YWNtZS1pbXBsZW1lbnRhdGlvbi1pZC0wMDAwMDAwMDE=",
+			"cca-platform-config": "cmF3dmFsdWUKcmF3dmFsdWUK"
+		},
+		"cca-realm-delegated-token": {
+			"cca-realm-hash-algo-id": "sha-384",
+			"cca-realm-initial-measurement": "QoS1aUymwNLPR4mguVrIAlyBjeUjBDZL580pgbLS7caFsyInfsJYGZYkE9jJssH1"
+		}
+	}`)
+
+	e, err := decodeEvidence(data)
+	require.NoError(t, err)
+
+	assert.Equal(t, evidenceCCA, e.Format)
+	assert.Equal(t, testImplID, e.ImplID)
+	assert.Equal(t, []byte("rawvalue\nrawvalue\n"), e.PlatformConfig)
+	require.NotNil(t, e.Realm)
+	assert.Equal(t, "sha-384", e.Realm.HashAlgID)
+	assert.Len(t, e.Realm.InitialMeasurement, 48)
+}
+
+func Test_decodeEvidence_psa_token(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	e, err := decodeEvidence(signTestToken(t, key, testPlatformClaims()))
+	require.NoError(t, err)
+
+	assert.Equal(t, evidencePSA, e.Format)
+	assert.Equal(t, testImplID, e.ImplID)
+	assert.Equal(t, testPlatformClaims().SwComponents, e.SwComponents)
+	assert.NotNil(t, e.platformToken)
+}
+
+func Test_decodeEvidence_legacy_psa_token(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	c := testPlatformClaims()
+	legacy := platformTokenClaims{
+		LegacyProfile:      "PSA_IOT_PROFILE_1",
+		LegacyImplID:       c.ImplID,
+		LegacyInstID:       c.InstID,
+		LegacySwComponents: c.SwComponents,
+	}
+
+	e, err := decodeEvidence(signTestToken(t, key, legacy))
+	require.NoError(t, err)
+
+	assert.Equal(t, "PSA_IOT_PROFILE_1", e.Profile)
+	assert.Equal(t, testImplID, e.ImplID)
+	assert.Equal(t, testInstID, e.InstID)
+	assert.Equal(t, c.SwComponents, e.SwComponents)
+}
+
+func Test_decodeEvidence_cca_token(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	realm := realmTokenClaims{
+		HashAlgID:              "sha-256",
+		InitialMeasurement:     make([]byte, 32),
+		ExtensibleMeasurements: [][]byte{make([]byte, 32)},
+	}
+
+	collection, err := cbor.Marshal(cbor.Tag{
+		Number: ccaTokenTag,
+		Content: map[int][]byte{
+			ccaPlatformTokenID: signTestToken(t, key, testPlatformClaims()),
+			ccaRealmTokenID:    signTestToken(t, key, realm),
+		},
+	})
+	require.NoError(t, err)
+
+	e, err := decodeEvidence(collection)
+	require.NoError(t, err)
+
+	assert.Equal(t, evidenceCCA, e.Format)
+	assert.Equal(t, testImplID, e.ImplID)
+	assert.NotNil(t, e.platformToken)
+	assert.Equal(t, &realm, e.Realm)
+}
+
+// testCCAToken returns a CCA token whose platform token, signed with iak, has
+// the supplied challenge, and whose realm token, signed with rak, carries
+// rakData as realm public key
+func testCCAToken(t *testing.T, iak, rak crypto.Signer, rakData, challenge []byte) []byte {
+	platform := testPlatformClaims()
+	platform.Challenge = challenge
+
+	realm := realmTokenClaims{
+		Challenge:          make([]byte, 64),
+		HashAlgID:          "sha-256",
+		PublicKey:          rakData,
+		InitialMeasurement: make([]byte, 32),
+		PublicKeyHashAlgID: "sha-256",
+	}
+
+	token, err := cbor.Marshal(cbor.Tag{
+		Number: ccaTokenTag,
+		Content: map[int][]byte{
+			ccaPlatformTokenID: signTestToken(t, iak, platform),
+			ccaRealmTokenID:    signTestToken(t, rak, realm),
+		},
+	})
+	require.NoError(t, err)
+
+	return token
+}
+
+func Test_evidence_verifyRealmToken(t *testing.T) {
+	iak, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rak, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	// earlier CCA tokens carry the RAK as a raw point, later ones as a COSE_Key
+	rawRAK := elliptic.Marshal(elliptic.P384(), rak.X, rak.Y) // nolint: staticcheck
+	coseRAK, err := cose.NewKeyFromPublic(&rak.PublicKey)
+	require.NoError(t, err)
+	coseRAKData, err := coseRAK.MarshalCBOR()
+	require.NoError(t, err)
+
+	for _, rakData := range [][]byte{rawRAK, coseRAKData} {
+		challenge := sha256.Sum256(rakData)
+
+		e, err := decodeEvidence(testCCAToken(t, iak, rak, rakData, challenge[:]))
+		require.NoError(t, err)
+		require.NoError(t, e.verifySignature(iak.Public()))
+		assert.NoError(t, e.verifyRealmToken())
+
+		e, err = decodeEvidence(testCCAToken(t, iak, rak, rakData, make([]byte, 32)))
+		require.NoError(t, err)
+		assert.EqualError(t, e.verifyRealmToken(),
+			"the platform token challenge is not the hash of the realm public key")
+
+		e, err = decodeEvidence(testCCAToken(t, iak, other, rakData, challenge[:]))
+		require.NoError(t, err)
+		assert.ErrorContains(t, e.verifyRealmToken(),
+			"realm token signature does not verify with the realm public key: ")
+	}
+
+	e, err := decodeEvidence(testCCAToken(t, iak, rak, []byte{0x04, 0x01}, nil))
+	require.NoError(t, err)
+	assert.EqualError(t, e.verifyRealmToken(),
+		"invalid realm public key: neither a COSE_Key nor an uncompressed P-384 point")
+
+	e, err = decodeEvidence([]byte(`{
+		"cca-platform-token": { "cca-platform-implementation-id": "YWNtZS1pbXBsZW1lbnRhdGlvbi1pZC0wMDAwMDAwMDE=" },
+		"cca-realm-delegated-token": { "cca-realm-initial-measurement": "AAAA" }
+	}`))
+	require.NoError(t, err)
+	assert.EqualError(t, e.verifyRealmToken(), "no signed realm token (JSON claims carry no signature)")
+}
+
+func Test_decodeEvidence_errors(t *testing.T) {
+	_, err := decodeEvidence([]byte(`{"psa-instance-id": "AQ=="}`))
+	assert.EqualError(t, err, "no implementation ID found in evidence")
+
+	_, err = decodeEvidence([]byte(`{"psa-implementation-id": 1}`))
+	assert.ErrorContains(t, err, "error decoding PSA claims: ")
+
+	_, err = decodeEvidence([]byte(`{"cca-platform-token": null}`))
+	assert.EqualError(t, err, "no cca-platform-token found in CCA claims")
+
+	_, err = decodeEvidence([]byte(`{"cca-realm-delegated-token": {}}`))
+	assert.EqualError(t, err, "no cca-platform-token found in CCA claims")
+
+	_, err = decodeEvidence([]byte{0x82, 0x01, 0x02})
+	assert.ErrorContains(t, err, "error decoding token: not a COSE Sign1 message: ")
+}
@@ -0,0 +1,616 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/swid"
+)
+
+var (
+	findFiles  []string
+	findDirs   []string
+	findFormat string
+	findDigest string
+	findMkey   string
+	findEnv    []string
+	findTagID  string
+	findRegID  string
+)
+
+var findCmd = NewFindCmd()
+
+func NewFindCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "find",
+		Short: "search CoRIM, CoMID, CoTS and CoSWID files by digest, measurement, environment, tag-id or regid",
+		Long: `search CoRIM, CoMID, CoTS and CoSWID files by digest, measurement, environment, tag-id or regid
+
+	Find the measurements with the supplied digest in any cbor file in the
+	endorsements/ directory and its subdirectories, including the tags embedded
+	in CoRIMs.  The digest is given as <alg>;<base64> (as in the templates), or
+	as a bare base64 or hex value to match any hash algorithm.
+
+	  cocli find --dir=endorsements --digest="sha-256;h0KPxSKAPTEGXnvOPPA/5HUJZjHl4Hu9eg/eYMTPJcc="
+
+	Find the triples whose environment has the supplied (PSA) implementation ID
+	and vendor.  Environment attributes are class-id, vendor, model, layer,
+	index, instance and group; identifiers are given as in the templates.
+
+	  cocli find -d endorsements --env class-id=YWNtZS1pbXBsZW1lbnRhdGlvbi1pZC0wMDAwMDAwMDE= --env vendor=ACME
+
+	Find the BL measurements in the tags created by the entity with the
+	supplied regid (or embedded in a CoRIM created by it).
+
+	  cocli find -d endorsements --regid=https://acme.example --mkey=BL
+
+	Find the tags (or CoRIMs) with the supplied tag-id (or corim-id).
+
+	  cocli find -d endorsements --tag-id=43BBE37F-2E61-4B33-AED3-53CFF1428B16
+
+	Criteria are combined: tag-id and regid select tags, environment
+	attributes select triples within them, and digest and measurement key
+	select measurements within those.  The most specific matching locations are
+	printed.  The command fails if nothing is found.
+	`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			criteria, err := checkFindArgs()
+			if err != nil {
+				return err
+			}
+
+			filesList := recursiveFilesList(findFiles, findDirs, ".cbor")
+			if len(filesList) == 0 {
+				return errors.New("no files found")
+			}
+
+			hits := find(filesList, criteria)
+
+			if err := printFindHits(hits, findFormat); err != nil {
+				return err
+			}
+
+			if len(hits) == 0 {
+				return errors.New("no matches found")
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(
+		&findFiles, "file", "f", []string{}, "a CoRIM, CoMID, CoTS or CoSWID file (in CBOR format)",
+	)
+
+	cmd.Flags().StringArrayVarP(
+		&findDirs, "dir", "d", []string{}, "a directory to search recursively for CBOR files",
+	)
+
+	cmd.Flags().StringVarP(
+		&findFormat, "format", "o", "text", "output format: text or json",
+	)
+
+	cmd.Flags().StringVar(
+		&findDigest, "digest", "", "a digest, as <alg>;<base64>, or as a bare base64 or hex value",
+	)
+
+	cmd.Flags().StringVar(
+		&findMkey, "mkey", "", "a measurement key, or one of its fields (e.g., a PSA component label or version)",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&findEnv, "env", []string{}, "an environment attribute, as <attribute>=<value>",
+	)
+
+	cmd.Flags().StringVar(
+		&findTagID, "tag-id", "", "a tag-id (or corim-id)",
+	)
+
+	cmd.Flags().StringVar(
+		&findRegID, "regid", "", "the regid of an entity",
+	)
+
+	return cmd
+}
+
+// findCriteria are the parsed search criteria
+type findCriteria struct {
+	digestAlg   uint64 // 0 matches any algorithm
+	digestValue []byte
+	mkey        string
+	env         map[string]string
+	tagID       string
+	regid       string
+}
+
+func (o findCriteria) tagLevel() bool {
+	return o.tagID != "" || o.regid != ""
+}
+
+func (o findCriteria) envLevel() bool {
+	return len(o.env) != 0
+}
+
+func (o findCriteria) measurementLevel() bool {
+	return o.digestValue != nil || o.mkey != ""
+}
+
+var findEnvAttributes = []string{"class-id", "vendor", "model", "layer", "index", "instance", "group"}
+
+func checkFindArgs() (*findCriteria, error) {
+	if len(findFiles) == 0 && len(findDirs) == 0 {
+		return nil, errors.New("no files supplied")
+	}
+
+	switch findFormat {
+	case "text", "json":
+	default:
+		return nil, fmt.Errorf("unknown output format %q (want text or json)", findFormat)
+	}
+
+	c := findCriteria{
+		mkey:  findMkey,
+		env:   make(map[string]string),
+		tagID: findTagID,
+		regid: findRegID,
+	}
+
+	if findDigest != "" {
+		alg, value, err := parseFindDigest(findDigest)
+		if err != nil {
+			return nil, err
+		}
+		c.digestAlg, c.digestValue = alg, value
+	}
+
+	for _, kv := range findEnv {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || v == "" {
+			return nil, fmt.Errorf("malformed environment attribute %q (want <attribute>=<value>)", kv)
+		}
+
+		if indexOf(findEnvAttributes, k) == -1 {
+			return nil, fmt.Errorf(
+				"unknown environment attribute %q (want one of %s)", k, strings.Join(findEnvAttributes, ", "),
+			)
+		}
+
+		c.env[k] = v
+	}
+
+	if !c.tagLevel() && !c.envLevel() && !c.measurementLevel() {
+		return nil, errors.New("no search criteria supplied")
+	}
+
+	return &c, nil
+}
+
+// parseFindDigest parses a digest given as <alg>;<base64>, or as a bare hex or
+// base64 value (in which case the returned algorithm is 0)
+func parseFindDigest(s string) (uint64, []byte, error) {
+	if strings.Contains(s, ";") {
+		he, err := swid.ParseHashEntry(s)
+		if err != nil {
+			return 0, nil, fmt.Errorf("malformed digest %q: %w", s, err)
+		}
+		return he.HashAlgID, he.HashValue, nil
+	}
+
+	if v, err := decodeHexOrBase64(s); err == nil {
+		return 0, v, nil
+	}
+
+	return 0, nil, fmt.Errorf("malformed digest %q (want <alg>;<base64>, base64 or hex)", s)
+}
+
+// findHit is a location matching the search criteria
+type findHit struct {
+	File  string `json:"file"`
+	Path  string `json:"path,omitempty"`
+	Kind  string `json:"kind"`
+	TagID string `json:"tag-id,omitempty"`
+	Match string `json:"match"`
+}
+
+func find(files []string, c *findCriteria) []findHit {
+	var hits []findHit
+
+	for _, file := range files {
+		endorsements, tagErrs, err := loadEndorsements(file)
+		if err != nil {
+			fmt.Printf(">> skipping %v\n", err)
+			continue
+		}
+
+		for _, err := range tagErrs {
+			fmt.Printf(">> skipping %v\n", err)
+		}
+
+		// the CoRIM, if any, comes first: its id and entities apply to the
+		// embedded tags too
+		var corimTag *endorsement
+
+		for i, e := range endorsements {
+			if e.Corim != nil {
+				corimTag = &endorsements[i]
+			}
+
+			hits = append(hits, findInEndorsement(e, corimTag, c)...)
+		}
+	}
+
+	return hits
+}
+
+func findInEndorsement(e endorsement, corimTag *endorsement, c *findCriteria) []findHit {
+	var (
+		hits  []findHit
+		tagID = endorsementTagID(e)
+	)
+
+	hit := func(path, match string) {
+		if e.Loc != "" {
+			if path != "" {
+				path = e.Loc + "." + path
+			} else {
+				path = e.Loc
+			}
+		}
+		hits = append(hits, findHit{File: e.File, Path: path, Kind: e.Kind(), TagID: tagID, Match: match})
+	}
+
+	var matched []string
+
+	if c.tagID != "" {
+		switch {
+		case strings.EqualFold(tagID, c.tagID):
+			matched = append(matched, "tag-id "+tagID)
+		case e.Corim == nil && corimTag != nil && strings.EqualFold(endorsementTagID(*corimTag), c.tagID):
+			matched = append(matched, "in CoRIM "+c.tagID)
+		default:
+			return nil
+		}
+	}
+
+	if c.regid != "" {
+		switch {
+		case indexOf(endorsementRegIDs(e), c.regid) != -1:
+			matched = append(matched, "entity regid "+c.regid)
+		case e.Corim == nil && corimTag != nil && indexOf(endorsementRegIDs(*corimTag), c.regid) != -1:
+			matched = append(matched, "in CoRIM with entity regid "+c.regid)
+		default:
+			return nil
+		}
+	}
+
+	if !c.envLevel() && !c.measurementLevel() {
+		hit("", strings.Join(matched, ", "))
+		return hits
+	}
+
+	switch {
+	case e.Comid != nil:
+		for _, vts := range comidValueTriples(e.Comid) {
+			for i, vt := range vts.Values {
+				path := fmt.Sprintf("triples.%s[%d]", vts.name, i)
+
+				if c.envLevel() && !findMatchEnv(vt.Environment, c.env) {
+					continue
+				}
+
+				if !c.measurementLevel() {
+					hit(path, "environment "+findEnvString(vt.Environment))
+					continue
+				}
+
+				for j, m := range vt.Measurements.Values {
+					if match, ok := findMatchMeasurement(m, c); ok {
+						hit(fmt.Sprintf("%s.measurements[%d]", path, j), match)
+					}
+				}
+			}
+		}
+
+		if c.measurementLevel() {
+			break
+		}
+
+		for _, kts := range []struct {
+			name string
+			kts  *comid.KeyTriples
+		}{
+			{"attester-verification-keys", e.Comid.Triples.AttestVerifKeys},
+			{"dev-identity-keys", e.Comid.Triples.DevIdentityKeys},
+		} {
+			if kts.kts == nil {
+				continue
+			}
+
+			for i, kt := range *kts.kts {
+				if findMatchEnv(kt.Environment, c.env) {
+					hit(fmt.Sprintf("triples.%s[%d]", kts.name, i), "environment "+findEnvString(kt.Environment))
+				}
+			}
+		}
+	case e.Cots != nil:
+		if c.measurementLevel() {
+			break
+		}
+
+		for i, eg := range e.Cots.Environments {
+			if eg.Environment != nil && findMatchEnv(*eg.Environment, c.env) {
+				hit(fmt.Sprintf("environments[%d]", i), "environment "+findEnvString(*eg.Environment))
+			}
+		}
+	}
+
+	return hits
+}
+
+// endorsementTagID returns the tag-id of a tag, or the id of a CoRIM
+func endorsementTagID(e endorsement) string {
+	switch {
+	case e.Corim != nil:
+		return e.Corim.ID.String()
+	case e.Comid != nil:
+		return e.Comid.TagIdentity.TagID.String()
+	case e.Cots != nil && e.Cots.TagIdentity != nil:
+		return e.Cots.TagIdentity.TagID.String()
+	case e.Coswid != nil:
+		return e.Coswid.TagID.String()
+	}
+	return ""
+}
+
+// endorsementRegIDs returns the regids of the entities of a CoRIM or tag
+func endorsementRegIDs(e endorsement) []string {
+	var ret []string
+
+	switch {
+	case e.Corim != nil && e.Corim.Entities != nil:
+		for _, ent := range e.Corim.Entities.Values {
+			if ent.RegID != nil {
+				ret = append(ret, string(*ent.RegID))
+			}
+		}
+	case e.Comid != nil && e.Comid.Entities != nil:
+		for _, ent := range e.Comid.Entities.Values {
+			if ent.RegID != nil {
+				ret = append(ret, string(*ent.RegID))
+			}
+		}
+	case e.Coswid != nil:
+		for _, ent := range e.Coswid.Entities {
+			if ent.RegID != "" {
+				ret = append(ret, ent.RegID)
+			}
+		}
+	}
+
+	return ret
+}
+
+// findEnvAttrs returns the searchable attributes of an environment, with
+// identifiers rendered as in the JSON templates
+func findEnvAttrs(env comid.Environment) map[string]string {
+	ret := make(map[string]string)
+
+	j, err := json.Marshal(env)
+	if err != nil {
+		return ret
+	}
+
+	type typedValue struct {
+		Value json.RawMessage `json:"value"`
+	}
+
+	var fields struct {
+		Class *struct {
+			ID     *typedValue     `json:"id"`
+			Vendor string          `json:"vendor"`
+			Model  string          `json:"model"`
+			Layer  json.RawMessage `json:"layer"`
+			Index  json.RawMessage `json:"index"`
+		} `json:"class"`
+		Instance *typedValue `json:"instance"`
+		Group    *typedValue `json:"group"`
+	}
+
+	if err := json.Unmarshal(j, &fields); err != nil {
+		return ret
+	}
+
+	scalar := func(raw json.RawMessage) string {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return s
+		}
+		return string(raw)
+	}
+
+	if cl := fields.Class; cl != nil {
+		if cl.ID != nil {
+			ret["class-id"] = scalar(cl.ID.Value)
+		}
+		ret["vendor"] = cl.Vendor
+		ret["model"] = cl.Model
+		if cl.Layer != nil {
+			ret["layer"] = string(cl.Layer)
+		}
+		if cl.Index != nil {
+			ret["index"] = string(cl.Index)
+		}
+	}
+
+	if fields.Instance != nil {
+		ret["instance"] = scalar(fields.Instance.Value)
+	}
+
+	if fields.Group != nil {
+		ret["group"] = scalar(fields.Group.Value)
+	}
+
+	return ret
+}
+
+func findMatchEnv(env comid.Environment, want map[string]string) bool {
+	attrs := findEnvAttrs(env)
+
+	for k, v := range want {
+		if attrs[k] == "" || !strings.EqualFold(attrs[k], v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// findEnvString returns the attributes of an environment in a compact,
+// human-readable form, e.g., "class-id=... vendor=ACME"
+func findEnvString(env comid.Environment) string {
+	attrs := findEnvAttrs(env)
+
+	var l []string
+	for _, k := range findEnvAttributes {
+		if attrs[k] != "" {
+			l = append(l, k+"="+attrs[k])
+		}
+	}
+
+	return strings.Join(l, " ")
+}
+
+// findMatchMeasurement checks a measurement against the digest and
+// measurement key criteria, and describes what matched
+func findMatchMeasurement(m comid.Measurement, c *findCriteria) (string, bool) {
+	var matched []string
+
+	if c.mkey != "" {
+		if m.Key == nil || !m.Key.IsSet() {
+			return "", false
+		}
+
+		fields := mkeyFields(*m.Key)
+		if indexOf(fields, c.mkey) == -1 {
+			return "", false
+		}
+
+		matched = append(matched, fmt.Sprintf("mkey %s=%s", m.Key.Type(), strings.Join(fields, ",")))
+	}
+
+	if c.digestValue != nil {
+		where, ok := findDigestIn(m.Val, c)
+		if !ok {
+			return "", false
+		}
+
+		matched = append(matched, where)
+	}
+
+	return strings.Join(matched, ", "), true
+}
+
+// mkeyFields returns the measurement key value, or its fields (e.g., the
+// label, version and signer ID of a PSA refval-id), as rendered in JSON
+func mkeyFields(k comid.Mkey) []string {
+	j, err := json.Marshal(k)
+	if err != nil {
+		return nil
+	}
+
+	var tv struct {
+		Value json.RawMessage `json:"value"`
+	}
+
+	if err := json.Unmarshal(j, &tv); err != nil {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(tv.Value, &s); err == nil {
+		return []string{s}
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(tv.Value, &fields); err == nil {
+		var ret []string
+		for _, name := range []string{"label", "version", "signer-id"} {
+			if v, ok := fields[name]; ok {
+				ret = append(ret, fmt.Sprint(v))
+			}
+		}
+		return ret
+	}
+
+	return []string{string(tv.Value)}
+}
+
+// findDigestIn looks for the searched digest among the digests and the
+// integrity registers of a measured value, and returns where it was found
+func findDigestIn(v comid.Mval, c *findCriteria) (string, bool) {
+	match := func(digests comid.Digests) (string, bool) {
+		for _, d := range digests {
+			if (c.digestAlg == 0 || d.HashAlgID == c.digestAlg) && bytes.Equal(d.HashValue, c.digestValue) {
+				return d.String(), true
+			}
+		}
+		return "", false
+	}
+
+	if v.Digests != nil {
+		if d, ok := match(*v.Digests); ok {
+			return "digest " + d, true
+		}
+	}
+
+	if v.IntegrityRegisters != nil {
+		for _, idx := range sortedRegisterIndices(v.IntegrityRegisters) {
+			if d, ok := match(v.IntegrityRegisters.IndexMap[idx]); ok {
+				return fmt.Sprintf("integrity-registers.%v digest %s", idx, d), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func printFindHits(hits []findHit, format string) error {
+	if format == "json" {
+		if hits == nil {
+			hits = []findHit{}
+		}
+
+		j, err := json.MarshalIndent(hits, "", "  ")
+		if err != nil {
+			return fmt.Errorf("JSON encoding failed: %w", err)
+		}
+		fmt.Println(string(j))
+		return nil
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].File < hits[j].File })
+
+	for _, h := range hits {
+		loc := h.File
+		if h.Path != "" {
+			loc += ":" + h.Path
+		}
+		fmt.Printf("%s [%s %s]: %s\n", loc, h.Kind, h.TagID, h.Match)
+	}
+
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(findCmd)
+}
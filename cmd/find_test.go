@@ -0,0 +1,141 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/swid"
+)
+
+func resetFindFlags() {
+	findFiles, findDirs, findEnv = nil, nil, nil
+	findFormat, findDigest, findMkey, findTagID, findRegID = "text", "", "", "", ""
+}
+
+// findTestFS creates a stand-alone CoMID and, in a subdirectory, a CoRIM
+// embedding the same CoMID
+func findTestFS(t *testing.T) {
+	refval, err := os.ReadFile("../data/comid/comid-psa-refval.cbor")
+	require.NoError(t, err)
+
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "endorsements/refval.cbor", refval, 0400))
+	require.NoError(t, afero.WriteFile(fs, "endorsements/v1/corim.cbor", psaCorim(t), 0400))
+	require.NoError(t, afero.WriteFile(fs, "endorsements/v1/README.md", []byte("ignored"), 0400))
+}
+
+func Test_FindCmd_no_criteria(t *testing.T) {
+	resetFindFlags()
+	cmd := NewFindCmd()
+
+	cmd.SetArgs([]string{"--dir=endorsements"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no search criteria supplied")
+}
+
+func Test_FindCmd_bad_env(t *testing.T) {
+	resetFindFlags()
+	cmd := NewFindCmd()
+
+	cmd.SetArgs([]string{"--dir=endorsements", "--env=colour=red"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err,
+		`unknown environment attribute "colour" (want one of class-id, vendor, model, layer, index, instance, group)`)
+}
+
+func Test_FindCmd_no_matches(t *testing.T) {
+	resetFindFlags()
+	findTestFS(t)
+	cmd := NewFindCmd()
+
+	cmd.SetArgs([]string{"--dir=endorsements", "--tag-id=unknown"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no matches found")
+}
+
+func Test_parseFindDigest(t *testing.T) {
+	alg, v, err := parseFindDigest("sha-256;h0KPxSKAPTEGXnvOPPA/5HUJZjHl4Hu9eg/eYMTPJcc=")
+	require.NoError(t, err)
+	assert.Equal(t, swid.Sha256, alg)
+	assert.Equal(t, testBLDigest, v)
+
+	alg, v, err = parseFindDigest("deadbeef")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), alg)
+	assert.Equal(t, []byte{0xde, 0xad, 0xbe, 0xef}, v)
+
+	_, _, err = parseFindDigest("not a digest!")
+	assert.EqualError(t, err, `malformed digest "not a digest!" (want <alg>;<base64>, base64 or hex)`)
+}
+
+func Test_find_digest(t *testing.T) {
+	findTestFS(t)
+
+	alg, v, err := parseFindDigest("h0KPxSKAPTEGXnvOPPA/5HUJZjHl4Hu9eg/eYMTPJcc=")
+	require.NoError(t, err)
+
+	files := recursiveFilesList(nil, []string{"endorsements"}, ".cbor")
+	require.Equal(t, []string{"endorsements/refval.cbor", "endorsements/v1/corim.cbor"}, files)
+
+	hits := find(files, &findCriteria{digestAlg: alg, digestValue: v})
+	assert.Equal(t, []findHit{
+		{
+			File:  "endorsements/refval.cbor",
+			Path:  "triples.reference-values[0].measurements[0]",
+			Kind:  "CoMID",
+			TagID: "43bbe37f-2e61-4b33-aed3-53cff1428b16",
+			Match: "digest sha-256;h0KPxSKAPTEGXnvOPPA/5HUJZjHl4Hu9eg/eYMTPJcc=",
+		},
+		{
+			File:  "endorsements/v1/corim.cbor",
+			Path:  "tags[0].triples.reference-values[0].measurements[0]",
+			Kind:  "CoMID",
+			TagID: "43bbe37f-2e61-4b33-aed3-53cff1428b16",
+			Match: "digest sha-256;h0KPxSKAPTEGXnvOPPA/5HUJZjHl4Hu9eg/eYMTPJcc=",
+		},
+	}, hits)
+}
+
+func Test_find_corim_id_and_env(t *testing.T) {
+	findTestFS(t)
+
+	files := recursiveFilesList(nil, []string{"endorsements"}, ".cbor")
+
+	// tags embedded in the CoRIM inherit its id
+	hits := find(files, &findCriteria{
+		tagID: "5C57E8F4-46CD-421B-91C9-08CF93E13CFC",
+		env:   map[string]string{"class-id": "YWNtZS1pbXBsZW1lbnRhdGlvbi1pZC0wMDAwMDAwMDE=", "model": "roadrunner"},
+	})
+	require.Len(t, hits, 1)
+	assert.Equal(t, "endorsements/v1/corim.cbor", hits[0].File)
+	assert.Equal(t, "tags[0].triples.reference-values[0]", hits[0].Path)
+
+	hits = find(files, &findCriteria{tagID: "5c57e8f4-46cd-421b-91c9-08cf93e13cfc"})
+	require.Len(t, hits, 2)
+	assert.Equal(t, findHit{
+		File: "endorsements/v1/corim.cbor", Kind: "CoRIM",
+		TagID: "5c57e8f4-46cd-421b-91c9-08cf93e13cfc", Match: "tag-id 5c57e8f4-46cd-421b-91c9-08cf93e13cfc",
+	}, hits[0])
+	assert.Equal(t, "tags[0]", hits[1].Path)
+}
+
+func Test_find_regid_and_mkey(t *testing.T) {
+	findTestFS(t)
+
+	hits := find([]string{"endorsements/refval.cbor"}, &findCriteria{regid: "https://acme.example", mkey: "1.3.5"})
+	require.Len(t, hits, 1)
+	assert.Equal(t, "triples.reference-values[0].measurements[1]", hits[0].Path)
+	assert.Equal(t, "mkey psa.refval-id=PRoT,1.3.5,rLsRx+TaIXIFUjzkzhokWuGiOa48a/2eeHH35di66Gs=", hits[0].Match)
+
+	hits = find([]string{"endorsements/refval.cbor"}, &findCriteria{regid: "https://other.example", mkey: "1.3.5"})
+	assert.Empty(t, hits)
+}
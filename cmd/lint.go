@@ -0,0 +1,367 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const defaultLintMaxValidityYears = 5
+
+var (
+	lintFiles            []string
+	lintDirs             []string
+	lintFormat           string
+	lintDisable          []string
+	lintMaxValidityYears int
+)
+
+// lintNow is the reference time used by the lint rules (overridden in tests)
+var lintNow = time.Now
+
+var lintCmd = NewLintCmd()
+
+func NewLintCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "report questionable content in CoRIM, CoMID, CoTS and CoSWID files",
+		Long: `report questionable content in CoRIM, CoMID, CoTS and CoSWID files
+
+	Run the lint rules over the CBOR-encoded files c1.cbor and c2.cbor, and over
+	any cbor file in the endorsements/ directory.  Tags embedded in CoRIMs are
+	checked too.
+
+	  cocli lint --file=c1.cbor --file=c2.cbor --dir=endorsements
+
+	Same as above, but emit a SARIF log (e.g., for code-scanning UIs) and skip
+	the missing-lang rule (CL006).
+
+	  cocli lint --dir=endorsements --format=sarif --disable=CL006
+
+	List the available rules.
+
+	  cocli lint --list-rules
+
+	Rules can also be disabled (or re-enabled) in the configuration file:
+
+	  lint:
+	    max-validity-years: 3
+	    rules:
+	      CL006: false
+	`,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if list, _ := cmd.Flags().GetBool("list-rules"); list {
+				printLintRules()
+				return nil
+			}
+
+			if err := checkLintArgs(); err != nil {
+				return err
+			}
+
+			filesList := filesList(lintFiles, lintDirs, ".cbor")
+			if len(filesList) == 0 {
+				return errors.New("no files found")
+			}
+
+			maxYears := lintMaxValidityYears
+			if !cmd.Flags().Changed("max-validity-years") && viper.IsSet("lint.max-validity-years") {
+				maxYears = viper.GetInt("lint.max-validity-years")
+			}
+
+			rules, err := enabledLintRules(lintDisable)
+			if err != nil {
+				return err
+			}
+
+			findings, errs := lint(filesList, rules, newLintContext(lintNow(), maxYears))
+
+			if err := printLintFindings(findings, rules, lintFormat); err != nil {
+				return err
+			}
+
+			if errs != 0 {
+				return fmt.Errorf("%d/%d file(s) could not be linted", errs, len(filesList))
+			}
+
+			if len(findings) != 0 {
+				return fmt.Errorf("%d issue(s) found", len(findings))
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(
+		&lintFiles, "file", "f", []string{}, "a CoRIM, CoMID, CoTS or CoSWID file (in CBOR format)",
+	)
+
+	cmd.Flags().StringArrayVarP(
+		&lintDirs, "dir", "d", []string{}, "a directory containing CoRIM, CoMID, CoTS or CoSWID files (in CBOR format)",
+	)
+
+	cmd.Flags().StringVarP(
+		&lintFormat, "format", "o", "text", "output format: text, json or sarif",
+	)
+
+	cmd.Flags().StringArrayVarP(
+		&lintDisable, "disable", "x", []string{}, "ID of a rule to skip (e.g., CL006)",
+	)
+
+	cmd.Flags().IntVarP(
+		&lintMaxValidityYears, "max-validity-years", "y", defaultLintMaxValidityYears,
+		"longest acceptable validity window, in years",
+	)
+
+	cmd.Flags().BoolP("list-rules", "l", false, "list the available rules and exit")
+
+	return cmd
+}
+
+func checkLintArgs() error {
+	if len(lintFiles) == 0 && len(lintDirs) == 0 {
+		return errors.New("no files supplied")
+	}
+
+	switch lintFormat {
+	case "text", "json", "sarif":
+	default:
+		return fmt.Errorf("unknown output format %q (want text, json or sarif)", lintFormat)
+	}
+
+	return nil
+}
+
+// enabledLintRules returns the rules that are not disabled, either in the
+// configuration file (lint.rules.<ID>: false) or on the command line
+func enabledLintRules(disabled []string) ([]lintRule, error) {
+	skip := make(map[string]bool)
+
+	for _, id := range disabled {
+		rule := lookupLintRule(id)
+		if rule == nil {
+			return nil, fmt.Errorf("unknown lint rule %q", id)
+		}
+		skip[rule.ID] = true
+	}
+
+	var ret []lintRule
+	for _, r := range lintRules {
+		// viper keys are case-insensitive
+		cfgKey := "lint.rules." + strings.ToLower(r.ID)
+		if viper.IsSet(cfgKey) && !viper.GetBool(cfgKey) {
+			continue
+		}
+
+		if skip[r.ID] {
+			continue
+		}
+
+		ret = append(ret, r)
+	}
+
+	return ret, nil
+}
+
+func lookupLintRule(id string) *lintRule {
+	for i, r := range lintRules {
+		if strings.EqualFold(r.ID, id) || r.Name == id {
+			return &lintRules[i]
+		}
+	}
+	return nil
+}
+
+func lint(files []string, rules []lintRule, ctx *lintContext) ([]lintFinding, int) {
+	var (
+		findings []lintFinding
+		errs     int
+	)
+
+	for _, file := range files {
+		endorsements, tagErrs, err := loadEndorsements(file)
+		if err != nil {
+			fmt.Printf(">> skipping %v\n", err)
+			errs++
+			continue
+		}
+
+		for _, err := range tagErrs {
+			fmt.Printf(">> skipping %v\n", err)
+		}
+
+		for _, e := range endorsements {
+			for _, r := range rules {
+				for _, p := range r.check(e, ctx) {
+					path := p.path
+					if e.Loc != "" {
+						path = e.Loc + "." + path
+					}
+
+					findings = append(findings, lintFinding{
+						Rule:    r.ID,
+						Name:    r.Name,
+						File:    e.File,
+						Path:    path,
+						Message: p.message,
+					})
+				}
+			}
+		}
+	}
+
+	return findings, errs
+}
+
+func printLintRules() {
+	for _, r := range lintRules {
+		fmt.Printf("%s  %-22s %s\n", r.ID, r.Name, r.Description)
+	}
+}
+
+func printLintFindings(findings []lintFinding, rules []lintRule, format string) error {
+	switch format {
+	case "json":
+		if findings == nil {
+			findings = []lintFinding{}
+		}
+
+		j, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return fmt.Errorf("JSON encoding failed: %w", err)
+		}
+		fmt.Println(string(j))
+	case "sarif":
+		j, err := json.MarshalIndent(newSarifLog(findings, rules), "", "  ")
+		if err != nil {
+			return fmt.Errorf("SARIF encoding failed: %w", err)
+		}
+		fmt.Println(string(j))
+	default:
+		for _, f := range findings {
+			fmt.Printf("%s:%s: [%s %s] %s\n", f.File, f.Path, f.Rule, f.Name, f.Message)
+		}
+	}
+
+	return nil
+}
+
+// The following is the subset of the SARIF 2.1.0 object model needed to
+// report lint findings.  See
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Version        string      `json:"version"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+}
+
+func newSarifLog(findings []lintFinding, rules []lintRule) sarifLog {
+	driver := sarifDriver{
+		Name:           "cocli",
+		InformationURI: "https://github.com/veraison/cocli",
+		Version:        rootCmd.Version,
+		Rules:          []sarifRule{},
+	}
+
+	ruleIndex := make(map[string]int)
+	for i, r := range rules {
+		ruleIndex[r.ID] = i
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:               r.ID,
+			Name:             r.Name,
+			ShortDescription: sarifMessage{r.Description},
+		})
+	}
+
+	results := []sarifResult{}
+	for _, f := range findings {
+		loc := sarifLocation{
+			PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: f.File},
+			},
+		}
+
+		if f.Path != "" {
+			loc.LogicalLocations = []sarifLogicalLocation{{FullyQualifiedName: f.Path}}
+		}
+
+		results = append(results, sarifResult{
+			RuleID:    f.Rule,
+			RuleIndex: ruleIndex[f.Rule],
+			Level:     "warning",
+			Message:   sarifMessage{f.Message},
+			Locations: []sarifLocation{loc},
+		})
+	}
+
+	return sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+}
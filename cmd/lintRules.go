@@ -0,0 +1,341 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/corim/corim"
+	"github.com/veraison/swid"
+)
+
+// lintFinding is a warning raised by a lint rule against an endorsement
+type lintFinding struct {
+	Rule    string `json:"rule"`
+	Name    string `json:"name"`
+	File    string `json:"file"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// lintContext carries the settings of a lint run, and the state shared by the
+// rules across the processed endorsements
+type lintContext struct {
+	now              time.Time
+	maxValidityYears int
+
+	// seenMeasurements maps an environment+measurement key to the location
+	// where it was first found
+	seenMeasurements map[string]string
+}
+
+func newLintContext(now time.Time, maxValidityYears int) *lintContext {
+	return &lintContext{
+		now:              now,
+		maxValidityYears: maxValidityYears,
+		seenMeasurements: make(map[string]string),
+	}
+}
+
+// lintRule is an entry in the lint rule catalogue.  Rules are identified by a
+// stable ID (e.g., "CL001"), which is what the configuration refers to.
+type lintRule struct {
+	ID          string
+	Name        string
+	Description string
+
+	// check returns the message and the path (relative to the endorsement)
+	// of each problem found
+	check func(e endorsement, ctx *lintContext) []lintProblem
+}
+
+type lintProblem struct {
+	path    string
+	message string
+}
+
+var lintRules = []lintRule{
+	{
+		ID:          "CL001",
+		Name:        "long-validity",
+		Description: "validity window is longer than the configured maximum",
+		check:       lintLongValidity,
+	},
+	{
+		ID:          "CL002",
+		Name:        "expired",
+		Description: "validity window has already ended",
+		check:       lintExpired,
+	},
+	{
+		ID:          "CL003",
+		Name:        "duplicate-measurement",
+		Description: "the same measurement is asserted more than once for an environment",
+		check:       lintDuplicateMeasurement,
+	},
+	{
+		ID:          "CL004",
+		Name:        "empty-entity",
+		Description: "entity with an empty name or no roles, or empty list of entities",
+		check:       lintEmptyEntity,
+	},
+	{
+		ID:          "CL005",
+		Name:        "weak-digest",
+		Description: "digest uses a hash algorithm weaker than sha-256",
+		check:       lintWeakDigest,
+	},
+	{
+		ID:          "CL006",
+		Name:        "missing-lang",
+		Description: "tag does not declare its language",
+		check:       lintMissingLang,
+	},
+	{
+		ID:          "CL007",
+		Name:        "missing-profile",
+		Description: "CoRIM does not declare a profile",
+		check:       lintMissingProfile,
+	},
+}
+
+type validityWindow struct {
+	path string
+	*corim.Validity
+}
+
+// validityWindows returns the validity windows found in the endorsement
+func validityWindows(e endorsement) []validityWindow {
+	var ret []validityWindow
+
+	if e.Corim != nil && e.Corim.RimValidity != nil {
+		ret = append(ret, validityWindow{"validity", e.Corim.RimValidity})
+	}
+
+	if e.Meta != nil && e.Meta.Validity != nil {
+		ret = append(ret, validityWindow{"meta.validity", e.Meta.Validity})
+	}
+
+	return ret
+}
+
+func lintLongValidity(e endorsement, ctx *lintContext) []lintProblem {
+	var problems []lintProblem
+
+	for _, v := range validityWindows(e) {
+		start := ctx.now
+		if v.NotBefore != nil {
+			start = *v.NotBefore
+		}
+
+		if v.NotAfter.After(start.AddDate(ctx.maxValidityYears, 0, 0)) {
+			problems = append(problems, lintProblem{v.path, fmt.Sprintf(
+				"validity window from %s to %s exceeds %d years",
+				start.Format(time.RFC3339), v.NotAfter.Format(time.RFC3339), ctx.maxValidityYears,
+			)})
+		}
+	}
+
+	return problems
+}
+
+func lintExpired(e endorsement, ctx *lintContext) []lintProblem {
+	var problems []lintProblem
+
+	for _, v := range validityWindows(e) {
+		if v.NotAfter.Before(ctx.now) {
+			problems = append(problems, lintProblem{v.path, fmt.Sprintf(
+				"expired on %s", v.NotAfter.Format(time.RFC3339),
+			)})
+		}
+	}
+
+	return problems
+}
+
+type namedValueTriples struct {
+	name string
+	*comid.ValueTriples
+}
+
+// comidValueTriples returns the reference and endorsed values triples of a
+// CoMID, named after their JSON field
+func comidValueTriples(c *comid.Comid) []namedValueTriples {
+	var ret []namedValueTriples
+
+	if c.Triples.ReferenceValues != nil {
+		ret = append(ret, namedValueTriples{"reference-values", c.Triples.ReferenceValues})
+	}
+
+	if c.Triples.EndorsedValues != nil {
+		ret = append(ret, namedValueTriples{"endorsed-values", c.Triples.EndorsedValues})
+	}
+
+	return ret
+}
+
+func lintDuplicateMeasurement(e endorsement, ctx *lintContext) []lintProblem {
+	var problems []lintProblem
+
+	if e.Comid == nil {
+		return nil
+	}
+
+	for _, vts := range comidValueTriples(e.Comid) {
+		for i, vt := range vts.Values {
+			env, err := json.Marshal(vt.Environment)
+			if err != nil {
+				continue
+			}
+
+			for j, m := range vt.Measurements.Values {
+				// unkeyed measurements are identified by their value
+				var id []byte
+				if m.Key != nil && m.Key.IsSet() {
+					id, err = json.Marshal(m.Key)
+				} else {
+					id, err = json.Marshal(m.Val)
+				}
+				if err != nil {
+					continue
+				}
+
+				path := fmt.Sprintf("triples.%s[%d].measurements[%d]", vts.name, i, j)
+				k := vts.name + string(env) + string(id)
+
+				if first, ok := ctx.seenMeasurements[k]; ok {
+					problems = append(problems, lintProblem{path, "duplicates measurement at " + first})
+					continue
+				}
+
+				if e.Loc != "" {
+					path = e.Loc + "." + path
+				}
+				ctx.seenMeasurements[k] = e.File + ":" + path
+			}
+		}
+	}
+
+	return problems
+}
+
+func lintEmptyEntity(e endorsement, ctx *lintContext) []lintProblem {
+	var problems []lintProblem
+
+	check := func(path, name string, nroles int) {
+		if name == "" {
+			problems = append(problems, lintProblem{path, "entity has an empty name"})
+		}
+		if nroles == 0 {
+			problems = append(problems, lintProblem{path, "entity has no roles"})
+		}
+	}
+
+	switch {
+	case e.Corim != nil && e.Corim.Entities != nil:
+		if len(e.Corim.Entities.Values) == 0 {
+			problems = append(problems, lintProblem{"entities", "empty list of entities"})
+		}
+		for i, ent := range e.Corim.Entities.Values {
+			var name string
+			if ent.Name != nil && ent.Name.Value != nil {
+				name = ent.Name.String()
+			}
+			check(fmt.Sprintf("entities[%d]", i), name, len(ent.Roles))
+		}
+	case e.Comid != nil && e.Comid.Entities != nil:
+		if len(e.Comid.Entities.Values) == 0 {
+			problems = append(problems, lintProblem{"entities", "empty list of entities"})
+		}
+		for i, ent := range e.Comid.Entities.Values {
+			var name string
+			if ent.Name != nil && ent.Name.Value != nil {
+				name = ent.Name.String()
+			}
+			check(fmt.Sprintf("entities[%d]", i), name, len(ent.Roles))
+		}
+	case e.Coswid != nil:
+		for i, ent := range e.Coswid.Entities {
+			var nroles int
+			if ent.Roles.String() != "" {
+				nroles = 1
+			}
+			check(fmt.Sprintf("entity[%d]", i), ent.EntityName, nroles)
+		}
+	}
+
+	return problems
+}
+
+func lintWeakDigest(e endorsement, ctx *lintContext) []lintProblem {
+	var problems []lintProblem
+
+	check := func(path string, digests []swid.HashEntry) {
+		for i, d := range digests {
+			if !isStrongHashAlg(d.HashAlgID) {
+				problems = append(problems, lintProblem{
+					fmt.Sprintf("%s[%d]", path, i),
+					fmt.Sprintf("weak hash algorithm %s", hashAlgName(d.HashAlgID)),
+				})
+			}
+		}
+	}
+
+	if e.Corim != nil && e.Corim.DependentRims != nil {
+		for i, l := range *e.Corim.DependentRims {
+			if l.Thumbprint != nil {
+				check(fmt.Sprintf("dependent-rims[%d].thumbprint", i), []swid.HashEntry{*l.Thumbprint})
+			}
+		}
+	}
+
+	if e.Comid != nil {
+		for _, vts := range comidValueTriples(e.Comid) {
+			for i, vt := range vts.Values {
+				for j, m := range vt.Measurements.Values {
+					path := fmt.Sprintf("triples.%s[%d].measurements[%d].value", vts.name, i, j)
+
+					if m.Val.Digests != nil {
+						check(path+".digests", *m.Val.Digests)
+					}
+
+					if m.Val.IntegrityRegisters != nil {
+						for _, idx := range sortedRegisterIndices(m.Val.IntegrityRegisters) {
+							check(
+								fmt.Sprintf("%s.integrity-registers.%v", path, idx),
+								m.Val.IntegrityRegisters.IndexMap[idx],
+							)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+func lintMissingLang(e endorsement, ctx *lintContext) []lintProblem {
+	switch {
+	case e.Comid != nil && (e.Comid.Language == nil || *e.Comid.Language == ""):
+		return []lintProblem{{"lang", "CoMID does not declare its language"}}
+	case e.Cots != nil && (e.Cots.Language == nil || *e.Cots.Language == ""):
+		return []lintProblem{{"language", "CoTS does not declare its language"}}
+	case e.Coswid != nil && e.Coswid.Lang == "":
+		return []lintProblem{{"lang", "CoSWID does not declare its language"}}
+	}
+
+	return nil
+}
+
+func lintMissingProfile(e endorsement, ctx *lintContext) []lintProblem {
+	if e.Corim != nil && e.Corim.Profile == nil {
+		return []lintProblem{{"profile", "CoRIM does not declare a profile"}}
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/swid"
+)
+
+func lintTestComid(t *testing.T) *comid.Comid {
+	data, err := os.ReadFile("../data/comid/comid-psa-refval.cbor")
+	require.NoError(t, err)
+
+	var c comid.Comid
+	require.NoError(t, c.FromCBOR(data))
+
+	return &c
+}
+
+func Test_lintWeakDigest(t *testing.T) {
+	c := lintTestComid(t)
+
+	m := &c.Triples.ReferenceValues.Values[0].Measurements.Values[1]
+	m.Val.Digests = &comid.Digests{
+		swid.HashEntry{HashAlgID: swid.Sha256_32, HashValue: []byte{0xde, 0xad, 0xbe, 0xef}},
+		swid.HashEntry{HashAlgID: swid.Sha3_224, HashValue: make([]byte, 28)},
+		swid.HashEntry{HashAlgID: swid.Sha3_256, HashValue: make([]byte, 32)},
+	}
+
+	problems := lintWeakDigest(endorsement{Comid: c}, newLintContext(time.Now(), 5))
+	require.Len(t, problems, 2)
+	assert.Equal(t, "triples.reference-values[0].measurements[1].value.digests[0]", problems[0].path)
+	assert.Equal(t, "weak hash algorithm sha-256-32", problems[0].message)
+	assert.Equal(t, "weak hash algorithm sha3-224", problems[1].message)
+}
+
+func Test_lintMissingLang(t *testing.T) {
+	c := lintTestComid(t)
+
+	assert.Empty(t, lintMissingLang(endorsement{Comid: c}, nil))
+
+	c.Language = nil
+	assert.Equal(t,
+		[]lintProblem{{"lang", "CoMID does not declare its language"}},
+		lintMissingLang(endorsement{Comid: c}, nil),
+	)
+}
+
+func Test_lintEmptyEntity(t *testing.T) {
+	c := lintTestComid(t)
+
+	assert.Empty(t, lintEmptyEntity(endorsement{Comid: c}, nil))
+
+	c.Entities.Values[0].Roles = comid.Roles{}
+	assert.Equal(t,
+		[]lintProblem{{"entities[0]", "entity has no roles"}},
+		lintEmptyEntity(endorsement{Comid: c}, nil),
+	)
+}
+
+func Test_lintDuplicateMeasurement_same_tag(t *testing.T) {
+	c := lintTestComid(t)
+
+	vt := &c.Triples.ReferenceValues.Values[0]
+	vt.Measurements.Values = append(vt.Measurements.Values, vt.Measurements.Values[0])
+
+	problems := lintDuplicateMeasurement(endorsement{File: "c.cbor", Comid: c}, newLintContext(time.Now(), 5))
+	require.Len(t, problems, 1)
+	assert.Equal(t, "triples.reference-values[0].measurements[3]", problems[0].path)
+	assert.Equal(t, "duplicates measurement at c.cbor:triples.reference-values[0].measurements[0]", problems[0].message)
+}
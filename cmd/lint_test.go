@@ -0,0 +1,211 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/corim/corim"
+)
+
+var testLintNow = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// lintTestCorim returns an unsigned CoRIM wrapping the PSA reference values
+// CoMID twice, with no profile and a 10 year validity window that ended
+// before testLintNow
+func lintTestCorim(t *testing.T) []byte {
+	data, err := os.ReadFile("../data/comid/comid-psa-refval.cbor")
+	require.NoError(t, err)
+
+	var c comid.Comid
+	require.NoError(t, c.FromCBOR(data))
+
+	notBefore := time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	u := corim.NewUnsignedCorim().
+		SetID("5c57e8f4-46cd-421b-91c9-08cf93e13cfc").
+		SetRimValidity(notAfter, &notBefore).
+		AddComid(c).
+		AddComid(c)
+	require.NotNil(t, u)
+
+	cbor, err := u.ToCBOR()
+	require.NoError(t, err)
+
+	return cbor
+}
+
+func Test_LintCmd_unknown_argument(t *testing.T) {
+	cmd := NewLintCmd()
+
+	args := []string{"--unknown-argument=val"}
+	cmd.SetArgs(args)
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "unknown flag: --unknown-argument")
+}
+
+func Test_LintCmd_no_files(t *testing.T) {
+	cmd := NewLintCmd()
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no files supplied")
+}
+
+func Test_LintCmd_unknown_format(t *testing.T) {
+	cmd := NewLintCmd()
+
+	args := []string{
+		"--file=ok.cbor",
+		"--format=xml",
+	}
+	cmd.SetArgs(args)
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, `unknown output format "xml" (want text, json or sarif)`)
+}
+
+func Test_LintCmd_unknown_rule(t *testing.T) {
+	cmd := NewLintCmd()
+
+	args := []string{
+		"--file=ok.cbor",
+		"--disable=CL999",
+	}
+	cmd.SetArgs(args)
+
+	fs = afero.NewMemMapFs()
+	err := afero.WriteFile(fs, "ok.cbor", psaCorim(t), 0644)
+	require.NoError(t, err)
+
+	err = cmd.Execute()
+	assert.EqualError(t, err, `unknown lint rule "CL999"`)
+}
+
+func Test_LintCmd_undecodable_file(t *testing.T) {
+	cmd := NewLintCmd()
+
+	args := []string{
+		"--file=bad.cbor",
+	}
+	cmd.SetArgs(args)
+
+	fs = afero.NewMemMapFs()
+	err := afero.WriteFile(fs, "bad.cbor", []byte{0xa0}, 0644)
+	require.NoError(t, err)
+
+	err = cmd.Execute()
+	assert.EqualError(t, err, "1/1 file(s) could not be linted")
+}
+
+func Test_LintCmd_clean(t *testing.T) {
+	cmd := NewLintCmd()
+
+	args := []string{
+		"--file=ok.cbor",
+	}
+	cmd.SetArgs(args)
+
+	fs = afero.NewMemMapFs()
+	err := afero.WriteFile(fs, "ok.cbor", psaCorim(t), 0644)
+	require.NoError(t, err)
+
+	err = cmd.Execute()
+	assert.NoError(t, err)
+}
+
+func Test_LintCmd_findings(t *testing.T) {
+	lintNow = func() time.Time { return testLintNow }
+	defer func() { lintNow = time.Now }()
+
+	for _, format := range []string{"text", "json", "sarif"} {
+		cmd := NewLintCmd()
+
+		args := []string{
+			"--file=lint.cbor",
+			"--format=" + format,
+		}
+		cmd.SetArgs(args)
+
+		fs = afero.NewMemMapFs()
+		err := afero.WriteFile(fs, "lint.cbor", lintTestCorim(t), 0644)
+		require.NoError(t, err)
+
+		// long-validity, expired, missing-profile and the three
+		// measurements of the second CoMID duplicating those of the first
+		err = cmd.Execute()
+		assert.EqualError(t, err, "6 issue(s) found", format)
+	}
+}
+
+func Test_LintCmd_disabled_rules(t *testing.T) {
+	lintNow = func() time.Time { return testLintNow }
+	defer func() { lintNow = time.Now }()
+
+	viper.Set("lint.rules.cl003", false)
+	defer viper.Set("lint.rules.cl003", true)
+
+	cmd := NewLintCmd()
+
+	args := []string{
+		"--file=lint.cbor",
+		"--disable=CL007",
+		"--max-validity-years=10",
+	}
+	cmd.SetArgs(args)
+
+	fs = afero.NewMemMapFs()
+	err := afero.WriteFile(fs, "lint.cbor", lintTestCorim(t), 0644)
+	require.NoError(t, err)
+
+	// only expired is left
+	err = cmd.Execute()
+	assert.EqualError(t, err, "1 issue(s) found")
+}
+
+func Test_enabledLintRules(t *testing.T) {
+	for _, id := range []string{"CL006", "cl006", "missing-lang"} {
+		rules, err := enabledLintRules([]string{id})
+		require.NoError(t, err)
+		require.Len(t, rules, len(lintRules)-1, id)
+
+		for _, r := range rules {
+			assert.NotEqual(t, "CL006", r.ID, id)
+		}
+	}
+}
+
+func Test_newSarifLog(t *testing.T) {
+	findings := []lintFinding{
+		{
+			Rule:    "CL007",
+			Name:    "missing-profile",
+			File:    "corim.cbor",
+			Path:    "profile",
+			Message: "CoRIM does not declare a profile",
+		},
+	}
+
+	l := newSarifLog(findings, lintRules)
+
+	assert.Equal(t, "2.1.0", l.Version)
+	require.Len(t, l.Runs, 1)
+	assert.Len(t, l.Runs[0].Tool.Driver.Rules, len(lintRules))
+	require.Len(t, l.Runs[0].Results, 1)
+
+	r := l.Runs[0].Results[0]
+	assert.Equal(t, "CL007", r.RuleID)
+	assert.Equal(t, 6, r.RuleIndex)
+	assert.Equal(t, "warning", r.Level)
+	assert.Equal(t, "corim.cbor", r.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Equal(t, "profile", r.Locations[0].LogicalLocations[0].FullyQualifiedName)
+}
@@ -0,0 +1,407 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	cbor "github.com/fxamacker/cbor/v2"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/swid"
+)
+
+// comidProfile describes the semantic rules a profile places on the CoMIDs it
+// governs, on top of the structural checks carried out by comid.Comid.Valid().
+// The check function receives both the decoded CoMID and its raw CBOR, since
+// some constraints (e.g., the size of fixed-length identifiers) are lost in
+// decoding.
+type comidProfile struct {
+	name  string
+	ids   []string
+	check func(c *comid.Comid, data []byte) []string
+}
+
+var comidProfiles = []comidProfile{
+	{
+		name:  "psa",
+		ids:   []string{"http://arm.com/psa/iot/1", "tag:arm.com,2023:psa#1.0.0"},
+		check: checkPSAComid,
+	},
+	{
+		name:  "cca",
+		ids:   []string{"http://arm.com/cca/ssd/1", "tag:arm.com,2023:cca_platform#1.0.0"},
+		check: checkCCAComid,
+	},
+	{
+		name:  "cca-realm",
+		ids:   []string{"http://arm.com/cca/realm/1", "tag:arm.com,2023:realm#1.0.0"},
+		check: checkCCARealmComid,
+	},
+	{
+		name:  "dice",
+		check: checkDICEComid,
+	},
+}
+
+// lookupComidProfile returns the profile matching the supplied short name
+// (e.g., "psa") or profile identifier (e.g., "http://arm.com/psa/iot/1").
+func lookupComidProfile(s string) (*comidProfile, error) {
+	var names []string
+
+	for i, p := range comidProfiles {
+		if p.name == s {
+			return &comidProfiles[i], nil
+		}
+
+		for _, id := range p.ids {
+			if id == s {
+				return &comidProfiles[i], nil
+			}
+		}
+
+		names = append(names, p.name)
+	}
+
+	return nil, fmt.Errorf(
+		"unknown profile %q (supported: %s, or one of their identifiers)",
+		s, strings.Join(names, ", "),
+	)
+}
+
+// checkComidProfile applies the profile rules to the supplied CoMID and
+// returns an error listing every violation found.
+func checkComidProfile(p *comidProfile, c *comid.Comid, data []byte) error {
+	problems := p.check(c, data)
+	if len(problems) != 0 {
+		return fmt.Errorf("%s profile violation(s): %s", p.name, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func checkPSAComid(c *comid.Comid, data []byte) []string {
+	return checkArmComid(c, data, false)
+}
+
+func checkCCAComid(c *comid.Comid, data []byte) []string {
+	return checkArmComid(c, data, true)
+}
+
+// checkArmComid implements the rules shared by the PSA and CCA platform
+// profiles.  The CCA platform profile additionally allows
+// cca.platform-config-id measurements.
+func checkArmComid(c *comid.Comid, data []byte, cca bool) []string {
+	problems := checkImplIDSize(data)
+
+	if c.Triples.EndorsedValues != nil && !c.Triples.EndorsedValues.IsEmpty() {
+		problems = append(problems, "endorsed-values: not allowed by the profile")
+	}
+
+	if c.Triples.ReferenceValues != nil {
+		for i, rv := range c.Triples.ReferenceValues.Values {
+			path := fmt.Sprintf("reference-values[%d]", i)
+
+			problems = append(problems, checkImplIDClass(rv.Environment, path)...)
+
+			for j, m := range rv.Measurements.Values {
+				mpath := fmt.Sprintf("%s.measurements[%d]", path, j)
+
+				if m.Key == nil || !m.Key.IsSet() {
+					problems = append(problems, mpath+": missing measurement key")
+					continue
+				}
+
+				switch m.Key.Type() {
+				case comid.PSARefValIDType:
+					problems = append(problems, checkPSASwComponent(m, mpath)...)
+				case comid.CCAPlatformConfigIDType:
+					if !cca {
+						problems = append(problems, fmt.Sprintf(
+							"%s: measurement key type %q is only allowed by the CCA profile",
+							mpath, m.Key.Type(),
+						))
+					} else if m.Val.RawValue == nil {
+						problems = append(problems, mpath+": missing platform configuration raw-value")
+					}
+				default:
+					problems = append(problems, fmt.Sprintf(
+						"%s: unexpected measurement key type %q", mpath, m.Key.Type(),
+					))
+				}
+			}
+		}
+	}
+
+	if c.Triples.AttestVerifKeys != nil {
+		for i, ak := range *c.Triples.AttestVerifKeys {
+			path := fmt.Sprintf("attester-verification-keys[%d]", i)
+
+			problems = append(problems, checkImplIDClass(ak.Environment, path)...)
+
+			if ak.Environment.Instance == nil || ak.Environment.Instance.Type() != comid.UEIDType {
+				problems = append(problems, path+": environment instance must be a ueid")
+			}
+
+			for j, k := range ak.VerifKeys {
+				if k.Type() != comid.PKIXBase64KeyType {
+					problems = append(problems, fmt.Sprintf(
+						"%s.verification-keys[%d]: key type must be %q, got %q",
+						path, j, comid.PKIXBase64KeyType, k.Type(),
+					))
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+func checkImplIDClass(env comid.Environment, path string) []string {
+	if env.Class == nil || env.Class.ClassID == nil || !env.Class.ClassID.IsSet() {
+		return []string{path + ": environment class id must be a " + comid.ImplIDType}
+	}
+
+	if t := env.Class.ClassID.Type(); t != comid.ImplIDType {
+		return []string{fmt.Sprintf(
+			"%s: environment class id must be a %s, got %q", path, comid.ImplIDType, t,
+		)}
+	}
+
+	return nil
+}
+
+func checkPSASwComponent(m comid.Measurement, path string) []string {
+	var problems []string
+
+	refValID, err := m.Key.GetPSARefValID()
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", path, err)}
+	}
+
+	if m.Val.Digests == nil || len(*m.Val.Digests) == 0 {
+		return append(problems, path+": missing digests")
+	}
+
+	for k, d := range *m.Val.Digests {
+		if !isStrongHashAlg(d.HashAlgID) {
+			problems = append(problems, fmt.Sprintf(
+				"%s.value.digests[%d]: hash algorithm %s not allowed by the profile",
+				path, k, hashAlgName(d.HashAlgID),
+			))
+		}
+	}
+
+	switch got := len(refValID.SignerID); got {
+	case 32, 48, 64:
+	default:
+		problems = append(problems, fmt.Sprintf(
+			"%s: signer-id is %d bytes, want 32, 48 or 64", path, got,
+		))
+	}
+
+	return problems
+}
+
+// checkCCARealmComid implements the rules of the CCA realm profile: realm
+// reference values are identified by a UUID class and a RIM instance, and
+// consist of the RIM and REM integrity registers only.
+func checkCCARealmComid(c *comid.Comid, data []byte) []string {
+	var problems []string
+
+	if c.Triples.ReferenceValues == nil || c.Triples.ReferenceValues.IsEmpty() {
+		return []string{"reference-values: missing"}
+	}
+
+	for i, rv := range c.Triples.ReferenceValues.Values {
+		path := fmt.Sprintf("reference-values[%d]", i)
+		env := rv.Environment
+
+		if env.Class == nil || env.Class.ClassID == nil || env.Class.ClassID.Type() != comid.UUIDType {
+			problems = append(problems, path+": environment class id must be a uuid")
+		}
+
+		if env.Instance == nil || env.Instance.Type() != comid.BytesType {
+			problems = append(problems, path+": environment instance must be the RIM (bytes)")
+		} else if n := len(env.Instance.Bytes()); n != 32 && n != 48 && n != 64 {
+			problems = append(problems, fmt.Sprintf(
+				"%s: RIM instance is %d bytes, want 32, 48 or 64", path, n,
+			))
+		}
+
+		for j, m := range rv.Measurements.Values {
+			mpath := fmt.Sprintf("%s.measurements[%d]", path, j)
+
+			if m.Val.IntegrityRegisters == nil {
+				problems = append(problems, mpath+": missing integrity-registers")
+				continue
+			}
+
+			if _, ok := m.Val.IntegrityRegisters.IndexMap["rim"]; !ok {
+				problems = append(problems, mpath+": missing rim integrity register")
+			}
+
+			var alg uint64
+			for _, idx := range sortedRegisterIndices(m.Val.IntegrityRegisters) {
+				digests := m.Val.IntegrityRegisters.IndexMap[idx]
+				name, ok := idx.(string)
+				if !ok || !isRealmRegister(name) {
+					problems = append(problems, fmt.Sprintf(
+						"%s: unexpected integrity register %v (want rim, rem0..rem3)", mpath, idx,
+					))
+					continue
+				}
+
+				for _, d := range digests {
+					if !isStrongHashAlg(d.HashAlgID) {
+						problems = append(problems, fmt.Sprintf(
+							"%s.%s: hash algorithm %s not allowed by the profile",
+							mpath, name, hashAlgName(d.HashAlgID),
+						))
+					} else if alg == 0 {
+						alg = d.HashAlgID
+					} else if alg != d.HashAlgID {
+						problems = append(problems, fmt.Sprintf(
+							"%s.%s: hash algorithm %s differs from %s used by other registers",
+							mpath, name, hashAlgName(d.HashAlgID), hashAlgName(alg),
+						))
+					}
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+func isRealmRegister(name string) bool {
+	switch name {
+	case "rim", "rem0", "rem1", "rem2", "rem3":
+		return true
+	}
+	return false
+}
+
+// checkDICEComid implements the DICE rules: each environment describes a
+// layer of the DICE chain, whose measurements carry digests and are not
+// keyed by Arm-specific measurement types.
+func checkDICEComid(c *comid.Comid, data []byte) []string {
+	var problems []string
+
+	for _, vts := range []struct {
+		name    string
+		triples *comid.ValueTriples
+	}{
+		{"reference-values", c.Triples.ReferenceValues},
+		{"endorsed-values", c.Triples.EndorsedValues},
+	} {
+		if vts.triples == nil {
+			continue
+		}
+
+		for i, vt := range vts.triples.Values {
+			path := fmt.Sprintf("%s[%d]", vts.name, i)
+			env := vt.Environment
+
+			if env.Class == nil {
+				problems = append(problems, path+": missing environment class")
+			} else {
+				if env.Class.ClassID == nil || !env.Class.ClassID.IsSet() {
+					problems = append(problems, path+": missing environment class id")
+				} else if t := env.Class.ClassID.Type(); t != comid.UUIDType && t != comid.OIDType {
+					problems = append(problems, fmt.Sprintf(
+						"%s: environment class id must be a uuid or oid, got %q", path, t,
+					))
+				}
+
+				if env.Class.Layer == nil {
+					problems = append(problems, path+": missing environment class layer")
+				}
+			}
+
+			for j, m := range vt.Measurements.Values {
+				mpath := fmt.Sprintf("%s.measurements[%d]", path, j)
+
+				if m.Key != nil && m.Key.IsSet() {
+					switch m.Key.Type() {
+					case comid.UintType, comid.UUIDType, comid.OIDType:
+					default:
+						problems = append(problems, fmt.Sprintf(
+							"%s: unexpected measurement key type %q", mpath, m.Key.Type(),
+						))
+					}
+				}
+
+				if vts.name == "reference-values" && (m.Val.Digests == nil || len(*m.Val.Digests) == 0) {
+					problems = append(problems, mpath+": missing digests")
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+// checkImplIDSize scans the raw CBOR for tagged PSA implementation IDs (tag
+// 600) and reports those that are not exactly 32 bytes.  The decoder silently
+// pads or truncates them to fit comid.ImplID.
+func checkImplIDSize(data []byte) []string {
+	var (
+		v        interface{}
+		problems []string
+	)
+
+	if err := cbor.Unmarshal(data, &v); err != nil {
+		return []string{fmt.Sprintf("raw CBOR decoding failed: %v", err)}
+	}
+
+	walkCBORTags(v, func(t cbor.Tag) {
+		if t.Number != 600 {
+			return
+		}
+
+		b, ok := t.Content.([]byte)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s is not a byte string", comid.ImplIDType))
+		} else if len(b) != 32 {
+			problems = append(problems, fmt.Sprintf(
+				"%s %x is %d bytes, want 32", comid.ImplIDType, b, len(b),
+			))
+		}
+	})
+
+	return problems
+}
+
+func walkCBORTags(v interface{}, visit func(cbor.Tag)) {
+	switch t := v.(type) {
+	case cbor.Tag:
+		visit(t)
+		walkCBORTags(t.Content, visit)
+	case []interface{}:
+		for _, e := range t {
+			walkCBORTags(e, visit)
+		}
+	case map[interface{}]interface{}:
+		for k, e := range t {
+			walkCBORTags(k, visit)
+			walkCBORTags(e, visit)
+		}
+	}
+}
+
+// isStrongHashAlg tells whether the hash algorithm is one of the SHA-2 and SHA-3
+// algorithms of at least 256 bits.  It is shared by the profile checks and the
+// weak-digest lint rule, so that both agree.
+func isStrongHashAlg(algID uint64) bool {
+	switch algID {
+	case swid.Sha256, swid.Sha384, swid.Sha512, swid.Sha3_256, swid.Sha3_384, swid.Sha3_512:
+		return true
+	}
+	return false
+}
+
+func hashAlgName(algID uint64) string {
+	he := swid.HashEntry{HashAlgID: algID}
+	return strings.TrimSuffix(he.String(), ";<empty>")
+}
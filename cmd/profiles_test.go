@@ -0,0 +1,106 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/swid"
+)
+
+func Test_lookupComidProfile(t *testing.T) {
+	p, err := lookupComidProfile("psa")
+	require.NoError(t, err)
+	assert.Equal(t, "psa", p.name)
+
+	p, err = lookupComidProfile("http://arm.com/cca/realm/1")
+	require.NoError(t, err)
+	assert.Equal(t, "cca-realm", p.name)
+
+	p, err = lookupComidProfile("dice")
+	require.NoError(t, err)
+	assert.Equal(t, "dice", p.name)
+
+	_, err = lookupComidProfile("http://example.com/unknown")
+	assert.Error(t, err)
+}
+
+func Test_checkComidProfile_psa_ok(t *testing.T) {
+	data, err := os.ReadFile("../data/comid/comid-psa-refval.cbor")
+	require.NoError(t, err)
+
+	var c comid.Comid
+	require.NoError(t, c.FromCBOR(data))
+
+	p, err := lookupComidProfile("psa")
+	require.NoError(t, err)
+
+	assert.NoError(t, checkComidProfile(p, &c, data))
+}
+
+func Test_checkComidProfile_psa_short_impl_id(t *testing.T) {
+	// rewrite the (tagged, 32 bytes) implementation ID as a 31 bytes one,
+	// which the CoMID decoder silently zero-pads
+	orig, err := os.ReadFile("../data/comid/comid-psa-refval.cbor")
+	require.NoError(t, err)
+
+	hdr := []byte{0xd9, 0x02, 0x58, 0x58, 0x20}
+	i := bytes.Index(orig, hdr)
+	require.NotEqual(t, -1, i)
+
+	data := append([]byte{}, orig[:i]...)
+	data = append(data, 0xd9, 0x02, 0x58, 0x58, 0x1f)
+	data = append(data, orig[i+len(hdr)+1:]...)
+
+	var c comid.Comid
+	require.NoError(t, c.FromCBOR(data))
+	require.NoError(t, c.Valid())
+
+	p, err := lookupComidProfile("psa")
+	require.NoError(t, err)
+
+	err = checkComidProfile(p, &c, data)
+	assert.ErrorContains(t, err, "is 31 bytes, want 32")
+}
+
+func Test_checkPSASwComponent_signer_id(t *testing.T) {
+	digest := bytes.Repeat([]byte{0x01}, 32)
+
+	for size, expected := range map[int]string{
+		32: "",
+		48: "",
+		64: "",
+		20: "m: signer-id is 20 bytes, want 32, 48 or 64",
+	} {
+		// set the key directly, as the constructor rejects bad sizes
+		m := comid.MustNewPSAMeasurement(comid.PSARefValID{
+			SignerID: bytes.Repeat([]byte{0x02}, 32),
+		}).AddDigest(swid.Sha256, digest)
+		m.Key.Value = comid.TaggedPSARefValID{SignerID: bytes.Repeat([]byte{0x02}, size)}
+
+		problems := checkPSASwComponent(*m, "m")
+		if expected == "" {
+			assert.Empty(t, problems, size)
+		} else {
+			assert.Equal(t, []string{expected}, problems, size)
+		}
+	}
+}
+
+func Test_checkComidProfile_realm_rejects_psa(t *testing.T) {
+	var c comid.Comid
+	require.NoError(t, c.FromCBOR(PSARefValCBOR))
+
+	p, err := lookupComidProfile("cca-realm")
+	require.NoError(t, err)
+
+	err = checkComidProfile(p, &c, PSARefValCBOR)
+	assert.ErrorContains(t, err, "environment class id must be a uuid")
+	assert.ErrorContains(t, err, "missing integrity-registers")
+}
@@ -0,0 +1,264 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/afero"
+)
+
+// RMM constants used to compute the realm initial measurement
+const (
+	realmGranuleSize = 4096
+
+	realmDescTypeData  = 0x0
+	realmDescTypeRec   = 0x1
+	realmDescTypeRipas = 0x2
+	realmDescSize      = 0x100
+
+	// RMI_MEASURE_CONTENT
+	realmDataMeasureContent = 0x1
+	// RMI_RUNNABLE
+	realmRecRunnable = 0x1
+)
+
+// realmHashAlgs maps the hash algorithms the RMM can measure a realm with
+// onto their RMI encoding
+var realmHashAlgs = map[string]uint8{
+	"sha-256": 0,
+	"sha-512": 1,
+}
+
+// launchUint is an unsigned integer that can be given in JSON either as a
+// number or as a string (e.g., "0x80000000")
+type launchUint uint64
+
+func (o *launchUint) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var u uint64
+		if err := json.Unmarshal(data, &u); err != nil {
+			return fmt.Errorf("want an unsigned integer or a string, got %s", data)
+		}
+		*o = launchUint(u)
+		return nil
+	}
+
+	u, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return fmt.Errorf("invalid unsigned integer %q", s)
+	}
+	*o = launchUint(u)
+
+	return nil
+}
+
+// realmParams holds the measured fields of RmiRealmParams
+type realmParams struct {
+	Flags      launchUint `json:"flags"`
+	S2SZ       uint8      `json:"s2sz"`
+	SVEVL      uint8      `json:"sve-vl"`
+	NumBPs     uint8      `json:"num-bps"`
+	NumWPs     uint8      `json:"num-wps"`
+	PMUNumCtrs uint8      `json:"pmu-num-ctrs"`
+}
+
+// realmData is a RMI_DATA_CREATE of the content of a file, one granule at a
+// time, starting at IPA
+type realmData struct {
+	File       string     `json:"file"`
+	IPA        launchUint `json:"ipa"`
+	Unmeasured bool       `json:"unmeasured,omitempty"`
+}
+
+// realmRec is a RMI_REC_CREATE with the measured fields of RmiRecParams
+type realmRec struct {
+	PC       launchUint   `json:"pc"`
+	GPRs     []launchUint `json:"gprs,omitempty"`
+	Runnable bool         `json:"runnable"`
+}
+
+// realmRipas is a RMI_RIPAS_INIT of the [Base, Top) IPA range
+type realmRipas struct {
+	Base launchUint `json:"base"`
+	Top  launchUint `json:"top"`
+}
+
+// realmLaunchStep is one of the measured RMI commands issued by the host
+// while setting up the realm
+type realmLaunchStep struct {
+	Data  *realmData  `json:"data,omitempty"`
+	Rec   *realmRec   `json:"rec,omitempty"`
+	Ripas *realmRipas `json:"ripas,omitempty"`
+}
+
+// realmLaunchDescription is the format of the file supplied with
+// --launch-description.  Steps are measured in order, file paths are
+// relative to the directory containing the description.
+type realmLaunchDescription struct {
+	Realm realmParams       `json:"realm"`
+	Steps []realmLaunchStep `json:"steps"`
+
+	dir string
+}
+
+func loadRealmLaunchDescription(file string) (*realmLaunchDescription, error) {
+	data, err := afero.ReadFile(fs, file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading realm launch description from %s: %w", file, err)
+	}
+
+	var d realmLaunchDescription
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("error decoding realm launch description from %s: %w", file, err)
+	}
+
+	d.dir = filepath.Dir(file)
+
+	return &d, nil
+}
+
+// realmMeasurer computes the RIM the way the RMM does: the hash of the
+// measured realm parameters, then, for each measured RMI command, the hash of
+// its measurement descriptor, which embeds the current RIM
+type realmMeasurer struct {
+	newHash func() hash.Hash
+	rim     []byte
+}
+
+func (o *realmMeasurer) digest(data []byte) []byte {
+	h := o.newHash()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// descriptor returns a measurement descriptor of the supplied type with the
+// current RIM, zero-padded to 64 bytes, at offset 0x10
+func (o *realmMeasurer) descriptor(typ byte) []byte {
+	desc := make([]byte, realmDescSize)
+	desc[0] = typ
+	binary.LittleEndian.PutUint64(desc[0x8:], realmDescSize)
+	copy(desc[0x10:0x50], o.rim)
+	return desc
+}
+
+func (o *realmMeasurer) params(p realmParams, algo uint8) {
+	params := make([]byte, realmGranuleSize)
+	binary.LittleEndian.PutUint64(params[0x0:], uint64(p.Flags))
+	params[0x8] = p.S2SZ
+	params[0x10] = p.SVEVL
+	params[0x18] = p.NumBPs
+	params[0x20] = p.NumWPs
+	params[0x28] = p.PMUNumCtrs
+	params[0x30] = algo
+
+	o.rim = o.digest(params)
+}
+
+func (o *realmMeasurer) data(ipa uint64, content []byte, measured bool) {
+	desc := o.descriptor(realmDescTypeData)
+	binary.LittleEndian.PutUint64(desc[0x50:], ipa)
+	if measured {
+		binary.LittleEndian.PutUint64(desc[0x58:], realmDataMeasureContent)
+		copy(desc[0x60:], o.digest(content))
+	}
+
+	o.rim = o.digest(desc)
+}
+
+func (o *realmMeasurer) rec(r realmRec) error {
+	if len(r.GPRs) > 8 {
+		return fmt.Errorf("%d GPRs, want at most 8", len(r.GPRs))
+	}
+
+	params := make([]byte, realmGranuleSize)
+	if r.Runnable {
+		binary.LittleEndian.PutUint64(params[0x0:], realmRecRunnable)
+	}
+	binary.LittleEndian.PutUint64(params[0x200:], uint64(r.PC))
+	for i, gpr := range r.GPRs {
+		binary.LittleEndian.PutUint64(params[0x300+8*i:], uint64(gpr))
+	}
+
+	desc := o.descriptor(realmDescTypeRec)
+	copy(desc[0x50:], o.digest(params))
+
+	o.rim = o.digest(desc)
+
+	return nil
+}
+
+func (o *realmMeasurer) ripas(base, top uint64) {
+	desc := o.descriptor(realmDescTypeRipas)
+	binary.LittleEndian.PutUint64(desc[0x50:], base)
+	binary.LittleEndian.PutUint64(desc[0x58:], top)
+
+	o.rim = o.digest(desc)
+}
+
+// computeRIM replays the measurements of the launch description using the
+// supplied hash algorithm and returns the resulting RIM
+func (o realmLaunchDescription) computeRIM(alg string) ([]byte, error) {
+	algo, ok := realmHashAlgs[alg]
+	if !ok {
+		return nil, fmt.Errorf("the RMM cannot measure a realm with %s (want sha-256 or sha-512)", alg)
+	}
+
+	m := realmMeasurer{newHash: refvalDigestAlgs[alg].new}
+	m.params(o.Realm, algo)
+
+	for i, step := range o.Steps {
+		if err := o.measureStep(&m, step); err != nil {
+			return nil, fmt.Errorf("steps[%d]: %w", i, err)
+		}
+	}
+
+	return m.rim, nil
+}
+
+func (o realmLaunchDescription) measureStep(m *realmMeasurer, step realmLaunchStep) error {
+	switch {
+	case step.Data != nil && step.Rec == nil && step.Ripas == nil:
+		ipa := uint64(step.Data.IPA)
+		if ipa%realmGranuleSize != 0 {
+			return fmt.Errorf("data IPA 0x%x is not granule aligned", ipa)
+		}
+
+		file := step.Data.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(o.dir, file)
+		}
+
+		content, err := afero.ReadFile(fs, file)
+		if err != nil {
+			return fmt.Errorf("error loading realm data: %w", err)
+		}
+
+		// the last granule is zero-padded
+		for off := 0; off < len(content); off += realmGranuleSize {
+			granule := make([]byte, realmGranuleSize)
+			copy(granule, content[off:])
+			m.data(ipa+uint64(off), granule, !step.Data.Unmeasured)
+		}
+	case step.Rec != nil && step.Data == nil && step.Ripas == nil:
+		return m.rec(*step.Rec)
+	case step.Ripas != nil && step.Data == nil && step.Rec == nil:
+		base, top := uint64(step.Ripas.Base), uint64(step.Ripas.Top)
+		if base%realmGranuleSize != 0 || top%realmGranuleSize != 0 || top <= base {
+			return fmt.Errorf("invalid RIPAS range [0x%x, 0x%x)", base, top)
+		}
+		m.ripas(base, top)
+	default:
+		return errors.New("want exactly one of data, rec or ripas")
+	}
+
+	return nil
+}
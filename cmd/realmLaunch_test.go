@@ -0,0 +1,112 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_realmLaunchDescription_computeRIM_params_only(t *testing.T) {
+	d := realmLaunchDescription{Realm: realmParams{S2SZ: 40, Flags: 1}}
+
+	rim, err := d.computeRIM("sha-256")
+	require.NoError(t, err)
+
+	params := make([]byte, realmGranuleSize)
+	params[0x0] = 1
+	params[0x8] = 40
+	expected := sha256.Sum256(params)
+
+	assert.Equal(t, expected[:], rim)
+}
+
+func Test_realmLaunchDescription_computeRIM_ripas(t *testing.T) {
+	d := realmLaunchDescription{
+		Steps: []realmLaunchStep{{Ripas: &realmRipas{Base: 0x80000000, Top: 0x80002000}}},
+	}
+
+	rim, err := d.computeRIM("sha-256")
+	require.NoError(t, err)
+
+	initial := sha256.Sum256(make([]byte, realmGranuleSize))
+
+	desc := make([]byte, realmDescSize)
+	desc[0] = realmDescTypeRipas
+	binary.LittleEndian.PutUint64(desc[0x8:], realmDescSize)
+	copy(desc[0x10:], initial[:])
+	binary.LittleEndian.PutUint64(desc[0x50:], 0x80000000)
+	binary.LittleEndian.PutUint64(desc[0x58:], 0x80002000)
+	expected := sha256.Sum256(desc)
+
+	assert.Equal(t, expected[:], rim)
+}
+
+func Test_realmLaunchDescription_computeRIM_data(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "realm/Image", make([]byte, realmGranuleSize+1), 0400))
+
+	measured := realmLaunchDescription{
+		Steps: []realmLaunchStep{{Data: &realmData{File: "Image", IPA: 0x80000000}}},
+		dir:   "realm",
+	}
+
+	rim1, err := measured.computeRIM("sha-512")
+	require.NoError(t, err)
+	assert.Len(t, rim1, 64)
+
+	unmeasured := measured
+	unmeasured.Steps = []realmLaunchStep{{Data: &realmData{File: "Image", IPA: 0x80000000, Unmeasured: true}}}
+
+	rim2, err := unmeasured.computeRIM("sha-512")
+	require.NoError(t, err)
+	assert.NotEqual(t, rim1, rim2)
+}
+
+func Test_realmLaunchDescription_computeRIM_errors(t *testing.T) {
+	d := realmLaunchDescription{}
+
+	_, err := d.computeRIM("sha-384")
+	assert.EqualError(t, err, "the RMM cannot measure a realm with sha-384 (want sha-256 or sha-512)")
+
+	d.Steps = []realmLaunchStep{{}}
+	_, err = d.computeRIM("sha-256")
+	assert.EqualError(t, err, "steps[0]: want exactly one of data, rec or ripas")
+
+	d.Steps = []realmLaunchStep{{Data: &realmData{File: "Image", IPA: 0x1001}}}
+	_, err = d.computeRIM("sha-256")
+	assert.EqualError(t, err, "steps[0]: data IPA 0x1001 is not granule aligned")
+
+	d.Steps = []realmLaunchStep{{Ripas: &realmRipas{Base: 0x2000, Top: 0x1000}}}
+	_, err = d.computeRIM("sha-256")
+	assert.EqualError(t, err, "steps[0]: invalid RIPAS range [0x2000, 0x1000)")
+
+	d.Steps = []realmLaunchStep{{Rec: &realmRec{GPRs: make([]launchUint, 9)}}}
+	_, err = d.computeRIM("sha-256")
+	assert.EqualError(t, err, "steps[0]: 9 GPRs, want at most 8")
+}
+
+func Test_loadRealmLaunchDescription(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "dir/realm.json", []byte(`{
+		"realm": { "s2sz": 40, "flags": "0x2" },
+		"steps": [ { "rec": { "pc": "0x80000000", "gprs": [ 1, "0x10" ], "runnable": true } } ]
+	}`), 0400))
+
+	d, err := loadRealmLaunchDescription("dir/realm.json")
+	require.NoError(t, err)
+
+	assert.Equal(t, "dir", d.dir)
+	assert.Equal(t, launchUint(2), d.Realm.Flags)
+	assert.Equal(t, []launchUint{1, 0x10}, d.Steps[0].Rec.GPRs)
+
+	require.NoError(t, afero.WriteFile(fs, "bad.json", []byte(`{"realm": {"flags": "two"}}`), 0400))
+	_, err = loadRealmLaunchDescription("bad.json")
+	assert.ErrorContains(t, err, `invalid unsigned integer "two"`)
+}
@@ -0,0 +1,239 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+//go:embed schemas/*.json
+var schemasFS embed.FS
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaNames lists the available schemas, each stored in schemas/<name>.json.
+// The definitions in schemas/defs.json are shared among them and are added to
+// each schema on output.
+var schemaNames = []string{"comid", "corim", "meta", "cots-env", "cots-claims"}
+
+// schemaKeysOrder is the order in which the top level keywords are output
+var schemaKeysOrder = []string{
+	"$schema", "title", "description", "type", "properties", "items",
+	"required", "minItems", "minProperties", "additionalProperties",
+}
+
+var schemaRefRe = regexp.MustCompile(`"#/\$defs/([^"]+)"`)
+
+var schemaCmd = NewSchemaCmd()
+
+func NewSchemaCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema <" + strings.Join(schemaNames, "|") + ">",
+		Short: "print the JSON Schema of a cocli template",
+		Long: `print the JSON Schema of a cocli template
+
+	The schemas describe the JSON templates accepted by:
+
+	  comid        cocli comid create --template
+	  corim        cocli corim create --template
+	  meta         cocli corim sign --meta
+	  cots-env     cocli cots create --environment
+	  cots-claims  cocli cots create --permclaims / --exclclaims
+
+	Save the CoMID template schema to comid.schema.json, e.g., for use by an
+	editor.
+
+	  cocli schema comid > comid.schema.json
+	`,
+		ValidArgs: schemaNames,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkSchemaArgs(args); err != nil {
+				return err
+			}
+
+			s, err := buildSchema(args[0])
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(string(s))
+
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func checkSchemaArgs(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no schema name supplied (want one of: %s)", strings.Join(schemaNames, ", "))
+	}
+
+	if len(args) > 1 {
+		return errors.New("too many arguments: only one schema name can be supplied")
+	}
+
+	for _, n := range schemaNames {
+		if args[0] == n {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown schema %q (want one of: %s)", args[0], strings.Join(schemaNames, ", "))
+}
+
+// buildSchema returns the indented JSON Schema with the supplied name,
+// including the shared definitions it refers to
+func buildSchema(name string) ([]byte, error) {
+	var (
+		schema, defs map[string]json.RawMessage
+		localDefs    = make(map[string]json.RawMessage)
+	)
+
+	if err := loadSchemaFile(name, &schema); err != nil {
+		return nil, err
+	}
+
+	if err := loadSchemaFile("defs", &defs); err != nil {
+		return nil, err
+	}
+
+	if raw, ok := schema["$defs"]; ok {
+		if err := json.Unmarshal(raw, &localDefs); err != nil {
+			return nil, fmt.Errorf("error decoding definitions of schema %s: %w", name, err)
+		}
+	}
+
+	// add the shared definitions that are (transitively) referenced
+	pending := []json.RawMessage{}
+	for _, v := range schema {
+		pending = append(pending, v)
+	}
+
+	for len(pending) != 0 {
+		raw := pending[0]
+		pending = pending[1:]
+
+		for _, m := range schemaRefRe.FindAllSubmatch(raw, -1) {
+			ref := string(m[1])
+			if _, ok := localDefs[ref]; ok {
+				continue
+			}
+
+			def, ok := defs[ref]
+			if !ok {
+				return nil, fmt.Errorf("schema %s: unresolved reference to %q", name, ref)
+			}
+
+			localDefs[ref] = def
+			pending = append(pending, def)
+		}
+	}
+
+	schema["$schema"], _ = json.Marshal(jsonSchemaDialect)
+
+	if len(localDefs) != 0 {
+		var names []string
+		for k := range localDefs {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		schema["$defs"] = rawJSONObject(names, localDefs)
+	}
+
+	return marshalSchema(schema)
+}
+
+func loadSchemaFile(name string, v interface{}) error {
+	data, err := schemasFS.ReadFile("schemas/" + name + ".json")
+	if err != nil {
+		return fmt.Errorf("error loading schema %s: %w", name, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error decoding schema %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// marshalSchema encodes the top level keywords of the schema in the
+// conventional order, followed by any other keyword and the definitions
+func marshalSchema(schema map[string]json.RawMessage) ([]byte, error) {
+	var keys []string
+
+	for _, k := range schemaKeysOrder {
+		if _, ok := schema[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+
+	var others []string
+	for k := range schema {
+		if k != "$defs" && indexOf(schemaKeysOrder, k) == -1 {
+			others = append(others, k)
+		}
+	}
+	sort.Strings(others)
+	keys = append(keys, others...)
+
+	if _, ok := schema["$defs"]; ok {
+		keys = append(keys, "$defs")
+	}
+
+	var compact, out bytes.Buffer
+	if err := json.Compact(&compact, rawJSONObject(keys, schema)); err != nil {
+		return nil, fmt.Errorf("error encoding schema: %w", err)
+	}
+
+	if err := json.Indent(&out, compact.Bytes(), "", "  "); err != nil {
+		return nil, fmt.Errorf("error encoding schema: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// rawJSONObject encodes the supplied members as a JSON object with the keys in
+// the given order.  (Unlike json.Marshal, this does not escape HTML characters
+// in the values.)
+func rawJSONObject(keys []string, members map[string]json.RawMessage) json.RawMessage {
+	var b bytes.Buffer
+
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%q:", k)
+		b.Write(members[k])
+	}
+	b.WriteByte('}')
+
+	return b.Bytes()
+}
+
+func indexOf(l []string, s string) int {
+	for i, v := range l {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+}
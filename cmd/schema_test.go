@@ -0,0 +1,282 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SchemaCmd_no_args(t *testing.T) {
+	cmd := NewSchemaCmd()
+	cmd.SetArgs([]string{})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, "no schema name supplied (want one of: comid, corim, meta, cots-env, cots-claims)")
+}
+
+func Test_SchemaCmd_unknown_schema(t *testing.T) {
+	cmd := NewSchemaCmd()
+	cmd.SetArgs([]string{"coswid"})
+
+	err := cmd.Execute()
+	assert.EqualError(t, err, `unknown schema "coswid" (want one of: comid, corim, meta, cots-env, cots-claims)`)
+}
+
+func Test_SchemaCmd_ok(t *testing.T) {
+	for _, name := range schemaNames {
+		cmd := NewSchemaCmd()
+		cmd.SetArgs([]string{name})
+
+		err := cmd.Execute()
+		assert.NoError(t, err, name)
+	}
+}
+
+func Test_buildSchema_refs_resolve(t *testing.T) {
+	for _, name := range schemaNames {
+		s := loadTestSchema(t, name)
+
+		assert.Equal(t, jsonSchemaDialect, s["$schema"], name)
+
+		defs, _ := s["$defs"].(map[string]interface{})
+		raw, err := buildSchema(name)
+		require.NoError(t, err)
+
+		for _, m := range schemaRefRe.FindAllStringSubmatch(string(raw), -1) {
+			assert.Contains(t, defs, m[1], name)
+		}
+	}
+}
+
+// Test_buildSchema_templates checks the templates shipped in the data/
+// directory against the schemas
+func Test_buildSchema_templates(t *testing.T) {
+	for _, tv := range []struct {
+		schema string
+		glob   string
+	}{
+		{"comid", "../data/comid/templates/*.json"},
+		{"corim", "../data/corim/templates/corim-*.json"},
+		{"meta", "../data/corim/templates/meta-*.json"},
+		{"cots-env", "../data/cots/templates/env/*.json"},
+		{"cots-claims", "../data/cots/templates/claims/*.json"},
+	} {
+		s := loadTestSchema(t, tv.schema)
+
+		files, err := filepath.Glob(tv.glob)
+		require.NoError(t, err)
+		require.NotEmpty(t, files, tv.glob)
+
+		for _, f := range files {
+			assert.Empty(t, schemaViolations(t, s, loadTestJSON(t, f)), f)
+		}
+	}
+}
+
+func Test_buildSchema_comid_violations(t *testing.T) {
+	s := loadTestSchema(t, "comid")
+
+	var tmpl interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"tag-identity": { "id": "43BBE37F-2E61-4B33-AED3-53CFF1428B16" },
+		"entities": [ { "name": "ACME", "roles": [ "tagMaker" ] } ],
+		"triples": {
+			"reference-values": [
+				{
+					"environment": { "class": { "id": { "type": "psa.impl-idx", "value": "AA==" } } },
+					"measurements": [ { "value": { "digests": [ "sha-999;AA==" ] } } ]
+				}
+			]
+		}
+	}`), &tmpl))
+
+	assert.Equal(t, []string{
+		`entities[0].roles[0]: "tagMaker" not in enum`,
+		`triples.reference-values[0].environment.class.id: matches 0 of the oneOf alternatives`,
+		`triples.reference-values[0].measurements[0].value.digests[0]: "sha-999;AA==" does not match pattern`,
+	}, schemaViolations(t, s, tmpl))
+}
+
+func loadTestSchema(t *testing.T, name string) map[string]interface{} {
+	raw, err := buildSchema(name)
+	require.NoError(t, err)
+
+	var s map[string]interface{}
+	require.NoError(t, json.Unmarshal(raw, &s))
+
+	return s
+}
+
+func loadTestJSON(t *testing.T, file string) interface{} {
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+
+	var v interface{}
+	require.NoError(t, json.Unmarshal(data, &v))
+
+	return v
+}
+
+// schemaViolations is a minimal JSON Schema validator, supporting only the
+// keywords used by the cocli schemas
+func schemaViolations(t *testing.T, root map[string]interface{}, v interface{}) []string {
+	var check func(s map[string]interface{}, v interface{}, path string) []string
+
+	check = func(s map[string]interface{}, v interface{}, path string) []string {
+		var errs []string
+		fail := func(format string, a ...interface{}) {
+			errs = append(errs, path+": "+fmt.Sprintf(format, a...))
+		}
+
+		if ref, ok := s["$ref"].(string); ok {
+			name := strings.TrimPrefix(ref, "#/$defs/")
+			def, ok := root["$defs"].(map[string]interface{})[name].(map[string]interface{})
+			require.True(t, ok, ref)
+			errs = append(errs, check(def, v, path)...)
+		}
+
+		if typ, ok := s["type"]; ok {
+			types := []interface{}{typ}
+			if l, ok := typ.([]interface{}); ok {
+				types = l
+			}
+
+			match := false
+			for _, typ := range types {
+				switch typ {
+				case "object":
+					_, match = v.(map[string]interface{})
+				case "array":
+					_, match = v.([]interface{})
+				case "string":
+					_, match = v.(string)
+				case "boolean":
+					_, match = v.(bool)
+				case "number":
+					_, match = v.(float64)
+				case "integer":
+					f, ok := v.(float64)
+					match = ok && f == float64(int64(f))
+				}
+				if match {
+					break
+				}
+			}
+			if !match {
+				fail("not of type %v", typ)
+				return errs
+			}
+		}
+
+		if c, ok := s["const"]; ok && c != v {
+			fail("%v is not %v", v, c)
+		}
+
+		if enum, ok := s["enum"].([]interface{}); ok {
+			found := false
+			for _, e := range enum {
+				if e == v {
+					found = true
+				}
+			}
+			if !found {
+				fail("%q not in enum", v)
+			}
+		}
+
+		if p, ok := s["pattern"].(string); ok {
+			if !regexp.MustCompile(p).MatchString(v.(string)) {
+				fail("%q does not match pattern", v)
+			}
+		}
+
+		if min, ok := s["minLength"].(float64); ok && len(v.(string)) < int(min) {
+			fail("too short")
+		}
+
+		if min, ok := s["minimum"].(float64); ok && v.(float64) < min {
+			fail("less than %v", min)
+		}
+
+		if l, ok := v.([]interface{}); ok {
+			if min, ok := s["minItems"].(float64); ok && len(l) < int(min) {
+				fail("too few items")
+			}
+			if items, ok := s["items"].(map[string]interface{}); ok {
+				for i, e := range l {
+					errs = append(errs, check(items, e, fmt.Sprintf("%s[%d]", path, i))...)
+				}
+			}
+		}
+
+		if o, ok := v.(map[string]interface{}); ok {
+			props, _ := s["properties"].(map[string]interface{})
+
+			if min, ok := s["minProperties"].(float64); ok && len(o) < int(min) {
+				fail("too few properties")
+			}
+
+			if req, ok := s["required"].([]interface{}); ok {
+				for _, r := range req {
+					if _, ok := o[r.(string)]; !ok {
+						fail("missing %q", r)
+					}
+				}
+			}
+
+			for k, e := range o {
+				childPath := k
+				if path != "" {
+					childPath = path + "." + k
+				}
+
+				if ps, ok := props[k].(map[string]interface{}); ok {
+					errs = append(errs, check(ps, e, childPath)...)
+					continue
+				}
+
+				switch ap := s["additionalProperties"].(type) {
+				case bool:
+					if !ap {
+						fail("unexpected property %q", k)
+					}
+				case map[string]interface{}:
+					errs = append(errs, check(ap, e, childPath)...)
+				}
+			}
+		}
+
+		if alts, ok := s["oneOf"].([]interface{}); ok {
+			n := 0
+			for _, a := range alts {
+				if len(check(a.(map[string]interface{}), v, path)) == 0 {
+					n++
+				}
+			}
+			if n != 1 {
+				fail("matches %d of the oneOf alternatives", n)
+			}
+		}
+
+		return errs
+	}
+
+	errs := check(root, v, "")
+
+	// sort for stable comparisons, as object members are visited in random
+	// order
+	sort.Strings(errs)
+
+	return errs
+}
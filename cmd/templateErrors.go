@@ -0,0 +1,297 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/corim/corim"
+	"github.com/veraison/swid"
+)
+
+// templateProblem is an error found at a specific location in a JSON template
+type templateProblem struct {
+	Line   int
+	Column int
+	// Path is the JSON path of the offending element (e.g.,
+	// "triples.reference-values[3].measurements[0]"), empty for the
+	// document itself
+	Path string
+	Err  error
+}
+
+func (o templateProblem) Error() string {
+	loc := fmt.Sprintf("%d:%d", o.Line, o.Column)
+	if o.Path == "" {
+		return fmt.Sprintf("%s: %v", loc, o.Err)
+	}
+	return fmt.Sprintf("%s: %s: %v", loc, o.Path, o.Err)
+}
+
+// templateProblems collects all the problems found in a JSON template
+type templateProblems []templateProblem
+
+func (o templateProblems) Error() string {
+	if len(o) == 1 {
+		return o[0].Error()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d problems found", len(o))
+	for _, p := range o {
+		b.WriteString("\n\t")
+		b.WriteString(p.Error())
+	}
+	return b.String()
+}
+
+// templateProbe decodes a JSON element in isolation
+type templateProbe func(data []byte) error
+
+func probeAs[T any]() templateProbe {
+	return func(data []byte) error {
+		var v T
+		return json.Unmarshal(data, &v)
+	}
+}
+
+// comidTemplateProbes maps the (index-less) JSON paths of the elements of a
+// CoMID template to the decoder used to check them
+var comidTemplateProbes = func() map[string]templateProbe {
+	m := map[string]templateProbe{
+		"tag-identity":     probeAs[comid.TagIdentity](),
+		"entities[]":       probeAs[comid.Entity](),
+		"entities[].roles": probeAs[comid.Roles](),
+		"linked-tags[]":    probeAs[comid.LinkedTag](),
+	}
+
+	environment := func(prefix string) {
+		m[prefix+".environment"] = probeAs[comid.Environment]()
+		m[prefix+".environment.class"] = probeAs[comid.Class]()
+		m[prefix+".environment.class.id"] = probeAs[comid.ClassID]()
+		m[prefix+".environment.instance"] = probeAs[comid.Instance]()
+		m[prefix+".environment.group"] = probeAs[comid.Group]()
+	}
+
+	for _, vts := range []string{"reference-values", "endorsed-values"} {
+		prefix := "triples." + vts + "[]"
+		environment(prefix)
+		m[prefix+".measurements[]"] = probeAs[comid.Measurement]()
+		m[prefix+".measurements[].key"] = probeAs[comid.Mkey]()
+		m[prefix+".measurements[].value"] = probeAs[comid.Mval]()
+		m[prefix+".measurements[].value.digests[]"] = probeAs[swid.HashEntry]()
+		m[prefix+".measurements[].value.integrity-registers"] = probeAs[comid.IntegrityRegisters]()
+	}
+
+	for _, kts := range []string{"attester-verification-keys", "dev-identity-keys"} {
+		prefix := "triples." + kts + "[]"
+		environment(prefix)
+		m[prefix+".verification-keys[]"] = probeAs[comid.CryptoKey]()
+	}
+
+	return m
+}()
+
+// corimTemplateProbes is the same as comidTemplateProbes for CoRIM templates
+var corimTemplateProbes = map[string]templateProbe{
+	"entities[]":       probeAs[corim.Entity](),
+	"entities[].roles": probeAs[corim.Roles](),
+	"dependent-rims[]": probeAs[corim.Locator](),
+	"validity":         probeAs[corim.Validity](),
+}
+
+// jsonNode is an element of a JSON document, with its position and the JSON
+// path leading to it
+type jsonNode struct {
+	path       string
+	start, end int64
+	children   []*jsonNode
+}
+
+var jsonPathIndexRe = regexp.MustCompile(`\[\d+\]`)
+
+// pattern returns the node path without array indices
+func (o jsonNode) pattern() string {
+	return jsonPathIndexRe.ReplaceAllString(o.path, "[]")
+}
+
+// find returns the node with the supplied path, or nil
+func (o *jsonNode) find(path string) *jsonNode {
+	if o.path == path {
+		return o
+	}
+
+	for _, c := range o.children {
+		if n := c.find(path); n != nil {
+			return n
+		}
+	}
+
+	return nil
+}
+
+// parseJSONNodes builds the tree of elements of the supplied JSON document.
+// Only syntactically valid documents can be parsed.
+func parseJSONNodes(data []byte) (*jsonNode, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	root, err := parseJSONNode(dec, data, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, &json.SyntaxError{Offset: dec.InputOffset()}
+	}
+
+	return root, nil
+}
+
+func parseJSONNode(dec *json.Decoder, data []byte, path string) (*jsonNode, error) {
+	n := &jsonNode{path: path, start: skipJSONSeparators(data, dec.InputOffset())}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			childPath := fmt.Sprint(key)
+			if path != "" {
+				childPath = path + "." + childPath
+			}
+
+			child, err := parseJSONNode(dec, data, childPath)
+			if err != nil {
+				return nil, err
+			}
+			n.children = append(n.children, child)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			child, err := parseJSONNode(dec, data, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			n.children = append(n.children, child)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	n.end = dec.InputOffset()
+
+	return n, nil
+}
+
+// skipJSONSeparators returns the offset of the first token at or after off
+func skipJSONSeparators(data []byte, off int64) int64 {
+	for off < int64(len(data)) && strings.IndexByte(" \t\r\n,:", data[off]) != -1 {
+		off++
+	}
+	return off
+}
+
+// lineCol converts a byte offset into 1-based line and column numbers
+func lineCol(data []byte, off int64) (int, int) {
+	if off > int64(len(data)) {
+		off = int64(len(data))
+	}
+
+	before := data[:off]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := int(off) - (bytes.LastIndexByte(before, '\n') + 1) + 1
+
+	return line, col
+}
+
+// locateTemplateErrors is used once a template has been rejected by the
+// decoder (with error decodeErr) to find where the problems are.  Syntax and
+// type errors are located using the offset reported by the JSON decoder.
+// Otherwise, each element for which a probe exists is decoded in isolation,
+// starting from the innermost ones, so that every faulty element is reported,
+// rather than just the first.
+func locateTemplateErrors(
+	data []byte, decodeErr error, probes map[string]templateProbe,
+) templateProblems {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+
+	problem := func(off int64, path string, err error) templateProblem {
+		line, col := lineCol(data, off)
+		return templateProblem{Line: line, Column: col, Path: path, Err: err}
+	}
+
+	root, err := parseJSONNodes(data)
+	if err != nil {
+		if errors.As(err, &syntaxErr) {
+			// the offset is that of the byte following the offending one
+			return templateProblems{problem(syntaxErr.Offset-1, "", err)}
+		}
+		return templateProblems{problem(int64(len(data)), "", err)}
+	}
+
+	var problems templateProblems
+
+	var walk func(n *jsonNode) bool
+	walk = func(n *jsonNode) bool {
+		found := false
+		for _, c := range n.children {
+			if walk(c) {
+				found = true
+			}
+		}
+
+		// report the innermost faulty element only
+		if found {
+			return true
+		}
+
+		probe, ok := probes[n.pattern()]
+		if !ok {
+			return false
+		}
+
+		if err := probe(data[n.start:n.end]); err != nil {
+			problems = append(problems, problem(n.start, n.path, err))
+			return true
+		}
+
+		return false
+	}
+	walk(root)
+
+	if len(problems) != 0 {
+		return problems
+	}
+
+	if errors.As(decodeErr, &typeErr) && typeErr.Field != "" {
+		if n := root.find(typeErr.Field); n != nil {
+			return templateProblems{problem(n.start, n.path, decodeErr)}
+		}
+	}
+
+	return templateProblems{problem(root.start, "", decodeErr)}
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/comid"
+	"github.com/veraison/corim/corim"
+)
+
+func Test_locateTemplateErrors_syntax_error(t *testing.T) {
+	tmpl := []byte("{\n  \"lang\": \"en\",\n  \"tag-identity\": {]\n}")
+
+	var c comid.Comid
+	decodeErr := c.FromJSON(tmpl)
+	require.Error(t, decodeErr)
+
+	problems := locateTemplateErrors(tmpl, decodeErr, comidTemplateProbes)
+	require.Len(t, problems, 1)
+	assert.Equal(t, 3, problems[0].Line)
+	assert.Equal(t, 20, problems[0].Column)
+	assert.EqualError(t, problems, "3:20: invalid character ']' looking for beginning of value")
+}
+
+func Test_locateTemplateErrors_all_problems(t *testing.T) {
+	tmpl := []byte(strings.Join([]string{
+		`{`,
+		`  "tag-identity": { "id": "43BBE37F-2E61-4B33-AED3-53CFF1428B16" },`,
+		`  "entities": [ { "name": "ACME", "roles": [ "tagMaker" ] } ],`,
+		`  "triples": {`,
+		`    "reference-values": [`,
+		`      {`,
+		`        "environment": { "class": { "vendor": "ACME" } },`,
+		`        "measurements": [`,
+		`          { "value": { "digests": [ "sha-256:h0KPxSKAPTEGXnvOPPA/5HUJZjHl4Hu9eg/eYMTPJcc=" ] } },`,
+		`          { "value": { "digests": [ "sha-256:h0KPxSKAPTEGXnvOPPA/5HUJZjHl4Hu9eg/eYMTPJcc=", "sha-999:AA==" ] } }`,
+		`        ]`,
+		`      }`,
+		`    ]`,
+		`  }`,
+		`}`,
+	}, "\n"))
+
+	var c comid.Comid
+	decodeErr := c.FromJSON(tmpl)
+	require.Error(t, decodeErr)
+
+	problems := locateTemplateErrors(tmpl, decodeErr, comidTemplateProbes)
+	require.Len(t, problems, 2)
+
+	assert.Equal(t, "entities[0].roles", problems[0].Path)
+	assert.Equal(t, 3, problems[0].Line)
+	assert.Equal(t, 44, problems[0].Column)
+
+	assert.Equal(t, "triples.reference-values[0].measurements[1].value.digests[1]", problems[1].Path)
+	assert.Equal(t, 10, problems[1].Line)
+	assert.Equal(t, 93, problems[1].Column)
+
+	assert.EqualError(t, problems, `2 problems found
+	3:44: entities[0].roles: unknown role "tagMaker"
+	10:93: triples.reference-values[0].measurements[1].value.digests[1]: unknown hash algorithm sha-999`)
+}
+
+func Test_locateTemplateErrors_corim(t *testing.T) {
+	tmpl := []byte(`{ "corim-id": "5c57e8f4-46cd-421b-91c9-08cf93e13cfc", "dependent-rims": [ { "href": 1 } ] }`)
+
+	var c corim.UnsignedCorim
+	decodeErr := c.FromJSON(tmpl)
+	require.Error(t, decodeErr)
+
+	problems := locateTemplateErrors(tmpl, decodeErr, corimTemplateProbes)
+	require.Len(t, problems, 1)
+	assert.Equal(t, "dependent-rims[0]", problems[0].Path)
+	assert.Equal(t, 1, problems[0].Line)
+	assert.Equal(t, 75, problems[0].Column)
+}
+
+func Test_lineCol(t *testing.T) {
+	data := []byte("ab\ncd\n")
+
+	for _, tv := range []struct {
+		off       int64
+		line, col int
+	}{
+		{0, 1, 1},
+		{1, 1, 2},
+		{3, 2, 1},
+		{4, 2, 2},
+		{6, 3, 1},
+		{100, 3, 1},
+	} {
+		line, col := lineCol(data, tv.off)
+		assert.Equal(t, tv.line, line, tv.off)
+		assert.Equal(t, tv.col, col, tv.off)
+	}
+}
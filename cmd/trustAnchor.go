@@ -0,0 +1,520 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/veraison/corim/cots"
+)
+
+var taFormatNames = map[cots.TaFormat]string{
+	cots.TaFormatCertificate:          "certificate",
+	cots.TaFormatTrustAnchorInfo:      "TrustAnchorInfo",
+	cots.TaFormatSubjectPublicKeyInfo: "SubjectPublicKeyInfo",
+}
+
+// taFormatExts maps the TA file extensions onto the format they imply
+var taFormatExts = map[string]cots.TaFormat{
+	".der":  cots.TaFormatCertificate,
+	".ta":   cots.TaFormatTrustAnchorInfo,
+	".spki": cots.TaFormatSubjectPublicKeyInfo,
+}
+
+func taFormatName(f cots.TaFormat) string {
+	if name, ok := taFormatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown format %d", f)
+}
+
+// trustAnchorInfo is the RFC 5914 TrustAnchorInfo.  Extensions are not
+// decoded.
+type trustAnchorInfo struct {
+	Version      int
+	PubKey       []byte
+	KeyID        []byte
+	Title        string
+	TitleLangTag string
+	CertPath     *certPathControls
+}
+
+// certPathControls is the RFC 5914 CertPathControls.  Name constraints are
+// only recorded as present.
+type certPathControls struct {
+	TaName            pkix.Name
+	Certificate       *x509.Certificate
+	Policies          []asn1.ObjectIdentifier
+	PolicyFlags       *asn1.BitString
+	NameConstraints   bool
+	PathLenConstraint *int
+}
+
+// asn1Elements splits the content of a constructed ASN.1 value into its
+// elements
+func asn1Elements(data []byte) ([]asn1.RawValue, error) {
+	var elems []asn1.RawValue
+
+	for len(data) > 0 {
+		var e asn1.RawValue
+		rest, err := asn1.Unmarshal(data, &e)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, e)
+		data = rest
+	}
+
+	return elems, nil
+}
+
+// asn1Retag returns the DER encoding of an implicitly tagged value with its
+// tag replaced by the supplied universal one
+func asn1Retag(e asn1.RawValue, tag byte) []byte {
+	return append([]byte{tag}, e.FullBytes[1:]...)
+}
+
+func isUniversal(e asn1.RawValue, tag int) bool {
+	return e.Class == asn1.ClassUniversal && e.Tag == tag
+}
+
+func isContextSpecific(e asn1.RawValue, tag int) bool {
+	return e.Class == asn1.ClassContextSpecific && e.Tag == tag
+}
+
+// parseTrustAnchorInfo decodes a TrustAnchorInfo, either bare or wrapped in
+// the taInfo alternative ([2] EXPLICIT) of a TrustAnchorChoice
+func parseTrustAnchorInfo(data []byte) (*trustAnchorInfo, error) {
+	var outer asn1.RawValue
+	rest, err := asn1.Unmarshal(data, &outer)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data after TrustAnchorInfo")
+	}
+
+	if isContextSpecific(outer, 2) {
+		if rest, err = asn1.Unmarshal(outer.Bytes, &outer); err != nil {
+			return nil, err
+		}
+		if len(rest) != 0 {
+			return nil, errors.New("trailing data after TrustAnchorInfo")
+		}
+	}
+
+	if !isUniversal(outer, asn1.TagSequence) {
+		return nil, errors.New("TrustAnchorInfo is not a SEQUENCE")
+	}
+
+	elems, err := asn1Elements(outer.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	tai := trustAnchorInfo{Version: 1}
+
+	if len(elems) > 0 && isUniversal(elems[0], asn1.TagInteger) {
+		if _, err := asn1.Unmarshal(elems[0].FullBytes, &tai.Version); err != nil {
+			return nil, fmt.Errorf("invalid TrustAnchorInfo version: %w", err)
+		}
+		elems = elems[1:]
+	}
+
+	if tai.Version != 1 {
+		return nil, fmt.Errorf("unsupported TrustAnchorInfo version %d", tai.Version)
+	}
+
+	if len(elems) < 2 || !isUniversal(elems[0], asn1.TagSequence) || !isUniversal(elems[1], asn1.TagOctetString) {
+		return nil, errors.New("TrustAnchorInfo lacks a public key or key identifier")
+	}
+
+	if _, err := x509.ParsePKIXPublicKey(elems[0].FullBytes); err != nil {
+		return nil, fmt.Errorf("invalid TrustAnchorInfo public key: %w", err)
+	}
+
+	tai.PubKey, tai.KeyID = elems[0].FullBytes, elems[1].Bytes
+
+	for _, e := range elems[2:] {
+		switch {
+		case isUniversal(e, asn1.TagUTF8String):
+			tai.Title = string(e.Bytes)
+		case isUniversal(e, asn1.TagSequence):
+			if tai.CertPath, err = parseCertPathControls(e.Bytes); err != nil {
+				return nil, fmt.Errorf("invalid TrustAnchorInfo certPath: %w", err)
+			}
+		case isContextSpecific(e, 1):
+			// extensions
+		case isContextSpecific(e, 2):
+			tai.TitleLangTag = string(e.Bytes)
+		default:
+			return nil, fmt.Errorf("unexpected TrustAnchorInfo field with tag %d", e.Tag)
+		}
+	}
+
+	return &tai, nil
+}
+
+func parseCertPathControls(data []byte) (*certPathControls, error) {
+	elems, err := asn1Elements(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(elems) == 0 || !isUniversal(elems[0], asn1.TagSequence) {
+		return nil, errors.New("missing taName")
+	}
+
+	var (
+		cpc certPathControls
+		rdn pkix.RDNSequence
+	)
+
+	if _, err := asn1.Unmarshal(elems[0].FullBytes, &rdn); err != nil {
+		return nil, fmt.Errorf("invalid taName: %w", err)
+	}
+	cpc.TaName.FillFromRDNSequence(&rdn)
+
+	for _, e := range elems[1:] {
+		if e.Class != asn1.ClassContextSpecific {
+			return nil, fmt.Errorf("unexpected field with tag %d", e.Tag)
+		}
+
+		switch e.Tag {
+		case 0:
+			if cpc.Certificate, err = x509.ParseCertificate(asn1Retag(e, 0x30)); err != nil {
+				return nil, fmt.Errorf("invalid certificate: %w", err)
+			}
+		case 1:
+			policies, err := asn1Elements(e.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("invalid policySet: %w", err)
+			}
+			for _, p := range policies {
+				var pi struct{ ID asn1.ObjectIdentifier }
+				if _, err := asn1.Unmarshal(p.FullBytes, &pi); err != nil {
+					return nil, fmt.Errorf("invalid policySet: %w", err)
+				}
+				cpc.Policies = append(cpc.Policies, pi.ID)
+			}
+		case 2:
+			var flags asn1.BitString
+			if _, err := asn1.Unmarshal(asn1Retag(e, 0x03), &flags); err != nil {
+				return nil, fmt.Errorf("invalid policyFlags: %w", err)
+			}
+			cpc.PolicyFlags = &flags
+		case 3:
+			cpc.NameConstraints = true
+		case 4:
+			var n int
+			if _, err := asn1.Unmarshal(asn1Retag(e, 0x02), &n); err != nil {
+				return nil, fmt.Errorf("invalid pathLenConstraint: %w", err)
+			}
+			cpc.PathLenConstraint = &n
+		default:
+			return nil, fmt.Errorf("unexpected field with tag %d", e.Tag)
+		}
+	}
+
+	return &cpc, nil
+}
+
+// detectTaFormat returns the format of the supplied DER-encoded TA: an X.509
+// certificate, a SubjectPublicKeyInfo or a TrustAnchorInfo
+func detectTaFormat(data []byte) (cots.TaFormat, error) {
+	if _, err := x509.ParseCertificate(data); err == nil {
+		return cots.TaFormatCertificate, nil
+	}
+
+	if _, err := x509.ParsePKIXPublicKey(data); err == nil {
+		return cots.TaFormatSubjectPublicKeyInfo, nil
+	}
+
+	if _, err := parseTrustAnchorInfo(data); err == nil {
+		return cots.TaFormatTrustAnchorInfo, nil
+	}
+
+	return 0, errors.New("not a certificate, SubjectPublicKeyInfo or TrustAnchorInfo")
+}
+
+// certificate validity statuses
+const (
+	certValid       = "valid"
+	certExpired     = "expired"
+	certNotYetValid = "not yet valid"
+)
+
+type certificateSummary struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	Serial       string    `json:"serial"`
+	NotBefore    time.Time `json:"not-before"`
+	NotAfter     time.Time `json:"not-after"`
+	Validity     string    `json:"validity"`
+	KeyAlgorithm string    `json:"key-algorithm"`
+	KeySize      int       `json:"key-size,omitempty"`
+	Fingerprint  string    `json:"sha256-fingerprint"`
+	SKI          string    `json:"subject-key-id,omitempty"`
+}
+
+type spkiSummary struct {
+	KeyAlgorithm string `json:"key-algorithm"`
+	KeySize      int    `json:"key-size,omitempty"`
+	Fingerprint  string `json:"sha256-fingerprint"`
+}
+
+type certPathSummary struct {
+	TaName            string              `json:"ta-name"`
+	Certificate       *certificateSummary `json:"certificate,omitempty"`
+	Policies          []string            `json:"policy-set,omitempty"`
+	PolicyFlags       []string            `json:"policy-flags,omitempty"`
+	NameConstraints   bool                `json:"name-constraints,omitempty"`
+	PathLenConstraint *int                `json:"path-len-constraint,omitempty"`
+}
+
+type taInfoSummary struct {
+	Title        string           `json:"ta-title,omitempty"`
+	TitleLangTag string           `json:"ta-title-lang-tag,omitempty"`
+	KeyID        string           `json:"key-id"`
+	PublicKey    spkiSummary      `json:"public-key"`
+	CertPath     *certPathSummary `json:"cert-path,omitempty"`
+}
+
+// CertPolicyFlags bits
+var certPolicyFlagNames = []string{"inhibitPolicyMapping", "requireExplicitPolicy", "inhibitAnyPolicy"}
+
+// keySummary returns the algorithm and size in bits of a public key
+func keySummary(pub interface{}) (string, int) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return x509.RSA.String(), k.N.BitLen()
+	case *ecdsa.PublicKey:
+		return x509.ECDSA.String(), k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return x509.Ed25519.String(), 256
+	default:
+		return fmt.Sprintf("%T", pub), 0
+	}
+}
+
+func fingerprint(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func summarizeCertificate(cert *x509.Certificate) *certificateSummary {
+	alg, size := keySummary(cert.PublicKey)
+
+	validity := certValid
+	if now := time.Now(); now.After(cert.NotAfter) {
+		validity = certExpired
+	} else if now.Before(cert.NotBefore) {
+		validity = certNotYetValid
+	}
+
+	return &certificateSummary{
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		Serial:       cert.SerialNumber.Text(16),
+		NotBefore:    cert.NotBefore.UTC(),
+		NotAfter:     cert.NotAfter.UTC(),
+		Validity:     validity,
+		KeyAlgorithm: alg,
+		KeySize:      size,
+		Fingerprint:  fingerprint(cert.Raw),
+		SKI:          hex.EncodeToString(cert.SubjectKeyId),
+	}
+}
+
+func summarizeSPKI(data []byte) (*spkiSummary, error) {
+	pub, err := x509.ParsePKIXPublicKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	alg, size := keySummary(pub)
+
+	return &spkiSummary{KeyAlgorithm: alg, KeySize: size, Fingerprint: fingerprint(data)}, nil
+}
+
+func summarizeTrustAnchorInfo(tai *trustAnchorInfo) (*taInfoSummary, error) {
+	key, err := summarizeSPKI(tai.PubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	s := taInfoSummary{
+		Title:        tai.Title,
+		TitleLangTag: tai.TitleLangTag,
+		KeyID:        hex.EncodeToString(tai.KeyID),
+		PublicKey:    *key,
+	}
+
+	if cp := tai.CertPath; cp != nil {
+		s.CertPath = &certPathSummary{
+			TaName:            cp.TaName.String(),
+			NameConstraints:   cp.NameConstraints,
+			PathLenConstraint: cp.PathLenConstraint,
+		}
+
+		if cp.Certificate != nil {
+			s.CertPath.Certificate = summarizeCertificate(cp.Certificate)
+		}
+
+		for _, p := range cp.Policies {
+			s.CertPath.Policies = append(s.CertPath.Policies, p.String())
+		}
+
+		if cp.PolicyFlags != nil {
+			for i, name := range certPolicyFlagNames {
+				if cp.PolicyFlags.At(i) == 1 {
+					s.CertPath.PolicyFlags = append(s.CertPath.PolicyFlags, name)
+				}
+			}
+		}
+	}
+
+	return &s, nil
+}
+
+// decodedTrustAnchor is the human readable form of a TA or CA certificate.
+// The format is omitted for CA certificates.
+type decodedTrustAnchor struct {
+	Format          string              `json:"format,omitempty"`
+	Certificate     *certificateSummary `json:"certificate,omitempty"`
+	SPKI            *spkiSummary        `json:"spki,omitempty"`
+	TrustAnchorInfo *taInfoSummary      `json:"ta-info,omitempty"`
+	Error           string              `json:"error,omitempty"`
+	Data            []byte              `json:"data"`
+}
+
+// decodeTrustAnchor decodes the supplied TA according to its format.  Any
+// decoding error is reported in the result rather than returned, so that the
+// rest of the store can still be displayed.
+func decodeTrustAnchor(ta cots.TrustAnchor) decodedTrustAnchor {
+	d := decodedTrustAnchor{Format: taFormatName(ta.Format), Data: ta.Data}
+
+	var err error
+
+	switch ta.Format {
+	case cots.TaFormatCertificate:
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(ta.Data); err == nil {
+			d.Certificate = summarizeCertificate(cert)
+		}
+	case cots.TaFormatSubjectPublicKeyInfo:
+		d.SPKI, err = summarizeSPKI(ta.Data)
+	case cots.TaFormatTrustAnchorInfo:
+		var tai *trustAnchorInfo
+		if tai, err = parseTrustAnchorInfo(ta.Data); err == nil {
+			d.TrustAnchorInfo, err = summarizeTrustAnchorInfo(tai)
+		}
+	default:
+		err = errors.New("unknown TA format")
+	}
+
+	if err != nil {
+		d.Error = err.Error()
+	}
+
+	return d
+}
+
+func decodeCACertificate(data []byte) decodedTrustAnchor {
+	d := decodedTrustAnchor{Data: data}
+
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		d.Error = err.Error()
+	} else {
+		d.Certificate = summarizeCertificate(cert)
+	}
+
+	return d
+}
+
+// certificate returns the certificate found in the decoded TA, if any
+func (o decodedTrustAnchor) certificate() *certificateSummary {
+	if o.Certificate != nil {
+		return o.Certificate
+	}
+	if o.TrustAnchorInfo != nil && o.TrustAnchorInfo.CertPath != nil {
+		return o.TrustAnchorInfo.CertPath.Certificate
+	}
+	return nil
+}
+
+type decodedTasAndCas struct {
+	Tas []decodedTrustAnchor `json:"tas"`
+	Cas []decodedTrustAnchor `json:"cas,omitempty"`
+}
+
+// cotsDisplay is a CoTS with its TAs and CA certificates decoded
+type cotsDisplay struct {
+	*cots.ConciseTaStore
+	Keys *decodedTasAndCas `json:"keys"`
+}
+
+func newCotsDisplay(cts *cots.ConciseTaStore) *cotsDisplay {
+	d := cotsDisplay{ConciseTaStore: cts}
+
+	if cts.Keys != nil {
+		d.Keys = &decodedTasAndCas{}
+		for _, ta := range cts.Keys.Tas {
+			d.Keys.Tas = append(d.Keys.Tas, decodeTrustAnchor(ta))
+		}
+		for _, ca := range cts.Keys.Cas {
+			d.Keys.Cas = append(d.Keys.Cas, decodeCACertificate(ca))
+		}
+	}
+
+	return &d
+}
+
+// warnings returns a line for each TA or CA that could not be decoded or
+// whose certificate is expired or not yet valid
+func (o cotsDisplay) warnings() []string {
+	var w []string
+
+	if o.Keys == nil {
+		return nil
+	}
+
+	check := func(where string, d decodedTrustAnchor) {
+		if d.Error != "" {
+			w = append(w, fmt.Sprintf("%s: cannot be decoded: %s", where, d.Error))
+			return
+		}
+
+		c := d.certificate()
+		switch {
+		case c == nil:
+		case c.Validity == certExpired:
+			w = append(w, fmt.Sprintf("%s: certificate %q expired on %s",
+				where, c.Subject, c.NotAfter.Format(time.RFC3339)))
+		case c.Validity == certNotYetValid:
+			w = append(w, fmt.Sprintf("%s: certificate %q not valid before %s",
+				where, c.Subject, c.NotBefore.Format(time.RFC3339)))
+		}
+	}
+
+	for i, d := range o.Keys.Tas {
+		check(fmt.Sprintf("tas[%d]", i), d)
+	}
+	for i, d := range o.Keys.Cas {
+		check(fmt.Sprintf("cas[%d]", i), d)
+	}
+
+	return w
+}
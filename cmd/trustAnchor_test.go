@@ -0,0 +1,191 @@
+// Copyright 2024 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/veraison/corim/cots"
+)
+
+func Test_detectTaFormat(t *testing.T) {
+	for file, expected := range map[string]cots.TaFormat{
+		"../data/cots/shared_ta.ta":           cots.TaFormatTrustAnchorInfo,
+		"../data/cots/Zesty Hands_ta.ta":      cots.TaFormatTrustAnchorInfo,
+		"../data/cots/worthlesssea.spki":      cots.TaFormatSubjectPublicKeyInfo,
+		"../data/cots/Snobbish Apparel_ta.ta": cots.TaFormatTrustAnchorInfo,
+	} {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+
+		format, err := detectTaFormat(data)
+		require.NoError(t, err, file)
+		assert.Equal(t, expected, format, file)
+	}
+
+	format, err := detectTaFormat(testDiceCert(t, asn1.ObjectIdentifier{1, 2, 3}, "test"))
+	require.NoError(t, err)
+	assert.Equal(t, cots.TaFormatCertificate, format)
+
+	_, err = detectTaFormat([]byte("rubbish"))
+	assert.EqualError(t, err, "not a certificate, SubjectPublicKeyInfo or TrustAnchorInfo")
+}
+
+func Test_parseTrustAnchorInfo_bare(t *testing.T) {
+	_, pubPEM := testPublicKeyPEM(t)
+	block, _ := pem.Decode([]byte(pubPEM))
+
+	data, err := asn1.Marshal(struct {
+		PubKey asn1.RawValue
+		KeyID  []byte
+	}{asn1.RawValue{FullBytes: block.Bytes}, []byte{1, 2, 3}})
+	require.NoError(t, err)
+
+	tai, err := parseTrustAnchorInfo(data)
+	require.NoError(t, err)
+	assert.Equal(t, 1, tai.Version)
+	assert.Equal(t, []byte{1, 2, 3}, tai.KeyID)
+}
+
+// testCertWithValidity returns a self-signed CA certificate valid in the
+// supplied period
+func testCertWithValidity(t *testing.T, notBefore, notAfter time.Time) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := x509.Certificate{
+		SerialNumber:          big.NewInt(0x1234),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, key.Public(), key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert
+}
+
+// testTrustAnchorInfo returns a TrustAnchorChoice wrapping a TrustAnchorInfo
+// with a title and a certPath holding the supplied certificate
+func testTrustAnchorInfo(t *testing.T, cert *x509.Certificate) []byte {
+	certPath, err := asn1.Marshal(struct {
+		TaName            asn1.RawValue
+		Certificate       asn1.RawValue
+		PolicyFlags       asn1.BitString `asn1:"tag:2"`
+		PathLenConstraint int            `asn1:"tag:4"`
+	}{
+		TaName:            asn1.RawValue{FullBytes: cert.RawSubject},
+		Certificate:       asn1.RawValue{FullBytes: append([]byte{0xa0}, cert.Raw[1:]...)},
+		PolicyFlags:       asn1.BitString{Bytes: []byte{0x40}, BitLength: 3},
+		PathLenConstraint: 3,
+	})
+	require.NoError(t, err)
+
+	tai, err := asn1.Marshal(struct {
+		PubKey   asn1.RawValue
+		KeyID    []byte
+		Title    string `asn1:"utf8"`
+		CertPath asn1.RawValue
+	}{
+		PubKey:   asn1.RawValue{FullBytes: cert.RawSubjectPublicKeyInfo},
+		KeyID:    cert.SubjectKeyId,
+		Title:    "Test TA",
+		CertPath: asn1.RawValue{FullBytes: certPath},
+	})
+	require.NoError(t, err)
+
+	choice, err := asn1.Marshal(asn1.RawValue{
+		Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: tai,
+	})
+	require.NoError(t, err)
+
+	return choice
+}
+
+func Test_decodeTrustAnchor_ta_info(t *testing.T) {
+	now := time.Now()
+	cert := testCertWithValidity(t, now.Add(-time.Hour), now.Add(time.Hour))
+
+	d := decodeTrustAnchor(cots.TrustAnchor{
+		Format: cots.TaFormatTrustAnchorInfo, Data: testTrustAnchorInfo(t, cert),
+	})
+	require.Empty(t, d.Error)
+	require.NotNil(t, d.TrustAnchorInfo)
+
+	tai := d.TrustAnchorInfo
+	assert.Equal(t, "Test TA", tai.Title)
+	assert.Equal(t, "01020304", tai.KeyID)
+	assert.Equal(t, "ECDSA", tai.PublicKey.KeyAlgorithm)
+	assert.Equal(t, 256, tai.PublicKey.KeySize)
+
+	require.NotNil(t, tai.CertPath)
+	assert.Equal(t, "CN=Test Root", tai.CertPath.TaName)
+	assert.Equal(t, []string{"requireExplicitPolicy"}, tai.CertPath.PolicyFlags)
+	assert.Equal(t, 3, *tai.CertPath.PathLenConstraint)
+
+	require.NotNil(t, tai.CertPath.Certificate)
+	assert.Equal(t, "1234", tai.CertPath.Certificate.Serial)
+	assert.Equal(t, certValid, tai.CertPath.Certificate.Validity)
+}
+
+func Test_decodeTrustAnchor_spki_and_errors(t *testing.T) {
+	spki, err := os.ReadFile("../data/cots/worthlesssea.spki")
+	require.NoError(t, err)
+
+	d := decodeTrustAnchor(cots.TrustAnchor{Format: cots.TaFormatSubjectPublicKeyInfo, Data: spki})
+	require.Empty(t, d.Error)
+	assert.Equal(t, "SubjectPublicKeyInfo", d.Format)
+	assert.Equal(t, "ECDSA", d.SPKI.KeyAlgorithm)
+	assert.Equal(t, fingerprint(spki), d.SPKI.Fingerprint)
+
+	d = decodeTrustAnchor(cots.TrustAnchor{Format: cots.TaFormatCertificate, Data: spki})
+	assert.NotEmpty(t, d.Error)
+	assert.Nil(t, d.Certificate)
+}
+
+func Test_cotsDisplay_warnings(t *testing.T) {
+	now := time.Now()
+	expired := testCertWithValidity(t, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	future := testCertWithValidity(t, now.Add(time.Hour), now.Add(2*time.Hour))
+	valid := testCertWithValidity(t, now.Add(-time.Hour), now.Add(time.Hour))
+
+	cts := cots.ConciseTaStore{Keys: &cots.TasAndCas{
+		Tas: []cots.TrustAnchor{
+			{Format: cots.TaFormatCertificate, Data: valid.Raw},
+			{Format: cots.TaFormatTrustAnchorInfo, Data: testTrustAnchorInfo(t, expired)},
+		},
+		Cas: [][]byte{future.Raw, []byte("rubbish")},
+	}}
+
+	d := newCotsDisplay(&cts)
+
+	assert.Equal(t, certValid, d.Keys.Tas[0].Certificate.Validity)
+	assert.Equal(t, certNotYetValid, d.Keys.Cas[0].Certificate.Validity)
+
+	w := d.warnings()
+	require.Len(t, w, 3)
+	assert.Contains(t, w[0], `tas[1]: certificate "CN=Test Root" expired on `)
+	assert.Contains(t, w[1], `cas[0]: certificate "CN=Test Root" not valid before `)
+	assert.Contains(t, w[2], "cas[1]: cannot be decoded: ")
+}